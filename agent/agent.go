@@ -14,16 +14,25 @@ package agent
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 
 	"time"
 
@@ -39,6 +48,8 @@ import (
 )
 
 // Agent struct
+// AgentID, BaseURL, ApiURL and Token are as loaded at startup, ReEnroll and RotateToken change them at runtime
+// so read agentID(), baseURL(), apiURL() and authToken() instead
 type Agent struct {
 	Hostname      string
 	Arch          string
@@ -60,12 +71,55 @@ type Agent struct {
 	Version       string
 	Debug         bool
 	rClient       *resty.Client
+	caPool        *x509.CertPool
 	Proxy         string
-	LogTo         string
-	LogFile       *os.File
-	Platform      string
-	GoArch        string
-	ServiceConfig *service.Config
+	SystemProxy   bool
+	AuditLog      string
+	// configured window during which automated scripts and tasks don't run
+	MaintenanceWindow rmm.MaintenanceWindow
+	LogTo             string
+	LogFile           *os.File
+	Platform          string
+	GoArch            string
+	ServiceConfig     *service.Config
+	// checkin immediately when the network changes
+	NetChangeCheckin bool
+	// sign api request bodies with the agent key
+	SignPayloads bool
+	// how long to wait for the api to be reachable on startup, 0 to not wait
+	NetworkWait time.Duration
+	// nats heartbeat settings, zero values leave the nats defaults (2 minutes, 2 pings)
+	NatsPingInterval time.Duration
+	NatsMaxPingsOut  int
+	// ask the rmm to re-enroll the agent when DetectClonedAgent finds a clone
+	ReenrollOnClone bool
+	// task and script result output over ResultInlineMax bytes is uploaded, or truncated if there's no endpoint
+	ResultInlineMax int
+	ResultUploadURL string
+	// hmac sign the syncmesh payload for servers that verify it
+	SignMeshSync bool
+	// default bandwidth cap for UploadFileChunked in bytes per second
+	UploadMaxBps int
+	// audit log rotation, see rotateAuditLog
+	AuditMaxSizeMB  int
+	AuditMaxAgeDays int
+	AuditKeep       int
+	// limits concurrent RunPythonCode calls, nil when unlimited
+	pyPool chan struct{}
+	// limits and counts concurrent CmdV2 commands
+	cmdLimiter *execLimiter
+	// persisted agent state shared by all features, see AgentState
+	state *AgentState
+	// command allow/deny patterns enforced in CmdV2, nil when unrestricted
+	cmdPolicy *commandPolicy
+	// current token and nats sessions, shared since the agent is copied by value in main
+	auth *authState
+	// runtime log level changes and their revert timer
+	logLevel *logLevelState
+	// feature toggles from the rmm, see Toggle
+	toggles *featureToggles
+	// functions called after each CmdV2 command, see RegisterPostCmdHook
+	postCmdHooks *postCmdHooks
 }
 
 const (
@@ -75,6 +129,25 @@ const (
 	meshSvcName   = "mesh agent"
 )
 
+var (
+	ErrJournalUnsupported = errors.New("journald is not available on this system")
+	ErrNotSupported       = errors.New("not supported on this platform")
+	ErrNoSecurityCenter   = errors.New("neither security center nor defender is available on this system")
+	ErrMaintenanceMode    = errors.New("suppressed: maintenance mode")
+	ErrPythonBusy         = errors.New("timed out waiting for a free python worker")
+	ErrCertConnect        = errors.New("could not connect")
+	ErrCertHandshake      = errors.New("tls handshake failed")
+	ErrNoPackageManager   = errors.New("no supported package manager found (apt, dnf, yum or zypper)")
+	ErrBlockedByPolicy    = errors.New("blocked by policy")
+	ErrNotElevated        = errors.New("this requires administrator privileges")
+	ErrNoBitLocker        = errors.New("bitlocker is not available on this system")
+	ErrCmdQueueTimeout    = errors.New("timed out waiting for a free command slot")
+	ErrNoSession          = errors.New("no session with that id")
+	ErrNoSandbox          = errors.New("sandboxing was requested but bubblewrap (bwrap) is not available")
+	ErrVirtUnknown        = errors.New("virtualization support can't be determined on this system")
+	ErrAuthRequired       = errors.New("authentication required: the agent token was rejected")
+)
+
 var natsCheckin = []string{"agent-hello", "agent-agentinfo", "agent-disks", "agent-winsvc", "agent-publicip", "agent-wmi"}
 
 func New(logger *logrus.Logger, version string) *Agent {
@@ -107,11 +180,29 @@ func New(logger *logrus.Logger, version string) *Agent {
 	restyC.SetTimeout(15 * time.Second)
 	restyC.SetDebug(logger.IsLevelEnabled(logrus.DebugLevel))
 
-	if len(ac.Proxy) > 0 {
-		restyC.SetProxy(ac.Proxy)
+	// explicit config always wins, "system" asks the os
+	proxy := ac.Proxy
+	if proxy == systemProxy {
+		p, err := getSystemProxy(ac.BaseURL)
+		if err != nil {
+			logger.Debugln("getSystemProxy():", err)
+		}
+		proxy = p
 	}
+
+	if len(proxy) > 0 {
+		restyC.SetProxy(proxy)
+	}
+	var caPool *x509.CertPool
 	if len(ac.Cert) > 0 {
-		restyC.SetRootCertificate(ac.Cert)
+		pool, n, err := LoadCABundle(ac.Cert)
+		if err != nil {
+			logger.Errorln("LoadCABundle():", err)
+		} else {
+			logger.Debugf("Loaded %d certificates from %s", n, ac.Cert)
+			caPool = pool
+			restyC.SetTLSClientConfig(&tls.Config{RootCAs: caPool})
+		}
 	}
 
 	var MeshSysExe string
@@ -139,40 +230,106 @@ func New(logger *logrus.Logger, version string) *Agent {
 		},
 	}
 
-	return &Agent{
-		Hostname:      info.Hostname,
-		Arch:          info.Architecture,
-		BaseURL:       ac.BaseURL,
-		AgentID:       ac.AgentID,
-		ApiURL:        ac.APIURL,
-		Token:         ac.Token,
-		AgentPK:       ac.PK,
-		Cert:          ac.Cert,
-		ProgramDir:    pd,
-		EXE:           exe,
-		SystemDrive:   sd,
-		MeshInstaller: "meshagent.exe",
-		MeshSystemEXE: MeshSysExe,
-		MeshSVC:       meshSvcName,
-		PyBin:         pybin,
-		Headers:       headers,
-		Logger:        logger,
-		Version:       version,
-		Debug:         logger.IsLevelEnabled(logrus.DebugLevel),
-		rClient:       restyC,
-		Proxy:         ac.Proxy,
-		Platform:      runtime.GOOS,
-		GoArch:        runtime.GOARCH,
-		ServiceConfig: svcConf,
+	auth := &authState{
+		token:   ac.Token,
+		secret:  ac.EnrollSecret,
+		baseURL: ac.BaseURL,
+		apiURL:  ac.APIURL,
+		agentID: ac.AgentID,
+	}
+
+	agent := &Agent{
+		Hostname:          info.Hostname,
+		Arch:              info.Architecture,
+		BaseURL:           ac.BaseURL,
+		AgentID:           ac.AgentID,
+		ApiURL:            ac.APIURL,
+		Token:             ac.Token,
+		AgentPK:           ac.PK,
+		Cert:              ac.Cert,
+		ProgramDir:        pd,
+		EXE:               exe,
+		SystemDrive:       sd,
+		MeshInstaller:     "meshagent.exe",
+		MeshSystemEXE:     MeshSysExe,
+		MeshSVC:           meshSvcName,
+		PyBin:             pybin,
+		Headers:           headers,
+		Logger:            logger,
+		Version:           version,
+		Debug:             logger.IsLevelEnabled(logrus.DebugLevel),
+		rClient:           restyC,
+		caPool:            caPool,
+		Proxy:             proxy,
+		SystemProxy:       ac.Proxy == systemProxy,
+		Platform:          runtime.GOOS,
+		GoArch:            runtime.GOARCH,
+		ServiceConfig:     svcConf,
+		NetChangeCheckin:  ac.NetChangeCheckin,
+		AuditLog:          ac.AuditLog,
+		MaintenanceWindow: ac.MaintenanceWindow,
+		SignPayloads:      ac.SignPayloads,
+		NetworkWait:       time.Duration(ac.NetworkWait) * time.Second,
+		NatsPingInterval:  time.Duration(ac.NatsPingInterval) * time.Second,
+		NatsMaxPingsOut:   ac.NatsMaxPingsOut,
+		ReenrollOnClone:   ac.ReenrollOnClone,
+		ResultInlineMax:   ac.ResultInlineMax,
+		ResultUploadURL:   ac.ResultUploadURL,
+		SignMeshSync:      ac.SignMeshSync,
+		UploadMaxBps:      ac.UploadMaxBps,
+		AuditMaxSizeMB:    ac.AuditMaxSizeMB,
+		AuditMaxAgeDays:   ac.AuditMaxAgeDays,
+		AuditKeep:         ac.AuditKeep,
+		pyPool:            newPyPool(ac.PythonWorkers),
+		cmdLimiter:        newExecLimiter(ac.MaxParallelCmds, time.Duration(ac.CmdQueueTimeout)*time.Second),
+		auth:              auth,
+		logLevel:          &logLevelState{base: logger.GetLevel()},
+		postCmdHooks:      &postCmdHooks{},
 	}
+	agent.state = newAgentState(agent.stateFile(agentStateFile), logger)
+	agent.importStateFiles()
+	agent.cmdPolicy = agent.newCommandPolicy(ac.CommandDenylist, ac.CommandAllowlist)
+	agent.toggles = agent.loadToggles()
+	// the token and server can change at runtime so they're set per request rather than in the client
+	restyC.OnBeforeRequest(agent.setRequestURL)
+	restyC.OnBeforeRequest(agent.setAuthHeader)
+	agent.enableReauth(restyC)
+	if agent.SignPayloads {
+		if _, err := agent.agentKey(); err != nil {
+			logger.Errorln("agentKey():", err)
+		}
+		restyC.SetPreRequestHook(agent.signRequest)
+	}
+	return agent
 }
 
 type CmdStatus struct {
 	Status gocmd.Status
 	Stdout string
 	Stderr string
+	// number of times the command was run, more than 1 if it was retried
+	Attempts int
+	// total stdout lines seen, including ones dropped by a line filter
+	TotalLines int
+	// TimeoutStartup or TimeoutRun if the command was killed for taking too long
+	TimedOut string
+	// set when CollectCrashDump is on and the command crashed
+	Crash *CrashInfo
+	// what the exit code means, set by InstallPackage and UninstallPackage
+	ExitMeaning string
+	// lines OnLine never got because of OutputDropOldest
+	DroppedLines int
+	// Stdout is base64, set when CmdOptions.BinaryOutput is on
+	Binary bool
+	// set when CmdOptions.Timing is on
+	Timing *CmdTiming
 }
 
+const (
+	TimeoutStartup = "startup"
+	TimeoutRun     = "run"
+)
+
 type CmdOptions struct {
 	Shell        string
 	Command      string
@@ -181,18 +338,311 @@ type CmdOptions struct {
 	IsScript     bool
 	IsExecutable bool
 	Detached     bool
+	// the body of the script Shell runs, only used to check it against the command policy
+	Script string
+	// Initiator is recorded in the audit log, e.g. "rpc:rawcmd". Leave it empty for the agent's own
+	// commands, the command policy doesn't apply to those
+	Initiator string
+	// Sensitive redacts the command text in the audit log
+	Sensitive bool
+	// re-run the command up to MaxRetries times if it exits with one of these codes
+	RetryOnExitCodes []int
+	MaxRetries       int
+	// wait between retries, defaults to a second
+	RetryDelay time.Duration
+	// don't run while the agent is in a maintenance window, for automated runs like tasks, checks and
+	// scripts the server sends with automated set. Suppressed commands are still audited
+	Suppressible bool
+	// only keep stdout lines matching the filter and/or regex, all lines are kept if neither is set
+	LineFilter func(line string) bool
+	LineRegex  *regexp.Regexp
+	// on timeout kill every process the command started, not just the top level one
+	KillProcessTree bool
+	// debug log every stdout/stderr line, on by default, turn off for noisy commands
+	LogLines bool
+	// kill the command if it hasn't printed anything or exited by then, separate from Timeout
+	// which covers the whole run. Only used by CmdV2
+	StartupTimeout time.Duration
+	// if the command crashes look for the core file or wer dump it left, see CmdStatus.Crash
+	CollectCrashDump bool
+	// called with each stdout and stderr line as the command runs. Lines are queued so a slow consumer
+	// doesn't hold up reading, up to OutputBuffer lines (default 1000) then OutputPolicy decides
+	OnLine       func(stderr bool, line string)
+	OutputBuffer int
+	OutputPolicy string
+	// with OnLine set, don't also keep the output for CmdStatus.Stdout and Stderr. For long running
+	// commands whose output is streamed somewhere and would otherwise all be held in memory
+	DiscardOutput bool
+	// capture stdout as raw bytes and return it base64 encoded, for tools that write images or archives.
+	// base64 is a third bigger than the output and the whole thing is held in memory, so keep it to a few MB.
+	// Line filters, OnLine and LogLines only see stderr
+	BinaryOutput bool
+	// run inside a bubblewrap sandbox with no network and a read only filesystem except for a scratch dir.
+	// Linux only, the command is refused if the sandbox can't be set up
+	Sandbox bool
+	// fill in CmdStatus.Timing, for finding where the time goes in short frequent commands
+	Timing bool
+}
+
+// ScriptOptions are the optional settings for RunScriptWith, the zero value is what RunScript uses
+type ScriptOptions struct {
+	// filled in with where the time went if not nil
+	Timing *CmdTiming
+	// recorded in the audit log, empty for the agent's own scripts, see CmdOptions.Initiator
+	Initiator string
+	// redacts the script in the audit log
+	Sensitive bool
+	// don't run while the agent is in a maintenance window, see CmdOptions.Suppressible
+	Suppressible bool
+}
+
+// internal reports whether c is one of the agent's own commands rather than one it was sent
+func (c *CmdOptions) internal() bool {
+	return c.Initiator == "" || c.Initiator == agentInitiator
+}
+
+// cmdArgs returns the arguments c.Shell is run with
+func (c *CmdOptions) cmdArgs() []string {
+	if c.IsScript {
+		return c.Args // call script directly
+	} else if c.IsExecutable {
+		return []string{c.Command} // c.Shell: bin + c.Command: args as one string
+	}
+	return []string{commandFlag(c.Shell), c.Command} // /bin/bash -c 'ls -l /var/log/...'
+}
+
+func (c *CmdOptions) keepLine(line string) bool {
+	if c.LineRegex != nil && !c.LineRegex.MatchString(line) {
+		return false
+	}
+	if c.LineFilter != nil && !c.LineFilter(line) {
+		return false
+	}
+	return true
 }
 
 func (a *Agent) NewCMDOpts() *CmdOptions {
 	return &CmdOptions{
-		Shell:   "/bin/bash",
-		Timeout: 30,
+		Shell:    defaultShell(),
+		Timeout:  30 * time.Second,
+		LogLines: true,
+	}
+}
+
+// defaultShell returns the shell commands run under when the caller doesn't set one
+func defaultShell() string {
+	var candidates []string
+	switch runtime.GOOS {
+	case "windows":
+		return "cmd.exe"
+	case "darwin":
+		candidates = []string{"/bin/zsh", "/bin/bash"}
+	default:
+		candidates = []string{"/bin/bash", "/bin/sh"}
+	}
+	for _, sh := range candidates {
+		if trmm.FileExists(sh) {
+			return sh
+		}
+	}
+	return "/bin/sh"
+}
+
+// commandFlag returns the flag used to pass a command string to shell
+func commandFlag(shell string) string {
+	switch strings.TrimSuffix(strings.ToLower(filepath.Base(shell)), ".exe") {
+	case "cmd":
+		return "/C"
+	case "powershell", "pwsh":
+		return "-Command"
+	default:
+		return "-c"
 	}
 }
 
 func (a *Agent) CmdV2(c *CmdOptions) CmdStatus {
+	if ret, ok := a.checkPolicy(c); !ok {
+		a.auditCommand(c, ret, time.Now())
+		return ret
+	}
+	if c.Suppressible && a.InMaintenance() {
+		a.Logger.Debugln("CmdV2():", ErrMaintenanceMode)
+		ret := CmdStatus{
+			Status: gocmd.Status{Exit: -1, Error: ErrMaintenanceMode},
+			Stderr: ErrMaintenanceMode.Error(),
+		}
+		a.auditCommand(c, ret, time.Now())
+		a.queuePostCmdHooks(c, ret)
+		return ret
+	}
+
+	release, err := a.acquireCmd(c)
+	if err != nil {
+		a.Logger.Debugln("CmdV2():", err)
+		ret := CmdStatus{
+			Status: gocmd.Status{Exit: -1, Error: err},
+			Stderr: err.Error(),
+		}
+		a.auditCommand(c, ret, time.Now())
+		a.queuePostCmdHooks(c, ret)
+		return ret
+	}
+	defer release()
+
+	run := c
+	if c.Sandbox {
+		sc, cleanup, err := sandboxCmd(c)
+		if err != nil {
+			a.Logger.Errorln("CmdV2() sandbox:", err)
+			ret := CmdStatus{
+				Status: gocmd.Status{Exit: -1, Error: err},
+				Stderr: err.Error(),
+			}
+			a.auditCommand(c, ret, time.Now())
+			return ret
+		}
+		defer cleanup()
+		run = sc
+	}
+
+	ret := a.cmdV2(run)
+	ret.Attempts = 1
+
+	delay := c.RetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+
+	for ret.Attempts <= c.MaxRetries && shouldRetry(ret, c.RetryOnExitCodes) {
+		a.Logger.Debugf("Command exited with %d, retrying in %s (attempt %d of %d)\n", ret.Status.Exit, delay, ret.Attempts+1, c.MaxRetries+1)
+		time.Sleep(delay)
+		attempts := ret.Attempts
+		ret = a.cmdV2(run)
+		ret.Attempts = attempts + 1
+	}
+	a.queuePostCmdHooks(c, ret)
+	return ret
+}
+
+// CmdExitCode runs a command for its exit code only, output is discarded rather than buffered
+// Timeouts are handled like CmdV2, the process (or tree) is killed and the error is context.DeadlineExceeded
+func (a *Agent) CmdExitCode(c *CmdOptions) (int, error) {
+	if ret, ok := a.checkPolicy(c); !ok {
+		a.auditCommand(c, ret, time.Now())
+		return -1, ErrBlockedByPolicy
+	}
+	if c.Suppressible && a.InMaintenance() {
+		a.auditCommand(c, CmdStatus{Status: gocmd.Status{Exit: -1, Error: ErrMaintenanceMode}}, time.Now())
+		return -1, ErrMaintenanceMode
+	}
+	release, err := a.acquireCmd(c)
+	if err != nil {
+		a.auditCommand(c, CmdStatus{Status: gocmd.Status{Exit: -1, Error: err}}, time.Now())
+		return -1, err
+	}
+	defer release()
+	if c.Sandbox {
+		sc, cleanup, err := sandboxCmd(c)
+		if err != nil {
+			return -1, err
+		}
+		defer cleanup()
+		c = sc
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	cmd := exec.Command(c.Shell, c.cmdArgs()...)
+	cmd.Stdout = io.Discard
+	cmd.Stderr = io.Discard
+	if c.Detached {
+		cmd.SysProcAttr = SetDetached()
+	}
+	if c.KillProcessTree {
+		prepareProcTree(cmd)
+	}
+
+	status := CmdStatus{}
+	defer func() { a.auditCommand(c, status, start) }()
+
+	if err := cmd.Start(); err != nil {
+		status.Status.Error = err
+		return -1, err
+	}
+	status.Status.PID = cmd.Process.Pid
+
+	var tree *procTree
+	if c.KillProcessTree {
+		if t, err := trackProcTree(cmd.Process.Pid); err == nil {
+			tree = t
+			defer tree.Close()
+		} else {
+			a.Logger.Debugln("trackProcTree():", err)
+		}
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout*time.Second)
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- cmd.Wait() }()
+
+	select {
+	case err := <-waitErr:
+		status.Status.Exit = cmd.ProcessState.ExitCode()
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			status.Status.Error = err
+			return status.Status.Exit, err
+		}
+		return status.Status.Exit, nil
+	case <-ctx.Done():
+		a.Logger.Debugf("Command timed out after %v\n", c.Timeout)
+		if tree == nil || tree.Kill() != nil {
+			KillProc(int32(cmd.Process.Pid))
+		}
+		<-waitErr
+		status.Status.Exit = -1
+		status.Status.Error = ctx.Err()
+		return -1, ctx.Err()
+	}
+}
+
+// trackCmdTree waits for the command to get a pid and starts tracking its process tree
+func (a *Agent) trackCmdTree(envCmd *gocmd.Cmd, done <-chan struct{}) *procTree {
+	for i := 0; i < 100; i++ {
+		if pid := envCmd.Status().PID; pid > 0 {
+			tree, err := trackProcTree(pid)
+			if err != nil {
+				a.Logger.Debugln("trackProcTree():", err)
+				return nil
+			}
+			return tree
+		}
+		select {
+		case <-done:
+			return nil
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+func shouldRetry(ret CmdStatus, codes []int) bool {
+	if ret.Status.Error != nil {
+		return false
+	}
+	for _, code := range codes {
+		if ret.Status.Exit == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Agent) cmdV2(c *CmdOptions) CmdStatus {
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
 	defer cancel()
 
 	// Disable output buffering, enable streaming
@@ -211,17 +661,34 @@ func (a *Agent) CmdV2(c *CmdOptions) CmdStatus {
 		}
 	}
 
-	var envCmd *gocmd.Cmd
-	if c.IsScript {
-		envCmd = gocmd.NewCmdOptions(cmdOptions, c.Shell, c.Args...) // call script directly
-	} else if c.IsExecutable {
-		envCmd = gocmd.NewCmdOptions(cmdOptions, c.Shell, c.Command) // c.Shell: bin + c.Command: args as one string
-	} else {
-		envCmd = gocmd.NewCmdOptions(cmdOptions, c.Shell, "-c", c.Command) // /bin/bash -c 'ls -l /var/log/...'
+	if c.KillProcessTree {
+		cmdOptions.BeforeExec = append(cmdOptions.BeforeExec, prepareProcTree)
 	}
 
 	var stdoutBuf bytes.Buffer
 	var stderrBuf bytes.Buffer
+	totalLines := 0
+	// closed on the first line of output, stops the startup timeout
+	gotOutput := make(chan struct{})
+	var seenOutput sync.Once
+	outputSeen := func() {
+		seenOutput.Do(func() { close(gotOutput) })
+	}
+
+	// go-cmd splits stdout into lines, which mangles binary data, so it's sent straight to the buffer
+	// instead and the stdout stream just closes when the command exits
+	if c.BinaryOutput {
+		cmdOptions.BeforeExec = append(cmdOptions.BeforeExec, func(cmd *exec.Cmd) {
+			cmd.Stdout = &binaryWriter{buf: &stdoutBuf, seen: outputSeen}
+		})
+	}
+
+	envCmd := gocmd.NewCmdOptions(cmdOptions, c.Shell, c.cmdArgs()...)
+	var queue *lineQueue
+	if c.OnLine != nil {
+		queue = newLineQueue(c)
+	}
+	keep := queue == nil || !c.DiscardOutput
 	// Print STDOUT and STDERR lines streaming from Cmd
 	doneChan := make(chan struct{})
 	go func() {
@@ -235,46 +702,148 @@ func (a *Agent) CmdV2(c *CmdOptions) CmdStatus {
 					envCmd.Stdout = nil
 					continue
 				}
-				fmt.Fprintln(&stdoutBuf, line)
-				a.Logger.Debugln(line)
+				outputSeen()
+				totalLines++
+				if c.keepLine(line) {
+					if keep {
+						fmt.Fprintln(&stdoutBuf, line)
+					}
+					if queue != nil {
+						queue.push(false, line)
+					}
+				}
+				if c.LogLines {
+					a.Logger.Debugln(line)
+				}
 
 			case line, open := <-envCmd.Stderr:
 				if !open {
 					envCmd.Stderr = nil
 					continue
 				}
-				fmt.Fprintln(&stderrBuf, line)
-				a.Logger.Debugln(line)
+				outputSeen()
+				if keep {
+					fmt.Fprintln(&stderrBuf, line)
+				}
+				if queue != nil {
+					queue.push(true, line)
+				}
+				if c.LogLines {
+					a.Logger.Debugln(line)
+				}
 			}
 		}
 	}()
 
 	// Run and wait for Cmd to return, discard Status
+	startCalled := time.Now()
 	envCmd.Start()
 
-	go func() {
-		select {
-		case <-doneChan:
+	var tree *procTree
+	if c.KillProcessTree {
+		tree = a.trackCmdTree(envCmd, doneChan)
+		if tree != nil {
+			defer tree.Close()
+		}
+	}
+
+	kill := func() {
+		pid := envCmd.Status().PID
+		if tree != nil {
+			a.Logger.Debugln("Killing process tree of PID", pid)
+			if err := tree.Kill(); err != nil {
+				a.Logger.Debugln("procTree Kill():", err)
+				KillProc(int32(pid))
+			}
 			return
-		case <-ctx.Done():
-			a.Logger.Debugf("Command timed out after %d seconds\n", c.Timeout)
-			pid := envCmd.Status().PID
-			a.Logger.Debugln("Killing process with PID", pid)
-			KillProc(int32(pid))
+		}
+		a.Logger.Debugln("Killing process with PID", pid)
+		KillProc(int32(pid))
+	}
+
+	var startup <-chan time.Time
+	if c.StartupTimeout > 0 {
+		t := time.NewTimer(c.StartupTimeout)
+		defer t.Stop()
+		startup = t.C
+	}
+
+	timedOut := make(chan string, 1)
+	go func() {
+		output := gotOutput
+		for {
+			select {
+			case <-doneChan:
+				return
+			case <-output:
+				// nil channels block, so neither fires again
+				output, startup = nil, nil
+			case <-startup:
+				a.Logger.Debugf("Command produced no output within %v\n", c.StartupTimeout)
+				timedOut <- TimeoutStartup
+				kill()
+				return
+			case <-ctx.Done():
+				a.Logger.Debugf("Command timed out after %v\n", c.Timeout)
+				timedOut <- TimeoutRun
+				kill()
+				return
+			}
 		}
 	}()
 
 	// Wait for goroutine to print everything
 	<-doneChan
 	ret := CmdStatus{
-		Status: envCmd.Status(),
-		Stdout: CleanString(stdoutBuf.String()),
-		Stderr: CleanString(stderrBuf.String()),
+		Status:     envCmd.Status(),
+		Stdout:     CleanString(stdoutBuf.String()),
+		Stderr:     CleanString(stderrBuf.String()),
+		TotalLines: totalLines,
 	}
-	a.Logger.Debugf("%+v\n", ret)
+	if c.BinaryOutput {
+		ret.Stdout = base64.StdEncoding.EncodeToString(stdoutBuf.Bytes())
+		ret.Binary = true
+	}
+	// go-cmd records when the process actually started and exited
+	if c.Timing && ret.Status.StartTs > 0 {
+		started := time.Unix(0, ret.Status.StartTs)
+		ret.Timing = &CmdTiming{Start: started.Sub(startCalled)}
+		if ret.Status.StopTs > 0 {
+			ret.Timing.Exec = time.Unix(0, ret.Status.StopTs).Sub(started)
+		}
+	}
+	if queue != nil {
+		ret.DroppedLines = queue.close()
+	}
+	select {
+	case ret.TimedOut = <-timedOut:
+	default:
+	}
+	// processes we killed for timing out didn't crash
+	if c.CollectCrashDump && ret.TimedOut == "" {
+		ret.Crash = a.collectCrash(ret.Status)
+	}
+	if c.LogLines {
+		a.Logger.Debugf("%+v\n", ret)
+	} else {
+		a.Logger.Debugf("Command exited with %d after %d lines of output\n", ret.Status.Exit, totalLines)
+	}
+	a.auditCommand(c, ret, start)
 	return ret
 }
 
+// binaryWriter collects raw stdout for BinaryOutput, exec writes to it from its own goroutine
+// but nothing reads the buffer until the command has exited
+type binaryWriter struct {
+	buf  *bytes.Buffer
+	seen func()
+}
+
+func (w *binaryWriter) Write(p []byte) (int, error) {
+	w.seen()
+	return w.buf.Write(p)
+}
+
 func (a *Agent) GetCPULoadAvg() int {
 	fallback := false
 	pyCode := `
@@ -305,6 +874,24 @@ except:
 	return i
 }
 
+// GetPerCoreCPU returns the utilization of each logical core over interval seconds
+// Sampled in go so it doesn't need python, interval defaults to 1 second and is capped at 60
+func (a *Agent) GetPerCoreCPU(interval int) ([]float64, error) {
+	if interval <= 0 {
+		interval = 1
+	} else if interval > 60 {
+		interval = 60
+	}
+	percent, err := cpu.Percent(time.Duration(interval)*time.Second, true)
+	if err != nil {
+		return []float64{}, err
+	}
+	for i := range percent {
+		percent[i] = math.Round(percent[i]*10) / 10
+	}
+	return percent, nil
+}
+
 // ForceKillMesh kills all mesh agent related processes
 func (a *Agent) ForceKillMesh() {
 	pids := make([]int, 0)
@@ -325,7 +912,7 @@ func (a *Agent) ForceKillMesh() {
 	}
 
 	for _, pid := range pids {
-		a.Logger.Debugln("Killing mesh process with pid %d", pid)
+		a.Logger.Debugln("Killing mesh process with pid", pid)
 		if err := KillProc(int32(pid)); err != nil {
 			a.Logger.Debugln(err)
 		}
@@ -342,24 +929,114 @@ func (a *Agent) SyncMeshNodeID() {
 
 	payload := rmm.MeshNodeID{
 		Func:    "syncmesh",
-		Agentid: a.AgentID,
+		Agentid: a.agentID(),
 		NodeID:  StripAll(id),
 	}
 
-	_, err = a.rClient.R().SetBody(payload).Post("/api/v3/syncmesh/")
+	req := a.rClient.R()
+	if a.SignMeshSync {
+		// sign the exact bytes that are sent, resty would otherwise serialize the struct itself
+		body, err := json.Marshal(payload)
+		if err != nil {
+			a.Logger.Errorln("SyncMesh:", err)
+			return
+		}
+		req.SetHeader("Content-Type", "application/json")
+		req.SetHeader(hmacHeader, a.hmacSign(body))
+		req.SetBody(body)
+	} else {
+		req.SetBody(payload)
+	}
+	_, err = req.Post("/api/v3/syncmesh/")
 	if err != nil {
 		a.Logger.Debugln("SyncMesh:", err)
 	}
 }
 
+// TraceRequest performs a single traced GET against the api and returns its timings
+// Unlike SetDebug this only affects this one request
+func (a *Agent) TraceRequest(path string) (rmm.HTTPTrace, error) {
+	var ret rmm.HTTPTrace
+
+	r, err := a.rClient.R().EnableTrace().Get(path)
+	if err != nil {
+		return ret, err
+	}
+
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	ti := r.Request.TraceInfo()
+	ret = rmm.HTTPTrace{
+		URL:          r.Request.URL,
+		StatusCode:   r.StatusCode(),
+		DNSLookup:    ms(ti.DNSLookup),
+		TCPConnect:   ms(ti.TCPConnTime),
+		TLSHandshake: ms(ti.TLSHandshake),
+		ServerTime:   ms(ti.ServerTime),
+		ResponseTime: ms(ti.ResponseTime),
+		TotalTime:    ms(ti.TotalTime),
+		ConnReused:   ti.IsConnReused,
+	}
+	if ti.RemoteAddr != nil {
+		ret.RemoteAddr = ti.RemoteAddr.String()
+	}
+	a.Logger.Debugf("%+v\n", ret)
+	return ret, nil
+}
+
+// ServerTimeOffset estimates how far the server's clock is ahead of ours using the Date header of a
+// lightweight api request, corrected for half the round trip
+// The Date header only has second resolution so small offsets are noise
+func (a *Agent) ServerTimeOffset() (time.Duration, error) {
+	start := time.Now()
+	r, err := a.rClient.R().Head(fmt.Sprintf("/api/v3/%s/checkinterval/", a.agentID()))
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+
+	date := r.Header().Get("Date")
+	if date == "" {
+		return 0, errors.New("server response has no Date header")
+	}
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		return 0, err
+	}
+
+	offset := serverTime.Sub(start.Add(rtt / 2)).Round(time.Second)
+	a.Logger.Debugln("Server clock offset:", offset, "rtt:", rtt)
+	return offset, nil
+}
+
 func (a *Agent) setupNatsOptions() []nats.Option {
+	return a.natsOptions(a.authToken())
+}
+
+func (a *Agent) natsOptions(token string) []nats.Option {
 	opts := make([]nats.Option, 0)
 	opts = append(opts, nats.Name("TacticalRMM"))
-	opts = append(opts, nats.UserInfo(a.AgentID, a.Token))
+	opts = append(opts, nats.UserInfo(a.agentID(), token))
 	opts = append(opts, nats.ReconnectWait(time.Second*5))
 	opts = append(opts, nats.RetryOnFailedConnect(true))
 	opts = append(opts, nats.MaxReconnects(-1))
 	opts = append(opts, nats.ReconnectBufSize(-1))
+	opts = append(opts, nats.DisconnectErrHandler(a.natsDisconnected))
+	opts = append(opts, nats.ReconnectHandler(a.natsReconnected))
+	// a shorter ping interval keeps nat mappings alive on otherwise idle connections
+	if a.NatsPingInterval > 0 {
+		opts = append(opts, nats.PingInterval(a.NatsPingInterval))
+	}
+	if a.NatsMaxPingsOut > 0 {
+		opts = append(opts, nats.MaxPingsOutstanding(a.NatsMaxPingsOut))
+	}
+	if a.caPool != nil {
+		opts = append(opts, nats.Secure(&tls.Config{RootCAs: a.caPool}))
+	}
+	if a.SystemProxy && len(a.Proxy) > 0 {
+		if u, err := url.Parse(a.Proxy); err == nil {
+			opts = append(opts, nats.SetCustomDialer(&proxyDialer{proxy: u, timeout: 10 * time.Second}))
+		}
+	}
 	return opts
 }
 
@@ -388,7 +1065,11 @@ func (a *Agent) CleanupAgentUpdates() {
 	files, err := filepath.Glob("winagent-v*.exe")
 	if err == nil {
 		for _, f := range files {
-			os.Remove(f)
+			if err := os.Remove(f); err != nil {
+				if lockers, lerr := a.GetFileLockers(f); lerr == nil && len(lockers) > 0 {
+					a.Logger.Debugf("CleanupAgentUpdates(): %s is in use by %+v\n", f, lockers)
+				}
+			}
 		}
 	}
 
@@ -405,14 +1086,45 @@ func (a *Agent) CleanupAgentUpdates() {
 	}
 }
 
-func (a *Agent) RunPythonCode(code string, timeout int, args []string) (string, error) {
+func newPyPool(workers int) chan struct{} {
+	if workers <= 0 {
+		return nil
+	}
+	return make(chan struct{}, workers)
+}
+
+// acquirePython waits for a free python worker slot, the returned func releases it
+func (a *Agent) acquirePython(wait time.Duration) (func(), error) {
+	if a.pyPool == nil {
+		return func() {}, nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case a.pyPool <- struct{}{}:
+		return func() { <-a.pyPool }, nil
+	case <-t.C:
+		return nil, ErrPythonBusy
+	}
+}
+
+// RunPythonCodeTimed is RunPythonCode, filling in timing if it's not nil. Setup includes waiting for a python slot
+func (a *Agent) RunPythonCodeTimed(code string, timeout int, args []string, timing *CmdTiming) (string, error) {
+	setupStart := time.Now()
+	release, err := a.acquirePython(time.Duration(timeout) * time.Second)
+	if err != nil {
+		a.Logger.Debugln("RunPythonCode:", err)
+		return "", err
+	}
+	defer release()
+
 	content := []byte(code)
 	dir, err := ioutil.TempDir("", "tacticalpy")
 	if err != nil {
 		a.Logger.Debugln(err)
 		return "", err
 	}
-	defer os.RemoveAll(dir)
+	defer timing.timeCleanup(func() { os.RemoveAll(dir) })
 
 	tmpfn, _ := ioutil.TempFile(dir, "*.py")
 	if _, err := tmpfn.Write(content); err != nil {
@@ -437,7 +1149,17 @@ func (a *Agent) RunPythonCode(code string, timeout int, args []string) (string,
 	cmd.Stdout = &outb
 	cmd.Stderr = &errb
 
-	cmdErr := cmd.Run()
+	startCalled := time.Now()
+	cmdErr := cmd.Start()
+	started := time.Now()
+	if cmdErr == nil {
+		cmdErr = cmd.Wait()
+	}
+	if timing != nil {
+		timing.Setup = startCalled.Sub(setupStart)
+		timing.Start = started.Sub(startCalled)
+		timing.Exec = time.Since(started)
+	}
 
 	if ctx.Err() == context.DeadlineExceeded {
 		a.Logger.Debugln("RunPythonCode:", ctx.Err())
@@ -458,6 +1180,55 @@ func (a *Agent) RunPythonCode(code string, timeout int, args []string) (string,
 
 }
 
+// newRestyClient returns an api client configured like rClient but with its own timeout
+func (a *Agent) newRestyClient(timeout time.Duration) *resty.Client {
+	c := a.newAnonRestyClient(timeout)
+	c.OnBeforeRequest(a.setAuthHeader)
+	a.enableReauth(c)
+	return c
+}
+
+// newAnonRestyClient is newRestyClient without the agent token
+func (a *Agent) newAnonRestyClient(timeout time.Duration) *resty.Client {
+	c := resty.New()
+	c.SetBaseURL(a.baseURL())
+	c.OnBeforeRequest(a.setRequestURL)
+	c.SetCloseConnection(true)
+	// Headers has the token from when the agent started, newRestyClient sets the current one per request
+	for k, v := range a.Headers {
+		if !strings.EqualFold(k, "Authorization") {
+			c.SetHeader(k, v)
+		}
+	}
+	c.SetTimeout(timeout)
+	c.SetDebug(a.Debug)
+	if a.SignPayloads {
+		c.SetPreRequestHook(a.signRequest)
+	}
+	if len(a.Proxy) > 0 {
+		c.SetProxy(a.Proxy)
+	}
+	if a.caPool != nil {
+		c.SetTLSClientConfig(&tls.Config{RootCAs: a.caPool})
+	}
+	return c
+}
+
+// stateFile returns the path of a file used to persist agent state between processes
+func (a *Agent) stateFile(name string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(a.ProgramDir, name)
+	}
+	return filepath.Join("/var/lib/tacticalagent", name)
+}
+
+func writeStateFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
 func (a *Agent) CreateTRMMTempDir() {
 	// create the temp dir for running scripts
 	dir := filepath.Join(os.TempDir(), "trmm")
@@ -140,22 +140,73 @@ func NewAgentConfig() *rmm.AgentConfig {
 
 	agentpk := viper.GetString("agentpk")
 	pk, _ := strconv.Atoi(agentpk)
+	days, _ := ParseMaintenanceDays(viper.GetString("maintenancedays"))
 
 	ret := &rmm.AgentConfig{
-		BaseURL:       viper.GetString("baseurl"),
-		AgentID:       viper.GetString("agentid"),
-		APIURL:        viper.GetString("apiurl"),
-		Token:         viper.GetString("token"),
-		AgentPK:       agentpk,
-		PK:            pk,
-		Cert:          viper.GetString("cert"),
-		Proxy:         viper.GetString("proxy"),
-		CustomMeshDir: viper.GetString("meshdir"),
+		BaseURL:          viper.GetString("baseurl"),
+		AgentID:          viper.GetString("agentid"),
+		APIURL:           viper.GetString("apiurl"),
+		Token:            viper.GetString("token"),
+		AgentPK:          agentpk,
+		PK:               pk,
+		Cert:             viper.GetString("cert"),
+		Proxy:            viper.GetString("proxy"),
+		CustomMeshDir:    viper.GetString("meshdir"),
+		NetChangeCheckin: viper.GetBool("netchangecheckin"),
+		SignPayloads:     viper.GetBool("signpayloads"),
+		NetworkWait:      viper.GetInt("networkwait"),
+		PythonWorkers:    viper.GetInt("pythonworkers"),
+		CommandDenylist:  viper.GetStringSlice("commanddenylist"),
+		CommandAllowlist: viper.GetStringSlice("commandallowlist"),
+		NatsPingInterval: viper.GetInt("natspinginterval"),
+		NatsMaxPingsOut:  viper.GetInt("natsmaxpingsout"),
+		ReenrollOnClone:  viper.GetBool("reenrollonclone"),
+		ResultInlineMax:  viper.GetInt("resultinlinemax"),
+		ResultUploadURL:  viper.GetString("resultuploadurl"),
+		MaxParallelCmds:  viper.GetInt("maxparallelcmds"),
+		CmdQueueTimeout:  viper.GetInt("cmdqueuetimeout"),
+		SignMeshSync:     viper.GetBool("signmeshsync"),
+		UploadMaxBps:     viper.GetInt("uploadmaxbps"),
+		AuditMaxSizeMB:   viper.GetInt("auditmaxsizemb"),
+		AuditMaxAgeDays:  viper.GetInt("auditmaxagedays"),
+		AuditKeep:        viper.GetInt("auditkeep"),
+		EnrollSecret:     viper.GetString("enrollsecret"),
+		AuditLog:         viper.GetString("auditlog"),
+		MaintenanceWindow: rmm.MaintenanceWindow{
+			Enabled: viper.GetBool("maintenance"),
+			Start:   viper.GetString("maintenancestart"),
+			End:     viper.GetString("maintenanceend"),
+			Days:    days,
+		},
 	}
 	return ret
 }
 
-func (a *Agent) RunScript(code string, shell string, args []string, timeout int) (stdout, stderr string, exitcode int, e error) {
+// saveToken persists a rotated token so other processes and restarts pick it up
+func saveToken(token string) error {
+	viper.Set("token", token)
+	return viper.WriteConfig()
+}
+
+func saveEnrollSecret(secret string) error {
+	viper.Set("enrollsecret", secret)
+	return viper.WriteConfig()
+}
+
+// saveEnrollment persists the server, agent id and token after a re-enroll
+func saveEnrollment(e enrollment) error {
+	viper.Set("baseurl", e.BaseURL)
+	viper.Set("apiurl", e.ApiURL)
+	viper.Set("agentid", e.AgentID)
+	viper.Set("token", e.Token)
+	return viper.WriteConfig()
+}
+
+// RunScriptWith is RunScript with the extra settings in so
+func (a *Agent) RunScriptWith(code string, shell string, args []string, timeout int, so ScriptOptions) (stdout, stderr string, exitcode int, e error) {
+	timing := so.Timing
+	setupStart := time.Now()
+
 	code = removeWinNewLines(code)
 	content := []byte(code)
 
@@ -164,7 +215,7 @@ func (a *Agent) RunScript(code string, shell string, args []string, timeout int)
 		a.Logger.Errorln("RunScript createTmpFile()", err)
 		return "", err.Error(), 85, err
 	}
-	defer os.Remove(f.Name())
+	defer timing.timeCleanup(func() { os.Remove(f.Name()) })
 
 	if _, err := f.Write(content); err != nil {
 		a.Logger.Errorln(err)
@@ -184,9 +235,24 @@ func (a *Agent) RunScript(code string, shell string, args []string, timeout int)
 	opts := a.NewCMDOpts()
 	opts.IsScript = true
 	opts.Shell = f.Name()
+	opts.Script = code
 	opts.Args = args
-	opts.Timeout = time.Duration(timeout)
+	opts.Timeout = time.Duration(timeout) * time.Second
+	opts.Initiator = so.Initiator
+	opts.Sensitive = so.Sensitive
+	opts.Suppressible = so.Suppressible
+	opts.Timing = timing != nil
+	setup := time.Since(setupStart)
 	out := a.CmdV2(opts)
+	if out.Status.Error == ErrMaintenanceMode {
+		return "", ErrMaintenanceMode.Error(), 1, ErrMaintenanceMode
+	}
+	if timing != nil {
+		timing.Setup = setup
+		if out.Timing != nil {
+			timing.Start, timing.Exec = out.Timing.Start, out.Timing.Exec
+		}
+	}
 	retError := ""
 	if out.Status.Error != nil {
 		retError += CleanString(out.Status.Error.Error())
@@ -479,6 +545,8 @@ func (a *Agent) installMesh(meshbin, exe, proxy string) (string, error) {
 	return "not implemented", nil
 }
 
+func (a *Agent) reinstallMesh() (string, error) { return "", ErrNotSupported }
+
 func CMDShell(shell string, cmdArgs []string, command string, timeout int, detached bool) (output [2]string, e error) {
 	return [2]string{"", ""}, nil
 }
@@ -494,3 +562,31 @@ func (a *Agent) Start(_ service.Service) error { return nil }
 func (a *Agent) Stop(_ service.Service) error { return nil }
 
 func (a *Agent) InstallService() error { return nil }
+
+func (a *Agent) GetAntivirusStatus() ([]rmm.AVProduct, error) {
+	return []rmm.AVProduct{}, ErrNotSupported
+}
+
+func (a *Agent) GetDefenderExclusions() (rmm.DefenderExclusions, error) {
+	return rmm.DefenderExclusions{}, ErrNotSupported
+}
+
+func (a *Agent) AddDefenderExclusion(kind, value string) error { return ErrNotSupported }
+
+func (a *Agent) GetBitLockerStatus() ([]rmm.VolumeEncryption, error) {
+	return []rmm.VolumeEncryption{}, ErrNotSupported
+}
+
+func (a *Agent) BackupBitLockerKey() error { return ErrNotSupported }
+
+func (a *Agent) RunWMIQuery(namespace, query string) ([]map[string]interface{}, error) {
+	return nil, ErrNotSupported
+}
+
+func (a *Agent) GetPowerPlan() (string, error) { return "", ErrNotSupported }
+
+func (a *Agent) SetPowerPlan(guidOrName string) error { return ErrNotSupported }
+
+func (a *Agent) DisableSleep() error { return ErrNotSupported }
+
+func (a *Agent) DisableHibernate() error { return ErrNotSupported }
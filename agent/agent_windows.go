@@ -30,6 +30,7 @@ import (
 
 	rmm "github.com/amidaware/rmmagent/shared"
 	ps "github.com/elastic/go-sysinfo"
+	gocmd "github.com/go-cmd/cmd"
 	"github.com/go-ole/go-ole"
 	"github.com/go-ole/go-ole/oleutil"
 	"github.com/go-resty/resty/v2"
@@ -61,21 +62,143 @@ func NewAgentConfig() *rmm.AgentConfig {
 	cert, _, _ := k.GetStringValue("Cert")
 	proxy, _, _ := k.GetStringValue("Proxy")
 	customMeshDir, _, _ := k.GetStringValue("MeshDir")
+	netChange, _, _ := k.GetStringValue("NetChangeCheckin")
+	netChangeCheckin, _ := strconv.ParseBool(netChange)
+	sign, _, _ := k.GetStringValue("SignPayloads")
+	signPayloads, _ := strconv.ParseBool(sign)
+	netWait, _, _ := k.GetStringValue("NetworkWait")
+	networkWait, _ := strconv.Atoi(netWait)
+	pyWorkers, _, _ := k.GetStringValue("PythonWorkers")
+	pythonWorkers, _ := strconv.Atoi(pyWorkers)
+	pingInt, _, _ := k.GetStringValue("NatsPingInterval")
+	natsPingInterval, _ := strconv.Atoi(pingInt)
+	maxPings, _, _ := k.GetStringValue("NatsMaxPingsOut")
+	natsMaxPingsOut, _ := strconv.Atoi(maxPings)
+	reenroll, _, _ := k.GetStringValue("ReenrollOnClone")
+	reenrollOnClone, _ := strconv.ParseBool(reenroll)
+	inlineMax, _, _ := k.GetStringValue("ResultInlineMax")
+	resultInlineMax, _ := strconv.Atoi(inlineMax)
+	resultUploadEndpoint, _, _ := k.GetStringValue("ResultUploadURL")
+	maxCmds, _, _ := k.GetStringValue("MaxParallelCmds")
+	maxParallelCmds, _ := strconv.Atoi(maxCmds)
+	queueTimeout, _, _ := k.GetStringValue("CmdQueueTimeout")
+	cmdQueueTimeout, _ := strconv.Atoi(queueTimeout)
+	signSync, _, _ := k.GetStringValue("SignMeshSync")
+	signMeshSync, _ := strconv.ParseBool(signSync)
+	maxBps, _, _ := k.GetStringValue("UploadMaxBps")
+	uploadMaxBps, _ := strconv.Atoi(maxBps)
+	auditSize, _, _ := k.GetStringValue("AuditMaxSizeMB")
+	auditMaxSizeMB, _ := strconv.Atoi(auditSize)
+	auditAge, _, _ := k.GetStringValue("AuditMaxAgeDays")
+	auditMaxAgeDays, _ := strconv.Atoi(auditAge)
+	keep, _, _ := k.GetStringValue("AuditKeep")
+	auditKeep, _ := strconv.Atoi(keep)
+	enrollSecret, _, _ := k.GetStringValue("EnrollSecret")
+	cmdDeny, _, _ := k.GetStringsValue("CommandDenylist")
+	cmdAllow, _, _ := k.GetStringsValue("CommandAllowlist")
+	auditLog, _, _ := k.GetStringValue("AuditLog")
+	maint, _, _ := k.GetStringValue("Maintenance")
+	maintEnabled, _ := strconv.ParseBool(maint)
+	maintStart, _, _ := k.GetStringValue("MaintenanceStart")
+	maintEnd, _, _ := k.GetStringValue("MaintenanceEnd")
+	maintDays, _, _ := k.GetStringValue("MaintenanceDays")
+	days, _ := ParseMaintenanceDays(maintDays)
 
 	return &rmm.AgentConfig{
-		BaseURL:       baseurl,
-		AgentID:       agentid,
-		APIURL:        apiurl,
-		Token:         token,
-		AgentPK:       agentpk,
-		PK:            pk,
-		Cert:          cert,
-		Proxy:         proxy,
-		CustomMeshDir: customMeshDir,
+		BaseURL:          baseurl,
+		AgentID:          agentid,
+		APIURL:           apiurl,
+		Token:            token,
+		AgentPK:          agentpk,
+		PK:               pk,
+		Cert:             cert,
+		Proxy:            proxy,
+		CustomMeshDir:    customMeshDir,
+		NetChangeCheckin: netChangeCheckin,
+		SignPayloads:     signPayloads,
+		NetworkWait:      networkWait,
+		PythonWorkers:    pythonWorkers,
+		CommandDenylist:  cmdDeny,
+		CommandAllowlist: cmdAllow,
+		NatsPingInterval: natsPingInterval,
+		NatsMaxPingsOut:  natsMaxPingsOut,
+		ReenrollOnClone:  reenrollOnClone,
+		ResultInlineMax:  resultInlineMax,
+		ResultUploadURL:  resultUploadEndpoint,
+		MaxParallelCmds:  maxParallelCmds,
+		CmdQueueTimeout:  cmdQueueTimeout,
+		SignMeshSync:     signMeshSync,
+		UploadMaxBps:     uploadMaxBps,
+		AuditMaxSizeMB:   auditMaxSizeMB,
+		AuditMaxAgeDays:  auditMaxAgeDays,
+		AuditKeep:        auditKeep,
+		EnrollSecret:     enrollSecret,
+		AuditLog:         auditLog,
+		MaintenanceWindow: rmm.MaintenanceWindow{
+			Enabled: maintEnabled,
+			Start:   maintStart,
+			End:     maintEnd,
+			Days:    days,
+		},
 	}
 }
 
-func (a *Agent) RunScript(code string, shell string, args []string, timeout int) (stdout, stderr string, exitcode int, e error) {
+// saveToken persists a rotated token so other processes and restarts pick it up
+func saveToken(token string) error {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\TacticalRMM`, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	return k.SetStringValue("Token", token)
+}
+
+func saveEnrollSecret(secret string) error {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\TacticalRMM`, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	return k.SetStringValue("EnrollSecret", secret)
+}
+
+// saveEnrollment persists the server, agent id and token after a re-enroll
+func saveEnrollment(e enrollment) error {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\TacticalRMM`, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	values := []struct{ name, value string }{
+		{"BaseURL", e.BaseURL},
+		{"ApiURL", e.ApiURL},
+		{"AgentID", e.AgentID},
+		{"Token", e.Token},
+	}
+	for _, v := range values {
+		if err := k.SetStringValue(v.name, v.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunScriptWith is RunScript with the extra settings in so
+func (a *Agent) RunScriptWith(code string, shell string, args []string, timeout int, so ScriptOptions) (stdout, stderr string, exitcode int, e error) {
+	timing := so.Timing
+	setupStart := time.Now()
+	// this doesn't go through CmdV2 so the policy is checked and the run audited here
+	c := &CmdOptions{Shell: shell, Args: args, IsScript: true, Script: code, Initiator: so.Initiator, Sensitive: so.Sensitive}
+	var pid int
+	defer func() {
+		a.auditCommand(c, CmdStatus{Status: gocmd.Status{PID: pid, Exit: exitcode, Error: e}}, setupStart)
+	}()
+	if blocked, ok := a.checkPolicy(c); !ok {
+		return "", blocked.Stderr, blocked.Status.Exit, ErrBlockedByPolicy
+	}
+	if so.Suppressible && a.InMaintenance() {
+		return "", ErrMaintenanceMode.Error(), 1, ErrMaintenanceMode
+	}
 
 	content := []byte(code)
 
@@ -108,7 +231,7 @@ func (a *Agent) RunScript(code string, shell string, args []string, timeout int)
 		a.Logger.Errorln(err)
 		return "", err.Error(), 85, err
 	}
-	defer os.Remove(tmpfn.Name())
+	defer timing.timeCleanup(func() { os.Remove(tmpfn.Name()) })
 
 	if _, err := tmpfn.Write(content); err != nil {
 		a.Logger.Errorln(err)
@@ -142,11 +265,13 @@ func (a *Agent) RunScript(code string, shell string, args []string, timeout int)
 	cmd.Stdout = &outb
 	cmd.Stderr = &errb
 
+	startCalled := time.Now()
 	if cmdErr := cmd.Start(); cmdErr != nil {
 		a.Logger.Debugln(cmdErr)
 		return "", cmdErr.Error(), 65, cmdErr
 	}
-	pid := int32(cmd.Process.Pid)
+	started := time.Now()
+	pid = cmd.Process.Pid
 
 	// custom context handling, we need to kill child procs if this is a batch script,
 	// otherwise it will hang forever
@@ -157,9 +282,14 @@ func (a *Agent) RunScript(code string, shell string, args []string, timeout int)
 
 		_ = KillProc(p)
 		timedOut = true
-	}(pid)
+	}(int32(pid))
 
 	cmdErr := cmd.Wait()
+	if timing != nil {
+		timing.Setup = startCalled.Sub(setupStart)
+		timing.Start = started.Sub(startCalled)
+		timing.Exec = time.Since(started)
+	}
 
 	if timedOut {
 		stdout = CleanString(outb.String())
@@ -539,7 +669,7 @@ func (a *Agent) SendSoftware() {
 	sw := a.GetInstalledSoftware()
 	a.Logger.Debugln(sw)
 
-	payload := map[string]interface{}{"agent_id": a.AgentID, "software": sw}
+	payload := map[string]interface{}{"agent_id": a.agentID(), "software": sw}
 	_, err := a.rClient.R().SetBody(payload).Post("/api/v3/software/")
 	if err != nil {
 		a.Logger.Debugln(err)
@@ -703,6 +833,28 @@ func (a *Agent) installMesh(meshbin, exe, proxy string) (string, error) {
 	return meshNodeID, nil
 }
 
+// reinstallMesh downloads the mesh installer if it's not already in the program dir and reinstalls mesh
+func (a *Agent) reinstallMesh() (string, error) {
+	mesh := filepath.Join(a.ProgramDir, a.MeshInstaller)
+	if !trmm.FileExists(mesh) {
+		arch := "64"
+		if a.Arch == "x86" {
+			arch = "32"
+		}
+		a.Logger.Infoln("Downloading mesh agent...")
+		payload := map[string]string{"arch": arch, "plat": a.Platform}
+		r, err := a.rClient.R().SetBody(payload).SetOutput(mesh).Post("/api/v3/meshexe/")
+		if err != nil {
+			return "", err
+		}
+		if r.IsError() {
+			os.Remove(mesh)
+			return "", fmt.Errorf("meshexe response code: %v", r.StatusCode())
+		}
+	}
+	return a.installMesh(mesh, a.MeshSystemEXE, a.Proxy)
+}
+
 // ChecksRunning prevents duplicate checks from running
 // Have to do it this way, can't use atomic because they can run from both rpc and tacticalagent services
 func (a *Agent) ChecksRunning() bool {
@@ -851,3 +1003,19 @@ func (a *Agent) InstallService() error {
 func (a *Agent) NixMeshNodeID() string {
 	return "not implemented"
 }
+
+func (a *Agent) GetJournalLog(unit string, priority int, since time.Time, max int) ([]rmm.JournalEntry, error) {
+	return []rmm.JournalEntry{}, ErrJournalUnsupported
+}
+
+func (a *Agent) GetLUKSStatus() ([]rmm.VolumeEncryption, error) {
+	return []rmm.VolumeEncryption{}, ErrNotSupported
+}
+
+func (a *Agent) GetLinuxUpdates() ([]rmm.PackageUpdate, error) {
+	return []rmm.PackageUpdate{}, ErrNotSupported
+}
+
+func (a *Agent) GetEntropyStatus() (int, error) {
+	return 0, ErrNotSupported
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import "time"
+
+const runtimeStateKey = "runtime"
+
+type agentRuntimeState struct {
+	Started  int64 `json:"started"`
+	Restarts int   `json:"restarts"`
+}
+
+// recordAgentStart bumps the restart counter, called once when the service starts
+func (a *Agent) recordAgentStart() {
+	state := agentRuntimeState{}
+	if found, err := a.state.Get(runtimeStateKey, &state); err != nil {
+		a.Logger.Debugln("recordAgentStart(): resetting corrupt state:", err)
+		state = agentRuntimeState{}
+	} else if found {
+		state.Restarts++
+	}
+	state.Started = time.Now().Unix()
+
+	if err := a.state.Set(runtimeStateKey, state); err != nil {
+		a.Logger.Errorln("recordAgentStart():", err)
+	}
+}
+
+// GetAgentRuntime returns when the agent service last started and how many times it has restarted
+// A missing or corrupt state file is reset, starting the count again from now
+func (a *Agent) GetAgentRuntime() (startedAt time.Time, restartCount int, err error) {
+	var state agentRuntimeState
+	if _, err := a.state.Get(runtimeStateKey, &state); err != nil || state.Started == 0 {
+		state = agentRuntimeState{Started: time.Now().Unix()}
+		if err := a.state.Set(runtimeStateKey, state); err != nil {
+			return time.Time{}, 0, err
+		}
+	}
+	return time.Unix(state.Started, 0), state.Restarts, nil
+}
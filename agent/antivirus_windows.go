@@ -0,0 +1,73 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"github.com/StackExchange/wmi"
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetAntivirusStatus returns av products registered with security center plus defender's own status
+// Security center doesn't exist on servers, in which case only defender is reported
+func (a *Agent) GetAntivirusStatus() ([]rmm.AVProduct, error) {
+	ret := make([]rmm.AVProduct, 0)
+
+	var products []struct {
+		DisplayName            string
+		ProductState           uint32
+		PathToSignedProductExe string
+	}
+	scErr := wmi.QueryNamespace("SELECT displayName, productState, pathToSignedProductExe FROM AntiVirusProduct", &products, `root\SecurityCenter2`)
+	if scErr != nil {
+		a.Logger.Debugln("GetAntivirusStatus() SecurityCenter2:", scErr)
+	}
+	for _, p := range products {
+		// https://docs.microsoft.com/en-us/windows/win32/api/iwscapi/ne-iwscapi-wsc_security_product_state
+		ret = append(ret, rmm.AVProduct{
+			Name:         p.DisplayName,
+			Source:       "SecurityCenter2",
+			Path:         p.PathToSignedProductExe,
+			ProductState: p.ProductState,
+			Enabled:      p.ProductState&0x1000 != 0,
+			UpToDate:     p.ProductState&0x10 == 0,
+			SignatureAge: -1,
+		})
+	}
+
+	var mp []struct {
+		AMServiceEnabled          bool
+		AntivirusEnabled          bool
+		RealTimeProtectionEnabled bool
+		AntivirusSignatureAge     uint32
+		AntivirusSignatureVersion string
+	}
+	mpErr := wmi.QueryNamespace("SELECT AMServiceEnabled, AntivirusEnabled, RealTimeProtectionEnabled, AntivirusSignatureAge, AntivirusSignatureVersion FROM MSFT_MpComputerStatus", &mp, `root\Microsoft\Windows\Defender`)
+	if mpErr != nil {
+		a.Logger.Debugln("GetAntivirusStatus() MSFT_MpComputerStatus:", mpErr)
+	}
+	for _, m := range mp {
+		ret = append(ret, rmm.AVProduct{
+			Name:               "Microsoft Defender Antivirus",
+			Source:             "Defender",
+			Enabled:            m.AMServiceEnabled && m.AntivirusEnabled,
+			UpToDate:           m.AntivirusSignatureAge <= 1,
+			RealTimeProtection: m.RealTimeProtectionEnabled,
+			SignatureAge:       int(m.AntivirusSignatureAge),
+			SignatureVersion:   m.AntivirusSignatureVersion,
+		})
+	}
+
+	if scErr != nil && mpErr != nil {
+		return ret, ErrNoSecurityCenter
+	}
+	return ret, nil
+}
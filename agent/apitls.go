@@ -0,0 +1,114 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// InspectAPITLS does a tls handshake with the api and reports the chain it presented and whether the agent trusts it,
+// using the custom ca bundle from a.Cert when one is set. Verification failures are reported rather than returned,
+// errors wrap ErrCertConnect when nothing answered and ErrCertHandshake when tls failed
+func (a *Agent) InspectAPITLS() (rmm.TLSReport, error) {
+	var ret rmm.TLSReport
+	u, err := url.Parse(a.baseURL())
+	if err != nil {
+		return ret, err
+	}
+	host := u.Hostname()
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	ret.Address = net.JoinHostPort(host, port)
+	ret.ServerName = host
+	ret.CustomCA = a.caPool != nil
+
+	dialer := &net.Dialer{Timeout: certCheckTimeout}
+	rawConn, err := dialer.Dial("tcp", ret.Address)
+	if err != nil {
+		return ret, fmt.Errorf("%w: %v", ErrCertConnect, err)
+	}
+	defer rawConn.Close()
+
+	// verified below instead so the chain can still be reported when it's bad
+	conn := tls.Client(rawConn, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+	})
+	conn.SetDeadline(time.Now().Add(certCheckTimeout))
+	if err := conn.Handshake(); err != nil {
+		return ret, fmt.Errorf("%w: %v", ErrCertHandshake, err)
+	}
+
+	state := conn.ConnectionState()
+	ret.TLSVersion = tlsVersions[state.Version]
+	ret.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	if len(state.PeerCertificates) == 0 {
+		return ret, fmt.Errorf("%w: no certificate presented", ErrCertHandshake)
+	}
+
+	for _, c := range state.PeerCertificates {
+		ret.Chain = append(ret.Chain, tlsCertInfo(c))
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range state.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	_, verr := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         a.caPool,
+		Intermediates: intermediates,
+	})
+	ret.Verified = verr == nil
+	if verr != nil {
+		ret.VerifyError = verr.Error()
+	}
+	return ret, nil
+}
+
+func tlsCertInfo(c *x509.Certificate) rmm.TLSCert {
+	sum := sha256.Sum256(c.Raw)
+	sans := make([]string, 0, len(c.DNSNames)+len(c.IPAddresses))
+	sans = append(sans, c.DNSNames...)
+	for _, ip := range c.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return rmm.TLSCert{
+		Subject:   c.Subject.String(),
+		Issuer:    c.Issuer.String(),
+		SANs:      sans,
+		NotBefore: c.NotBefore.UTC().Format(time.RFC3339),
+		NotAfter:  c.NotAfter.UTC().Format(time.RFC3339),
+		DaysLeft:  int(math.Floor(time.Until(c.NotAfter).Hours() / 24)),
+		IsCA:      c.IsCA,
+		SHA256:    hex.EncodeToString(sum[:]),
+	}
+}
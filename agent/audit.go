@@ -0,0 +1,312 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gocmd "github.com/go-cmd/cmd"
+)
+
+const (
+	redactedCommand = "[redacted]"
+	// recorded for commands the agent runs itself
+	agentInitiator = "agent"
+	// audit log rotation defaults
+	defaultAuditMaxSizeMB = 10
+	defaultAuditKeep      = 10
+)
+
+var auditMu sync.Mutex
+
+type AuditRecord struct {
+	Time      string  `json:"time"`
+	Initiator string  `json:"initiator"`
+	Command   string  `json:"command"`
+	Redacted  bool    `json:"redacted"`
+	Detached  bool    `json:"detached"`
+	PID       int     `json:"pid"`
+	ExitCode  int     `json:"exit_code"`
+	Error     string  `json:"error,omitempty"`
+	Duration  float64 `json:"duration"`
+	// set on the first record of a segment, the file the previous segment was rotated to
+	Segment string `json:"segment,omitempty"`
+	// each record's hash covers the record and the hash before it, across rotations,
+	// so an edited, removed or reordered record or a missing segment breaks the chain.
+	// It's an hmac keyed from the agent key so the chain can't be recomputed after an edit without it
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// seal sets PrevHash and Hash and returns the json line to write
+func (r *AuditRecord) seal(key []byte, prev string) ([]byte, error) {
+	r.PrevHash = prev
+	r.Hash = ""
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	r.Hash = hex.EncodeToString(mac.Sum(nil))
+	return json.Marshal(r)
+}
+
+// auditKey is the hmac key for the audit chain, derived from the agent key rather than using it directly
+func (a *Agent) auditKey() ([]byte, error) {
+	key, err := a.agentKey()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key.Seed())
+	mac.Write([]byte("audit log chain"))
+	return mac.Sum(nil), nil
+}
+
+// auditCommand appends a json line record of an executed command to the audit log
+// Does nothing unless an audit log path is configured
+func (a *Agent) auditCommand(c *CmdOptions, ret CmdStatus, start time.Time) {
+	if a.AuditLog == "" {
+		return
+	}
+
+	rec := AuditRecord{
+		Time:      start.UTC().Format(time.RFC3339Nano),
+		Initiator: c.Initiator,
+		Command:   auditCommandText(c),
+		Detached:  c.Detached,
+		PID:       ret.Status.PID,
+		ExitCode:  ret.Status.Exit,
+		Duration:  time.Since(start).Seconds(),
+	}
+	if rec.Initiator == "" {
+		rec.Initiator = agentInitiator
+	}
+	if c.Sensitive {
+		rec.Command = redactedCommand
+		rec.Redacted = true
+	}
+	if ret.Status.Error != nil {
+		rec.Error = ret.Status.Error.Error()
+	}
+
+	key, err := a.auditKey()
+	if err != nil {
+		a.Logger.Errorln("auditCommand():", err)
+		return
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	// the rpc and agent services are separate processes, the lock file keeps them from interleaving
+	// appends or both rotating. It sits next to the log since rotation replaces the log itself
+	unlock, err := lockFile(a.AuditLog + ".lock")
+	if err != nil {
+		a.Logger.Errorln("auditCommand():", err)
+		return
+	}
+	defer unlock()
+
+	if err := a.rotateAuditLog(key); err != nil {
+		a.Logger.Errorln("rotateAuditLog():", err)
+	}
+	// read back every time, the rpc and agent services both write to the log
+	prev, err := lastAuditHash(a.AuditLog)
+	if err != nil {
+		a.Logger.Debugln("auditCommand():", err)
+	}
+	if err := appendAuditRecord(a.AuditLog, key, &rec, prev); err != nil {
+		a.Logger.Errorln("auditCommand():", err)
+	}
+}
+
+func appendAuditRecord(path string, key []byte, rec *AuditRecord, prev string) error {
+	b, err := rec.seal(key, prev)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// lastAuditHash returns the hash of the last record in the log, empty for a new log or one from before hashing
+func lastAuditHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	lines, _, err := lastLines(f, 1)
+	if err != nil || len(lines) == 0 {
+		return "", err
+	}
+	var rec AuditRecord
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		return "", err
+	}
+	return rec.Hash, nil
+}
+
+// rotateAuditLog gzips the log once it's over AuditMaxSizeMB or its first record is older than AuditMaxAgeDays.
+// The new log starts with a record naming the old segment and chained to its last hash, then the oldest
+// segments over AuditKeep are removed. Called with auditMu and the log's lock file held
+func (a *Agent) rotateAuditLog(key []byte) error {
+	fi, err := os.Stat(a.AuditLog)
+	if err != nil || fi.Size() == 0 {
+		return nil
+	}
+
+	maxSize := a.AuditMaxSizeMB
+	if maxSize <= 0 {
+		maxSize = defaultAuditMaxSizeMB
+	}
+	due := fi.Size() >= int64(maxSize)*1024*1024
+	if !due && a.AuditMaxAgeDays > 0 {
+		if first, err := firstAuditTime(a.AuditLog); err == nil {
+			due = time.Since(first) >= time.Duration(a.AuditMaxAgeDays)*24*time.Hour
+		}
+	}
+	if !due {
+		return nil
+	}
+
+	prev, err := lastAuditHash(a.AuditLog)
+	if err != nil {
+		return err
+	}
+	segment := fmt.Sprintf("%s.%s.gz", a.AuditLog, time.Now().UTC().Format("20060102T150405"))
+	if err := gzipFile(a.AuditLog, segment); err != nil {
+		return err
+	}
+	if err := os.Remove(a.AuditLog); err != nil {
+		return err
+	}
+
+	rec := AuditRecord{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Initiator: agentInitiator,
+		Command:   "audit log rotated",
+		Segment:   filepath.Base(segment),
+	}
+	if err := appendAuditRecord(a.AuditLog, key, &rec, prev); err != nil {
+		return err
+	}
+
+	keep := a.AuditKeep
+	if keep <= 0 {
+		keep = defaultAuditKeep
+	}
+	segments, err := filepath.Glob(a.AuditLog + ".*.gz")
+	if err != nil {
+		return err
+	}
+	// the timestamps sort oldest first
+	sort.Strings(segments)
+	for len(segments) > keep {
+		if err := os.Remove(segments[0]); err != nil {
+			return err
+		}
+		segments = segments[1:]
+	}
+	return nil
+}
+
+func firstAuditTime(path string) (time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return time.Time{}, err
+	}
+	var rec AuditRecord
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, rec.Time)
+}
+
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// don't leave a truncated segment behind
+		os.Remove(dst)
+	}
+	return err
+}
+
+// auditExec audits a command that was run without CmdV2, the exit code is taken from err
+func (a *Agent) auditExec(c *CmdOptions, pid int, err error, start time.Time) {
+	st := gocmd.Status{PID: pid}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			st.Exit = exitErr.ExitCode()
+		} else {
+			st.Exit = -1
+			st.Error = err
+		}
+	}
+	a.auditCommand(c, CmdStatus{Status: st}, start)
+}
+
+func auditCommandText(c *CmdOptions) string {
+	switch {
+	case c.IsScript:
+		return strings.TrimSpace(c.Shell + " " + strings.Join(c.Args, " "))
+	default:
+		return strings.TrimSpace(c.Shell + " " + c.Command)
+	}
+}
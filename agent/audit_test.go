@@ -0,0 +1,224 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAuditAgent has its own agent key so the chain is keyed without touching the state dir
+func testAuditAgent(t *testing.T) *Agent {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := testAgent()
+	a.auth = &authState{key: key}
+	a.AuditLog = filepath.Join(t.TempDir(), "audit.log")
+	return a
+}
+
+// verifyAuditChain checks each record's hash and that it chains to the one before, starting from prev
+func verifyAuditChain(key []byte, lines []string, prev string) (string, error) {
+	for i, line := range lines {
+		var rec AuditRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return "", fmt.Errorf("record %d: %v", i, err)
+		}
+		if rec.PrevHash != prev {
+			return "", fmt.Errorf("record %d: prev_hash %q, want %q", i, rec.PrevHash, prev)
+		}
+		hash := rec.Hash
+		rec.Hash = ""
+		b, _ := json.Marshal(rec)
+		mac := hmac.New(sha256.New, key)
+		mac.Write(b)
+		if hex.EncodeToString(mac.Sum(nil)) != hash {
+			return "", fmt.Errorf("record %d: hash doesn't match", i)
+		}
+		prev = hash
+	}
+	return prev, nil
+}
+
+// resealAuditLines edits the first record and recomputes the whole chain with a key other than the agent's
+func resealAuditLines(t *testing.T, lines []string) []string {
+	t.Helper()
+	out := make([]string, 0, len(lines))
+	prev := ""
+	for i, line := range lines {
+		var rec AuditRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			rec.Command = "edited"
+		}
+		b, err := rec.seal([]byte("not the agent key"), prev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev = rec.Hash
+		out = append(out, string(b))
+	}
+	return out
+}
+
+func readAuditLines(t *testing.T, path string) []string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+func TestAuditCommand(t *testing.T) {
+	a := testAuditAgent(t)
+
+	cmds := []*CmdOptions{
+		{Shell: "/bin/sh", Command: "uptime", Initiator: "rpc:rawcmd"},
+		{Shell: "/bin/sh", Command: "echo secret", Sensitive: true},
+		{Shell: "/tmp/script.sh", Args: []string{"-v"}, IsScript: true, Initiator: "check"},
+	}
+	for _, c := range cmds {
+		a.auditCommand(c, CmdStatus{}, time.Now())
+	}
+	a.auditExec(&CmdOptions{Shell: "cmd", Command: "dir"}, 0, errors.New("no shell"), time.Now())
+
+	lines := readAuditLines(t, a.AuditLog)
+	if len(lines) != 4 {
+		t.Fatalf("got %d records, want 4", len(lines))
+	}
+
+	tests := []struct {
+		line      int
+		initiator string
+		command   string
+		redacted  bool
+		exit      int
+		err       string
+	}{
+		{0, "rpc:rawcmd", "/bin/sh uptime", false, 0, ""},
+		{1, "agent", redactedCommand, true, 0, ""},
+		{2, "check", "/tmp/script.sh -v", false, 0, ""},
+		{3, "agent", "cmd dir", false, -1, "no shell"},
+	}
+	for _, tt := range tests {
+		var rec AuditRecord
+		if err := json.Unmarshal([]byte(lines[tt.line]), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Initiator != tt.initiator || rec.Command != tt.command || rec.Redacted != tt.redacted ||
+			rec.ExitCode != tt.exit || rec.Error != tt.err {
+			t.Errorf("record %d = %+v, want initiator %q command %q redacted %v exit %d error %q",
+				tt.line, rec, tt.initiator, tt.command, tt.redacted, tt.exit, tt.err)
+		}
+	}
+}
+
+func TestAuditHashChain(t *testing.T) {
+	a := testAuditAgent(t)
+	key, err := a.auditKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range []string{"uptime", "whoami", "hostname", "date"} {
+		a.auditCommand(&CmdOptions{Shell: "/bin/sh", Command: cmd}, CmdStatus{}, time.Now())
+	}
+	lines := readAuditLines(t, a.AuditLog)
+	if _, err := verifyAuditChain(key, lines, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		lines []string
+	}{
+		{"edited", []string{lines[0], strings.Replace(lines[1], `"exit_code":0`, `"exit_code":1`, 1), lines[2], lines[3]}},
+		{"removed", []string{lines[0], lines[2], lines[3]}},
+		{"reordered", []string{lines[0], lines[2], lines[1], lines[3]}},
+		{"first removed", lines[1:]},
+		{"resealed without the key", resealAuditLines(t, lines)},
+	}
+	for _, tt := range tests {
+		if _, err := verifyAuditChain(key, tt.lines, ""); err == nil {
+			t.Errorf("%s log verified", tt.name)
+		}
+	}
+}
+
+func TestAuditRotationKeepsChain(t *testing.T) {
+	a := testAuditAgent(t)
+	a.AuditMaxAgeDays = 1
+	key, err := a.auditKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := AuditRecord{Time: time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339Nano), Command: "old"}
+	if err := appendAuditRecord(a.AuditLog, key, &old, ""); err != nil {
+		t.Fatal(err)
+	}
+	a.auditCommand(&CmdOptions{Shell: "/bin/sh", Command: "new"}, CmdStatus{}, time.Now())
+
+	segments, err := filepath.Glob(a.AuditLog + ".*.gz")
+	if err != nil || len(segments) != 1 {
+		t.Fatalf("got segments %v, %v, want 1", segments, err)
+	}
+	f, err := os.Open(segments[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rotated []string
+	sc := bufio.NewScanner(zr)
+	for sc.Scan() {
+		rotated = append(rotated, sc.Text())
+	}
+
+	prev, err := verifyAuditChain(key, rotated, "")
+	if err != nil {
+		t.Fatal("rotated segment:", err)
+	}
+	lines := readAuditLines(t, a.AuditLog)
+	if _, err := verifyAuditChain(key, lines, prev); err != nil {
+		t.Fatal("new log:", err)
+	}
+	var first AuditRecord
+	json.Unmarshal([]byte(lines[0]), &first)
+	if first.Segment != filepath.Base(segments[0]) {
+		t.Errorf("first record names segment %q, want %q", first.Segment, filepath.Base(segments[0]))
+	}
+	if len(lines) != 2 {
+		t.Errorf("new log has %d records, want 2", len(lines))
+	}
+}
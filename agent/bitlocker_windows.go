@@ -0,0 +1,161 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/StackExchange/wmi"
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+const bitlockerNamespace = `root\CIMV2\Security\MicrosoftVolumeEncryption`
+
+// numerical password key protectors, the 48 digit recovery passwords
+const bitlockerRecoveryPassword = 3
+
+var bitlockerConversionStatus = map[uint32]string{
+	0: "fully decrypted",
+	1: "fully encrypted",
+	2: "encrypting",
+	3: "decrypting",
+	4: "encryption paused",
+	5: "decryption paused",
+}
+
+var bitlockerMethods = map[uint32]string{
+	0: "none",
+	1: "AES 128 with diffuser",
+	2: "AES 256 with diffuser",
+	3: "AES 128",
+	4: "AES 256",
+	5: "hardware",
+	6: "XTS-AES 128",
+	7: "XTS-AES 256",
+}
+
+type encryptableVolume struct {
+	DeviceID         string
+	DriveLetter      string
+	ProtectionStatus uint32
+	ConversionStatus uint32
+	EncryptionMethod uint32
+}
+
+func bitlockerVolumes() ([]encryptableVolume, error) {
+	var dst []encryptableVolume
+	q := "SELECT DeviceID, DriveLetter, ProtectionStatus, ConversionStatus, EncryptionMethod FROM Win32_EncryptableVolume"
+	if err := wmi.QueryNamespace(q, &dst, bitlockerNamespace); err != nil {
+		// home editions don't have the namespace at all
+		if strings.Contains(strings.ToLower(err.Error()), "invalid namespace") {
+			return nil, ErrNoBitLocker
+		}
+		return nil, err
+	}
+	return dst, nil
+}
+
+func encryptableVolumePath(deviceID string) string {
+	return fmt.Sprintf("Win32_EncryptableVolume.DeviceID='%s'", strings.ReplaceAll(deviceID, `\`, `\\`))
+}
+
+// GetBitLockerStatus returns the bitlocker state of every encryptable volume
+func (a *Agent) GetBitLockerStatus() ([]rmm.VolumeEncryption, error) {
+	ret := make([]rmm.VolumeEncryption, 0)
+	vols, err := bitlockerVolumes()
+	if err != nil {
+		return ret, err
+	}
+
+	for _, v := range vols {
+		name := v.DriveLetter
+		if name == "" {
+			name = v.DeviceID
+		}
+		status, ok := bitlockerConversionStatus[v.ConversionStatus]
+		if !ok {
+			status = fmt.Sprintf("unknown (%d)", v.ConversionStatus)
+		}
+		method, ok := bitlockerMethods[v.EncryptionMethod]
+		if !ok {
+			method = fmt.Sprintf("unknown (%d)", v.EncryptionMethod)
+		}
+		unlocked := true
+		if out, err := execWMIMethod(bitlockerNamespace, encryptableVolumePath(v.DeviceID), "GetLockStatus", nil, "LockStatus"); err == nil {
+			unlocked = out["LockStatus"] != nil && fmt.Sprint(out["LockStatus"]) == "0"
+		}
+		ret = append(ret, rmm.VolumeEncryption{
+			Volume:    name,
+			Type:      "bitlocker",
+			Encrypted: v.ConversionStatus != 0,
+			Status:    status,
+			Method:    method,
+			Protected: v.ProtectionStatus == 1,
+			Unlocked:  unlocked,
+		})
+	}
+	return ret, nil
+}
+
+// BackupBitLockerKey escrows the recovery passwords of every encrypted volume with the rmm
+func (a *Agent) BackupBitLockerKey() error {
+	vols, err := bitlockerVolumes()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]rmm.BitLockerKey, 0)
+	for _, v := range vols {
+		if v.ConversionStatus == 0 {
+			continue
+		}
+		path := encryptableVolumePath(v.DeviceID)
+		out, err := execWMIMethod(bitlockerNamespace, path, "GetKeyProtectors", map[string]interface{}{"KeyProtectorType": bitlockerRecoveryPassword}, "VolumeKeyProtectorID")
+		if err != nil {
+			a.Logger.Debugln("BackupBitLockerKey() GetKeyProtectors:", err)
+			continue
+		}
+		ids, _ := out["VolumeKeyProtectorID"].([]string)
+		for _, id := range ids {
+			pw, err := execWMIMethod(bitlockerNamespace, path, "GetKeyProtectorNumericalPassword", map[string]interface{}{"VolumeKeyProtectorID": id}, "NumericalPassword")
+			if err != nil {
+				a.Logger.Debugln("BackupBitLockerKey() GetKeyProtectorNumericalPassword:", err)
+				continue
+			}
+			password, _ := pw["NumericalPassword"].(string)
+			name := v.DriveLetter
+			if name == "" {
+				name = v.DeviceID
+			}
+			keys = append(keys, rmm.BitLockerKey{Volume: name, ProtectorID: id, RecoveryPassword: password})
+		}
+	}
+	if len(keys) == 0 {
+		return errors.New("no bitlocker recovery passwords found")
+	}
+
+	// a separate client so debug logging never writes the recovery passwords to the log
+	client := a.newRestyClient(15 * time.Second)
+	client.SetDebug(false)
+	payload := map[string]interface{}{"agent_id": a.agentID(), "keys": keys}
+	r, err := client.R().SetBody(payload).Post(fmt.Sprintf("/api/v3/%s/bitlocker/", a.agentID()))
+	if err != nil {
+		return err
+	}
+	if r.IsError() {
+		return fmt.Errorf("bitlocker response code: %v", r.StatusCode())
+	}
+	return nil
+}
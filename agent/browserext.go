@@ -0,0 +1,244 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// browserRoot is where a browser keeps its profiles for one user, kind is chromium or firefox
+type browserRoot struct {
+	browser string
+	kind    string
+	dir     string
+}
+
+// userProfile is a user's home dir, from the platform's user list
+type userProfile struct {
+	user string
+	home string
+}
+
+// GetBrowserExtensions returns the extensions installed in every chromium based browser and firefox profile of every user
+// Browsers that aren't installed or a profile that can't be read are skipped, the error is only for not finding any users
+func (a *Agent) GetBrowserExtensions() ([]rmm.BrowserExtension, error) {
+	ret := make([]rmm.BrowserExtension, 0)
+	users, err := userProfiles()
+	if err != nil {
+		return ret, err
+	}
+
+	for _, u := range users {
+		for _, root := range browserRoots(u.home) {
+			var exts []rmm.BrowserExtension
+			switch root.kind {
+			case "chromium":
+				exts = chromiumExtensions(root.dir)
+			case "firefox":
+				exts = firefoxExtensions(root.dir)
+			}
+			for _, e := range exts {
+				e.User = u.user
+				e.Browser = root.browser
+				ret = append(ret, e)
+			}
+		}
+	}
+	return ret, nil
+}
+
+type chromiumManifest struct {
+	Name            string        `json:"name"`
+	Version         string        `json:"version"`
+	DefaultLocale   string        `json:"default_locale"`
+	Permissions     []interface{} `json:"permissions"`
+	HostPermissions []string      `json:"host_permissions"`
+}
+
+// chromiumExtensions reads Extensions/<id>/<version>/manifest.json in each profile (Default, Profile 1...)
+func chromiumExtensions(userData string) []rmm.BrowserExtension {
+	ret := make([]rmm.BrowserExtension, 0)
+	profiles, _ := filepath.Glob(filepath.Join(userData, "*", "Extensions"))
+	for _, extDir := range profiles {
+		profile := filepath.Base(filepath.Dir(extDir))
+		disabled := chromiumDisabled(filepath.Dir(extDir))
+		ids, err := os.ReadDir(extDir)
+		if err != nil {
+			continue
+		}
+		for _, id := range ids {
+			if !id.IsDir() || id.Name() == "Temp" {
+				continue
+			}
+			versions, err := os.ReadDir(filepath.Join(extDir, id.Name()))
+			if err != nil || len(versions) == 0 {
+				continue
+			}
+			// an update leaves the old version dir until the browser restarts, the last one is newest
+			names := make([]string, 0, len(versions))
+			for _, v := range versions {
+				if v.IsDir() {
+					names = append(names, v.Name())
+				}
+			}
+			if len(names) == 0 {
+				continue
+			}
+			sort.Strings(names)
+			dir := filepath.Join(extDir, id.Name(), names[len(names)-1])
+
+			b, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+			if err != nil {
+				continue
+			}
+			var m chromiumManifest
+			if err := json.Unmarshal(b, &m); err != nil {
+				continue
+			}
+			perms := make([]string, 0, len(m.Permissions)+len(m.HostPermissions))
+			for _, p := range m.Permissions {
+				// manifest v2 allows objects here, e.g. {"fileSystem": ["write"]}
+				if s, ok := p.(string); ok {
+					perms = append(perms, s)
+				}
+			}
+			perms = append(perms, m.HostPermissions...)
+			ret = append(ret, rmm.BrowserExtension{
+				ID:          id.Name(),
+				Name:        chromiumMessage(dir, m.DefaultLocale, m.Name),
+				Version:     m.Version,
+				Profile:     profile,
+				Permissions: perms,
+				Enabled:     !disabled[id.Name()],
+			})
+		}
+	}
+	return ret
+}
+
+// chromiumDisabled returns the extensions turned off in a profile, the state is in Secure Preferences or
+// Preferences depending on the browser and version, newer versions only set disable_reasons
+func chromiumDisabled(profileDir string) map[string]bool {
+	ret := make(map[string]bool)
+	for _, name := range []string{"Preferences", "Secure Preferences"} {
+		b, err := os.ReadFile(filepath.Join(profileDir, name))
+		if err != nil {
+			continue
+		}
+		var prefs struct {
+			Extensions struct {
+				Settings map[string]struct {
+					State *int `json:"state"`
+					// a bitmask in older versions, a list in newer ones
+					DisableReasons interface{} `json:"disable_reasons"`
+				} `json:"settings"`
+			} `json:"extensions"`
+		}
+		if err := json.Unmarshal(b, &prefs); err != nil {
+			continue
+		}
+		for id, s := range prefs.Extensions.Settings {
+			disabled := s.State != nil && *s.State == 0
+			switch r := s.DisableReasons.(type) {
+			case float64:
+				disabled = disabled || r != 0
+			case []interface{}:
+				disabled = disabled || len(r) > 0
+			}
+			if disabled {
+				ret[id] = true
+			}
+		}
+	}
+	return ret
+}
+
+// chromiumMessage resolves a __MSG_name__ placeholder from the extension's default locale
+func chromiumMessage(dir, locale, s string) string {
+	if !strings.HasPrefix(s, "__MSG_") || !strings.HasSuffix(s, "__") || locale == "" {
+		return s
+	}
+	key := strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(s, "__MSG_"), "__"))
+	b, err := os.ReadFile(filepath.Join(dir, "_locales", locale, "messages.json"))
+	if err != nil {
+		return s
+	}
+	var msgs map[string]struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(b, &msgs); err != nil {
+		return s
+	}
+	// keys are case insensitive
+	for k, v := range msgs {
+		if strings.ToLower(k) == key && v.Message != "" {
+			return v.Message
+		}
+	}
+	return s
+}
+
+type firefoxAddons struct {
+	Addons []struct {
+		ID            string `json:"id"`
+		Version       string `json:"version"`
+		Type          string `json:"type"`
+		Location      string `json:"location"`
+		Active        bool   `json:"active"`
+		DefaultLocale struct {
+			Name string `json:"name"`
+		} `json:"defaultLocale"`
+		UserPermissions struct {
+			Permissions []string `json:"permissions"`
+			Origins     []string `json:"origins"`
+		} `json:"userPermissions"`
+	} `json:"addons"`
+}
+
+// firefoxExtensions reads extensions.json in each profile, skipping the add-ons built into firefox
+func firefoxExtensions(profilesDir string) []rmm.BrowserExtension {
+	ret := make([]rmm.BrowserExtension, 0)
+	files, _ := filepath.Glob(filepath.Join(profilesDir, "*", "extensions.json"))
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		var addons firefoxAddons
+		if err := json.Unmarshal(b, &addons); err != nil {
+			continue
+		}
+		for _, ad := range addons.Addons {
+			if ad.Type != "extension" || strings.HasPrefix(ad.Location, "app-") {
+				continue
+			}
+			perms := make([]string, 0)
+			perms = append(perms, ad.UserPermissions.Permissions...)
+			perms = append(perms, ad.UserPermissions.Origins...)
+			ret = append(ret, rmm.BrowserExtension{
+				ID:          ad.ID,
+				Name:        ad.DefaultLocale.Name,
+				Version:     ad.Version,
+				Profile:     filepath.Base(filepath.Dir(f)),
+				Permissions: perms,
+				Enabled:     ad.Active,
+			})
+		}
+	}
+	return ret
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// userProfiles returns root and regular users that have a home dir
+func userProfiles() ([]userProfile, error) {
+	entries, err := readColonFile("/etc/passwd")
+	if err != nil {
+		return nil, err
+	}
+	min := uidMin()
+	ret := make([]userProfile, 0)
+	for _, e := range entries {
+		if len(e) < 6 {
+			continue
+		}
+		uid, err := strconv.Atoi(e[2])
+		if err != nil || (uid != 0 && uid < min) {
+			continue
+		}
+		if fi, err := os.Stat(e[5]); err == nil && fi.IsDir() {
+			ret = append(ret, userProfile{user: e[0], home: e[5]})
+		}
+	}
+	return ret, nil
+}
+
+func browserRoots(home string) []browserRoot {
+	return []browserRoot{
+		{"Chrome", "chromium", filepath.Join(home, ".config", "google-chrome")},
+		{"Chromium", "chromium", filepath.Join(home, ".config", "chromium")},
+		{"Chromium", "chromium", filepath.Join(home, "snap", "chromium", "common", "chromium")},
+		{"Edge", "chromium", filepath.Join(home, ".config", "microsoft-edge")},
+		{"Brave", "chromium", filepath.Join(home, ".config", "BraveSoftware", "Brave-Browser")},
+		{"Firefox", "firefox", filepath.Join(home, ".mozilla", "firefox")},
+		{"Firefox", "firefox", filepath.Join(home, "snap", "firefox", "common", ".mozilla", "firefox")},
+	}
+}
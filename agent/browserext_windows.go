@@ -0,0 +1,65 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// userProfiles returns the profile dirs of local and domain users that have logged on, from the ProfileList
+func userProfiles() ([]userProfile, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows NT\CurrentVersion\ProfileList`, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+
+	sids, err := k.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]userProfile, 0)
+	for _, sid := range sids {
+		// S-1-5-18 to 20 are the system and service accounts
+		if !strings.HasPrefix(sid, "S-1-5-21-") {
+			continue
+		}
+		sk, err := registry.OpenKey(k, sid, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		path, _, err := sk.GetStringValue("ProfileImagePath")
+		sk.Close()
+		if err != nil {
+			continue
+		}
+		path, _ = registry.ExpandString(path)
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			ret = append(ret, userProfile{user: filepath.Base(path), home: path})
+		}
+	}
+	return ret, nil
+}
+
+func browserRoots(home string) []browserRoot {
+	local := filepath.Join(home, "AppData", "Local")
+	return []browserRoot{
+		{"Chrome", "chromium", filepath.Join(local, "Google", "Chrome", "User Data")},
+		{"Edge", "chromium", filepath.Join(local, "Microsoft", "Edge", "User Data")},
+		{"Brave", "chromium", filepath.Join(local, "BraveSoftware", "Brave-Browser", "User Data")},
+		{"Firefox", "firefox", filepath.Join(home, "AppData", "Roaming", "Mozilla", "Firefox", "Profiles")},
+	}
+}
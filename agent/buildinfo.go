@@ -0,0 +1,44 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// set at build time with -ldflags "-X ...", see the README
+var (
+	BuildRevision string
+	BuildTime     string
+)
+
+// GetBuildInfo returns what's known about how this binary was built
+// Fields are left empty when the build info was stripped or the ldflags weren't set
+func (a *Agent) GetBuildInfo() rmm.BuildInfo {
+	ret := rmm.BuildInfo{
+		AgentVersion: a.Version,
+		GoVersion:    runtime.Version(),
+		Platform:     runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		Revision:     BuildRevision,
+		BuildTime:    BuildTime,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		ret.Module = bi.Main.Path
+		// (devel) for a plain go build, a real version when built with go install module@version
+		ret.ModuleVersion = bi.Main.Version
+	}
+	return ret
+}
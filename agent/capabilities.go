@@ -0,0 +1,50 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import "runtime"
+
+// GetCapabilities returns the optional features this agent build supports on this platform
+// so the rmm can avoid sending commands the agent can't handle
+func (a *Agent) GetCapabilities() map[string]bool {
+	windows := runtime.GOOS == "windows"
+	linux := runtime.GOOS == "linux"
+	return map[string]bool{
+		"custom_ca":           true,
+		"mtls":                false,
+		"nats_websocket":      false,
+		"token_rotation":      true,
+		"signed_payloads":     true,
+		"health_check":        true,
+		"diagnostics_bundle":  true,
+		"maintenance_window":  true,
+		"command_policy":      true,
+		"tail_file":           true,
+		"scheduled_reboot":    true,
+		"mesh_repair":         windows,
+		"software_inventory":  windows,
+		"windows_updates":     windows,
+		"linux_updates":       linux,
+		"journal_logs":        linux,
+		"event_logs":          windows,
+		"services":            windows,
+		"scheduled_tasks":     windows,
+		"power_plan":          windows,
+		"defender_exclusions": windows,
+		"chocolatey":          windows,
+		"removable_devices":   windows || linux,
+		"tpm":                 windows || linux,
+		"kill_process_tree":   windows || linux,
+		"structured_results":  true,
+		"clone_detection":     true,
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"crypto/tls"
+	"fmt"
+	"math"
+	"net"
+	"time"
+)
+
+const certCheckTimeout = 10 * time.Second
+
+// CheckCertExpiry connects to addr (host:port) and reports when the leaf certificate expires
+// The chain isn't verified so self-signed and internal certs still report.
+// Errors wrap ErrCertConnect when nothing answered and ErrCertHandshake when tls failed
+func (a *Agent) CheckCertExpiry(addr string) (notAfter time.Time, daysLeft int, err error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	dialer := &net.Dialer{Timeout: certCheckTimeout}
+	rawConn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("%w: %v", ErrCertConnect, err)
+	}
+	defer rawConn.Close()
+
+	conn := tls.Client(rawConn, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+	})
+	conn.SetDeadline(time.Now().Add(certCheckTimeout))
+	if err := conn.Handshake(); err != nil {
+		return time.Time{}, 0, fmt.Errorf("%w: %v", ErrCertHandshake, err)
+	}
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return time.Time{}, 0, fmt.Errorf("%w: no certificate presented", ErrCertHandshake)
+	}
+
+	notAfter = certs[0].NotAfter
+	// negative once expired
+	daysLeft = int(math.Floor(time.Until(notAfter).Hours() / 24))
+	return notAfter, daysLeft, nil
+}
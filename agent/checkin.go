@@ -16,25 +16,34 @@ import (
 	"runtime"
 	"time"
 
+	rmm "github.com/amidaware/rmmagent/shared"
 	nats "github.com/nats-io/nats.go"
 	"github.com/ugorji/go/codec"
 	trmm "github.com/wh1te909/trmm-shared"
 )
 
 func (a *Agent) NatsMessage(nc *nats.Conn, mode string) {
+	if a.checkinDisabled(mode) {
+		a.Logger.Debugln("NatsMessage(): skipping disabled checkin", mode)
+		return
+	}
+
 	var resp []byte
 	var payload interface{}
 	ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
 
 	switch mode {
 	case "agent-hello":
-		payload = trmm.CheckInNats{
-			Agentid: a.AgentID,
-			Version: a.Version,
+		payload = rmm.CheckInNats{
+			CheckInNats: trmm.CheckInNats{
+				Agentid: a.agentID(),
+				Version: a.Version,
+			},
+			Capabilities: a.GetCapabilities(),
 		}
 	case "agent-winsvc":
 		payload = trmm.WinSvcNats{
-			Agentid: a.AgentID,
+			Agentid: a.agentID(),
 			WinSvcs: a.GetServices(),
 		}
 	case "agent-agentinfo":
@@ -43,51 +52,147 @@ func (a *Agent) NatsMessage(nc *nats.Conn, mode string) {
 		if err != nil {
 			reboot = false
 		}
-		payload = trmm.AgentInfoNats{
-			Agentid:      a.AgentID,
-			Username:     a.LoggedOnUser(),
-			Hostname:     a.Hostname,
-			OS:           osinfo,
-			Platform:     runtime.GOOS,
-			TotalRAM:     a.TotalRAM(),
-			BootTime:     a.BootTime(),
-			RebootNeeded: reboot,
-			GoArch:       a.GoArch,
+		info := rmm.AgentInfoNats{
+			AgentInfoNats: trmm.AgentInfoNats{
+				Agentid:      a.agentID(),
+				Username:     a.LoggedOnUser(),
+				Hostname:     a.Hostname,
+				OS:           osinfo,
+				Platform:     runtime.GOOS,
+				TotalRAM:     a.TotalRAM(),
+				BootTime:     a.BootTime(),
+				RebootNeeded: reboot,
+				GoArch:       a.GoArch,
+			},
+		}
+		if offset, err := a.ServerTimeOffset(); err == nil {
+			info.ClockOffset = offset.Seconds()
+		} else {
+			a.Logger.Debugln("ServerTimeOffset():", err)
 		}
+		info.Build = a.GetBuildInfo()
+		if elevated, err := a.IsElevated(); err == nil {
+			info.Elevated = elevated
+		} else {
+			a.Logger.Debugln("IsElevated():", err)
+		}
+		if started, restarts, err := a.GetAgentRuntime(); err == nil {
+			info.AgentStarted = started.Unix()
+			info.RestartCount = restarts
+		} else {
+			a.Logger.Debugln("GetAgentRuntime():", err)
+		}
+		payload = info
 	case "agent-wmi":
 		payload = trmm.WinWMINats{
-			Agentid: a.AgentID,
+			Agentid: a.agentID(),
 			WMI:     a.GetWMIInfo(),
 		}
 	case "agent-disks":
 		payload = trmm.WinDisksNats{
-			Agentid: a.AgentID,
+			Agentid: a.agentID(),
 			Disks:   a.GetDisks(),
 		}
 	case "agent-publicip":
 		payload = trmm.PublicIPNats{
-			Agentid:  a.AgentID,
+			Agentid:  a.agentID(),
 			PublicIP: a.PublicIP(),
 		}
 	}
 
 	a.Logger.Debugln(mode, payload)
 	ret.Encode(payload)
-	nc.PublishRequest(a.AgentID, mode, resp)
+	if err := nc.PublishRequest(a.agentID(), mode, resp); err != nil {
+		a.Logger.Debugln("NatsMessage():", mode, err)
+		return
+	}
+	markCheckin()
 }
 
 func (a *Agent) DoNatsCheckIn() {
+	if err := a.RunStartupTasks(); err != nil {
+		a.Logger.Errorln(err)
+	}
+}
+
+// checkinModes returns the natsCheckin set that applies to this platform
+func (a *Agent) checkinModes() []string {
+	if runtime.GOOS == "windows" {
+		return natsCheckin
+	}
+	modes := make([]string, 0, len(natsCheckin))
+	for _, m := range natsCheckin {
+		if m == "agent-winsvc" {
+			continue
+		}
+		modes = append(modes, m)
+	}
+	return modes
+}
+
+// RunStartupTasks runs the full checkin set once and waits for it to be delivered
+// so a freshly installed agent shows complete data right away
+func (a *Agent) RunStartupTasks() error {
 	opts := a.setupNatsOptions()
-	server := fmt.Sprintf("tls://%s:4222", a.ApiURL)
+	server := fmt.Sprintf("tls://%s:4222", a.apiURL())
 	nc, err := nats.Connect(server, opts...)
 	if err != nil {
-		a.Logger.Errorln(err)
-		return
+		return fmt.Errorf("RunStartupTasks() nats.Connect(): %w", err)
 	}
+	defer nc.Close()
 
-	for _, s := range natsCheckin {
+	for _, s := range a.checkinModes() {
 		time.Sleep(time.Duration(randRange(100, 400)) * time.Millisecond)
 		a.NatsMessage(nc, s)
+		a.Logger.Debugln("RunStartupTasks() sent", s)
+	}
+
+	if err := nc.FlushTimeout(30 * time.Second); err != nil {
+		return fmt.Errorf("RunStartupTasks() flush: %w", err)
+	}
+	if err := nc.LastError(); err != nil {
+		return fmt.Errorf("RunStartupTasks(): %w", err)
+	}
+	a.Logger.Infoln("Startup checkin complete")
+	return nil
+}
+
+// NetChangeWatcher triggers a publicip and agentinfo checkin when the network changes
+// Events are debounced so a flapping interface or vpn doesn't spam checkins
+func (a *Agent) NetChangeWatcher(sess *natsSession) {
+	events, err := netChangeNotifier()
+	if err != nil {
+		a.Logger.Errorln("NetChangeWatcher():", err)
+		return
+	}
+
+	const (
+		settle      = 15 * time.Second
+		minInterval = 2 * time.Minute
+	)
+
+	var lastCheckin time.Time
+	timer := time.NewTimer(settle)
+	timer.Stop()
+
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				a.Logger.Debugln("NetChangeWatcher(): notifier closed")
+				return
+			}
+			a.Logger.Debugln("Network change detected")
+			timer.Reset(settle)
+		case <-timer.C:
+			if since := time.Since(lastCheckin); since < minInterval {
+				timer.Reset(minInterval - since)
+				continue
+			}
+			lastCheckin = time.Now()
+			nc := sess.Conn()
+			a.NatsMessage(nc, "agent-publicip")
+			a.NatsMessage(nc, "agent-agentinfo")
+		}
 	}
-	nc.Close()
 }
@@ -15,7 +15,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -48,7 +50,7 @@ func (a *Agent) CheckRunner() {
 }
 
 func (a *Agent) GetCheckInterval() (int, error) {
-	r, err := a.rClient.R().SetResult(&rmm.CheckInfo{}).Get(fmt.Sprintf("/api/v3/%s/checkinterval/", a.AgentID))
+	r, err := a.rClient.R().SetResult(&rmm.CheckInfo{}).Get(fmt.Sprintf("/api/v3/%s/checkinterval/", a.agentID()))
 	if err != nil {
 		a.Logger.Debugln(err)
 		return 120, err
@@ -65,9 +67,9 @@ func (a *Agent) RunChecks(force bool) error {
 	data := rmm.AllChecks{}
 	var url string
 	if force {
-		url = fmt.Sprintf("/api/v3/%s/runchecks/", a.AgentID)
+		url = fmt.Sprintf("/api/v3/%s/runchecks/", a.agentID())
 	} else {
-		url = fmt.Sprintf("/api/v3/%s/checkrunner/", a.AgentID)
+		url = fmt.Sprintf("/api/v3/%s/checkrunner/", a.agentID())
 	}
 	r, err := a.rClient.R().Get(url)
 	if err != nil {
@@ -169,18 +171,23 @@ type ScriptCheckResult struct {
 // ScriptCheck runs either bat, powershell or python script
 func (a *Agent) ScriptCheck(data rmm.Check, r *resty.Client) {
 	start := time.Now()
-	stdout, stderr, retcode, _ := a.RunScript(data.Script.Code, data.Script.Shell, data.ScriptArgs, data.Timeout)
+	so := ScriptOptions{Initiator: "check", Suppressible: true}
+	stdout, stderr, retcode, err := a.RunScriptWith(data.Script.Code, data.Script.Shell, data.ScriptArgs, data.Timeout, so)
+	if err == ErrMaintenanceMode {
+		a.Logger.Debugln("ScriptCheck:", err)
+		return
+	}
 
 	payload := ScriptCheckResult{
 		ID:      data.CheckPK,
-		AgentID: a.AgentID,
+		AgentID: a.agentID(),
 		Stdout:  stdout,
 		Stderr:  stderr,
 		Retcode: retcode,
 		Runtime: time.Since(start).Seconds(),
 	}
 
-	_, err := r.R().SetBody(payload).Patch("/api/v3/checkrunner/")
+	_, err = r.R().SetBody(payload).Patch("/api/v3/checkrunner/")
 	if err != nil {
 		a.Logger.Debugln(err)
 	}
@@ -204,7 +211,7 @@ type DiskCheckResult struct {
 // DiskCheck checks disk usage
 func (a *Agent) DiskCheck(data rmm.Check) (payload DiskCheckResult) {
 	payload.ID = data.CheckPK
-	payload.AgentID = a.AgentID
+	payload.AgentID = a.agentID()
 
 	usage, err := disk.Usage(data.Disk)
 	if err != nil {
@@ -228,7 +235,7 @@ type CPUMemResult struct {
 
 // CPULoadCheck checks avg cpu load
 func (a *Agent) CPULoadCheck(data rmm.Check, r *resty.Client) {
-	payload := CPUMemResult{ID: data.CheckPK, AgentID: a.AgentID, Percent: a.GetCPULoadAvg()}
+	payload := CPUMemResult{ID: data.CheckPK, AgentID: a.agentID(), Percent: a.GetCPULoadAvg()}
 	_, err := r.R().SetBody(payload).Patch("/api/v3/checkrunner/")
 	if err != nil {
 		a.Logger.Debugln(err)
@@ -241,7 +248,7 @@ func (a *Agent) MemCheck(data rmm.Check, r *resty.Client) {
 	mem, _ := host.Memory()
 	percent := (float64(mem.Used) / float64(mem.Total)) * 100
 
-	payload := CPUMemResult{ID: data.CheckPK, AgentID: a.AgentID, Percent: int(math.Round(percent))}
+	payload := CPUMemResult{ID: data.CheckPK, AgentID: a.agentID(), Percent: int(math.Round(percent))}
 	_, err := r.R().SetBody(payload).Patch("/api/v3/checkrunner/")
 	if err != nil {
 		a.Logger.Debugln(err)
@@ -305,7 +312,7 @@ func (a *Agent) EventLogCheck(data rmm.Check, r *resty.Client) {
 		}
 	}
 
-	payload := EventLogCheckResult{ID: data.CheckPK, AgentID: a.AgentID, Log: log}
+	payload := EventLogCheckResult{ID: data.CheckPK, AgentID: a.agentID(), Log: log}
 	_, err := r.R().SetBody(payload).Patch("/api/v3/checkrunner/")
 	if err != nil {
 		a.Logger.Debugln(err)
@@ -321,7 +328,7 @@ func (a *Agent) SendPingCheckResult(payload rmm.PingCheckResponse, r *resty.Clie
 
 func (a *Agent) PingCheck(data rmm.Check) (payload rmm.PingCheckResponse) {
 	payload.ID = data.CheckPK
-	payload.AgentID = a.AgentID
+	payload.AgentID = a.agentID()
 
 	out, err := DoPing(data.IP)
 	if err != nil {
@@ -352,7 +359,7 @@ func (a *Agent) SendWinSvcCheckResult(payload WinSvcCheckResult, r *resty.Client
 
 func (a *Agent) WinSvcCheck(data rmm.Check) (payload WinSvcCheckResult) {
 	payload.ID = data.CheckPK
-	payload.AgentID = a.AgentID
+	payload.AgentID = a.agentID()
 
 	status, err := GetServiceStatus(data.ServiceName)
 	if err != nil {
@@ -386,3 +393,122 @@ func (a *Agent) WinSvcCheck(data rmm.Check) (payload WinSvcCheckResult) {
 	}
 	return
 }
+
+const (
+	CheckPassing = "passing"
+	CheckWarning = "warning"
+	CheckError   = "error"
+)
+
+// CheckExpect describes what a command check's output should look like, unset fields are ignored
+type CheckExpect struct {
+	// exit code the command must return
+	ExitCode *int
+	// stdout must match this regex
+	Match *regexp.Regexp
+	// the first capture group (or whole match) is parsed as a number and compared against the thresholds with Op
+	Extract  *regexp.Regexp
+	Op       string // one of < <= > >= == !=
+	Warning  *float64
+	Critical *float64
+}
+
+type CheckResult struct {
+	Status  string
+	Message string
+	Value   float64
+	Retcode int
+	Stdout  string
+	Stderr  string
+}
+
+// RunCheck runs a command with CmdV2 and grades its output against expect
+func (a *Agent) RunCheck(c *CmdOptions, expect CheckExpect) CheckResult {
+	ret := a.CmdV2(c)
+	res := CheckResult{
+		Status:  CheckPassing,
+		Retcode: ret.Status.Exit,
+		Stdout:  ret.Stdout,
+		Stderr:  ret.Stderr,
+	}
+
+	if ret.Status.Error != nil {
+		res.Status = CheckError
+		res.Message = ret.Status.Error.Error()
+		return res
+	}
+
+	if expect.ExitCode != nil && ret.Status.Exit != *expect.ExitCode {
+		res.Status = CheckError
+		res.Message = fmt.Sprintf("exit code %d, expected %d", ret.Status.Exit, *expect.ExitCode)
+		return res
+	}
+
+	if expect.Match != nil && !expect.Match.MatchString(ret.Stdout) {
+		res.Status = CheckError
+		res.Message = fmt.Sprintf("output did not match %q", expect.Match.String())
+		return res
+	}
+
+	if expect.Extract == nil {
+		return res
+	}
+
+	m := expect.Extract.FindStringSubmatch(ret.Stdout)
+	if m == nil {
+		res.Status = CheckError
+		res.Message = fmt.Sprintf("no value matching %q in output", expect.Extract.String())
+		return res
+	}
+	raw := m[0]
+	if len(m) > 1 {
+		raw = m[1]
+	}
+	val, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil {
+		res.Status = CheckError
+		res.Message = fmt.Sprintf("could not parse %q as a number", raw)
+		return res
+	}
+	res.Value = val
+
+	for _, t := range []struct {
+		threshold *float64
+		status    string
+	}{{expect.Critical, CheckError}, {expect.Warning, CheckWarning}} {
+		if t.threshold == nil {
+			continue
+		}
+		hit, err := compareThreshold(val, expect.Op, *t.threshold)
+		if err != nil {
+			res.Status = CheckError
+			res.Message = err.Error()
+			return res
+		}
+		if hit {
+			res.Status = t.status
+			res.Message = fmt.Sprintf("value %v %s %v", val, expect.Op, *t.threshold)
+			return res
+		}
+	}
+	return res
+}
+
+// compareThreshold reports whether val op threshold holds
+func compareThreshold(val float64, op string, threshold float64) (bool, error) {
+	switch op {
+	case "<":
+		return val < threshold, nil
+	case "<=":
+		return val <= threshold, nil
+	case ">":
+		return val > threshold, nil
+	case ">=":
+		return val >= threshold, nil
+	case "==":
+		return val == threshold, nil
+	case "!=":
+		return val != threshold, nil
+	}
+	return false, fmt.Errorf("unknown comparison operator %q", op)
+}
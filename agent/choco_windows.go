@@ -21,7 +21,7 @@ import (
 func (a *Agent) InstallChoco() {
 
 	var result rmm.ChocoInstalled
-	result.AgentID = a.AgentID
+	result.AgentID = a.agentID()
 	result.Installed = false
 
 	rClient := resty.New()
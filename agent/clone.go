@@ -0,0 +1,91 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const fingerprintStateKey = "fingerprint"
+
+// hardwareFingerprint hashes the machine uuid and serial, which change when a vm is cloned
+func (a *Agent) hardwareFingerprint() (string, error) {
+	info, err := a.GetSystemInfo()
+	if err != nil {
+		return "", err
+	}
+	if info.UUID == "" && info.SerialNumber == "" {
+		return "", errors.New("no machine uuid or serial number available")
+	}
+	h := sha256.Sum256([]byte(strings.ToLower(info.UUID) + "|" + info.SerialNumber))
+	return hex.EncodeToString(h[:]), nil
+}
+
+// saveHardwareFingerprint records the current fingerprint, called at enrollment
+func (a *Agent) saveHardwareFingerprint() error {
+	fp, err := a.hardwareFingerprint()
+	if err != nil {
+		return err
+	}
+	return a.state.Set(fingerprintStateKey, fp)
+}
+
+// DetectClonedAgent compares the hardware fingerprint with the one recorded at enrollment
+// A mismatch means the agent was installed in an image that has since been cloned, so it shares its AgentID with another machine
+// Agents enrolled before fingerprints were recorded get one saved on the first call
+func (a *Agent) DetectClonedAgent() (bool, error) {
+	current, err := a.hardwareFingerprint()
+	if err != nil {
+		return false, err
+	}
+
+	var saved string
+	found, err := a.state.Get(fingerprintStateKey, &saved)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		return false, a.state.Set(fingerprintStateKey, current)
+	}
+
+	if saved == current {
+		return false, nil
+	}
+
+	a.Logger.Errorf("Hardware fingerprint has changed since enrollment, this machine appears to be a clone of another agent with ID %s. Reinstall the agent to give it its own ID\n", a.agentID())
+	return true, nil
+}
+
+// requestReenroll tells the rmm this agent is a clone so it can be re-enrolled under a new record
+func (a *Agent) requestReenroll() error {
+	fp, err := a.hardwareFingerprint()
+	if err != nil {
+		return err
+	}
+	payload := map[string]string{
+		"agent_id":    a.agentID(),
+		"hostname":    a.Hostname,
+		"fingerprint": fp,
+	}
+	r, err := a.rClient.R().SetBody(payload).Post(fmt.Sprintf("/api/v3/%s/reenroll/", a.agentID()))
+	if err != nil {
+		return err
+	}
+	if r.IsError() {
+		return fmt.Errorf("reenroll response code: %v", r.StatusCode())
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import "sync"
+
+// post command hooks run on one worker, commands finishing faster than the hooks can keep up are dropped past this
+const postCmdHookQueue = 100
+
+type postCmdHook func(c *CmdOptions, status CmdStatus)
+
+type postCmdJob struct {
+	opts   CmdOptions
+	status CmdStatus
+}
+
+type postCmdHooks struct {
+	sync.Mutex
+	fns   []postCmdHook
+	queue chan postCmdJob
+}
+
+// RegisterPostCmdHook adds a function that's called after every command CmdV2 runs
+// Hooks run one at a time in the background with a copy of the options and status, so they can't slow down
+// or change the result
+func (a *Agent) RegisterPostCmdHook(fn func(c *CmdOptions, status CmdStatus)) {
+	h := a.postCmdHooks
+	h.Lock()
+	defer h.Unlock()
+	h.fns = append(h.fns, fn)
+	if h.queue == nil {
+		h.queue = make(chan postCmdJob, postCmdHookQueue)
+		go a.postCmdHookWorker(h.queue)
+	}
+}
+
+// queuePostCmdHooks hands a finished command to the hook worker without waiting
+func (a *Agent) queuePostCmdHooks(c *CmdOptions, status CmdStatus) {
+	h := a.postCmdHooks
+	h.Lock()
+	queue := h.queue
+	h.Unlock()
+	if queue == nil {
+		return
+	}
+
+	opts := *c
+	opts.Args = append([]string(nil), c.Args...)
+	opts.RetryOnExitCodes = append([]int(nil), c.RetryOnExitCodes...)
+	select {
+	case queue <- postCmdJob{opts: opts, status: status}:
+	default:
+		a.Logger.Debugln("Post command hook queue is full, skipping hooks for", opts.Shell)
+	}
+}
+
+func (a *Agent) postCmdHookWorker(queue <-chan postCmdJob) {
+	for job := range queue {
+		a.postCmdHooks.Lock()
+		fns := append([]postCmdHook(nil), a.postCmdHooks.fns...)
+		a.postCmdHooks.Unlock()
+
+		for _, fn := range fns {
+			// each hook gets its own copy so one can't change what the next sees
+			opts := job.opts
+			a.runPostCmdHook(fn, &opts, job.status)
+		}
+	}
+}
+
+func (a *Agent) runPostCmdHook(fn postCmdHook, c *CmdOptions, status CmdStatus) {
+	defer func() {
+		if r := recover(); r != nil {
+			a.Logger.Errorln("Post command hook panicked:", r)
+		}
+	}()
+	fn(c, status)
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// CmdOptions.OutputPolicy values, what happens when OnLine falls OutputBuffer lines behind
+const (
+	// stop reading output until OnLine catches up, the command blocks once its pipe fills
+	OutputBlock = "block"
+	// throw away the oldest queued line, the command never waits but lines are lost
+	OutputDropOldest = "dropoldest"
+)
+
+const (
+	defaultOutputBuffer = 1000
+	// RunCmdStreamToServer posts at most this often so fast output doesn't turn into a request per line
+	streamFlushInterval = time.Second
+	// lines held while the server is slow or down, the oldest are dropped past this
+	streamMaxPending = 10000
+)
+
+type outputLine struct {
+	stderr bool
+	text   string
+}
+
+// lineQueue sits between the cmdV2 reader and a slow OnLine consumer so the reader never waits on it
+// unless the policy says to
+type lineQueue struct {
+	ch      chan outputLine
+	policy  string
+	dropped int
+	wg      sync.WaitGroup
+}
+
+func newLineQueue(c *CmdOptions) *lineQueue {
+	size := c.OutputBuffer
+	if size <= 0 {
+		size = defaultOutputBuffer
+	}
+	q := &lineQueue{ch: make(chan outputLine, size), policy: c.OutputPolicy}
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		for l := range q.ch {
+			c.OnLine(l.stderr, l.text)
+		}
+	}()
+	return q
+}
+
+// push is only called from the reader goroutine
+func (q *lineQueue) push(stderr bool, text string) {
+	l := outputLine{stderr: stderr, text: text}
+	if q.policy != OutputDropOldest {
+		q.ch <- l
+		return
+	}
+	for {
+		select {
+		case q.ch <- l:
+			return
+		default:
+		}
+		select {
+		case <-q.ch:
+			q.dropped++
+		default:
+		}
+	}
+}
+
+// close waits for the consumer to finish the queued lines and returns how many were dropped
+func (q *lineQueue) close() int {
+	close(q.ch)
+	q.wg.Wait()
+	return q.dropped
+}
+
+// RunCmdStreamToServer runs a command through CmdV2 and posts its output to endpoint in batches as it runs,
+// followed by a final post with Done set and the exit code. Batches that fail to send are kept and retried
+// with the next one, up to streamMaxPending lines. Posts are paced to UploadMaxBps like uploads, and the
+// output is only held until it's sent
+func (a *Agent) RunCmdStreamToServer(c *CmdOptions, endpoint string) error {
+	client := a.newRestyClient(30 * time.Second)
+	var limiter *rateLimiter
+	if a.UploadMaxBps > 0 {
+		limiter = newRateLimiter(a.UploadMaxBps)
+	}
+	c.DiscardOutput = true
+
+	var mu sync.Mutex
+	pending := make([]rmm.CmdStreamLine, 0)
+	dropped := 0
+	c.OnLine = func(stderr bool, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		pending = append(pending, rmm.CmdStreamLine{Stderr: stderr, Line: line})
+		if over := len(pending) - streamMaxPending; over > 0 {
+			pending = pending[over:]
+			dropped += over
+		}
+	}
+
+	seq := 0
+	// sends everything pending, on failure it's put back in front of anything that arrived meanwhile
+	flush := func(final *CmdStatus) error {
+		mu.Lock()
+		batch := rmm.CmdStreamChunk{AgentID: a.agentID(), Seq: seq, Lines: pending, Dropped: dropped}
+		pending = make([]rmm.CmdStreamLine, 0)
+		dropped = 0
+		mu.Unlock()
+
+		// put back on failure, the final status's own count is added again by the retry
+		requeueDropped := batch.Dropped
+		if final != nil {
+			batch.Done = true
+			batch.ExitCode = final.Status.Exit
+			batch.TimedOut = final.TimedOut
+			batch.Dropped += final.DroppedLines
+			if final.Status.Error != nil {
+				batch.Error = final.Status.Error.Error()
+			}
+		} else if len(batch.Lines) == 0 && batch.Dropped == 0 {
+			return nil
+		}
+
+		body, err := json.Marshal(batch)
+		if err != nil {
+			return err
+		}
+		if limiter != nil {
+			limiter.wait(len(body))
+		}
+		r, err := client.R().SetHeader("Content-Type", "application/json").SetBody(body).Post(endpoint)
+		if err == nil && r.IsError() {
+			err = fmt.Errorf("%s", r.Status())
+		}
+		if err != nil {
+			mu.Lock()
+			pending = append(batch.Lines, pending...)
+			dropped += requeueDropped
+			if over := len(pending) - streamMaxPending; over > 0 {
+				pending = pending[over:]
+				dropped += over
+			}
+			mu.Unlock()
+			return err
+		}
+		seq++
+		return nil
+	}
+
+	done := make(chan struct{})
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		ticker := time.NewTicker(streamFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := flush(nil); err != nil {
+					a.Logger.Debugln("RunCmdStreamToServer():", err)
+				}
+			}
+		}
+	}()
+
+	ret := a.CmdV2(c)
+	close(done)
+	<-flushed
+
+	var err error
+	for i := 0; i < 3; i++ {
+		if err = flush(&ret); err == nil {
+			return nil
+		}
+		time.Sleep(streamFlushInterval)
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	psnet "github.com/shirou/gopsutil/v3/net"
+)
+
+// GetAgentConnections returns the agent process's own tcp and udp sockets, each remote address is labelled
+// api, nats or proxy when it belongs to one of the configured servers so anything else stands out
+func (a *Agent) GetAgentConnections() ([]rmm.ConnInfo, error) {
+	ret := make([]rmm.ConnInfo, 0)
+	conns, err := psnet.ConnectionsPid("inet", int32(os.Getpid()))
+	if err != nil {
+		return ret, err
+	}
+
+	apiIPs := make(map[string]bool)
+	if u, err := url.Parse(a.baseURL()); err == nil {
+		addHostIPs(apiIPs, u.Hostname())
+	}
+	natsIPs := make(map[string]bool)
+	addHostIPs(natsIPs, a.apiURL())
+	proxyIPs := make(map[string]bool)
+	if u, err := url.Parse(a.Proxy); err == nil && a.Proxy != "" {
+		addHostIPs(proxyIPs, u.Hostname())
+	}
+
+	for _, c := range conns {
+		ci := rmm.ConnInfo{
+			Protocol: "tcp",
+			Local:    net.JoinHostPort(c.Laddr.IP, strconv.Itoa(int(c.Laddr.Port))),
+			State:    c.Status,
+		}
+		if c.Type == 2 {
+			ci.Protocol = "udp"
+		}
+		if c.Raddr.IP != "" {
+			ci.Remote = net.JoinHostPort(c.Raddr.IP, strconv.Itoa(int(c.Raddr.Port)))
+		}
+
+		ip := net.ParseIP(c.Raddr.IP)
+		switch {
+		case c.Raddr.IP == "":
+		case ip != nil && ip.IsLoopback():
+			ci.Endpoint = "local"
+		case natsIPs[ip.String()] && c.Raddr.Port == 4222:
+			ci.Endpoint = "nats"
+		case apiIPs[ip.String()]:
+			ci.Endpoint = "api"
+		case proxyIPs[ip.String()]:
+			ci.Endpoint = "proxy"
+		}
+		ret = append(ret, ci)
+	}
+	return ret, nil
+}
+
+func addHostIPs(ips map[string]bool, host string) {
+	if host == "" {
+		return
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		ips[ip.String()] = true
+		return
+	}
+	addrs, err := net.LookupHost(host)
+	if err != nil {
+		return
+	}
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil {
+			ips[ip.String()] = true
+		}
+	}
+}
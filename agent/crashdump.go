@@ -0,0 +1,87 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	gocmd "github.com/go-cmd/cmd"
+)
+
+// dumps are written by the kernel or wer after the process is gone, so give them a moment to show up
+const crashDumpWait = 10 * time.Second
+
+// CrashInfo describes a command that died from a crash rather than exiting
+type CrashInfo struct {
+	// signal or exception the process died with
+	Reason string
+	// core file or wer dump, empty if none was found
+	DumpPath string
+	// why DumpPath is empty, e.g. core dumps are disabled
+	Detail string
+}
+
+// collectCrash returns nil unless the command crashed
+func (a *Agent) collectCrash(st gocmd.Status) *CrashInfo {
+	reason, ok := crashReason(st)
+	if !ok {
+		return nil
+	}
+	ret := &CrashInfo{Reason: reason}
+	ret.DumpPath, ret.Detail = findCrashDump(st.PID, time.Unix(0, st.StartTs))
+	a.Logger.Debugf("Command crashed with %s, dump: %q %s\n", reason, ret.DumpPath, ret.Detail)
+	return ret
+}
+
+// waitForDump polls dir for a dump created since start, preferring one with pid in the name
+func waitForDump(dir string, pid int, start time.Time, match func(name string) bool) string {
+	deadline := time.Now().Add(crashDumpWait)
+	for {
+		if path := newestDump(dir, pid, start, match); path != "" {
+			return path
+		}
+		if time.Now().After(deadline) {
+			return ""
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func newestDump(dir string, pid int, start time.Time, match func(name string) bool) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	var newest string
+	var newestMod time.Time
+	for _, e := range entries {
+		if e.IsDir() || !match(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().Before(start) {
+			continue
+		}
+		if strings.Contains(e.Name(), "."+strconv.Itoa(pid)+".") {
+			return filepath.Join(dir, e.Name())
+		}
+		if info.ModTime().After(newestMod) {
+			newest, newestMod = filepath.Join(dir, e.Name()), info.ModTime()
+		}
+	}
+	return newest
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	gocmd "github.com/go-cmd/cmd"
+)
+
+// signals whose default action dumps core
+var coreSignals = []syscall.Signal{
+	syscall.SIGQUIT, syscall.SIGILL, syscall.SIGTRAP, syscall.SIGABRT,
+	syscall.SIGBUS, syscall.SIGFPE, syscall.SIGSEGV, syscall.SIGSYS,
+}
+
+func crashReason(st gocmd.Status) (string, bool) {
+	// go-cmd reports a signaled process as exit -1 with "signal: segmentation fault (core dumped)"
+	if st.Exit == -1 && st.Error != nil && strings.HasPrefix(st.Error.Error(), "signal: ") {
+		name := strings.TrimSuffix(strings.TrimPrefix(st.Error.Error(), "signal: "), " (core dumped)")
+		for _, sig := range coreSignals {
+			if sig.String() == name {
+				return name, true
+			}
+		}
+		return "", false
+	}
+	// a shell reports a crashed child as 128 + the signal number
+	if st.Exit > 128 {
+		for _, sig := range coreSignals {
+			if int(sig) == st.Exit-128 {
+				return sig.String(), true
+			}
+		}
+	}
+	return "", false
+}
+
+func findCrashDump(pid int, start time.Time) (string, string) {
+	// commands inherit the agent's limit
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_CORE, &lim); err == nil && lim.Cur == 0 {
+		return "", "core dumps are disabled, the core file size limit (ulimit -c) is 0"
+	}
+
+	pattern := readSysfs("/proc/sys/kernel", "core_pattern")
+	if pattern == "" {
+		return "", "core dumps are disabled, kernel.core_pattern is empty"
+	}
+
+	if strings.HasPrefix(pattern, "|") {
+		handler := filepath.Base(strings.Fields(strings.TrimPrefix(pattern, "|"))[0])
+		switch {
+		case strings.Contains(handler, "systemd-coredump"):
+			// core.<comm>.<uid>.<boot id>.<pid>.<timestamp>.zst
+			dir := "/var/lib/systemd/coredump"
+			path := waitForDump(dir, pid, start, func(name string) bool { return strings.HasPrefix(name, "core.") })
+			if path == "" {
+				return "", fmt.Sprintf("no core file in %s, check coredumpctl list", dir)
+			}
+			return path, ""
+		case strings.Contains(handler, "apport"):
+			dir := "/var/crash"
+			path := waitForDump(dir, pid, start, func(name string) bool { return strings.HasSuffix(name, ".crash") })
+			if path == "" {
+				return "", fmt.Sprintf("no crash report in %s, apport skips programs that aren't from a package", dir)
+			}
+			return path, ""
+		}
+		return "", fmt.Sprintf("core dumps are piped to %s, the dump can't be located", handler)
+	}
+
+	dir := filepath.Dir(pattern)
+	if !filepath.IsAbs(pattern) {
+		// relative patterns are written to the crashed process's working directory, the same as the agent's
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", err.Error()
+		}
+		dir = filepath.Join(cwd, dir)
+	}
+	prefix := filepath.Base(pattern)
+	if i := strings.Index(prefix, "%"); i >= 0 {
+		prefix = prefix[:i]
+	}
+	path := waitForDump(dir, pid, start, func(name string) bool { return strings.HasPrefix(name, prefix) })
+	if path == "" {
+		return "", fmt.Sprintf("no core file matching %s was written", pattern)
+	}
+	return path, ""
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gocmd "github.com/go-cmd/cmd"
+	"golang.org/x/sys/windows/registry"
+)
+
+const werLocalDumpsKey = `SOFTWARE\Microsoft\Windows\Windows Error Reporting\LocalDumps`
+
+var crashExceptions = map[uint32]string{
+	0xC0000005: "access violation",
+	0xC000001D: "illegal instruction",
+	0xC0000094: "integer divide by zero",
+	0xC00000FD: "stack overflow",
+	0xC0000374: "heap corruption",
+	0xC0000409: "stack buffer overrun",
+}
+
+func crashReason(st gocmd.Status) (string, bool) {
+	// unhandled exceptions exit with the ntstatus code, all of them have the error severity bits set
+	code := uint32(st.Exit)
+	if code&0xC0000000 != 0xC0000000 {
+		return "", false
+	}
+	if name, ok := crashExceptions[code]; ok {
+		return fmt.Sprintf("%s (%#x)", name, code), true
+	}
+	return fmt.Sprintf("exception %#x", code), true
+}
+
+func findCrashDump(pid int, start time.Time) (string, string) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, werLocalDumpsKey, registry.QUERY_VALUE)
+	if err != nil {
+		return "", fmt.Sprintf("WER local dumps are not enabled, create HKLM\\%s to collect crash dumps", werLocalDumpsKey)
+	}
+	defer k.Close()
+
+	// the default is the crashing user's local appdata, the agent's since commands run as the agent
+	dir := filepath.Join(os.Getenv("LOCALAPPDATA"), "CrashDumps")
+	if folder, _, err := k.GetStringValue("DumpFolder"); err == nil && folder != "" {
+		if expanded, err := registry.ExpandString(folder); err == nil {
+			folder = expanded
+		}
+		dir = folder
+	}
+
+	// <exe>.<pid>.dmp
+	path := waitForDump(dir, pid, start, func(name string) bool { return strings.HasSuffix(strings.ToLower(name), ".dmp") })
+	if path == "" {
+		return "", fmt.Sprintf("no crash dump was written to %s", dir)
+	}
+	return path, ""
+}
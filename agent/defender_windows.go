@@ -0,0 +1,80 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/StackExchange/wmi"
+	rmm "github.com/amidaware/rmmagent/shared"
+	"golang.org/x/sys/windows"
+)
+
+const defenderNamespace = `root\Microsoft\Windows\Defender`
+
+// MSFT_MpPreference properties for each exclusion kind
+var defenderExclusionProps = map[string]string{
+	"path":      "ExclusionPath",
+	"process":   "ExclusionProcess",
+	"extension": "ExclusionExtension",
+}
+
+// GetDefenderExclusions returns the windows defender path, process and extension exclusions
+func (a *Agent) GetDefenderExclusions() (rmm.DefenderExclusions, error) {
+	// non admins get a single "N/A: Must be an administrator to view exclusions" entry instead of an error
+	if !windows.GetCurrentProcessToken().IsElevated() {
+		return rmm.DefenderExclusions{}, ErrNotElevated
+	}
+
+	var dst []struct {
+		ExclusionPath      []string
+		ExclusionProcess   []string
+		ExclusionExtension []string
+	}
+	q := "SELECT ExclusionPath, ExclusionProcess, ExclusionExtension FROM MSFT_MpPreference"
+	if err := wmi.QueryNamespace(q, &dst, defenderNamespace); err != nil {
+		return rmm.DefenderExclusions{}, err
+	}
+
+	ret := rmm.DefenderExclusions{Paths: []string{}, Processes: []string{}, Extensions: []string{}}
+	if len(dst) > 0 {
+		if dst[0].ExclusionPath != nil {
+			ret.Paths = dst[0].ExclusionPath
+		}
+		if dst[0].ExclusionProcess != nil {
+			ret.Processes = dst[0].ExclusionProcess
+		}
+		if dst[0].ExclusionExtension != nil {
+			ret.Extensions = dst[0].ExclusionExtension
+		}
+	}
+	return ret, nil
+}
+
+// AddDefenderExclusion adds a windows defender exclusion, kind is one of path, process or extension
+// Same as Add-MpPreference, existing exclusions are kept
+func (a *Agent) AddDefenderExclusion(kind, value string) error {
+	prop, ok := defenderExclusionProps[strings.ToLower(kind)]
+	if !ok {
+		return fmt.Errorf("unknown exclusion type %q, must be path, process or extension", kind)
+	}
+	if value == "" {
+		return fmt.Errorf("exclusion %s is empty", kind)
+	}
+	if !windows.GetCurrentProcessToken().IsElevated() {
+		return ErrNotElevated
+	}
+
+	_, err := execWMIMethod(defenderNamespace, "MSFT_MpPreference", "Add", map[string]interface{}{prop: []string{value}})
+	return err
+}
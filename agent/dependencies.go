@@ -0,0 +1,121 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	trmm "github.com/wh1te909/trmm-shared"
+)
+
+// CheckDependencies verifies the binaries and directories the agent relies on so a broken install shows up before the first task fails
+func (a *Agent) CheckDependencies() rmm.DependencyReport {
+	deps := []rmm.DependencyStatus{
+		a.checkPythonDep(),
+		a.checkMeshDep(),
+	}
+	deps = append(deps, checkShellDeps()...)
+	deps = append(deps, checkTempDirDep())
+
+	ok := true
+	for _, d := range deps {
+		if !d.Passed {
+			ok = false
+			break
+		}
+	}
+	return rmm.DependencyReport{OK: ok, Dependencies: deps}
+}
+
+// logMissingDependencies runs CheckDependencies at startup and logs anything missing
+func (a *Agent) logMissingDependencies() {
+	for _, d := range a.CheckDependencies().Dependencies {
+		if !d.Passed {
+			a.Logger.Errorf("Missing dependency %s: %s\n", d.Name, d.Detail)
+		}
+	}
+}
+
+func (a *Agent) checkPythonDep() rmm.DependencyStatus {
+	ret := rmm.DependencyStatus{Name: "python", Path: a.PyBin}
+	if runtime.GOOS != "windows" {
+		ret.Passed = true
+		ret.Detail = "not used on this platform"
+		return ret
+	}
+	if !trmm.FileExists(a.PyBin) {
+		ret.Detail = a.PyBin + " does not exist"
+		return ret
+	}
+	// python 2 writes the version to stderr, runTool returns both
+	out, err := runTool(15*time.Second, a.PyBin, "--version")
+	if err != nil {
+		ret.Detail = err.Error()
+		return ret
+	}
+	ret.Passed = true
+	ret.Detail = out
+	return ret
+}
+
+func (a *Agent) checkMeshDep() rmm.DependencyStatus {
+	ret := rmm.DependencyStatus{Name: "mesh", Path: a.MeshSystemEXE}
+	if !trmm.FileExists(a.MeshSystemEXE) {
+		ret.Detail = a.MeshSystemEXE + " does not exist"
+		return ret
+	}
+	ret.Passed = true
+	ret.Detail = "installed"
+	return ret
+}
+
+func checkShellDeps() []rmm.DependencyStatus {
+	shells := []string{"bash"}
+	if runtime.GOOS == "windows" {
+		shells = []string{"cmd", "powershell"}
+	}
+
+	ret := make([]rmm.DependencyStatus, 0, len(shells))
+	for _, shell := range shells {
+		d := rmm.DependencyStatus{Name: shell}
+		path, err := exec.LookPath(shell)
+		if err != nil {
+			d.Detail = err.Error()
+		} else {
+			d.Path = path
+			d.Passed = true
+			d.Detail = "found"
+		}
+		ret = append(ret, d)
+	}
+	return ret
+}
+
+func checkTempDirDep() rmm.DependencyStatus {
+	dir := filepath.Join(os.TempDir(), "trmm")
+	ret := rmm.DependencyStatus{Name: "tempdir", Path: dir}
+	f, err := os.CreateTemp(dir, "deps")
+	if err != nil {
+		ret.Detail = err.Error()
+		return ret
+	}
+	f.Close()
+	os.Remove(f.Name())
+	ret.Passed = true
+	ret.Detail = "writable"
+	return ret
+}
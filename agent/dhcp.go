@@ -0,0 +1,35 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"net"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+func isIPv4(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.To4() != nil
+}
+
+// setLeaseTimes fills in the lease times, zero times are left blank
+func setLeaseTimes(lease *rmm.DHCPLease, obtained, expires time.Time) {
+	if !obtained.IsZero() && obtained.Year() > 1601 {
+		lease.Obtained = obtained.Local().Format("2006-01-02 15:04:05")
+	}
+	if !expires.IsZero() && expires.Year() > 1601 {
+		lease.Expires = expires.Local().Format("2006-01-02 15:04:05")
+		lease.Expired = time.Now().After(expires)
+	}
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetDHCPInfo returns the ipv4 dhcp lease of each interface from systemd-networkd, NetworkManager or dhclient
+// An interface with an address but no lease from any of them is reported as static, one with dhcp configured
+// but no lease yet has Method dhcp and no lease details
+func (a *Agent) GetDHCPInfo() ([]rmm.DHCPLease, error) {
+	ret := make([]rmm.DHCPLease, 0)
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ret, err
+	}
+
+	dhclient := dhclientLeases()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		lease := rmm.DHCPLease{Interface: iface.Name}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+					lease.Address = ipnet.IP.String()
+					break
+				}
+			}
+		}
+
+		found := networkdLease(iface.Index, &lease) || nmLease(iface.Name, &lease)
+		if !found {
+			if l, ok := dhclient[iface.Name]; ok {
+				l.Address = lease.Address
+				lease = l
+				found = true
+			}
+		}
+		switch {
+		case found:
+			lease.Method = "dhcp"
+		case lease.Method == "" && lease.Address != "":
+			lease.Method = "static"
+		case lease.Method == "":
+			// down or not configured
+			continue
+		}
+		ret = append(ret, lease)
+	}
+	return ret, nil
+}
+
+// networkdLease reads systemd-networkd's lease file, which has no obtained time so the file's mtime is used
+func networkdLease(index int, lease *rmm.DHCPLease) bool {
+	path := filepath.Join("/run/systemd/netif/leases", strconv.Itoa(index))
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	vals := make(map[string]string)
+	for _, line := range strings.Split(string(b), "\n") {
+		if i := strings.Index(line, "="); i > 0 {
+			vals[line[:i]] = line[i+1:]
+		}
+	}
+	lease.Server = vals["SERVER_ADDRESS"]
+	if vals["ADDRESS"] != "" {
+		lease.Address = vals["ADDRESS"]
+	}
+	var expires time.Time
+	if secs, err := strconv.Atoi(vals["LIFETIME"]); err == nil {
+		expires = fi.ModTime().Add(time.Duration(secs) * time.Second)
+	}
+	setLeaseTimes(lease, fi.ModTime(), expires)
+	return true
+}
+
+// nmLease asks NetworkManager for the device's dhcp4 options, manual connections are marked static
+func nmLease(iface string, lease *rmm.DHCPLease) bool {
+	if !hasBinary("nmcli") {
+		return false
+	}
+	out, err := runTool(10*time.Second, "nmcli", "-t", "-f", "GENERAL.CONNECTION,DHCP4", "device", "show", iface)
+	if err != nil {
+		return false
+	}
+
+	// DHCP4.OPTION[3]:dhcp_server_identifier = 192.168.1.1
+	opts := make(map[string]string)
+	conn := ""
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "GENERAL.CONNECTION:") {
+			conn = strings.TrimPrefix(line, "GENERAL.CONNECTION:")
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 || !strings.HasPrefix(line, "DHCP4.OPTION") {
+			continue
+		}
+		kv := strings.SplitN(line[i+1:], "=", 2)
+		if len(kv) == 2 {
+			opts[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+
+	if len(opts) == 0 {
+		if conn != "" {
+			if method, err := runTool(10*time.Second, "nmcli", "-g", "ipv4.method", "connection", "show", conn); err == nil {
+				switch strings.TrimSpace(method) {
+				case "manual":
+					lease.Method = "static"
+				case "auto":
+					lease.Method = "dhcp"
+				}
+			}
+		}
+		return false
+	}
+
+	lease.Server = opts["dhcp_server_identifier"]
+	if opts["ip_address"] != "" {
+		lease.Address = opts["ip_address"]
+	}
+	var obtained, expires time.Time
+	if secs, err := strconv.ParseInt(opts["expiry"], 10, 64); err == nil {
+		expires = time.Unix(secs, 0)
+		if lt, err := strconv.Atoi(opts["dhcp_lease_time"]); err == nil {
+			obtained = expires.Add(-time.Duration(lt) * time.Second)
+		}
+	}
+	setLeaseTimes(lease, obtained, expires)
+	return true
+}
+
+// dhclientLeases returns the latest lease per interface from dhclient's lease files
+//
+//	lease {
+//	  interface "eth0";
+//	  fixed-address 10.0.0.5;
+//	  option dhcp-server-identifier 10.0.0.1;
+//	  option dhcp-lease-time 86400;
+//	  expire 3 2022/06/02 10:00:00;
+//	}
+func dhclientLeases() map[string]rmm.DHCPLease {
+	ret := make(map[string]rmm.DHCPLease)
+	files := make([]string, 0)
+	for _, pattern := range []string{"/var/lib/dhcp/dhclient*.lease*", "/var/lib/dhclient/*.lease*"} {
+		if m, err := filepath.Glob(pattern); err == nil {
+			files = append(files, m...)
+		}
+	}
+
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		var iface string
+		var lease rmm.DHCPLease
+		var leaseTime int
+		var expires time.Time
+		for _, line := range strings.Split(string(b), "\n") {
+			fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(line), ";"))
+			if len(fields) == 0 {
+				continue
+			}
+			switch {
+			case fields[0] == "lease":
+				iface, lease, leaseTime, expires = "", rmm.DHCPLease{}, 0, time.Time{}
+			case fields[0] == "interface" && len(fields) > 1:
+				iface = strings.Trim(fields[1], `"`)
+				lease.Interface = iface
+			case fields[0] == "option" && len(fields) > 2 && fields[1] == "dhcp-server-identifier":
+				lease.Server = fields[2]
+			case fields[0] == "option" && len(fields) > 2 && fields[1] == "dhcp-lease-time":
+				leaseTime, _ = strconv.Atoi(fields[2])
+			case fields[0] == "expire" && len(fields) > 3:
+				// dhclient writes times in utc
+				expires, _ = time.Parse("2006/01/02 15:04:05", fields[2]+" "+fields[3])
+			case fields[0] == "}" && iface != "":
+				var obtained time.Time
+				if !expires.IsZero() && leaseTime > 0 {
+					obtained = expires.Add(-time.Duration(leaseTime) * time.Second)
+				}
+				setLeaseTimes(&lease, obtained, expires)
+				// later leases in the file are newer
+				ret[iface] = lease
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"time"
+
+	"github.com/StackExchange/wmi"
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetDHCPInfo returns the ipv4 dhcp lease of each enabled adapter, static adapters have Method static and no lease
+func (a *Agent) GetDHCPInfo() ([]rmm.DHCPLease, error) {
+	ret := make([]rmm.DHCPLease, 0)
+
+	var adapters []struct {
+		Description       string
+		InterfaceIndex    uint32
+		IPAddress         []string
+		DHCPEnabled       bool
+		DHCPServer        string
+		DHCPLeaseObtained time.Time
+		DHCPLeaseExpires  time.Time
+	}
+	q := "SELECT Description, InterfaceIndex, IPAddress, DHCPEnabled, DHCPServer, DHCPLeaseObtained, DHCPLeaseExpires FROM Win32_NetworkAdapterConfiguration WHERE IPEnabled = TRUE"
+	if err := wmi.Query(q, &adapters); err != nil {
+		return ret, err
+	}
+
+	_, names := interfaceNames()
+	for _, ad := range adapters {
+		lease := rmm.DHCPLease{
+			Interface:   names[int(ad.InterfaceIndex)],
+			Description: ad.Description,
+			Method:      "static",
+		}
+		if lease.Interface == "" {
+			lease.Interface = ad.Description
+		}
+		for _, ip := range ad.IPAddress {
+			if isIPv4(ip) {
+				lease.Address = ip
+				break
+			}
+		}
+		if ad.DHCPEnabled {
+			lease.Method = "dhcp"
+			// 255.255.255.255 until a lease is obtained
+			if ad.DHCPServer != "255.255.255.255" {
+				lease.Server = ad.DHCPServer
+			}
+			setLeaseTimes(&lease, ad.DHCPLeaseObtained, ad.DHCPLeaseExpires)
+		}
+		ret = append(ret, lease)
+	}
+	return ret, nil
+}
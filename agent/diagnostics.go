@@ -0,0 +1,147 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// only the end of the agent log goes in the bundle
+	diagMaxLogBytes   = 10 * 1024 * 1024
+	diagAuditMaxLines = 500
+)
+
+// agentLogPath returns where main sets up the file logger
+func (a *Agent) agentLogPath() string {
+	if a.LogFile != nil {
+		return a.LogFile.Name()
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(a.ProgramDir, "agent.log")
+	}
+	return "/var/log/tacticalagent.log"
+}
+
+// CollectDiagnostics zips the agent log, redacted config, recent audit entries and system info for support
+// The token is scrubbed from every file. The caller should remove the zip once it's uploaded
+func (a *Agent) CollectDiagnostics() (string, error) {
+	dir := filepath.Join(os.TempDir(), "trmm")
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("diagnostics-%s-%d.zip", a.Hostname, time.Now().Unix()))
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	zw := zip.NewWriter(f)
+	err = a.writeDiagnostics(zw)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+func (a *Agent) writeDiagnostics(zw *zip.Writer) error {
+	add := func(name string, data []byte) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(a.redactSecrets(string(data))))
+		return err
+	}
+
+	log, err := readFileTail(a.agentLogPath(), diagMaxLogBytes)
+	if err != nil {
+		log = []byte(err.Error())
+	}
+	if err := add("agent.log", log); err != nil {
+		return err
+	}
+
+	cfg, _ := json.MarshalIndent(a.DumpConfig(), "", "  ")
+	if err := add("config.json", cfg); err != nil {
+		return err
+	}
+
+	if a.AuditLog != "" {
+		if af, err := os.Open(a.AuditLog); err == nil {
+			lines, _, lerr := lastLines(af, diagAuditMaxLines)
+			af.Close()
+			if lerr == nil {
+				if err := add("audit.log", []byte(strings.Join(lines, "\n")+"\n")); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if conns, err := a.GetAgentConnections(); err == nil {
+		b, _ := json.MarshalIndent(conns, "", "  ")
+		if err := add("connections.json", b); err != nil {
+			return err
+		}
+	}
+
+	info := map[string]interface{}{
+		"collected": time.Now().UTC().Format(time.RFC3339),
+		"version":   a.Version,
+		"hostname":  a.Hostname,
+		"os":        a.osString(),
+		"platform":  a.Platform,
+		"goarch":    a.GoArch,
+		"boot_time": a.BootTime(),
+		"total_ram": a.TotalRAM(),
+		"health":    a.HealthCheck(),
+	}
+	sys, _ := json.MarshalIndent(info, "", "  ")
+	return add("sysinfo.json", sys)
+}
+
+// readFileTail returns at most max bytes from the end of a file
+func readFileTail(path string, max int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() > max {
+		if _, err := f.Seek(-max, io.SeekEnd); err != nil {
+			return nil, err
+		}
+	}
+	return io.ReadAll(f)
+}
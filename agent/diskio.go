@@ -0,0 +1,109 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+const diskIOSampleWindow = 5 * time.Second
+
+// device name prefixes that are not real storage
+var diskIOVirtualPrefixes = []string{"loop", "ram", "zram", "sr", "fd", "nbd"}
+
+func isVirtualDiskDevice(name string) bool {
+	for _, p := range diskIOVirtualPrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// counterDelta returns the difference between two samples, or 0 if the counter was reset
+func counterDelta(before, after uint64) uint64 {
+	if after < before {
+		return 0
+	}
+	return after - before
+}
+
+// GetDiskIOStats samples disk io counters twice and returns per device totals and rates
+// Devices that only appear in one of the samples are skipped
+func (a *Agent) GetDiskIOStats() ([]rmm.DiskIO, error) {
+	ret := make([]rmm.DiskIO, 0)
+
+	first, err := disk.IOCounters()
+	if err != nil {
+		return ret, err
+	}
+	start := time.Now()
+
+	time.Sleep(diskIOSampleWindow)
+
+	second, err := disk.IOCounters()
+	if err != nil {
+		return ret, err
+	}
+	elapsed := time.Since(start).Seconds()
+
+	for name, after := range second {
+		if isVirtualDiskDevice(name) {
+			continue
+		}
+		before, ok := first[name]
+		if !ok {
+			a.Logger.Debugln("GetDiskIOStats(): device appeared during sampling", name)
+			continue
+		}
+
+		reads := counterDelta(before.ReadCount, after.ReadCount)
+		writes := counterDelta(before.WriteCount, after.WriteCount)
+		readTime := counterDelta(before.ReadTime, after.ReadTime)
+		writeTime := counterDelta(before.WriteTime, after.WriteTime)
+		ioTime := counterDelta(before.IoTime, after.IoTime)
+
+		d := rmm.DiskIO{
+			Device:           name,
+			ReadBytes:        after.ReadBytes,
+			WriteBytes:       after.WriteBytes,
+			ReadCount:        after.ReadCount,
+			WriteCount:       after.WriteCount,
+			ReadTime:         after.ReadTime,
+			WriteTime:        after.WriteTime,
+			IoTime:           after.IoTime,
+			ReadBytesPerSec:  float64(counterDelta(before.ReadBytes, after.ReadBytes)) / elapsed,
+			WriteBytesPerSec: float64(counterDelta(before.WriteBytes, after.WriteBytes)) / elapsed,
+			ReadOpsPerSec:    float64(reads) / elapsed,
+			WriteOpsPerSec:   float64(writes) / elapsed,
+			BusyPercent:      float64(ioTime) / (elapsed * 1000) * 100,
+		}
+		if reads > 0 {
+			d.ReadLatencyMs = float64(readTime) / float64(reads)
+		}
+		if writes > 0 {
+			d.WriteLatencyMs = float64(writeTime) / float64(writes)
+		}
+		if d.BusyPercent > 100 {
+			d.BusyPercent = 100
+		}
+		ret = append(ret, d)
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Device < ret[j].Device })
+	return ret, nil
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"strings"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// GetDiskUsageDetailed returns byte and inode usage for each mounted filesystem, pseudo filesystems and loop devices are skipped
+// Inode counts are 0 where the filesystem doesn't have them, e.g. ntfs
+func (a *Agent) GetDiskUsageDetailed() ([]rmm.DiskUsage, error) {
+	ret := make([]rmm.DiskUsage, 0)
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		return ret, err
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range partitions {
+		if strings.Contains(p.Device, "dev/loop") || seen[p.Mountpoint] {
+			continue
+		}
+		seen[p.Mountpoint] = true
+
+		usage, err := disk.Usage(p.Mountpoint)
+		if err != nil {
+			a.Logger.Debugln("GetDiskUsageDetailed():", p.Mountpoint, err)
+			continue
+		}
+		ret = append(ret, rmm.DiskUsage{
+			Device:            p.Device,
+			MountPoint:        p.Mountpoint,
+			FSType:            p.Fstype,
+			Total:             usage.Total,
+			Used:              usage.Used,
+			Free:              usage.Free,
+			UsedPercent:       usage.UsedPercent,
+			InodesTotal:       usage.InodesTotal,
+			InodesUsed:        usage.InodesUsed,
+			InodesFree:        usage.InodesFree,
+			InodesUsedPercent: usage.InodesUsedPercent,
+		})
+	}
+	return ret, nil
+}
@@ -0,0 +1,19 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import "os"
+
+// IsElevated reports whether the agent is running as root
+func (a *Agent) IsElevated() (bool, error) {
+	return os.Geteuid() == 0, nil
+}
@@ -0,0 +1,27 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import "golang.org/x/sys/windows"
+
+// IsElevated reports whether the agent's token is elevated or has the administrators group enabled
+func (a *Agent) IsElevated() (bool, error) {
+	if windows.GetCurrentProcessToken().IsElevated() {
+		return true, nil
+	}
+	sid, err := windows.CreateWellKnownSid(windows.WinBuiltinAdministratorsSid)
+	if err != nil {
+		return false, err
+	}
+	// token 0 checks the calling thread's effective token, the process token unless it's impersonating
+	return windows.Token(0).IsMember(sid)
+}
@@ -0,0 +1,29 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GetEntropyStatus returns the bits of entropy the kernel has available, below a few hundred
+// reads from /dev/random block and tls and ssh handshakes stall.
+// Kernels from 5.18 always report 256 once the pool is initialized
+func (a *Agent) GetEntropyStatus() (available int, err error) {
+	b, err := os.ReadFile("/proc/sys/kernel/random/entropy_avail")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
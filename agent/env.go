@@ -0,0 +1,40 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	envScopeSystem = "system"
+	envScopeUser   = "user"
+)
+
+// validateEnv checks the name, value and scope passed to SetPersistentEnv
+func validateEnv(name, value, scope string) error {
+	if scope != envScopeSystem && scope != envScopeUser {
+		return fmt.Errorf("invalid scope %q, must be %q or %q", scope, envScopeSystem, envScopeUser)
+	}
+	if len(name) == 0 {
+		return errors.New("environment variable name is empty")
+	}
+	if strings.ContainsAny(name, "= \t\r\n\x00") {
+		return fmt.Errorf("invalid environment variable name %q", name)
+	}
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return errors.New("environment variable value can't contain newlines")
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SetPersistentEnv sets an environment variable that survives a reboot
+// system scope goes in /etc/environment, user scope in the logged on user's ~/.profile
+func (a *Agent) SetPersistentEnv(name, value, scope string) error {
+	if err := validateEnv(name, value, scope); err != nil {
+		return err
+	}
+
+	if scope == envScopeSystem {
+		return setEnvLine("/etc/environment", name+"=", fmt.Sprintf("%s=\"%s\"", name, value), 0644, -1, -1)
+	}
+
+	username := a.LoggedOnUser()
+	if username == "" {
+		return errors.New("no user is logged on")
+	}
+	u, err := user.Lookup(username)
+	if err != nil {
+		return err
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, _ := strconv.Atoi(u.Gid)
+
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	line := fmt.Sprintf("export %s=\"%s\"", name, r.Replace(value))
+	return setEnvLine(filepath.Join(u.HomeDir, ".profile"), "export "+name+"=", line, 0644, uid, gid)
+}
+
+// setEnvLine replaces the line starting with prefix or appends it, the file is created if missing
+// uid/gid of -1 leaves ownership alone
+func setEnvLine(path, prefix, line string, perm os.FileMode, uid, gid int) error {
+	var lines []string
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		lines = strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+		if fi, serr := os.Stat(path); serr == nil {
+			perm = fi.Mode().Perm()
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	found := false
+	for i, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), prefix) {
+			lines[i] = line
+			found = true
+		}
+	}
+	if !found {
+		lines = append(lines, line)
+	}
+
+	tmp := path + ".trmm"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), perm); err != nil {
+		return err
+	}
+	if uid >= 0 {
+		if err := os.Chown(tmp, uid, gid); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
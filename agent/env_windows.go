@@ -0,0 +1,111 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+
+	wapf "github.com/wh1te909/go-win64api"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	hwndBroadcast   = 0xffff
+	wmSettingChange = 0x001A
+	smtoAbortIfHung = 0x0002
+)
+
+// SetPersistentEnv sets an environment variable that survives a reboot
+// user scope writes to the hive of the logged on user, since HKCU is the SYSTEM account's when running as a service
+func (a *Agent) SetPersistentEnv(name, value, scope string) error {
+	if err := validateEnv(name, value, scope); err != nil {
+		return err
+	}
+
+	var (
+		root registry.Key
+		path string
+	)
+	if scope == envScopeSystem {
+		root = registry.LOCAL_MACHINE
+		path = `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`
+	} else {
+		sid, _, err := loggedOnUserSID()
+		if err != nil {
+			return err
+		}
+		root = registry.USERS
+		path = sid + `\Environment`
+	}
+
+	k, err := registry.OpenKey(root, path, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer k.Close()
+
+	if strings.Contains(value, "%") {
+		err = k.SetExpandStringValue(name, value)
+	} else {
+		err = k.SetStringValue(name, value)
+	}
+	if err != nil {
+		return err
+	}
+
+	// let explorer and other running programs know the environment changed
+	if err := broadcastEnvChange(); err != nil {
+		a.Logger.Debugln("SetPersistentEnv() broadcast:", err)
+	}
+	return nil
+}
+
+// loggedOnUserSID returns the sid and domain\user of the first logged on user
+func loggedOnUserSID() (string, string, error) {
+	users, err := wapf.ListLoggedInUsers()
+	if err != nil {
+		return "", "", err
+	}
+	if len(users) == 0 {
+		return "", "", errors.New("no user is logged on")
+	}
+	sid, _, _, err := windows.LookupSID(users[0].Domain, users[0].Username)
+	if err != nil {
+		return "", "", err
+	}
+	return sid.String(), users[0].FullUser(), nil
+}
+
+func broadcastEnvChange() error {
+	env, err := windows.UTF16PtrFromString("Environment")
+	if err != nil {
+		return err
+	}
+	var result uintptr
+	r1, _, e1 := procSendMessageTimeoutW.Call(
+		hwndBroadcast,
+		wmSettingChange,
+		0,
+		uintptr(unsafe.Pointer(env)),
+		smtoAbortIfHung,
+		5000,
+		uintptr(unsafe.Pointer(&result)),
+	)
+	if r1 == 0 {
+		return e1
+	}
+	return nil
+}
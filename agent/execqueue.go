@@ -0,0 +1,81 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// how long a command waits for a free slot when CmdQueueTimeout isn't set
+const defaultCmdQueueTimeout = 10 * time.Minute
+
+// execLimiter caps how many commands run at once, commands over the limit wait for a slot
+type execLimiter struct {
+	slots   chan struct{}
+	timeout time.Duration
+	running int64
+	waiting int64
+}
+
+func newExecLimiter(max int, timeout time.Duration) *execLimiter {
+	l := &execLimiter{timeout: timeout}
+	if l.timeout <= 0 {
+		l.timeout = defaultCmdQueueTimeout
+	}
+	if max > 0 {
+		l.slots = make(chan struct{}, max)
+	}
+	return l
+}
+
+// acquire waits for a free slot, the returned func releases it
+func (l *execLimiter) acquire() (func(), error) {
+	if l.slots != nil {
+		atomic.AddInt64(&l.waiting, 1)
+		t := time.NewTimer(l.timeout)
+		defer t.Stop()
+		select {
+		case l.slots <- struct{}{}:
+			atomic.AddInt64(&l.waiting, -1)
+		case <-t.C:
+			atomic.AddInt64(&l.waiting, -1)
+			return nil, ErrCmdQueueTimeout
+		}
+	}
+	atomic.AddInt64(&l.running, 1)
+	return func() {
+		atomic.AddInt64(&l.running, -1)
+		if l.slots != nil {
+			<-l.slots
+		}
+	}, nil
+}
+
+// acquireCmd waits for a slot for c, the returned func releases it. The agent's own commands
+// aren't limited, a backlog of server commands mustn't hold up checkins or an update
+func (a *Agent) acquireCmd(c *CmdOptions) (func(), error) {
+	if c.internal() {
+		return func() {}, nil
+	}
+	return a.cmdLimiter.acquire()
+}
+
+// GetExecutionQueueDepth returns how many commands are running or waiting for a slot
+func (a *Agent) GetExecutionQueueDepth() int {
+	running, queued := a.executionQueue()
+	return running + queued
+}
+
+func (a *Agent) executionQueue() (running, queued int) {
+	return int(atomic.LoadInt64(&a.cmdLimiter.running)), int(atomic.LoadInt64(&a.cmdLimiter.waiting))
+}
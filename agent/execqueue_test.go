@@ -0,0 +1,50 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcquireCmd(t *testing.T) {
+	a := testAgent()
+	a.cmdLimiter = newExecLimiter(1, 50*time.Millisecond)
+
+	release, err := a.acquireCmd(&CmdOptions{Initiator: "rpc:rawcmd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := a.GetExecutionQueueDepth(); got != 1 {
+		t.Errorf("queue depth %d, want 1", got)
+	}
+
+	// the only slot is taken, the agent's own commands still run
+	for _, initiator := range []string{"", agentInitiator} {
+		r, err := a.acquireCmd(&CmdOptions{Initiator: initiator})
+		if err != nil {
+			t.Errorf("initiator %q: %v", initiator, err)
+			continue
+		}
+		r()
+	}
+
+	if _, err := a.acquireCmd(&CmdOptions{Initiator: "task"}); !errors.Is(err, ErrCmdQueueTimeout) {
+		t.Errorf("got %v, want ErrCmdQueueTimeout", err)
+	}
+
+	release()
+	if got := a.GetExecutionQueueDepth(); got != 0 {
+		t.Errorf("queue depth %d after release, want 0", got)
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetFileLockers returns the processes with path open, as a file descriptor or memory mapped like an executable or library
+// Processes of other users are only visible to root
+func (a *Agent) GetFileLockers(path string) ([]rmm.ProcessInfo, error) {
+	ret := make([]rmm.ProcessInfo, 0)
+	target, err := filepath.Abs(path)
+	if err != nil {
+		return ret, err
+	}
+	if _, err := os.Stat(target); err != nil {
+		return ret, err
+	}
+	if resolved, err := filepath.EvalSymlinks(target); err == nil {
+		target = resolved
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return ret, err
+	}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		if procHasFile(pid, target) {
+			ret = append(ret, processInfo(int32(pid)))
+		}
+	}
+	return ret, nil
+}
+
+func procHasFile(pid int, target string) bool {
+	fdDir := fmt.Sprintf("/proc/%d/fd", pid)
+	if fds, err := os.ReadDir(fdDir); err == nil {
+		for _, fd := range fds {
+			if link, err := os.Readlink(filepath.Join(fdDir, fd.Name())); err == nil && link == target {
+				return true
+			}
+		}
+	}
+
+	// 7f2c...-7f2c... r-xp 00000000 08:01 1234  /usr/lib/libc.so.6
+	maps, err := os.ReadFile(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(maps), "\n") {
+		if i := strings.Index(line, "/"); i >= 0 && line[i:] == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"path/filepath"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	"golang.org/x/sys/windows"
+)
+
+// GetFileLockers returns the processes holding path open, from the restart manager
+func (a *Agent) GetFileLockers(path string) ([]rmm.ProcessInfo, error) {
+	ret := make([]rmm.ProcessInfo, 0)
+	target, err := filepath.Abs(path)
+	if err != nil {
+		return ret, err
+	}
+
+	var session uint32
+	key := make([]uint16, CCH_RM_SESSION_KEY+1)
+	if err := RmStartSession(&session, 0, &key[0]); err != nil {
+		return ret, fmt.Errorf("RmStartSession: %v", err)
+	}
+	defer RmEndSession(session)
+
+	name, err := windows.UTF16PtrFromString(target)
+	if err != nil {
+		return ret, err
+	}
+	if err := RmRegisterResources(session, 1, &name); err != nil {
+		return ret, fmt.Errorf("RmRegisterResources: %v", err)
+	}
+
+	// the list can grow between calls so retry while it says there's more
+	var procs []RM_PROCESS_INFO
+	for {
+		var needed, n uint32
+		var reasons uint32
+		n = uint32(len(procs))
+		var first *RM_PROCESS_INFO
+		if n > 0 {
+			first = &procs[0]
+		}
+		err := RmGetList(session, &needed, &n, first, &reasons)
+		if err == windows.ERROR_MORE_DATA {
+			procs = make([]RM_PROCESS_INFO, needed)
+			continue
+		}
+		if err != nil {
+			return ret, fmt.Errorf("RmGetList: %v", err)
+		}
+		procs = procs[:n]
+		break
+	}
+
+	for _, p := range procs {
+		info := processInfo(int32(p.Process.ProcessId))
+		if info.Name == "" {
+			info.Name = windows.UTF16ToString(p.AppName[:])
+		}
+		ret = append(ret, info)
+	}
+	return ret, nil
+}
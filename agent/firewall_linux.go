@@ -0,0 +1,387 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetFirewallRules returns the nftables ruleset, or the iptables and ip6tables rules on hosts still using the legacy backend
+// The default policy of each base chain is included as a rule since an accept policy is usually what makes a host wide open
+func (a *Agent) GetFirewallRules() ([]rmm.FirewallRule, error) {
+	if !hasBinary("nft") && !hasBinary("iptables-save") {
+		return nil, ErrNotSupported
+	}
+
+	if hasBinary("nft") {
+		rules, err := nftRules()
+		if err != nil {
+			a.Logger.Debugln("GetFirewallRules() nft:", err)
+		} else if len(rules) > 0 {
+			return rules, nil
+		}
+	}
+
+	ret := make([]rmm.FirewallRule, 0)
+	for _, tool := range []string{"iptables-save", "ip6tables-save"} {
+		if !hasBinary(tool) {
+			continue
+		}
+		out, err := runTool(15*time.Second, tool, "-t", "filter")
+		if err != nil {
+			a.Logger.Debugln("GetFirewallRules():", err)
+			continue
+		}
+		prefix := ""
+		if tool == "ip6tables-save" {
+			prefix = "ip6 "
+		}
+		ret = append(ret, parseIptablesSave(out, prefix)...)
+	}
+	return ret, nil
+}
+
+// chain hooks and iptables built in chains to rule directions, rules in other chains are only reached by a jump
+var fwChainDirections = map[string]string{
+	"input":   "in",
+	"output":  "out",
+	"forward": "forward",
+}
+
+type nftRuleset struct {
+	Nftables []struct {
+		Chain *struct {
+			Family string `json:"family"`
+			Table  string `json:"table"`
+			Name   string `json:"name"`
+			Type   string `json:"type"`
+			Hook   string `json:"hook"`
+			Policy string `json:"policy"`
+		} `json:"chain"`
+		Rule *struct {
+			Family  string                   `json:"family"`
+			Table   string                   `json:"table"`
+			Chain   string                   `json:"chain"`
+			Handle  int                      `json:"handle"`
+			Comment string                   `json:"comment"`
+			Expr    []map[string]interface{} `json:"expr"`
+		} `json:"rule"`
+	} `json:"nftables"`
+}
+
+func nftRules() ([]rmm.FirewallRule, error) {
+	out, err := runTool(15*time.Second, "nft", "-j", "list", "ruleset")
+	if err != nil {
+		return nil, err
+	}
+
+	var rs nftRuleset
+	if err := json.Unmarshal([]byte(out), &rs); err != nil {
+		return nil, fmt.Errorf("nft -j list ruleset: %v", err)
+	}
+	return rs.rules(), nil
+}
+
+// rules normalizes the rules in filter chains, plus the base chain policies
+func (rs nftRuleset) rules() []rmm.FirewallRule {
+	type chainInfo struct{ typ, hook string }
+	chains := make(map[string]chainInfo)
+	ret := make([]rmm.FirewallRule, 0)
+	for _, obj := range rs.Nftables {
+		c := obj.Chain
+		if c == nil {
+			continue
+		}
+		chains[c.Family+" "+c.Table+" "+c.Name] = chainInfo{c.Type, c.Hook}
+		if c.Type == "filter" && c.Policy != "" {
+			ret = append(ret, rmm.FirewallRule{
+				Name:        fmt.Sprintf("%s %s/%s default policy", c.Family, c.Table, c.Name),
+				Direction:   fwChainDirections[c.Hook],
+				Action:      fwVerdict(c.Policy),
+				Protocol:    "any",
+				LocalPorts:  "*",
+				RemotePorts: "*",
+				RemoteAddrs: "*",
+				Enabled:     true,
+			})
+		}
+	}
+
+	for _, obj := range rs.Nftables {
+		r := obj.Rule
+		if r == nil {
+			continue
+		}
+		// skip nat, route etc. base chains, regular chains have no type and are kept
+		info := chains[r.Family+" "+r.Table+" "+r.Chain]
+		if info.typ != "" && info.typ != "filter" {
+			continue
+		}
+
+		rule := rmm.FirewallRule{
+			Name:        fmt.Sprintf("%s %s/%s #%d", r.Family, r.Table, r.Chain, r.Handle),
+			Direction:   fwChainDirections[info.hook],
+			Protocol:    "any",
+			LocalPorts:  "*",
+			RemotePorts: "*",
+			RemoteAddrs: "*",
+			Enabled:     true,
+		}
+		if r.Comment != "" {
+			rule.Name += " " + r.Comment
+		}
+		for _, e := range r.Expr {
+			nftApplyExpr(&rule, e)
+		}
+		// counters, logging and set updates without a verdict don't decide anything
+		if rule.Action == "" {
+			continue
+		}
+		ret = append(ret, rule)
+	}
+	return ret
+}
+
+// nftApplyExpr fills in the parts of rule that a single nft json expression sets
+func nftApplyExpr(rule *rmm.FirewallRule, e map[string]interface{}) {
+	for _, v := range []string{"accept", "drop", "reject", "return"} {
+		if _, ok := e[v]; ok {
+			rule.Action = fwVerdict(v)
+			return
+		}
+	}
+	for _, v := range []string{"jump", "goto"} {
+		if j, ok := e[v].(map[string]interface{}); ok {
+			rule.Action = fmt.Sprint(j["target"])
+			return
+		}
+	}
+
+	m, ok := e["match"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	left, _ := m["left"].(map[string]interface{})
+	right := nftValue(m["right"])
+	if op, _ := m["op"].(string); op == "!=" {
+		right = "!" + right
+	}
+
+	if meta, ok := left["meta"].(map[string]interface{}); ok {
+		if meta["key"] == "l4proto" {
+			rule.Protocol = right
+		}
+		return
+	}
+	payload, ok := left["payload"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	proto, _ := payload["protocol"].(string)
+	field, _ := payload["field"].(string)
+	local, remote := "dport", "sport"
+	addr := "saddr"
+	if rule.Direction == "out" {
+		local, remote = "sport", "dport"
+		addr = "daddr"
+	}
+	switch field {
+	case local:
+		rule.LocalPorts = right
+		if rule.Protocol == "any" {
+			rule.Protocol = proto
+		}
+	case remote:
+		rule.RemotePorts = right
+		if rule.Protocol == "any" {
+			rule.Protocol = proto
+		}
+	case addr:
+		rule.RemoteAddrs = right
+	case "protocol", "nexthdr":
+		rule.Protocol = right
+	}
+}
+
+// nftValue flattens the right hand side of an nft match, a value, prefix, range or anonymous set
+func nftValue(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case []interface{}:
+		parts := make([]string, 0, len(t))
+		for _, p := range t {
+			parts = append(parts, nftValue(p))
+		}
+		return strings.Join(parts, ",")
+	case map[string]interface{}:
+		if s, ok := t["set"]; ok {
+			return nftValue(s)
+		}
+		if r, ok := t["range"].([]interface{}); ok && len(r) == 2 {
+			return nftValue(r[0]) + "-" + nftValue(r[1])
+		}
+		if p, ok := t["prefix"].(map[string]interface{}); ok {
+			return fmt.Sprintf("%s/%s", nftValue(p["addr"]), nftValue(p["len"]))
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// fwVerdict maps nft verdicts and iptables targets to the normalized allow/block, anything else is passed through
+func fwVerdict(v string) string {
+	switch strings.ToLower(v) {
+	case "accept":
+		return "allow"
+	case "drop", "reject":
+		return "block"
+	}
+	return strings.ToLower(v)
+}
+
+// parseIptablesSave parses iptables-save -t filter output
+func parseIptablesSave(out, prefix string) []rmm.FirewallRule {
+	ret := make([]rmm.FirewallRule, 0)
+	count := make(map[string]int)
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, ":"):
+			// :INPUT ACCEPT [0:0], user chains have - as the policy
+			f := strings.Fields(line[1:])
+			if len(f) < 2 || f[1] == "-" {
+				continue
+			}
+			ret = append(ret, rmm.FirewallRule{
+				Name:        fmt.Sprintf("%sfilter/%s default policy", prefix, f[0]),
+				Direction:   fwChainDirections[strings.ToLower(f[0])],
+				Action:      fwVerdict(f[1]),
+				Protocol:    "any",
+				LocalPorts:  "*",
+				RemotePorts: "*",
+				RemoteAddrs: "*",
+				Enabled:     true,
+			})
+		case strings.HasPrefix(line, "-A "):
+			f := iptablesFields(line[3:])
+			rule, ok := parseIptablesRule(f)
+			if !ok {
+				continue
+			}
+			chain := f[0]
+			count[chain]++
+			name := fmt.Sprintf("%sfilter/%s #%d", prefix, chain, count[chain])
+			if rule.Name != "" {
+				name += " " + rule.Name
+			}
+			rule.Name = name
+			ret = append(ret, rule)
+		}
+	}
+	return ret
+}
+
+// parseIptablesRule parses the chain and options of an -A line, ok is false for rules without a target
+func parseIptablesRule(f []string) (rmm.FirewallRule, bool) {
+	rule := rmm.FirewallRule{
+		Protocol:    "any",
+		LocalPorts:  "*",
+		RemotePorts: "*",
+		RemoteAddrs: "*",
+		Enabled:     true,
+	}
+	if len(f) == 0 {
+		return rule, false
+	}
+	rule.Direction = fwChainDirections[strings.ToLower(f[0])]
+	local, remote := "dport", "sport"
+	addr := "-s"
+	if rule.Direction == "out" {
+		local, remote = "sport", "dport"
+		addr = "-d"
+	}
+
+	negate := false
+	for i := 1; i < len(f); i++ {
+		opt := f[i]
+		if opt == "!" {
+			negate = true
+			continue
+		}
+		val := ""
+		if i+1 < len(f) {
+			val = f[i+1]
+		}
+		if negate {
+			val = "!" + val
+			negate = false
+		}
+		switch opt {
+		case "-p", "--protocol":
+			rule.Protocol = val
+		case addr:
+			rule.RemoteAddrs = val
+		case "--" + local, "--" + local + "s":
+			rule.LocalPorts = strings.ReplaceAll(val, ":", "-")
+		case "--" + remote, "--" + remote + "s":
+			rule.RemotePorts = strings.ReplaceAll(val, ":", "-")
+		case "--comment":
+			rule.Name = val
+		case "-j", "-g":
+			rule.Action = fwVerdict(val)
+		default:
+			continue
+		}
+		i++
+	}
+	return rule, rule.Action != ""
+}
+
+// iptablesFields splits an iptables-save line on spaces, keeping double quoted values like comments together
+func iptablesFields(line string) []string {
+	ret := make([]string, 0)
+	var cur strings.Builder
+	quoted, escaped, inField := false, false, false
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quoted:
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+			inField = true
+		case r == ' ' && !quoted:
+			if inField {
+				ret = append(ret, cur.String())
+				cur.Reset()
+				inField = false
+			}
+		default:
+			cur.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		ret = append(ret, cur.String())
+	}
+	return ret
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"reflect"
+	"testing"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+func TestIptablesFields(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{`INPUT -p tcp -j ACCEPT`, []string{"INPUT", "-p", "tcp", "-j", "ACCEPT"}},
+		{`INPUT  -i lo   -j ACCEPT`, []string{"INPUT", "-i", "lo", "-j", "ACCEPT"}},
+		{`INPUT -m comment --comment "allow ssh" -j ACCEPT`, []string{"INPUT", "-m", "comment", "--comment", "allow ssh", "-j", "ACCEPT"}},
+		{`INPUT --comment "say \"hi\"" -j DROP`, []string{"INPUT", "--comment", `say "hi"`, "-j", "DROP"}},
+		{`INPUT --comment "" -j DROP`, []string{"INPUT", "--comment", "", "-j", "DROP"}},
+		{``, []string{}},
+	}
+	for _, tt := range tests {
+		if got := iptablesFields(tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("iptablesFields(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseIptablesSave(t *testing.T) {
+	out := `# Generated by iptables-save
+*filter
+:INPUT DROP [0:0]
+:FORWARD ACCEPT [0:0]
+:OUTPUT ACCEPT [12:3456]
+:DOCKER - [0:0]
+-A INPUT -i lo -j ACCEPT
+-A INPUT -p tcp -m tcp --dport 22 -m comment --comment "allow ssh" -j ACCEPT
+-A INPUT -s 10.0.0.0/8 ! -p udp -j DROP
+-A INPUT -m state --state RELATED,ESTABLISHED
+-A INPUT -p tcp -m tcp --dport 8000:8100 -j ACCEPT
+-A OUTPUT -d 192.0.2.1/32 -p tcp -m multiport --dports 80,443 -j REJECT --reject-with icmp-port-unreachable
+COMMIT
+`
+	rule := func(name, dir, action, proto, local, remote, addrs string) rmm.FirewallRule {
+		return rmm.FirewallRule{
+			Name:        name,
+			Direction:   dir,
+			Action:      action,
+			Protocol:    proto,
+			LocalPorts:  local,
+			RemotePorts: remote,
+			RemoteAddrs: addrs,
+			Enabled:     true,
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		want   []rmm.FirewallRule
+	}{
+		{"", []rmm.FirewallRule{
+			rule("filter/INPUT default policy", "in", "block", "any", "*", "*", "*"),
+			rule("filter/FORWARD default policy", "forward", "allow", "any", "*", "*", "*"),
+			rule("filter/OUTPUT default policy", "out", "allow", "any", "*", "*", "*"),
+			rule("filter/INPUT #1", "in", "allow", "any", "*", "*", "*"),
+			rule("filter/INPUT #2 allow ssh", "in", "allow", "tcp", "22", "*", "*"),
+			rule("filter/INPUT #3", "in", "block", "!udp", "*", "*", "10.0.0.0/8"),
+			rule("filter/INPUT #4", "in", "allow", "tcp", "8000-8100", "*", "*"),
+			rule("filter/OUTPUT #1", "out", "block", "tcp", "*", "80,443", "192.0.2.1/32"),
+		}},
+		{"ip6 ", nil},
+	}
+	for _, tt := range tests {
+		want := tt.want
+		if want == nil {
+			// same rules, only the names change
+			for _, r := range tests[0].want {
+				r.Name = tt.prefix + r.Name
+				want = append(want, r)
+			}
+		}
+		got := parseIptablesSave(out, tt.prefix)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("parseIptablesSave(prefix %q):\n got %+v\nwant %+v", tt.prefix, got, want)
+		}
+	}
+}
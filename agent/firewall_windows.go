@@ -0,0 +1,141 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	ole "github.com/go-ole/go-ole"
+	"github.com/go-ole/go-ole/oleutil"
+)
+
+// NET_FW_IP_PROTOCOL values, anything else is reported as the protocol number
+var fwProtocols = map[int]string{
+	1:   "icmpv4",
+	6:   "tcp",
+	17:  "udp",
+	58:  "icmpv6",
+	256: "any",
+}
+
+// GetFirewallRules returns every windows firewall rule from the HNetCfg.FwPolicy2 com api
+func (a *Agent) GetFirewallRules() ([]rmm.FirewallRule, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED); err != nil {
+		e, ok := err.(*ole.OleError)
+		if !ok || (e.Code() != S_OK && e.Code() != S_FALSE) {
+			return nil, fmt.Errorf("ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED): %v", err)
+		}
+	}
+	defer ole.CoUninitialize()
+
+	policy, err := NewCOMObject("HNetCfg.FwPolicy2")
+	if err != nil {
+		return nil, err
+	}
+	defer policy.Release()
+
+	rulesRaw, err := oleutil.GetProperty(policy, "Rules")
+	if err != nil {
+		return nil, fmt.Errorf("FwPolicy2.Rules: %v", err)
+	}
+	defer rulesRaw.Clear()
+
+	ret := make([]rmm.FirewallRule, 0)
+	err = oleutil.ForEach(rulesRaw.ToIDispatch(), func(v *ole.VARIANT) error {
+		defer v.Clear()
+		props, err := fwRuleProps(v.ToIDispatch())
+		if err != nil {
+			return err
+		}
+
+		rule := rmm.FirewallRule{
+			Name:        fwString(props["Name"]),
+			Direction:   "in",
+			Action:      "block",
+			Protocol:    strconv.Itoa(fwInt(props["Protocol"])),
+			LocalPorts:  fwAny(props["LocalPorts"]),
+			RemotePorts: fwAny(props["RemotePorts"]),
+			RemoteAddrs: fwAny(props["RemoteAddresses"]),
+			Program:     fwString(props["ApplicationName"]),
+		}
+		// NET_FW_RULE_DIRECTION: 1 in, 2 out. NET_FW_ACTION: 0 block, 1 allow
+		if fwInt(props["Direction"]) == 2 {
+			rule.Direction = "out"
+		}
+		if fwInt(props["Action"]) == 1 {
+			rule.Action = "allow"
+		}
+		if p, ok := fwProtocols[fwInt(props["Protocol"])]; ok {
+			rule.Protocol = p
+		}
+		rule.Enabled, _ = props["Enabled"].(bool)
+		ret = append(ret, rule)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// fwRuleProps reads the INetFwRule properties GetFirewallRules needs
+func fwRuleProps(rule *ole.IDispatch) (map[string]interface{}, error) {
+	ret := make(map[string]interface{})
+	for _, name := range []string{"Name", "Direction", "Action", "Protocol", "LocalPorts", "RemotePorts", "RemoteAddresses", "ApplicationName", "Enabled"} {
+		v, err := oleutil.GetProperty(rule, name)
+		if err != nil {
+			return nil, fmt.Errorf("INetFwRule.%s: %v", name, err)
+		}
+		ret[name] = v.Value()
+		v.Clear()
+	}
+	return ret, nil
+}
+
+func fwString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func fwInt(v interface{}) int {
+	switch n := v.(type) {
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case uint32:
+		return int(n)
+	case int16:
+		return int(n)
+	case uint8:
+		return int(n)
+	case int:
+		return n
+	}
+	return -1
+}
+
+// fwAny maps the blank ports of rules for protocols without ports to "*" like the addresses
+func fwAny(v interface{}) string {
+	s := strings.TrimSpace(fwString(v))
+	if s == "" {
+		return "*"
+	}
+	return s
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetGPUInfo returns gpus found with nvidia-smi and lspci
+// Missing tooling is not an error, an empty slice is returned instead
+func (a *Agent) GetGPUInfo() ([]rmm.GPUInfo, error) {
+	ret := a.nvidiaSmiGPUs()
+	haveNvidia := len(ret) > 0
+
+	if _, err := exec.LookPath("lspci"); err != nil {
+		a.Logger.Debugln("GetGPUInfo(): lspci not found")
+		return ret, nil
+	}
+
+	opts := a.NewCMDOpts()
+	opts.Command = "lspci -mm -D"
+	out := a.CmdV2(opts)
+	if out.Status.Exit != 0 {
+		a.Logger.Debugln("GetGPUInfo(): lspci", out.Stderr)
+		return ret, nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(out.Stdout))
+	for scanner.Scan() {
+		fields := splitQuoted(scanner.Text())
+		// slot "class" "vendor" "device" ...
+		if len(fields) < 4 {
+			continue
+		}
+		class := strings.ToLower(fields[1])
+		if !strings.Contains(class, "vga") && !strings.Contains(class, "3d") && !strings.Contains(class, "display") {
+			continue
+		}
+		if haveNvidia && strings.Contains(strings.ToLower(fields[2]), "nvidia") {
+			continue
+		}
+
+		gpu := rmm.GPUInfo{Name: fields[3], Vendor: fields[2]}
+		if link, err := os.Readlink(filepath.Join("/sys/bus/pci/devices", fields[0], "driver")); err == nil {
+			driver := filepath.Base(link)
+			gpu.DriverVersion = driver
+			if v, err := os.ReadFile(filepath.Join("/sys/module", driver, "version")); err == nil {
+				gpu.DriverVersion = driver + " " + strings.TrimSpace(string(v))
+			}
+		}
+		ret = append(ret, gpu)
+	}
+	return ret, nil
+}
+
+func (a *Agent) nvidiaSmiGPUs() []rmm.GPUInfo {
+	ret := make([]rmm.GPUInfo, 0)
+	if _, err := exec.LookPath("nvidia-smi"); err != nil {
+		return ret
+	}
+
+	opts := a.NewCMDOpts()
+	opts.Command = "nvidia-smi --query-gpu=name,driver_version,memory.total --format=csv,noheader,nounits"
+	out := a.CmdV2(opts)
+	if out.Status.Exit != 0 {
+		a.Logger.Debugln("nvidia-smi:", out.Stderr)
+		return ret
+	}
+
+	for _, line := range strings.Split(out.Stdout, "\n") {
+		cols := strings.Split(line, ",")
+		if len(cols) != 3 {
+			continue
+		}
+		// memory.total is in MiB
+		mib, _ := strconv.ParseUint(strings.TrimSpace(cols[2]), 10, 64)
+		ret = append(ret, rmm.GPUInfo{
+			Name:          strings.TrimSpace(cols[0]),
+			Vendor:        "NVIDIA Corporation",
+			DriverVersion: strings.TrimSpace(cols[1]),
+			VRAM:          mib * 1024 * 1024,
+		})
+	}
+	return ret
+}
+
+// splitQuoted splits lspci -mm output, keeping quoted fields together
+func splitQuoted(s string) []string {
+	ret := make([]string, 0)
+	var cur strings.Builder
+	inQuote := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case r == ' ' && !inQuote:
+			if cur.Len() > 0 {
+				ret = append(ret, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		ret = append(ret, cur.String())
+	}
+	return ret
+}
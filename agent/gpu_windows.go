@@ -0,0 +1,39 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"github.com/StackExchange/wmi"
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetGPUInfo returns the video controllers reported by wmi
+func (a *Agent) GetGPUInfo() ([]rmm.GPUInfo, error) {
+	var dst []rmm.Win32_VideoController
+	ret := make([]rmm.GPUInfo, 0)
+
+	q := wmi.CreateQuery(&dst, "")
+	if err := wmi.Query(q, &dst); err != nil {
+		return ret, err
+	}
+
+	for _, v := range dst {
+		ret = append(ret, rmm.GPUInfo{
+			Name:          v.Name,
+			Vendor:        v.AdapterCompatibility,
+			DriverVersion: v.DriverVersion,
+			// AdapterRAM is a uint32 so wmi caps it at 4GB
+			VRAM: uint64(v.AdapterRAM),
+		})
+	}
+	return ret, nil
+}
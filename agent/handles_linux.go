@@ -0,0 +1,54 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetHandleStats returns system wide open file descriptors and the kernel limit
+func (a *Agent) GetHandleStats() (rmm.HandleStats, error) {
+	var ret rmm.HandleStats
+
+	// allocated, allocated but unused (always 0 on 2.6+), max
+	b, err := os.ReadFile("/proc/sys/fs/file-nr")
+	if err != nil {
+		return ret, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 3 {
+		allocated, aerr := strconv.ParseUint(fields[0], 10, 64)
+		unused, uerr := strconv.ParseUint(fields[1], 10, 64)
+		if aerr == nil && uerr == nil && allocated >= unused {
+			ret.Open = allocated - unused
+			ret.HasOpen = true
+		}
+		if max, err := strconv.ParseUint(fields[2], 10, 64); err == nil {
+			ret.Limit = max
+			ret.HasLimit = true
+		}
+	}
+
+	if !ret.HasLimit {
+		if b, err := os.ReadFile("/proc/sys/fs/file-max"); err == nil {
+			if max, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64); err == nil {
+				ret.Limit = max
+				ret.HasLimit = true
+			}
+		}
+	}
+	return ret, nil
+}
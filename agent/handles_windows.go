@@ -0,0 +1,34 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"github.com/StackExchange/wmi"
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetHandleStats returns the total handle count from the process performance counters
+// Windows has no system wide handle limit so HasLimit is always false
+func (a *Agent) GetHandleStats() (rmm.HandleStats, error) {
+	var ret rmm.HandleStats
+	var procs []struct {
+		HandleCount uint32
+	}
+	if err := wmi.Query("SELECT HandleCount FROM Win32_PerfFormattedData_PerfProc_Process WHERE Name = '_Total'", &procs); err != nil {
+		return ret, err
+	}
+	if len(procs) > 0 {
+		ret.Open = uint64(procs[0].HandleCount)
+		ret.HasOpen = true
+	}
+	return ret, nil
+}
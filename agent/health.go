@@ -0,0 +1,154 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+const (
+	// hello checkins go out every 30-60 seconds so anything older than this means they're failing
+	healthCheckinMaxAge = 10 * time.Minute
+	healthMinFreeDisk   = 1 << 30
+)
+
+// unix time of the last checkin published to nats
+var lastCheckin int64
+
+func markCheckin() {
+	atomic.StoreInt64(&lastCheckin, time.Now().Unix())
+}
+
+// HealthCheck runs a set of self checks so support can assess the agent with one call
+func (a *Agent) HealthCheck() rmm.HealthReport {
+	checks := []rmm.HealthCheckResult{
+		a.healthNats(),
+		a.healthAPI(),
+		a.healthElevated(),
+	}
+	for _, d := range a.CheckDependencies().Dependencies {
+		checks = append(checks, healthResult(d.Name, d.Passed, d.Detail))
+	}
+	checks = append(checks,
+		a.healthDisk(),
+		a.healthCheckin(),
+		a.healthExecQueue(),
+	)
+
+	healthy := true
+	for _, c := range checks {
+		if !c.Passed {
+			healthy = false
+			break
+		}
+	}
+	return rmm.HealthReport{
+		Healthy:   healthy,
+		Version:   a.Version,
+		Timestamp: time.Now().Unix(),
+		Checks:    checks,
+	}
+}
+
+func healthResult(name string, passed bool, detail string) rmm.HealthCheckResult {
+	return rmm.HealthCheckResult{Name: name, Passed: passed, Detail: detail}
+}
+
+func (a *Agent) healthNats() rmm.HealthCheckResult {
+	a.auth.natsMu.Lock()
+	sessions := make([]*natsSession, len(a.auth.sessions))
+	copy(sessions, a.auth.sessions)
+	a.auth.natsMu.Unlock()
+
+	if len(sessions) == 0 {
+		return healthResult("nats", false, "no nats connections")
+	}
+	status, _ := a.NatsStatus()
+	for _, s := range sessions {
+		nc := s.Conn()
+		if nc == nil || !nc.IsConnected() {
+			detail := "not connected"
+			if nc != nil {
+				detail = nc.Status().String()
+			}
+			if status.LastError != "" {
+				detail += ", last error: " + status.LastError
+			}
+			return healthResult("nats", false, detail)
+		}
+	}
+	return healthResult("nats", true, fmt.Sprintf("%d connections up, %d reconnects", len(sessions), status.Reconnects))
+}
+
+func (a *Agent) healthAPI() rmm.HealthCheckResult {
+	rClient := a.newRestyClient(15 * time.Second)
+	start := time.Now()
+	r, err := rClient.R().Get(fmt.Sprintf("/api/v3/%s/checkinterval/", a.agentID()))
+	if err != nil {
+		return healthResult("api", false, err.Error())
+	}
+	if r.IsError() {
+		return healthResult("api", false, r.Status())
+	}
+	return healthResult("api", true, fmt.Sprintf("%s in %v", r.Status(), time.Since(start).Round(time.Millisecond)))
+}
+
+func (a *Agent) healthElevated() rmm.HealthCheckResult {
+	elevated, err := a.IsElevated()
+	if err != nil {
+		return healthResult("elevated", false, err.Error())
+	}
+	if !elevated {
+		return healthResult("elevated", false, "not running with admin rights, registry, service and update tasks will fail")
+	}
+	return healthResult("elevated", true, "running with admin rights")
+}
+
+func (a *Agent) healthDisk() rmm.HealthCheckResult {
+	path := "/"
+	if runtime.GOOS == "windows" {
+		path = strings.TrimSuffix(a.SystemDrive, `\`) + `\`
+	}
+	usage, err := disk.Usage(path)
+	if err != nil {
+		return healthResult("disk", false, err.Error())
+	}
+	detail := fmt.Sprintf("%s free on %s", ByteCountSI(usage.Free), path)
+	return healthResult("disk", usage.Free >= healthMinFreeDisk, detail)
+}
+
+func (a *Agent) healthCheckin() rmm.HealthCheckResult {
+	last := atomic.LoadInt64(&lastCheckin)
+	if last == 0 {
+		return healthResult("checkin", false, "no checkin since the agent started")
+	}
+	t := time.Unix(last, 0)
+	detail := fmt.Sprintf("last checkin %s", t.UTC().Format(time.RFC3339))
+	return healthResult("checkin", time.Since(t) < healthCheckinMaxAge, detail)
+}
+
+func (a *Agent) healthExecQueue() rmm.HealthCheckResult {
+	running, queued := a.executionQueue()
+	limit := cap(a.cmdLimiter.slots)
+	if limit == 0 {
+		return healthResult("exec_queue", true, fmt.Sprintf("%d running, no limit", running))
+	}
+	// a backlog bigger than the limit means commands are arriving faster than they finish
+	return healthResult("exec_queue", queued <= limit, fmt.Sprintf("%d running, %d queued (limit %d)", running, queued, limit))
+}
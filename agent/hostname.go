@@ -0,0 +1,106 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	ps "github.com/elastic/go-sysinfo"
+)
+
+// CheckHostnameConsistency compares the os hostname with the fqdn, reverse dns of the primary ip and what the rmm has recorded
+// Missing reverse dns or an unreachable rmm leave those fields empty rather than failing
+func (a *Agent) CheckHostnameConsistency() (rmm.HostnameReport, error) {
+	ret := rmm.HostnameReport{
+		AgentHostname: a.Hostname,
+		ReverseDNS:    []string{},
+		Mismatches:    []string{},
+	}
+
+	host, err := ps.Host()
+	if err != nil {
+		return ret, err
+	}
+	ret.Hostname = host.Info().Hostname
+	short := shortHostname(ret.Hostname)
+	mismatch := func(format string, args ...interface{}) {
+		ret.Mismatches = append(ret.Mismatches, fmt.Sprintf(format, args...))
+	}
+
+	if !strings.EqualFold(ret.Hostname, a.Hostname) {
+		mismatch("hostname is %s but the agent is reporting %s, restart the agent to pick up the rename", ret.Hostname, a.Hostname)
+	}
+
+	if fqdn, err := fqdn(); err == nil {
+		ret.FQDN = fqdn
+		if !strings.EqualFold(shortHostname(fqdn), short) {
+			mismatch("fqdn %s does not match hostname %s", fqdn, ret.Hostname)
+		}
+	} else {
+		a.Logger.Debugln("CheckHostnameConsistency() fqdn:", err)
+	}
+
+	if ip := a.primaryIP(); ip != "" {
+		ret.PrimaryIP = ip
+		if names, err := net.LookupAddr(ip); err == nil {
+			matched := false
+			for _, n := range names {
+				n = strings.TrimSuffix(n, ".")
+				ret.ReverseDNS = append(ret.ReverseDNS, n)
+				if strings.EqualFold(shortHostname(n), short) {
+					matched = true
+				}
+			}
+			if len(names) > 0 && !matched {
+				mismatch("reverse dns of %s is %s, not %s", ip, strings.Join(ret.ReverseDNS, ", "), ret.Hostname)
+			}
+		}
+	}
+
+	var server struct {
+		Hostname string `json:"hostname"`
+	}
+	r, err := a.rClient.R().SetResult(&server).Get(fmt.Sprintf("/api/v3/%s/hostname/", a.agentID()))
+	if err == nil && !r.IsError() {
+		ret.ServerHostname = server.Hostname
+		if server.Hostname != "" && !strings.EqualFold(server.Hostname, ret.Hostname) {
+			mismatch("rmm has hostname %s recorded, os hostname is %s", server.Hostname, ret.Hostname)
+		}
+	} else if err != nil {
+		a.Logger.Debugln("CheckHostnameConsistency() server hostname:", err)
+	}
+	return ret, nil
+}
+
+// primaryIP returns the local address used to reach the rmm, no packets are sent
+func (a *Agent) primaryIP() string {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(a.apiURL(), "443"), 5*time.Second)
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
+
+func shortHostname(name string) string {
+	if i := strings.Index(name, "."); i > 0 {
+		return name[:i]
+	}
+	return name
+}
@@ -0,0 +1,30 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+func fqdn() (string, error) {
+	out, err := runTool(5*time.Second, "hostname", "-f")
+	if err != nil {
+		return "", err
+	}
+	name := strings.TrimSpace(out)
+	if name == "" {
+		return "", errors.New("hostname -f returned nothing")
+	}
+	return name, nil
+}
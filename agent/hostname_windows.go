@@ -0,0 +1,30 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+func fqdn() (string, error) {
+	n := uint32(256)
+	for {
+		buf := make([]uint16, n)
+		err := windows.GetComputerNameEx(windows.ComputerNameDnsFullyQualified, &buf[0], &n)
+		if err == nil {
+			return windows.UTF16ToString(buf[:n]), nil
+		}
+		if err != windows.ERROR_MORE_DATA {
+			return "", err
+		}
+	}
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// hostsMu serializes edits to the hosts file from this process, lockHosts adds a lock file for other processes
+var hostsMu sync.Mutex
+
+func hostsFilePath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("SystemRoot"), "System32", "drivers", "etc", "hosts")
+	}
+	return "/etc/hosts"
+}
+
+// lockHosts serializes hosts file edits in this process with hostsMu and across processes,
+// like an rpc call racing a cli run, with hosts.rmmbak.lock next to the hosts file
+func lockHosts() (unlock func(), err error) {
+	hostsMu.Lock()
+	unlockFile, err := lockFile(hostsFilePath() + ".rmmbak.lock")
+	if err != nil {
+		hostsMu.Unlock()
+		return nil, err
+	}
+	return func() {
+		unlockFile()
+		hostsMu.Unlock()
+	}, nil
+}
+
+// GetHostsEntries returns the mappings in the hosts file, Line is 1 based
+func (a *Agent) GetHostsEntries() ([]rmm.HostEntry, error) {
+	unlock, err := lockHosts()
+	if err != nil {
+		return []rmm.HostEntry{}, err
+	}
+	defer unlock()
+
+	lines, _, err := readHostsFile()
+	if err != nil {
+		return []rmm.HostEntry{}, err
+	}
+	ret := make([]rmm.HostEntry, 0)
+	for i, line := range lines {
+		if e, ok := parseHostsLine(line); ok {
+			e.Line = i + 1
+			ret = append(ret, e)
+		}
+	}
+	return ret, nil
+}
+
+// AddHostsEntry appends ip hostname to the hosts file, a no-op if it's already there
+// A hostname already mapped to a different ip is an error rather than a second entry
+func (a *Agent) AddHostsEntry(ip, hostname, comment string) error {
+	if net.ParseIP(ip) == nil {
+		return fmt.Errorf("invalid ip address %q", ip)
+	}
+	if !validHostname(hostname) {
+		return fmt.Errorf("invalid hostname %q", hostname)
+	}
+	comment = strings.Join(strings.Fields(comment), " ")
+
+	unlock, err := lockHosts()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	lines, eol, err := readHostsFile()
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		e, ok := parseHostsLine(line)
+		if !ok || !hasHostname(e.Hostnames, hostname) {
+			continue
+		}
+		if net.ParseIP(e.IP).Equal(net.ParseIP(ip)) {
+			return nil
+		}
+		return fmt.Errorf("%s is already mapped to %s", hostname, e.IP)
+	}
+
+	entry := ip + "\t" + hostname
+	if comment != "" {
+		entry += "\t# " + comment
+	}
+	// a trailing newline shows up as an empty last line, keep it last
+	if n := len(lines); n > 0 && lines[n-1] == "" {
+		lines = append(lines[:n-1], entry, "")
+	} else {
+		lines = append(lines, entry, "")
+	}
+	return writeHostsFile(lines, eol)
+}
+
+// RemoveHostsEntry removes hostname from the hosts file, lines mapping other names as well only lose that name
+func (a *Agent) RemoveHostsEntry(hostname string) error {
+	if hostname == "" {
+		return errors.New("hostname is empty")
+	}
+
+	unlock, err := lockHosts()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	lines, eol, err := readHostsFile()
+	if err != nil {
+		return err
+	}
+	found := false
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		e, ok := parseHostsLine(line)
+		if !ok || !hasHostname(e.Hostnames, hostname) {
+			out = append(out, line)
+			continue
+		}
+		found = true
+		names := make([]string, 0, len(e.Hostnames))
+		for _, n := range e.Hostnames {
+			if !strings.EqualFold(n, hostname) {
+				names = append(names, n)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		rebuilt := e.IP + "\t" + strings.Join(names, " ")
+		if e.Comment != "" {
+			rebuilt += "\t# " + e.Comment
+		}
+		out = append(out, rebuilt)
+	}
+	if !found {
+		return fmt.Errorf("%s is not in the hosts file", hostname)
+	}
+	return writeHostsFile(out, eol)
+}
+
+// parseHostsLine splits an entry into ip, names and trailing comment, ok is false for blank and comment lines
+func parseHostsLine(line string) (rmm.HostEntry, bool) {
+	var comment string
+	if i := strings.Index(line, "#"); i >= 0 {
+		comment = strings.TrimSpace(line[i+1:])
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return rmm.HostEntry{}, false
+	}
+	return rmm.HostEntry{IP: fields[0], Hostnames: fields[1:], Comment: comment}, true
+}
+
+// validHostname checks hostname is made of rfc 1123 labels, which also keeps anything that would
+// break the hosts file format, like a newline, out of it
+func validHostname(hostname string) bool {
+	if hostname == "" || len(hostname) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(hostname, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func hasHostname(names []string, hostname string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+// readHostsFile returns the hosts file's lines and the line ending it uses
+func readHostsFile() ([]string, string, error) {
+	b, err := os.ReadFile(hostsFilePath())
+	if err != nil {
+		return nil, "", err
+	}
+	s := string(b)
+	eol := "\n"
+	if strings.Contains(s, "\r\n") || (runtime.GOOS == "windows" && !strings.Contains(s, "\n")) {
+		eol = "\r\n"
+	}
+	return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n"), eol, nil
+}
+
+// writeHostsFile backs up the current file to hosts.rmmbak then rewrites it in place
+// Writing in place rather than renaming a new file over it keeps the file's owner, acl and selinux context,
+// and works for a container's bind mounted /etc/hosts. If the write fails the backup is put back
+func writeHostsFile(lines []string, eol string) error {
+	path := hostsFilePath()
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	old, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".rmmbak", old, fi.Mode().Perm()); err != nil {
+		return fmt.Errorf("backing up hosts file: %w", err)
+	}
+
+	if err := writeInPlace(path, []byte(strings.Join(lines, eol))); err != nil {
+		if rerr := writeInPlace(path, old); rerr != nil {
+			return fmt.Errorf("%v, and restoring it from %s.rmmbak failed: %v", err, path, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// writeInPlace rewrites an existing file without replacing it. The content is written over the old
+// before the file is cut to its new length, so a failed write never leaves an empty or short file behind
+func writeInPlace(path string, content []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(content, 0); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Truncate(int64(len(content))); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
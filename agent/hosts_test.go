@@ -0,0 +1,94 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+func TestParseHostsLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want rmm.HostEntry
+		ok   bool
+	}{
+		{"127.0.0.1 localhost", rmm.HostEntry{IP: "127.0.0.1", Hostnames: []string{"localhost"}}, true},
+		{"::1 localhost ip6-localhost # loopback", rmm.HostEntry{IP: "::1", Hostnames: []string{"localhost", "ip6-localhost"}, Comment: "loopback"}, true},
+		{"  10.0.0.2\tdb  db.local#primary", rmm.HostEntry{IP: "10.0.0.2", Hostnames: []string{"db", "db.local"}, Comment: "primary"}, true},
+		{"# 10.0.0.3 old", rmm.HostEntry{}, false},
+		{"10.0.0.4", rmm.HostEntry{}, false},
+		{"", rmm.HostEntry{}, false},
+		{"   ", rmm.HostEntry{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseHostsLine(tt.line)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseHostsLine(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestValidHostname(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     bool
+	}{
+		{"localhost", true},
+		{"db-1.example.com", true},
+		{"1host", true},
+		{"XN--BCHER-KVA.example", true},
+		{strings.Repeat("a", 63) + ".com", true},
+		{strings.Repeat("a", 64) + ".com", false},
+		{strings.Repeat("a.", 126) + "a", true},
+		{strings.Repeat("a.", 127) + "a", false},
+		{"", false},
+		{"-host", false},
+		{"host-", false},
+		{"a..b", false},
+		{"host.", false},
+		{"under_score", false},
+		{"two words", false},
+		{"evil\n1.2.3.4 bank.com", false},
+		{"host#comment", false},
+	}
+	for _, tt := range tests {
+		if got := validHostname(tt.hostname); got != tt.want {
+			t.Errorf("validHostname(%q) = %v, want %v", tt.hostname, got, tt.want)
+		}
+	}
+}
+
+func TestWriteInPlace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	for _, content := range []string{
+		"127.0.0.1\tlocalhost\n",
+		"127.0.0.1\tlocalhost\n10.0.0.1\tserver\t# added\n",
+		"::1\tlocalhost\n",
+		"",
+	} {
+		if err := os.WriteFile(path, []byte("127.0.0.1\tlocalhost\n10.0.0.1\tserver\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeInPlace(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := os.ReadFile(path); string(b) != content {
+			t.Errorf("writeInPlace(%q) left %q", content, b)
+		}
+	}
+}
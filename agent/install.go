@@ -12,6 +12,7 @@ https://license.tacticalrmm.com
 package agent
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net/url"
@@ -131,7 +132,12 @@ func (a *Agent) Install(i *Installer) {
 		if !trmm.FileExists(i.Cert) {
 			a.installerMsg(fmt.Sprintf("%s does not exist", i.Cert), "error", i.Silent)
 		}
-		rClient.SetRootCertificate(i.Cert)
+		pool, n, err := LoadCABundle(i.Cert)
+		if err != nil {
+			a.installerMsg(err.Error(), "error", i.Silent)
+		}
+		a.Logger.Debugf("Loaded %d certificates from %s", n, i.Cert)
+		rClient.SetTLSClientConfig(&tls.Config{RootCAs: pool})
 	}
 
 	if len(i.Proxy) > 0 {
@@ -191,8 +197,9 @@ func (a *Agent) Install(i *Installer) {
 	a.Logger.Infoln("Adding agent to dashboard")
 	// add agent
 	type NewAgentResp struct {
-		AgentPK int    `json:"pk"`
-		Token   string `json:"token"`
+		AgentPK      int    `json:"pk"`
+		Token        string `json:"token"`
+		EnrollSecret string `json:"enroll_secret"`
 	}
 	agentPayload := map[string]interface{}{
 		"agent_id":        a.AgentID,
@@ -225,12 +232,27 @@ func (a *Agent) Install(i *Installer) {
 	a = New(a.Logger, a.Version)
 	a.Logger.Debugf("%+v\n", a)
 
+	// older servers don't hand out a secret, those agents just can't re-authenticate on their own
+	if secret := r.Result().(*NewAgentResp).EnrollSecret; secret != "" {
+		if err := saveEnrollSecret(secret); err != nil {
+			a.Logger.Errorln("saveEnrollSecret():", err)
+		} else {
+			a.auth.secret = secret
+		}
+	}
+
+	if err := a.saveHardwareFingerprint(); err != nil {
+		a.Logger.Debugln("saveHardwareFingerprint():", err)
+	}
+
 	// set new headers, no longer knox auth...use agent auth
 	rClient.SetHeaders(a.Headers)
 
 	time.Sleep(3 * time.Second)
-	// check in once
-	a.DoNatsCheckIn()
+	// check in once so the dashboard has complete data right away
+	if err := a.RunStartupTasks(); err != nil {
+		a.Logger.Errorln(err)
+	}
 
 	if runtime.GOOS == "windows" {
 		// send software api
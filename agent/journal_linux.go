@@ -0,0 +1,145 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	trmm "github.com/wh1te909/trmm-shared"
+)
+
+const (
+	// entries returned when the caller doesn't ask for a number
+	journalDefaultEntries = 1000
+	// most entries a call can ask for, they're all held in memory
+	journalMaxEntries = 10000
+)
+
+// journalAvailable checks for journalctl and a running journald
+func journalAvailable() (string, bool) {
+	bin, err := exec.LookPath("journalctl")
+	if err != nil {
+		return "", false
+	}
+	if !trmm.FileExists("/run/systemd/journal") {
+		return "", false
+	}
+	return bin, true
+}
+
+// GetJournalLog reads entries from the systemd journal, newest first
+// unit and priority are optional filters, pass an empty unit or a priority < 0 to skip them
+// max <= 0 returns journalDefaultEntries entries, and it's capped at journalMaxEntries
+func (a *Agent) GetJournalLog(unit string, priority int, since time.Time, max int) ([]rmm.JournalEntry, error) {
+	ret := make([]rmm.JournalEntry, 0)
+
+	bin, ok := journalAvailable()
+	if !ok {
+		return ret, ErrJournalUnsupported
+	}
+
+	args := []string{"--no-pager", "--output=json", "--reverse"}
+	if unit != "" {
+		args = append(args, fmt.Sprintf("--unit=%s", unit))
+	}
+	if priority >= 0 {
+		args = append(args, fmt.Sprintf("--priority=%d", priority))
+	}
+	if !since.IsZero() {
+		args = append(args, fmt.Sprintf("--since=%s", since.Format("2006-01-02 15:04:05")))
+	}
+	if max <= 0 {
+		max = journalDefaultEntries
+	} else if max > journalMaxEntries {
+		max = journalMaxEntries
+	}
+	args = append(args, fmt.Sprintf("--lines=%d", max))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	var outb, errb bytes.Buffer
+	a.Logger.Debugln(bin, args)
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Stdout = &outb
+	cmd.Stderr = &errb
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return ret, ctx.Err()
+		}
+		return ret, fmt.Errorf("%s: %s", err, CleanString(errb.String()))
+	}
+
+	uid := 0
+	scanner := bufio.NewScanner(&outb)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		entry, err := parseJournalEntry(scanner.Bytes(), uid)
+		if err != nil {
+			a.Logger.Debugln("GetJournalLog():", err)
+			continue
+		}
+		ret = append(ret, entry)
+		uid++
+	}
+	return ret, scanner.Err()
+}
+
+// parseJournalEntry parses one line of journalctl --output=json
+func parseJournalEntry(line []byte, uid int) (rmm.JournalEntry, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return rmm.JournalEntry{}, err
+	}
+
+	entry := rmm.JournalEntry{
+		Unit:       journalString(raw["_SYSTEMD_UNIT"]),
+		Identifier: journalString(raw["SYSLOG_IDENTIFIER"]),
+		Message:    CleanString(journalString(raw["MESSAGE"])),
+		UID:        uid,
+	}
+	entry.Priority, _ = strconv.Atoi(journalString(raw["PRIORITY"]))
+	entry.PID, _ = strconv.Atoi(journalString(raw["_PID"]))
+
+	usec, err := strconv.ParseInt(journalString(raw["__REALTIME_TIMESTAMP"]), 10, 64)
+	if err == nil {
+		entry.Time = time.UnixMicro(usec).Format("2006-01-02 15:04:05")
+	}
+	return entry, nil
+}
+
+// journalString converts a journal json field to a string
+// binary fields are exported by journalctl as an array of bytes
+func journalString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []interface{}:
+		b := make([]byte, 0, len(val))
+		for _, i := range val {
+			if n, ok := i.(float64); ok {
+				b = append(b, byte(n))
+			}
+		}
+		return string(b)
+	}
+	return ""
+}
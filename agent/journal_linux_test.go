@@ -0,0 +1,90 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"testing"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+func TestJournalString(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{"plain", "plain"},
+		// binary fields, like messages with control characters, come as an array of bytes
+		{[]interface{}{float64('h'), float64('i'), float64(0x1b), float64('!')}, "hi\x1b!"},
+		{[]interface{}{float64(0xe2), float64(0x9c), float64(0x93)}, "✓"},
+		{[]interface{}{"x", float64('a')}, "a"},
+		{[]interface{}{}, ""},
+		{nil, ""},
+		{float64(3), ""},
+	}
+	for _, tt := range tests {
+		if got := journalString(tt.v); got != tt.want {
+			t.Errorf("journalString(%#v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestParseJournalEntry(t *testing.T) {
+	const usec = 1700000000123456
+	ts := time.UnixMicro(usec).Format("2006-01-02 15:04:05")
+
+	tests := []struct {
+		name    string
+		line    string
+		uid     int
+		want    rmm.JournalEntry
+		wantErr bool
+	}{
+		{
+			name: "full entry",
+			line: `{"__REALTIME_TIMESTAMP":"1700000000123456","PRIORITY":"3","_PID":"812","_SYSTEMD_UNIT":"sshd.service","SYSLOG_IDENTIFIER":"sshd","MESSAGE":"Failed password for root"}`,
+			uid:  4,
+			want: rmm.JournalEntry{Unit: "sshd.service", Identifier: "sshd", Priority: 3, PID: 812, Message: "Failed password for root", Time: ts, UID: 4},
+		},
+		{
+			name: "binary message",
+			line: `{"__REALTIME_TIMESTAMP":"1700000000123456","PRIORITY":"6","MESSAGE":[111,107,0,10,100,111,110,101]}`,
+			want: rmm.JournalEntry{Priority: 6, Message: "ok\ndone", Time: ts},
+		},
+		{
+			name: "missing fields",
+			line: `{"MESSAGE":"kernel: hello"}`,
+			want: rmm.JournalEntry{Message: "kernel: hello"},
+		},
+		{
+			name: "bad numbers",
+			line: `{"PRIORITY":"high","_PID":"","__REALTIME_TIMESTAMP":"soon","MESSAGE":"x"}`,
+			want: rmm.JournalEntry{Message: "x"},
+		},
+		{
+			name:    "not json",
+			line:    `-- No entries --`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseJournalEntry([]byte(tt.line), tt.uid)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: parseJournalEntry() error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: parseJournalEntry() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// debug and trace set at runtime revert to the previous level after this long
+const logLevelRevertAfter = time.Hour
+
+type logLevelState struct {
+	sync.Mutex
+	// level to go back to once a raised level expires
+	base  logrus.Level
+	timer *time.Timer
+}
+
+// GetLogLevel returns the agent's current log level
+func (a *Agent) GetLogLevel() string {
+	return a.Logger.GetLevel().String()
+}
+
+// SetLogLevel changes the log level without restarting the service
+// debug and trace are temporary and revert after logLevelRevertAfter, other levels last until the agent restarts
+func (a *Agent) SetLogLevel(level string) error {
+	ll, err := logrus.ParseLevel(strings.TrimSpace(level))
+	if err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+
+	s := a.logLevel
+	s.Lock()
+	defer s.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if ll < logrus.DebugLevel {
+		s.base = ll
+	} else {
+		s.timer = time.AfterFunc(logLevelRevertAfter, func() {
+			s.Lock()
+			defer s.Unlock()
+			a.Logger.Infof("Reverting log level from %s to %s\n", a.Logger.GetLevel(), s.base)
+			a.applyLogLevel(s.base)
+			s.timer = nil
+		})
+	}
+
+	a.Logger.Infof("Log level changed from %s to %s\n", a.Logger.GetLevel(), ll)
+	a.applyLogLevel(ll)
+	return nil
+}
+
+func (a *Agent) applyLogLevel(ll logrus.Level) {
+	a.Logger.SetLevel(ll)
+	a.Debug = a.Logger.IsLevelEnabled(logrus.DebugLevel)
+	a.rClient.SetDebug(a.Debug)
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+type lsblkDevice struct {
+	Name     string        `json:"name"`
+	Type     string        `json:"type"`
+	FSType   string        `json:"fstype"`
+	Children []lsblkDevice `json:"children"`
+}
+
+// GetLUKSStatus returns every luks formatted block device and whether it's currently unlocked
+func (a *Agent) GetLUKSStatus() ([]rmm.VolumeEncryption, error) {
+	ret := make([]rmm.VolumeEncryption, 0)
+	if _, err := exec.LookPath("cryptsetup"); err != nil {
+		return ret, ErrNotSupported
+	}
+
+	out, err := runTool(15*time.Second, "lsblk", "-J", "-o", "NAME,TYPE,FSTYPE")
+	if err != nil {
+		return ret, err
+	}
+	var tree struct {
+		BlockDevices []lsblkDevice `json:"blockdevices"`
+	}
+	if err := json.Unmarshal([]byte(out), &tree); err != nil {
+		return ret, err
+	}
+
+	var walk func(devs []lsblkDevice)
+	walk = func(devs []lsblkDevice) {
+		for _, d := range devs {
+			if d.FSType == "crypto_LUKS" {
+				ret = append(ret, a.luksVolume(d))
+			}
+			walk(d.Children)
+		}
+	}
+	walk(tree.BlockDevices)
+	return ret, nil
+}
+
+func (a *Agent) luksVolume(d lsblkDevice) rmm.VolumeEncryption {
+	dev := "/dev/" + d.Name
+	v := rmm.VolumeEncryption{
+		Volume:    dev,
+		Type:      "luks",
+		Encrypted: true,
+		Status:    "fully encrypted",
+		Protected: true,
+	}
+	// an open luks device has its dm-crypt mapping as a child
+	for _, c := range d.Children {
+		if c.Type == "crypt" {
+			v.Unlocked = true
+			break
+		}
+	}
+
+	dump, err := runTool(15*time.Second, "cryptsetup", "luksDump", dev)
+	if err != nil {
+		a.Logger.Debugln("GetLUKSStatus() luksDump:", err)
+		return v
+	}
+	v.Method = luksCipher(dump)
+	return v
+}
+
+// luksCipher pulls the cipher out of luksDump, "Cipher name:" and "Cipher mode:" for luks1 and "cipher:" under Data segments for luks2
+func luksCipher(dump string) string {
+	var name, mode string
+	for _, line := range strings.Split(dump, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		val := strings.TrimSpace(parts[1])
+		switch parts[0] {
+		case "Cipher name":
+			name = val
+		case "Cipher mode":
+			mode = val
+		case "cipher":
+			if name == "" {
+				return val
+			}
+		}
+	}
+	if name != "" && mode != "" {
+		return name + "-" + mode
+	}
+	return name
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// the window set over nats is kept in AgentState since tasks and checks run in their own process on windows
+const maintenanceStateKey = "maintenance"
+
+// ParseMaintenanceDays parses a comma separated list of weekdays, 0 is sunday
+func ParseMaintenanceDays(s string) ([]int, error) {
+	ret := make([]int, 0)
+	for _, d := range strings.Split(s, ",") {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		n, err := strconv.Atoi(d)
+		if err != nil || n < 0 || n > 6 {
+			return ret, fmt.Errorf("invalid weekday %q", d)
+		}
+		ret = append(ret, n)
+	}
+	return ret, nil
+}
+
+func validateMaintenanceWindow(w rmm.MaintenanceWindow) error {
+	if (w.Start == "") != (w.End == "") {
+		return errors.New("maintenance window needs both a start and an end")
+	}
+	for _, t := range []string{w.Start, w.End} {
+		if t == "" {
+			continue
+		}
+		if _, err := time.Parse("15:04", t); err != nil {
+			return fmt.Errorf("invalid time %q, expected HH:MM", t)
+		}
+	}
+	for _, d := range w.Days {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("invalid weekday %d", d)
+		}
+	}
+	return nil
+}
+
+// maintenanceActiveAt checks if t falls inside the window
+// An enabled window without a start and end is always active
+// Windows that cross midnight belong to the day they start on
+func maintenanceActiveAt(w rmm.MaintenanceWindow, t time.Time) bool {
+	if !w.Enabled {
+		return false
+	}
+	if w.Start == "" && w.End == "" {
+		return true
+	}
+
+	start, err1 := time.Parse("15:04", w.Start)
+	end, err2 := time.Parse("15:04", w.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	now := t.Hour()*60 + t.Minute()
+	s := start.Hour()*60 + start.Minute()
+	e := end.Hour()*60 + end.Minute()
+
+	day := int(t.Weekday())
+	inTime := false
+	if s <= e {
+		inTime = now >= s && now < e
+	} else if now >= s {
+		inTime = true
+	} else if now < e {
+		inTime = true
+		day = (day + 6) % 7
+	}
+	if !inTime {
+		return false
+	}
+
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMaintenanceWindow returns the window set over nats, or the one from the agent config
+func (a *Agent) GetMaintenanceWindow() (rmm.MaintenanceWindow, string) {
+	var w rmm.MaintenanceWindow
+	if found, err := a.state.Get(maintenanceStateKey, &w); err != nil {
+		a.Logger.Debugln("GetMaintenanceWindow():", err)
+	} else if found {
+		return w, "rpc"
+	}
+	return a.MaintenanceWindow, "config"
+}
+
+// SetMaintenanceWindow overrides the configured window until it is cleared
+func (a *Agent) SetMaintenanceWindow(w rmm.MaintenanceWindow) error {
+	if err := validateMaintenanceWindow(w); err != nil {
+		return err
+	}
+	return a.state.Set(maintenanceStateKey, w)
+}
+
+// ClearMaintenanceWindow drops the override and goes back to the configured window
+func (a *Agent) ClearMaintenanceWindow() error {
+	return a.state.Delete(maintenanceStateKey)
+}
+
+// InMaintenance returns true if automated scripts and tasks should not run right now
+func (a *Agent) InMaintenance() bool {
+	w, _ := a.GetMaintenanceWindow()
+	return maintenanceActiveAt(w, time.Now())
+}
+
+func (a *Agent) MaintenanceStatus() rmm.MaintenanceStatus {
+	w, source := a.GetMaintenanceWindow()
+	return rmm.MaintenanceStatus{
+		Window: w,
+		Source: source,
+		Active: maintenanceActiveAt(w, time.Now()),
+	}
+}
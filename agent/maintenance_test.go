@@ -0,0 +1,83 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+func TestMaintenanceActiveAt(t *testing.T) {
+	// 2024-01-01 is a monday
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2024, 1, day, hour, min, 0, 0, time.UTC)
+	}
+	office := rmm.MaintenanceWindow{Enabled: true, Start: "09:00", End: "17:00"}
+	overnight := rmm.MaintenanceWindow{Enabled: true, Start: "22:00", End: "06:00", Days: []int{1}}
+
+	tests := []struct {
+		name string
+		w    rmm.MaintenanceWindow
+		t    time.Time
+		want bool
+	}{
+		{"disabled", rmm.MaintenanceWindow{Start: "00:00", End: "23:59"}, at(1, 12, 0), false},
+		{"no times is always on", rmm.MaintenanceWindow{Enabled: true}, at(1, 3, 0), true},
+		{"inside", office, at(1, 12, 0), true},
+		{"at start", office, at(1, 9, 0), true},
+		{"at end", office, at(1, 17, 0), false},
+		{"before", office, at(1, 8, 59), false},
+		{"other day", rmm.MaintenanceWindow{Enabled: true, Start: "09:00", End: "17:00", Days: []int{2}}, at(1, 12, 0), false},
+		{"listed day", rmm.MaintenanceWindow{Enabled: true, Start: "09:00", End: "17:00", Days: []int{0, 1}}, at(1, 12, 0), true},
+		{"overnight start day", overnight, at(1, 23, 0), true},
+		{"overnight after midnight", overnight, at(2, 5, 59), true},
+		{"overnight end", overnight, at(2, 6, 0), false},
+		{"overnight from the day before", overnight, at(1, 5, 0), false},
+		{"overnight next evening", overnight, at(2, 23, 0), false},
+		{"bad time", rmm.MaintenanceWindow{Enabled: true, Start: "25:00", End: "26:00"}, at(1, 12, 0), false},
+	}
+	for _, tt := range tests {
+		if got := maintenanceActiveAt(tt.w, tt.t); got != tt.want {
+			t.Errorf("%s: maintenanceActiveAt(%+v, %s) = %v, want %v", tt.name, tt.w, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestParseMaintenanceDays(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    []int
+		wantErr bool
+	}{
+		{"1, 2,3", []int{1, 2, 3}, false},
+		{"", []int{}, false},
+		{"0,6,", []int{0, 6}, false},
+		{"7", nil, true},
+		{"-1", nil, true},
+		{"mon", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMaintenanceDays(tt.s)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseMaintenanceDays(%q) = %v, want an error", tt.s, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseMaintenanceDays(%q) = %v, %v, want %v", tt.s, got, err, tt.want)
+		}
+	}
+}
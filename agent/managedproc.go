@@ -0,0 +1,198 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	gocmd "github.com/go-cmd/cmd"
+)
+
+// how long Stop waits after asking the process to exit before killing it
+const managedProcStopGrace = 5 * time.Second
+
+// ManagedProcess is a long running process the agent talks to over stdin and stdout
+// Stdout and Stderr are the raw output and must both be read, the process blocks writing to one nobody reads
+type ManagedProcess struct {
+	Stdin  io.WriteCloser
+	Stdout io.Reader
+	Stderr io.Reader
+
+	a      *Agent
+	cmd    *gocmd.Cmd
+	tree   *procTree
+	cancel context.CancelFunc
+	done   chan struct{}
+	status gocmd.Status
+
+	stdin  *os.File
+	stdout *io.PipeReader
+	stderr *io.PipeReader
+}
+
+// StartProcess starts c and returns a handle for exchanging data with it
+// The process runs until it exits, Stop is called, ctx is done or c.Timeout passes, a zero Timeout means no limit.
+// It holds one of the agent's command slots while it runs
+func (a *Agent) StartProcess(ctx context.Context, c *CmdOptions) (*ManagedProcess, error) {
+	if ret, ok := a.checkPolicy(c); !ok {
+		a.auditCommand(c, ret, time.Now())
+		return nil, ErrBlockedByPolicy
+	}
+	if c.Suppressible && a.InMaintenance() {
+		a.auditCommand(c, CmdStatus{Status: gocmd.Status{Exit: -1, Error: ErrMaintenanceMode}}, time.Now())
+		return nil, ErrMaintenanceMode
+	}
+	release, err := a.acquireCmd(c)
+	if err != nil {
+		a.auditCommand(c, CmdStatus{Status: gocmd.Status{Exit: -1, Error: err}}, time.Now())
+		return nil, err
+	}
+
+	// neither buffered nor streamed, gocmd would split the output into lines and drop them when
+	// they aren't read fast enough. The child writes straight to the pipes instead, set below
+	opts := gocmd.Options{}
+	if c.Detached {
+		opts.BeforeExec = append(opts.BeforeExec, func(cmd *exec.Cmd) {
+			cmd.SysProcAttr = SetDetached()
+		})
+	}
+	if c.KillProcessTree {
+		opts.BeforeExec = append(opts.BeforeExec, prepareProcTree)
+	}
+
+	// a real file rather than an io.Pipe so exec hands it straight to the child, otherwise
+	// Wait blocks on the stdin copy until the caller closes Stdin
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		release()
+		return nil, err
+	}
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+	opts.BeforeExec = append(opts.BeforeExec, func(cmd *exec.Cmd) {
+		cmd.Stdout = stdoutW
+		cmd.Stderr = stderrW
+	})
+
+	var cancel context.CancelFunc
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	cmd := gocmd.NewCmdOptions(opts, c.Shell, c.cmdArgs()...)
+	p := &ManagedProcess{
+		Stdin:  stdinW,
+		Stdout: stdoutR,
+		Stderr: stderrR,
+		a:      a,
+		cmd:    cmd,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		stdin:  stdinW,
+		stdout: stdoutR,
+		stderr: stderrR,
+	}
+
+	start := time.Now()
+	statusChan := cmd.StartWithStdin(stdinR)
+
+	if c.KillProcessTree {
+		p.tree = a.trackCmdTree(cmd, p.done)
+	}
+
+	go func() {
+		// exec's Wait returns once it has copied all the output, readers get EOF after what's left
+		status := <-statusChan
+		stdoutW.Close()
+		stderrW.Close()
+		stdinR.Close()
+		if p.tree != nil {
+			p.tree.Close()
+		}
+		p.status = status
+		close(p.done)
+		cancel()
+		release()
+		a.auditCommand(c, CmdStatus{Status: status}, start)
+	}()
+
+	go func() {
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+			p.terminate()
+		}
+	}()
+
+	return p, nil
+}
+
+// terminate asks the process to exit and kills it if it's still running after the grace period
+func (p *ManagedProcess) terminate() {
+	// unblock exec's output copy in case nobody is reading
+	p.stdout.Close()
+	p.stderr.Close()
+	p.stdin.Close()
+
+	err := p.cmd.Stop()
+	// a caller can cancel before gocmd has marked the process started
+	for i := 0; errors.Is(err, gocmd.ErrNotStarted) && i < 100; i++ {
+		select {
+		case <-p.done:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+		err = p.cmd.Stop()
+	}
+	if err != nil {
+		p.a.Logger.Debugln("ManagedProcess Stop():", err)
+	}
+	select {
+	case <-p.done:
+		return
+	case <-time.After(managedProcStopGrace):
+	}
+
+	pid := p.cmd.Status().PID
+	p.a.Logger.Debugln("ManagedProcess did not exit, killing PID", pid)
+	if p.tree != nil {
+		if err := p.tree.Kill(); err == nil {
+			return
+		}
+	}
+	KillProc(int32(pid))
+}
+
+// Stop ends the process and waits for it to exit, it's safe to call more than once
+func (p *ManagedProcess) Stop() gocmd.Status {
+	p.cancel()
+	<-p.done
+	return p.status
+}
+
+// Done is closed once the process has exited
+func (p *ManagedProcess) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait blocks until the process exits on its own and returns its status
+func (p *ManagedProcess) Wait() gocmd.Status {
+	<-p.done
+	return p.status
+}
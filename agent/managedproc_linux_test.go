@@ -0,0 +1,72 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestStartProcessRawOutput(t *testing.T) {
+	a := testAgent()
+	a.cmdLimiter = newExecLimiter(0, 0)
+
+	p, err := a.StartProcess(context.Background(), &CmdOptions{Shell: "/bin/sh", Command: "cat", Timeout: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// no trailing newline and bytes that aren't text, line splitting would change both
+	in := []byte("one\ntwo\x00\xff\r\nthree")
+	go func() {
+		p.Stdin.Write(in)
+		p.Stdin.Close()
+	}()
+	go io.Copy(io.Discard, p.Stderr)
+
+	out, err := io.ReadAll(p.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Errorf("stdout %q, want %q", out, in)
+	}
+	if st := p.Wait(); st.Exit != 0 {
+		t.Errorf("exit %d, want 0", st.Exit)
+	}
+}
+
+func TestStartProcessContext(t *testing.T) {
+	a := testAgent()
+	a.cmdLimiter = newExecLimiter(1, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p, err := a.StartProcess(ctx, &CmdOptions{Shell: "/bin/sh", Command: "sleep 30", Initiator: "rpc:test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := a.GetExecutionQueueDepth(); got != 1 {
+		t.Errorf("queue depth %d while running, want 1", got)
+	}
+	cancel()
+
+	select {
+	case <-p.Done():
+	case <-time.After(managedProcStopGrace + 5*time.Second):
+		t.Fatal("process still running after its context was cancelled")
+	}
+	if got := a.GetExecutionQueueDepth(); got != 0 {
+		t.Errorf("queue depth %d after exit, want 0", got)
+	}
+}
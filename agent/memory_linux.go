@@ -0,0 +1,133 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+const (
+	// how long swap activity is sampled for
+	memPressureInterval = time.Second
+	// most recent oom kills included in the report
+	memPressureMaxEvents = 10
+)
+
+// GetMemoryPressure reports available memory, swap activity, psi stall averages and oom kills since boot
+// Swap rates are 0 without swap. The oom messages come from the kernel log, if that can't be read OOMEventsError says why
+func (a *Agent) GetMemoryPressure() (rmm.MemPressure, error) {
+	var ret rmm.MemPressure
+
+	vm, err := mem.VirtualMemory()
+	if err != nil {
+		return ret, err
+	}
+	ret.TotalMemory = vm.Total
+	ret.AvailableMemory = vm.Available
+	if swap, err := mem.SwapMemory(); err == nil {
+		ret.SwapTotal = swap.Total
+		ret.SwapUsed = swap.Used
+	}
+
+	before, err := readVMStat()
+	if err != nil {
+		return ret, err
+	}
+	time.Sleep(memPressureInterval)
+	after, err := readVMStat()
+	if err != nil {
+		return ret, err
+	}
+	secs := memPressureInterval.Seconds()
+	ret.SwapInPerSec = float64(after["pswpin"]-before["pswpin"]) / secs
+	ret.SwapOutPerSec = float64(after["pswpout"]-before["pswpout"]) / secs
+
+	// some avg10=0.00 avg60=0.00 avg300=0.00 total=0, needs a 4.20+ kernel with psi enabled
+	if psi, err := os.ReadFile("/proc/pressure/memory"); err == nil {
+		for _, line := range strings.Split(string(psi), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 || !strings.HasPrefix(fields[1], "avg10=") {
+				continue
+			}
+			v, _ := strconv.ParseFloat(strings.TrimPrefix(fields[1], "avg10="), 64)
+			switch fields[0] {
+			case "some":
+				ret.PressureSome = v
+			case "full":
+				ret.PressureFull = v
+			}
+		}
+	}
+
+	events, err := a.oomEvents()
+	if err != nil {
+		ret.OOMEventsError = err.Error()
+	}
+	ret.RecentOOMEvents = events
+	// oom_kill is in vmstat from 4.13, older kernels only have the log
+	if n, ok := after["oom_kill"]; ok {
+		ret.OOMKills = int(n)
+	} else {
+		ret.OOMKills = len(events)
+	}
+	return ret, nil
+}
+
+func readVMStat() (map[string]uint64, error) {
+	b, err := os.ReadFile("/proc/vmstat")
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]uint64)
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			ret[fields[0]] = v
+		}
+	}
+	return ret, nil
+}
+
+// oomEvents returns the latest oom killer messages since boot from the journal, or dmesg without journald
+func (a *Agent) oomEvents() ([]string, error) {
+	var out string
+	var err error
+	if _, ok := journalAvailable(); ok {
+		out, err = runTool(30*time.Second, "journalctl", "-k", "-b", "--no-pager", "-o", "short-iso")
+	} else {
+		// fails for non root users when kernel.dmesg_restrict is set
+		out, err = runTool(30*time.Second, "dmesg")
+	}
+	if err != nil {
+		return []string{}, err
+	}
+
+	ret := make([]string, 0)
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, "Out of memory") || strings.Contains(line, "oom-kill:") || strings.Contains(line, "Killed process") {
+			ret = append(ret, strings.TrimSpace(line))
+		}
+	}
+	if len(ret) > memPressureMaxEvents {
+		ret = ret[len(ret)-memPressureMaxEvents:]
+	}
+	return ret, nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/StackExchange/wmi"
+	rmm "github.com/amidaware/rmmagent/shared"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// most recent low memory events included in the report
+const memPressureMaxEvents = 10
+
+// GetMemoryPressure reports available memory, paging activity and low memory events since boot
+// Windows has no oom killer, the resource exhaustion detector's low memory warnings are the closest thing
+// If the event log can't be read OOMEventsError says why
+func (a *Agent) GetMemoryPressure() (rmm.MemPressure, error) {
+	var ret rmm.MemPressure
+
+	vm, err := mem.VirtualMemory()
+	if err != nil {
+		return ret, err
+	}
+	ret.TotalMemory = vm.Total
+	ret.AvailableMemory = vm.Available
+	if swap, err := mem.SwapMemory(); err == nil {
+		ret.SwapTotal = swap.Total
+		ret.SwapUsed = swap.Used
+	}
+
+	var perf []struct {
+		PagesInputPersec  uint32
+		PagesOutputPersec uint32
+	}
+	if err := wmi.Query("SELECT PagesInputPersec, PagesOutputPersec FROM Win32_PerfFormattedData_PerfOS_Memory", &perf); err != nil {
+		return ret, err
+	}
+	if len(perf) > 0 {
+		ret.SwapInPerSec = float64(perf[0].PagesInputPersec)
+		ret.SwapOutPerSec = float64(perf[0].PagesOutputPersec)
+	}
+
+	events, count, err := lowMemoryEvents(time.Unix(a.BootTime(), 0))
+	if err != nil {
+		ret.OOMEventsError = err.Error()
+	}
+	ret.RecentOOMEvents = events
+	ret.OOMKills = count
+	return ret, nil
+}
+
+// lowMemoryEvents returns the latest low memory events since boot and how many there were, event 2004 is the
+// low virtual memory condition the resource exhaustion detector logs when programs start failing to allocate
+func lowMemoryEvents(boot time.Time) ([]string, int, error) {
+	ms := time.Since(boot).Milliseconds()
+	query := fmt.Sprintf("*[System[Provider[@Name='Microsoft-Windows-Resource-Exhaustion-Detector'] and (EventID=2004) and TimeCreated[timediff(@SystemTime) <= %d]]]", ms)
+	out, err := runTool(60*time.Second, "wevtutil", "qe", "System", "/q:"+query, "/rd:true", "/f:text")
+	if err != nil {
+		return []string{}, 0, err
+	}
+
+	// Event[0]: ... Date: 2022-06-01T10:15:00.000 ... Description: Windows successfully diagnosed a low virtual memory condition...
+	ret := make([]string, 0)
+	count := 0
+	var date string
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Event["):
+			count++
+		case strings.HasPrefix(line, "Date:"):
+			date = strings.TrimSpace(strings.TrimPrefix(line, "Date:"))
+		case strings.HasPrefix(line, "Description:") && i+1 < len(lines) && len(ret) < memPressureMaxEvents:
+			ret = append(ret, date+" "+strings.TrimSpace(lines[i+1]))
+		}
+	}
+	return ret, count, nil
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+)
+
+// serverMeshNodeID returns the mesh node id the rmm has on record for this agent
+func (a *Agent) serverMeshNodeID() (string, error) {
+	var ret struct {
+		NodeID string `json:"nodeid"`
+	}
+	r, err := a.rClient.R().SetResult(&ret).Get(fmt.Sprintf("/api/v3/%s/meshnodeid/", a.agentID()))
+	if err != nil {
+		return "", err
+	}
+	if r.IsError() {
+		return "", fmt.Errorf("meshnodeid response code: %v", r.StatusCode())
+	}
+	return StripAll(ret.NodeID), nil
+}
+
+// RepairMeshRegistration reinstalls mesh if its node id doesn't match the one the rmm expects, then syncs the new id
+// Nothing is done if the ids already match
+func (a *Agent) RepairMeshRegistration() error {
+	expected, err := a.serverMeshNodeID()
+	if err != nil {
+		return err
+	}
+
+	local, err := a.getMeshNodeID()
+	if err != nil {
+		a.Logger.Infoln("RepairMeshRegistration(): unable to get local mesh node id:", err)
+	}
+	local = StripAll(local)
+
+	if local != "" && local == expected {
+		a.Logger.Infoln("RepairMeshRegistration(): mesh node id matches, nothing to do")
+		return nil
+	}
+	a.Logger.Infof("RepairMeshRegistration(): mesh node id mismatch, local %q expected %q\n", local, expected)
+
+	a.Logger.Infoln("RepairMeshRegistration(): reinstalling mesh agent")
+	nodeID, err := a.reinstallMesh()
+	if err != nil {
+		return err
+	}
+	if nodeID == "" {
+		return errors.New("mesh reinstalled but has no node id")
+	}
+	a.Logger.Infoln("RepairMeshRegistration(): mesh reinstalled with node id", nodeID)
+
+	a.Logger.Infoln("RepairMeshRegistration(): syncing node id")
+	a.SyncMeshNodeID()
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	"github.com/shirou/gopsutil/v3/mem"
+	psnet "github.com/shirou/gopsutil/v3/net"
+)
+
+// CollectMetrics gathers cpu, memory, disk and network stats for PostMetricsBatch
+// cpu load is sampled over ~10 seconds
+func (a *Agent) CollectMetrics() rmm.MetricsBatch {
+	m := rmm.MetricsBatch{
+		AgentID:   a.agentID(),
+		Timestamp: time.Now().Unix(),
+		CPULoad:   a.GetCPULoadAvg(),
+		Disks:     a.GetDisks(),
+	}
+
+	if vm, err := mem.VirtualMemory(); err == nil {
+		m.MemTotal = vm.Total
+		m.MemUsed = vm.Used
+		m.MemPercent = vm.UsedPercent
+	} else {
+		a.Logger.Debugln("CollectMetrics() mem:", err)
+	}
+
+	if counters, err := psnet.IOCounters(false); err == nil && len(counters) > 0 {
+		m.Network = rmm.NetworkStats{
+			BytesSent:   counters[0].BytesSent,
+			BytesRecv:   counters[0].BytesRecv,
+			PacketsSent: counters[0].PacketsSent,
+			PacketsRecv: counters[0].PacketsRecv,
+			Errors:      counters[0].Errin + counters[0].Errout,
+			Drops:       counters[0].Dropin + counters[0].Dropout,
+		}
+	} else if err != nil {
+		a.Logger.Debugln("CollectMetrics() net:", err)
+	}
+	return m
+}
+
+// PostMetricsBatch sends a set of metrics in one api call instead of a checkin per metric
+func (a *Agent) PostMetricsBatch(m rmm.MetricsBatch) error {
+	if m.AgentID == "" {
+		m.AgentID = a.agentID()
+	}
+	r, err := a.rClient.R().SetBody(m).Post("/api/v3/metrics/")
+	if err != nil {
+		return err
+	}
+	if r.IsError() {
+		return fmt.Errorf("PostMetricsBatch(): %s", r.Status())
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+var networkFSTypes = map[string]bool{
+	"nfs":            true,
+	"nfs4":           true,
+	"cifs":           true,
+	"smb3":           true,
+	"smbfs":          true,
+	"ncpfs":          true,
+	"afs":            true,
+	"ceph":           true,
+	"glusterfs":      true,
+	"fuse.sshfs":     true,
+	"fuse.glusterfs": true,
+	"fuse.rclone":    true,
+	"davfs":          true,
+	"9p":             true,
+}
+
+// GetMounts returns the mounts in /proc/mounts, pseudo filesystems included
+func (a *Agent) GetMounts() ([]rmm.MountInfo, error) {
+	b, err := os.ReadFile("/proc/mounts")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]rmm.MountInfo, 0)
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		fstype := fields[2]
+		ret = append(ret, rmm.MountInfo{
+			MountPoint: unescapeMountField(fields[1]),
+			Device:     unescapeMountField(fields[0]),
+			FSType:     fstype,
+			Network:    networkFSTypes[fstype],
+		})
+	}
+	return ret, nil
+}
+
+// unescapeMountField decodes the octal escapes the kernel uses for spaces, tabs and backslashes
+func unescapeMountField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"strings"
+	"unsafe"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// GetMounts returns the drive letters visible to the agent plus the logged on user's mapped drives
+// Mapped drives live in the user's logon session so the service can't see them directly,
+// the persistent ones are read from the user's hive instead
+func (a *Agent) GetMounts() ([]rmm.MountInfo, error) {
+	mask, err := windows.GetLogicalDrives()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]rmm.MountInfo, 0)
+	seen := make(map[string]bool)
+	for i := 0; i < 26; i++ {
+		if mask&(1<<uint(i)) == 0 {
+			continue
+		}
+		letter := string(rune('A'+i)) + ":"
+		root, _ := windows.UTF16PtrFromString(letter + `\`)
+		m := rmm.MountInfo{
+			MountPoint: letter,
+			Device:     letter,
+			FSType:     volumeFSType(root),
+		}
+		if windows.GetDriveType(root) == windows.DRIVE_REMOTE {
+			m.Network = true
+			if unc, err := wnetGetConnection(letter); err == nil {
+				m.Device = unc
+			}
+		}
+		seen[letter] = true
+		ret = append(ret, m)
+	}
+
+	mapped, err := userMappedDrives()
+	if err != nil {
+		a.Logger.Debugln("GetMounts() userMappedDrives():", err)
+	}
+	for _, m := range mapped {
+		if !seen[m.MountPoint] {
+			ret = append(ret, m)
+		}
+	}
+	return ret, nil
+}
+
+func volumeFSType(root *uint16) string {
+	buf := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumeInformation(root, nil, 0, nil, nil, nil, &buf[0], uint32(len(buf))); err != nil {
+		return ""
+	}
+	return windows.UTF16ToString(buf)
+}
+
+func wnetGetConnection(letter string) (string, error) {
+	local, err := windows.UTF16PtrFromString(letter)
+	if err != nil {
+		return "", err
+	}
+	size := uint32(windows.MAX_PATH)
+	buf := make([]uint16, size)
+	r1, _, _ := procWNetGetConnectionW.Call(
+		uintptr(unsafe.Pointer(local)),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(unsafe.Pointer(&size)),
+	)
+	if r1 != 0 {
+		return "", windows.Errno(r1)
+	}
+	return windows.UTF16ToString(buf), nil
+}
+
+// userMappedDrives reads persistent drive mappings from HKEY_USERS\<sid>\Network
+func userMappedDrives() ([]rmm.MountInfo, error) {
+	sid, username, err := loggedOnUserSID()
+	if err != nil {
+		return nil, err
+	}
+	k, err := registry.OpenKey(registry.USERS, sid+`\Network`, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		if err == registry.ErrNotExist {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer k.Close()
+
+	letters, err := k.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]rmm.MountInfo, 0, len(letters))
+	for _, l := range letters {
+		dk, err := registry.OpenKey(k, l, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		remote, _, err := dk.GetStringValue("RemotePath")
+		dk.Close()
+		if err != nil {
+			continue
+		}
+		ret = append(ret, rmm.MountInfo{
+			MountPoint: strings.ToUpper(l) + ":",
+			Device:     remote,
+			Network:    true,
+			User:       username,
+		})
+	}
+	return ret, nil
+}
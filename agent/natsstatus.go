@@ -0,0 +1,77 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	nats "github.com/nats-io/nats.go"
+)
+
+// natsDisconnected records why a connection dropped, err is nil for a clean close
+func (a *Agent) natsDisconnected(nc *nats.Conn, err error) {
+	if err == nil {
+		return
+	}
+	a.Logger.Debugln("nats disconnected:", err)
+	a.auth.natsErrMu.Lock()
+	a.auth.natsLastErr = err.Error()
+	a.auth.natsLastErrAt = time.Now()
+	a.auth.natsErrMu.Unlock()
+}
+
+func (a *Agent) natsReconnected(nc *nats.Conn) {
+	a.Logger.Debugln("nats reconnected to", nc.ConnectedUrlRedacted())
+}
+
+// NatsStatus returns the state and counters of the rpc nats connection
+func (a *Agent) NatsStatus() (rmm.NatsStatus, error) {
+	a.auth.natsMu.Lock()
+	var sess *natsSession
+	for _, s := range a.auth.sessions {
+		if s.subject == a.agentID() {
+			sess = s
+			break
+		}
+	}
+	if sess == nil && len(a.auth.sessions) > 0 {
+		sess = a.auth.sessions[0]
+	}
+	a.auth.natsMu.Unlock()
+
+	if sess == nil || sess.Conn() == nil {
+		return rmm.NatsStatus{}, errors.New("no nats connection")
+	}
+
+	nc := sess.Conn()
+	stats := nc.Stats()
+	ret := rmm.NatsStatus{
+		Status:       nc.Status().String(),
+		Connected:    nc.IsConnected(),
+		ConnectedURL: nc.ConnectedUrlRedacted(),
+		Reconnects:   stats.Reconnects,
+		InMsgs:       stats.InMsgs,
+		OutMsgs:      stats.OutMsgs,
+		InBytes:      stats.InBytes,
+		OutBytes:     stats.OutBytes,
+	}
+
+	a.auth.natsErrMu.Lock()
+	ret.LastError = a.auth.natsLastErr
+	if !a.auth.natsLastErrAt.IsZero() {
+		ret.LastErrorAt = a.auth.natsLastErrAt.Unix()
+	}
+	a.auth.natsErrMu.Unlock()
+	return ret, nil
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"os/exec"
+	"time"
+)
+
+// FlushDNS clears whichever local dns cache is in use
+// systemd-resolved is tried first, then nscd and dnsmasq
+func (a *Agent) FlushDNS() error {
+	if _, err := exec.LookPath("resolvectl"); err == nil {
+		_, err := runTool(30*time.Second, "resolvectl", "flush-caches")
+		return err
+	}
+	if _, err := exec.LookPath("systemd-resolve"); err == nil {
+		_, err := runTool(30*time.Second, "systemd-resolve", "--flush-caches")
+		return err
+	}
+	if _, err := exec.LookPath("nscd"); err == nil {
+		_, err := runTool(30*time.Second, "nscd", "--invalidate=hosts")
+		return err
+	}
+	if serviceActive("dnsmasq") {
+		_, err := runTool(60*time.Second, "systemctl", "restart", "dnsmasq")
+		return err
+	}
+	return errors.New("no supported dns cache found (tried resolvectl, systemd-resolve, nscd and dnsmasq)")
+}
+
+// ResetNetworkStack flushes dns and restarts the active network manager
+// Connectivity drops briefly while the service restarts
+func (a *Agent) ResetNetworkStack() error {
+	if err := a.FlushDNS(); err != nil {
+		a.Logger.Debugln("ResetNetworkStack() FlushDNS():", err)
+	}
+	for _, svc := range []string{"NetworkManager", "systemd-networkd", "networking", "network"} {
+		if serviceActive(svc) {
+			_, err := runTool(2*time.Minute, "systemctl", "restart", svc)
+			return err
+		}
+	}
+	return errors.New("no supported network service found (tried NetworkManager, systemd-networkd, networking and network)")
+}
+
+func serviceActive(name string) bool {
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return false
+	}
+	_, err := runTool(10*time.Second, "systemctl", "is-active", "--quiet", name)
+	return err == nil
+}
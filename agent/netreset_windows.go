@@ -0,0 +1,39 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import "time"
+
+// FlushDNS clears the dns resolver cache
+func (a *Agent) FlushDNS() error {
+	out, err := runTool(30*time.Second, "ipconfig.exe", "/flushdns")
+	a.Logger.Debugln("FlushDNS():", out)
+	return err
+}
+
+// ResetNetworkStack resets winsock and the tcp/ip stack, a reboot is needed for it to take full effect
+func (a *Agent) ResetNetworkStack() error {
+	if err := a.FlushDNS(); err != nil {
+		return err
+	}
+	for _, args := range [][]string{
+		{"winsock", "reset"},
+		{"int", "ip", "reset"},
+	} {
+		out, err := runTool(60*time.Second, "netsh.exe", args...)
+		if err != nil {
+			return err
+		}
+		a.Logger.Debugln("ResetNetworkStack():", out)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+const netWaitInterval = 5 * time.Second
+
+// WaitForNetwork blocks until the api host resolves and accepts a tcp connection, or the timeout passes
+// It's meant for boot, so the agent doesn't start with a burst of failed api and nats calls
+func (a *Agent) WaitForNetwork(timeout time.Duration) error {
+	host, port := a.apiHostPort()
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), netWaitInterval)
+		lastErr = probeHost(ctx, host, port)
+		cancel()
+		if lastErr == nil {
+			a.Logger.Debugln("WaitForNetwork():", host, "is reachable")
+			return nil
+		}
+		a.Logger.Debugln("WaitForNetwork():", lastErr)
+
+		if time.Now().Add(netWaitInterval).After(deadline) {
+			return fmt.Errorf("network not ready after %v: %w", timeout, lastErr)
+		}
+		time.Sleep(netWaitInterval)
+	}
+}
+
+func (a *Agent) apiHostPort() (string, string) {
+	u, err := url.Parse(a.baseURL())
+	if err != nil || u.Hostname() == "" {
+		return a.apiURL(), "443"
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return u.Hostname(), port
+}
+
+func probeHost(ctx context.Context, host, port string) error {
+	if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+		return err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
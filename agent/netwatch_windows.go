@@ -0,0 +1,31 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+// netChangeNotifier waits on NotifyAddrChange in a loop
+// and sends on the returned channel whenever the address table changes
+func netChangeNotifier() (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+	go func() {
+		for {
+			if err := NotifyAddrChange(); err != nil {
+				close(ch)
+				return
+			}
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return ch, nil
+}
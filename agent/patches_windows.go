@@ -33,7 +33,7 @@ func (a *Agent) GetWinUpdates() {
 		a.Logger.Debugln("--------------------------------")
 	}
 
-	payload := rmm.WinUpdateResult{AgentID: a.AgentID, Updates: updates}
+	payload := rmm.WinUpdateResult{AgentID: a.agentID(), Updates: updates}
 	_, err = a.rClient.R().SetBody(payload).Post("/api/v3/winupdates/")
 	if err != nil {
 		a.Logger.Debugln(err)
@@ -50,7 +50,7 @@ func (a *Agent) InstallUpdates(guids []string) {
 
 	for _, id := range guids {
 		var result rmm.WinUpdateInstallResult
-		result.AgentID = a.AgentID
+		result.AgentID = a.agentID()
 		result.UpdateID = id
 
 		query := fmt.Sprintf("UpdateID='%s'", id)
@@ -74,7 +74,7 @@ func (a *Agent) InstallUpdates(guids []string) {
 		a.Logger.Debugln("updtCnt:", updtCnt)
 
 		if updtCnt == 0 {
-			superseded := rmm.SupersededUpdate{AgentID: a.AgentID, UpdateID: id}
+			superseded := rmm.SupersededUpdate{AgentID: a.agentID(), UpdateID: id}
 			a.rClient.R().SetBody(superseded).Post("/api/v3/superseded/")
 			continue
 		}
@@ -106,7 +106,7 @@ func (a *Agent) InstallUpdates(guids []string) {
 	if err != nil {
 		a.Logger.Errorln(err)
 	}
-	rebootPayload := rmm.AgentNeedsReboot{AgentID: a.AgentID, NeedsReboot: needsReboot}
+	rebootPayload := rmm.AgentNeedsReboot{AgentID: a.agentID(), NeedsReboot: needsReboot}
 	_, err = a.rClient.R().SetBody(rebootPayload).Put("/api/v3/winupdates/")
 	if err != nil {
 		a.Logger.Debugln("NeedsReboot:", err)
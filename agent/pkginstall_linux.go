@@ -0,0 +1,112 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const pkgInstallTimeout = 30 * time.Minute
+
+// InstallPackage installs a .deb or .rpm file, or a package by name, with the system package manager
+// Stdout and the exit code are in the returned status and any failure is also returned as an error
+func (a *Agent) InstallPackage(path string, args []string, timeout int) (CmdStatus, error) {
+	target := path
+	isFile := strings.HasSuffix(path, ".deb") || strings.HasSuffix(path, ".rpm")
+	if isFile {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return CmdStatus{}, err
+		}
+		if _, err := os.Stat(abs); err != nil {
+			return CmdStatus{}, err
+		}
+		// apt treats a bare name as a package name, a path has to contain a slash
+		target = abs
+	}
+
+	var cmdArgs []string
+	switch {
+	case hasBinary("apt-get"):
+		if strings.HasSuffix(path, ".rpm") {
+			return CmdStatus{}, fmt.Errorf("can't install an rpm with apt")
+		}
+		cmdArgs = []string{"apt-get", "install", "-y", "-q"}
+	case hasBinary("dnf"):
+		cmdArgs = []string{"dnf", "install", "-y"}
+	case hasBinary("yum"):
+		cmdArgs = []string{"yum", "install", "-y"}
+	case hasBinary("zypper"):
+		cmdArgs = []string{"zypper", "--non-interactive", "install"}
+		if isFile {
+			cmdArgs = append(cmdArgs, "--allow-unsigned-rpm")
+		}
+	default:
+		return CmdStatus{}, ErrNoPackageManager
+	}
+	if isFile && strings.HasSuffix(path, ".deb") && cmdArgs[0] != "apt-get" {
+		return CmdStatus{}, fmt.Errorf("can't install a deb with %s", cmdArgs[0])
+	}
+	cmdArgs = append(append(cmdArgs, args...), target)
+	return a.runPkgInstall(cmdArgs, timeout)
+}
+
+// UninstallPackage removes a package by name with the system package manager
+func (a *Agent) UninstallPackage(name string, args []string, timeout int) (CmdStatus, error) {
+	var cmdArgs []string
+	switch {
+	case hasBinary("apt-get"):
+		cmdArgs = []string{"apt-get", "remove", "-y", "-q"}
+	case hasBinary("dnf"):
+		cmdArgs = []string{"dnf", "remove", "-y"}
+	case hasBinary("yum"):
+		cmdArgs = []string{"yum", "remove", "-y"}
+	case hasBinary("zypper"):
+		cmdArgs = []string{"zypper", "--non-interactive", "remove"}
+	default:
+		return CmdStatus{}, ErrNoPackageManager
+	}
+	cmdArgs = append(append(cmdArgs, args...), name)
+	return a.runPkgInstall(cmdArgs, timeout)
+}
+
+func (a *Agent) runPkgInstall(cmdArgs []string, timeout int) (CmdStatus, error) {
+	if timeout <= 0 {
+		timeout = int(pkgInstallTimeout.Seconds())
+	}
+
+	// run through env so the package manager never stops to ask a question
+	opts := a.NewCMDOpts()
+	opts.Shell = "env"
+	opts.Args = append([]string{"DEBIAN_FRONTEND=noninteractive", "LC_ALL=C"}, cmdArgs...)
+	opts.IsScript = true
+	opts.Timeout = time.Duration(timeout) * time.Second
+	opts.Initiator = "installpackage"
+	ret := a.CmdV2(opts)
+
+	if ret.TimedOut != "" {
+		return ret, fmt.Errorf("%s timed out after %d seconds", cmdArgs[0], timeout)
+	}
+	if ret.Status.Exit != 0 {
+		ret.ExitMeaning = fmt.Sprintf("%s exited with %d", cmdArgs[0], ret.Status.Exit)
+		if ret.Status.Error != nil && ret.Status.Exit == -1 {
+			return ret, ret.Status.Error
+		}
+		return ret, fmt.Errorf("%s: %s", ret.ExitMeaning, ret.Stderr)
+	}
+	ret.ExitMeaning = "success"
+	return ret, nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	pkgInstallTimeout = 30 * time.Minute
+	// keep the end of the msi log, that's where the error is
+	msiLogMax = 64 * 1024
+)
+
+// https://docs.microsoft.com/en-us/windows/win32/msi/error-codes
+var msiExitCodes = map[int]string{
+	0:    "success",
+	1602: "the user cancelled the installation",
+	1603: "fatal error during installation",
+	1605: "the product is not installed",
+	1618: "another installation is already in progress",
+	1619: "the installation package could not be opened",
+	1620: "the installation package is invalid",
+	1624: "error applying transforms",
+	1625: "the installation is forbidden by system policy",
+	1633: "the package is not supported on this platform",
+	1638: "another version of this product is already installed",
+	1639: "invalid command line argument",
+	1641: "success, a reboot was started",
+	3010: "success, a reboot is required",
+}
+
+func msiExitMeaning(code int) string {
+	if m, ok := msiExitCodes[code]; ok {
+		return m
+	}
+	return fmt.Sprintf("msiexec exited with %d", code)
+}
+
+// InstallPackage installs an msi quietly, extra args such as PROPERTY=value are added to the msiexec command line
+// The end of the msi log is returned in Stdout and an error for any exit code that isn't a success
+func (a *Agent) InstallPackage(path string, args []string, timeout int) (CmdStatus, error) {
+	if !strings.EqualFold(filepath.Ext(path), ".msi") {
+		return CmdStatus{}, fmt.Errorf("%s is not an msi", path)
+	}
+	return a.runMsiexec("/i", path, args, timeout)
+}
+
+// UninstallPackage removes an msi by product code, e.g. {23170F69-40C1-2702-1900-000001000000}, or by the msi it was installed from
+func (a *Agent) UninstallPackage(product string, args []string, timeout int) (CmdStatus, error) {
+	return a.runMsiexec("/x", product, args, timeout)
+}
+
+func (a *Agent) runMsiexec(action, target string, args []string, timeout int) (CmdStatus, error) {
+	if timeout <= 0 {
+		timeout = int(pkgInstallTimeout.Seconds())
+	}
+
+	logFile := filepath.Join(os.TempDir(), "trmm", fmt.Sprintf("msiexec-%d.log", time.Now().UnixNano()))
+	defer os.Remove(logFile)
+
+	cmdArgs := append([]string{action, target, "/qn", "/norestart", "/l*v", logFile}, args...)
+	opts := a.NewCMDOpts()
+	opts.Shell = filepath.Join(os.Getenv("SYSTEMROOT"), "System32", "msiexec.exe")
+	opts.Args = cmdArgs
+	opts.IsScript = true
+	opts.Timeout = time.Duration(timeout) * time.Second
+	opts.Initiator = "installpackage"
+	ret := a.CmdV2(opts)
+
+	if log, err := readMsiLog(logFile); err == nil {
+		ret.Stdout = log
+	} else {
+		a.Logger.Debugln("runMsiexec(): reading log:", err)
+	}
+
+	if ret.TimedOut != "" {
+		return ret, fmt.Errorf("msiexec timed out after %d seconds", timeout)
+	}
+	if ret.Status.Error != nil && ret.Status.Exit == -1 {
+		return ret, ret.Status.Error
+	}
+	ret.ExitMeaning = msiExitMeaning(ret.Status.Exit)
+	switch ret.Status.Exit {
+	case 0, 1641, 3010:
+		return ret, nil
+	}
+	return ret, fmt.Errorf("%s (%d)", ret.ExitMeaning, ret.Status.Exit)
+}
+
+// readMsiLog returns the end of an msiexec log, which is utf-16 with a bom
+func readMsiLog(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	log := string(b)
+	if len(b) >= 2 && b[0] == 0xFF && b[1] == 0xFE {
+		u := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			u = append(u, uint16(b[i])|uint16(b[i+1])<<8)
+		}
+		log = string(utf16.Decode(u))
+	}
+	if len(log) > msiLogMax {
+		log = log[len(log)-msiLogMax:]
+	}
+	return removeWinNewLines(log), nil
+}
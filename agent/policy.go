@@ -0,0 +1,152 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"regexp"
+	"strings"
+
+	gocmd "github.com/go-cmd/cmd"
+)
+
+// commandPolicy decides which commands CmdV2 is allowed to run
+// deny patterns always win, if any allow patterns are set only matching commands run
+type commandPolicy struct {
+	deny  []*regexp.Regexp
+	allow []*regexp.Regexp
+}
+
+// newCommandPolicy compiles the configured patterns, nil means no policy
+// an allowlist where every pattern is invalid blocks everything rather than nothing
+func (a *Agent) newCommandPolicy(deny, allow []string) *commandPolicy {
+	if len(deny) == 0 && len(allow) == 0 {
+		return nil
+	}
+	p := &commandPolicy{
+		deny:  a.compilePatterns("deny", deny),
+		allow: a.compilePatterns("allow", allow),
+	}
+	if len(allow) > 0 && len(p.allow) == 0 {
+		p.allow = []*regexp.Regexp{regexp.MustCompile(`$^`)}
+	}
+	return p
+}
+
+func (a *Agent) compilePatterns(kind string, patterns []string) []*regexp.Regexp {
+	ret := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pat := range patterns {
+		if pat == "" {
+			continue
+		}
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			a.Logger.Errorf("Invalid command %s pattern %q: %v", kind, pat, err)
+			continue
+		}
+		ret = append(ret, re)
+	}
+	return ret
+}
+
+// allowed reports whether the command text passes the policy
+func (p *commandPolicy) allowed(cmd string) bool {
+	if p == nil {
+		return true
+	}
+	if matchAny(p.deny, cmd) {
+		return false
+	}
+	return len(p.allow) == 0 || matchAny(p.allow, cmd)
+}
+
+// allowedScript reports whether a script body passes the policy, a script is a list of commands so
+// a deny pattern matching any line or the whole body blocks it, and with an allowlist every line
+// other than blank lines and comments has to be allowed
+func (p *commandPolicy) allowedScript(body string) bool {
+	if p == nil || body == "" {
+		return true
+	}
+	if matchAny(p.deny, body) {
+		return false
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if matchAny(p.deny, line) {
+			return false
+		}
+		if len(p.allow) > 0 && !scriptComment(line) && !matchAny(p.allow, line) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPolicy returns a blocked status if c isn't allowed to run
+// Scripts are checked by their body, anything else by the command that was sent. The agent's own
+// commands aren't checked, an allowlist is about what technicians and automation can run
+func (a *Agent) checkPolicy(c *CmdOptions) (CmdStatus, bool) {
+	switch {
+	case c.internal():
+		return CmdStatus{}, true
+	case c.Script != "":
+		if a.cmdPolicy.allowedScript(c.Script) {
+			return CmdStatus{}, true
+		}
+	case a.cmdPolicy.allowed(policyText(c)):
+		return CmdStatus{}, true
+	}
+	a.Logger.Infoln("Command blocked by policy:", auditCommandText(c))
+	return CmdStatus{
+		Status: gocmd.Status{Exit: -1, Error: ErrBlockedByPolicy},
+		Stderr: ErrBlockedByPolicy.Error(),
+	}, false
+}
+
+// policyText is the command the policy is matched against, without the shell that runs it
+func policyText(c *CmdOptions) string {
+	switch {
+	case c.IsScript:
+		// a program run directly, like env apt-get install
+		return strings.TrimSpace(c.Shell + " " + strings.Join(c.Args, " "))
+	case c.IsExecutable:
+		return strings.TrimSpace(c.Shell + " " + c.Command)
+	default:
+		return c.Command
+	}
+}
+
+// scriptComment reports whether a trimmed script line is a comment in sh, python, powershell or batch
+func scriptComment(line string) bool {
+	upper := strings.ToUpper(line)
+	return strings.HasPrefix(line, "#") || strings.HasPrefix(line, "::") ||
+		upper == "REM" || strings.HasPrefix(upper, "REM ") || strings.HasPrefix(upper, "@REM")
+}
+
+func joinPatterns(res []*regexp.Regexp) string {
+	pats := make([]string, 0, len(res))
+	for _, re := range res {
+		pats = append(pats, re.String())
+	}
+	return strings.Join(pats, ",")
+}
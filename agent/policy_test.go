@@ -0,0 +1,103 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func testAgent() *Agent {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return &Agent{Logger: logger}
+}
+
+func TestCommandPolicyAllowed(t *testing.T) {
+	a := testAgent()
+	tests := []struct {
+		name        string
+		deny, allow []string
+		cmd         string
+		want        bool
+	}{
+		{"no policy", nil, nil, "rm -rf /", true},
+		{"denied", []string{`rm\s+-rf`}, nil, "/bin/bash rm -rf /", false},
+		{"not denied", []string{`rm\s+-rf`}, nil, "/bin/bash ls -la", true},
+		{"allowed", nil, []string{`^cmd ipconfig`}, "cmd ipconfig /all", true},
+		{"not allowed", nil, []string{`^cmd ipconfig`}, "cmd whoami", false},
+		{"deny wins", []string{`/release`}, []string{`^cmd ipconfig`}, "cmd ipconfig /release", false},
+		{"invalid deny is skipped", []string{`(`}, nil, "anything", true},
+		{"all allow invalid blocks everything", nil, []string{`(`}, "anything", false},
+	}
+	for _, tt := range tests {
+		p := a.newCommandPolicy(tt.deny, tt.allow)
+		if got := p.allowed(tt.cmd); got != tt.want {
+			t.Errorf("%s: allowed(%q) = %v, want %v", tt.name, tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestCommandPolicyAllowedScript(t *testing.T) {
+	a := testAgent()
+	tests := []struct {
+		name        string
+		deny, allow []string
+		body        string
+		want        bool
+	}{
+		{"no policy", nil, nil, "format c:", true},
+		{"empty body", []string{`.`}, nil, "", true},
+		{"denied line", []string{`^format`}, nil, "echo hi\nformat c:\n", false},
+		{"denied across lines", []string{`(?s)Invoke-WebRequest.*iex`}, nil, "$s = Invoke-WebRequest $u\niex $s", false},
+		{"clean", []string{`^format`}, nil, "echo hi\ndir\n", true},
+		{"every line allowed", nil, []string{`^(echo|dir)\b`}, "echo hi\r\n\r\n  dir c:\\\r\n", true},
+		{"one line not allowed", nil, []string{`^(echo|dir)\b`}, "echo hi\ndel c:\\x\n", false},
+	}
+	for _, tt := range tests {
+		p := a.newCommandPolicy(tt.deny, tt.allow)
+		if got := p.allowedScript(tt.body); got != tt.want {
+			t.Errorf("%s: allowedScript(%q) = %v, want %v", tt.name, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	a := testAgent()
+	a.cmdPolicy = a.newCommandPolicy([]string{`(?i)format\s`}, []string{`^(ls|echo|df)\b`, `^fi$`})
+
+	script := "#!/bin/bash\n# list things\n\nif true; then\n  ls -la\nfi\n"
+	tests := []struct {
+		name string
+		c    *CmdOptions
+		want bool
+	}{
+		{"anchored allow ignores the shell", &CmdOptions{Shell: "/bin/bash", Command: "ls -la", Initiator: "rpc:rawcmd"}, true},
+		{"not allowed", &CmdOptions{Shell: "/bin/bash", Command: "whoami", Initiator: "rpc:rawcmd"}, false},
+		{"denied", &CmdOptions{Shell: "cmd.exe", Command: "echo y | format c:", Initiator: "rpc:rawcmd"}, false},
+		{"agent's own command", &CmdOptions{Shell: "/bin/bash", Command: "systemctl restart tacticalagent.service"}, true},
+		{"agent initiator", &CmdOptions{Shell: "lspci", Initiator: agentInitiator}, true},
+		{"executable", &CmdOptions{Shell: "df", Command: "-h", IsExecutable: true, Initiator: "check"}, true},
+		{"program with args", &CmdOptions{Shell: "env", Args: []string{"apt-get", "install", "vim"}, IsScript: true, Initiator: "installpackage"}, false},
+		{"script body, not the temp file", &CmdOptions{Shell: "/tmp/trmm/123.sh", IsScript: true, Script: "echo hi\n", Initiator: "rpc:runscript"}, true},
+		{"script comments and blank lines", &CmdOptions{Shell: "/tmp/trmm/123.sh", IsScript: true, Script: "echo hi\n\n# a comment\n:: batch\nREM batch\n", Initiator: "task"}, true},
+		{"script line not allowed", &CmdOptions{Shell: "/tmp/trmm/123.sh", IsScript: true, Script: script, Initiator: "check"}, false},
+		{"script line denied", &CmdOptions{Shell: "/tmp/trmm/123.bat", IsScript: true, Script: "echo y\nformat d: /q\n", Initiator: "task"}, false},
+	}
+	for _, tt := range tests {
+		if _, got := a.checkPolicy(tt.c); got != tt.want {
+			t.Errorf("%s: checkPolicy() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
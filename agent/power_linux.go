@@ -0,0 +1,100 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+const powerSupplyDir = "/sys/class/power_supply"
+
+// GetPowerStatus returns ac and battery state from /sys/class/power_supply
+// Only the first system battery is reported, peripheral batteries (mice, headsets) are skipped
+func (a *Agent) GetPowerStatus() (rmm.PowerStatus, error) {
+	ret := rmm.PowerStatus{
+		BatteryPercent: -1,
+		TimeRemaining:  -1,
+	}
+
+	supplies, err := os.ReadDir(powerSupplyDir)
+	if err != nil && !os.IsNotExist(err) {
+		return ret, err
+	}
+
+	hasMains := false
+	var battery string
+	for _, s := range supplies {
+		dir := filepath.Join(powerSupplyDir, s.Name())
+		switch readSysfs(dir, "type") {
+		case "Mains":
+			hasMains = true
+			if readSysfs(dir, "online") == "1" {
+				ret.OnAC = true
+			}
+		case "Battery":
+			if battery == "" && readSysfs(dir, "scope") != "Device" {
+				battery = dir
+			}
+		}
+	}
+
+	if battery == "" {
+		// nothing to run off but the wall
+		ret.OnAC = true
+		ret.Detail = "no battery present"
+		return ret, nil
+	}
+
+	ret.HasBattery = true
+	status := readSysfs(battery, "status")
+	ret.Charging = status == "Charging"
+	if !hasMains {
+		ret.OnAC = status == "Charging" || status == "Full" || status == "Not charging"
+	}
+	if pct, err := strconv.Atoi(readSysfs(battery, "capacity")); err == nil {
+		ret.BatteryPercent = pct
+	}
+
+	// drivers report either energy (µWh/µW) or charge (µAh/µA), both divide out to hours
+	if status == "Discharging" {
+		now, rate := readSysfsInt(battery, "energy_now"), readSysfsInt(battery, "power_now")
+		if now <= 0 || rate <= 0 {
+			now, rate = readSysfsInt(battery, "charge_now"), readSysfsInt(battery, "current_now")
+		}
+		if now > 0 && rate > 0 {
+			ret.TimeRemaining = now * 3600 / rate
+		}
+	}
+	ret.Detail = status
+	return ret, nil
+}
+
+func readSysfs(dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func readSysfsInt(dir, name string) int64 {
+	i, err := strconv.ParseInt(readSysfs(dir, name), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return i
+}
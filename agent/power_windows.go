@@ -0,0 +1,68 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"unsafe"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// https://docs.microsoft.com/en-us/windows/win32/api/winbase/ns-winbase-system_power_status
+type systemPowerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+const (
+	batteryFlagCharging  = 8
+	batteryFlagNoBattery = 128
+	batteryFlagUnknown   = 255
+	batteryUnknown       = 255
+	batteryTimeUnknown   = 0xFFFFFFFF
+)
+
+// GetPowerStatus returns ac and battery state
+func (a *Agent) GetPowerStatus() (rmm.PowerStatus, error) {
+	var sps systemPowerStatus
+	r1, _, e1 := procGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&sps)))
+	if r1 == 0 {
+		return rmm.PowerStatus{}, e1
+	}
+
+	ret := rmm.PowerStatus{
+		OnAC:           sps.ACLineStatus == 1,
+		BatteryPercent: -1,
+		TimeRemaining:  -1,
+	}
+
+	if sps.BatteryFlag&batteryFlagNoBattery != 0 || sps.BatteryFlag == batteryFlagUnknown {
+		// desktops and servers report no battery and are on ac by definition
+		ret.OnAC = sps.ACLineStatus != 0
+		ret.Detail = "no battery present"
+		return ret, nil
+	}
+
+	ret.HasBattery = true
+	ret.Charging = sps.BatteryFlag&batteryFlagCharging != 0
+	if sps.BatteryLifePercent != batteryUnknown {
+		ret.BatteryPercent = int(sps.BatteryLifePercent)
+	}
+	if !ret.OnAC && sps.BatteryLifeTime != batteryTimeUnknown {
+		ret.TimeRemaining = int64(sps.BatteryLifeTime)
+	}
+	return ret, nil
+}
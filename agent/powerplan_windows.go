@@ -0,0 +1,110 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// matches the lines printed by powercfg /list and /getactivescheme
+var powerSchemeRe = regexp.MustCompile(`(?i)([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})\s+\((.*)\)`)
+
+var guidRe = regexp.MustCompile(`(?i)^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+var errNotElevated = errors.New("insufficient privileges: the agent must run elevated to change power settings")
+
+func powercfg(args ...string) (string, error) {
+	return runTool(30*time.Second, "powercfg.exe", args...)
+}
+
+func requireElevated() error {
+	if !windows.GetCurrentProcessToken().IsElevated() {
+		return errNotElevated
+	}
+	return nil
+}
+
+// GetPowerPlan returns the guid of the active power plan
+func (a *Agent) GetPowerPlan() (string, error) {
+	out, err := powercfg("/getactivescheme")
+	if err != nil {
+		return "", err
+	}
+	m := powerSchemeRe.FindStringSubmatch(out)
+	if m == nil {
+		return "", fmt.Errorf("unexpected powercfg output: %s", out)
+	}
+	a.Logger.Debugln("GetPowerPlan():", m[2])
+	return strings.ToLower(m[1]), nil
+}
+
+// SetPowerPlan activates a power plan by guid, by name (e.g. "High performance") or by
+// one of the SCHEME_MIN, SCHEME_MAX and SCHEME_BALANCED aliases
+func (a *Agent) SetPowerPlan(guidOrName string) error {
+	if err := requireElevated(); err != nil {
+		return err
+	}
+
+	plan := strings.TrimSpace(guidOrName)
+	switch {
+	case guidRe.MatchString(plan):
+	case strings.HasPrefix(strings.ToUpper(plan), "SCHEME_"):
+		plan = strings.ToUpper(plan)
+	default:
+		out, err := powercfg("/list")
+		if err != nil {
+			return err
+		}
+		found := ""
+		for _, m := range powerSchemeRe.FindAllStringSubmatch(out, -1) {
+			if strings.EqualFold(strings.TrimSpace(m[2]), plan) {
+				found = m[1]
+				break
+			}
+		}
+		if found == "" {
+			return fmt.Errorf("power plan %q not found", guidOrName)
+		}
+		plan = found
+	}
+
+	_, err := powercfg("/setactive", plan)
+	return err
+}
+
+// DisableSleep stops the machine from going to standby on ac and battery
+func (a *Agent) DisableSleep() error {
+	if err := requireElevated(); err != nil {
+		return err
+	}
+	for _, arg := range []string{"standby-timeout-ac", "standby-timeout-dc"} {
+		if _, err := powercfg("/change", arg, "0"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DisableHibernate turns hibernation off, which also removes hiberfil.sys
+func (a *Agent) DisableHibernate() error {
+	if err := requireElevated(); err != nil {
+		return err
+	}
+	_, err := powercfg("/hibernate", "off")
+	return err
+}
@@ -13,7 +13,10 @@ package agent
 
 import (
 	"fmt"
+	"math"
+	"sort"
 	"strings"
+	"time"
 
 	rmm "github.com/amidaware/rmmagent/shared"
 	ps "github.com/elastic/go-sysinfo"
@@ -53,6 +56,83 @@ func (a *Agent) GetProcsRPC() []rmm.ProcessMsg {
 	return ret
 }
 
+// how long GetTopProcesses samples cpu times for
+const topProcessesInterval = time.Second
+
+// GetTopProcesses returns the n processes using the most cpu or memory, by is "cpu" or "memory"
+// cpu usage is measured over a short interval rather than since each process started
+func (a *Agent) GetTopProcesses(by string, n int) ([]rmm.ProcessInfo, error) {
+	if by != "cpu" && by != "memory" {
+		return nil, fmt.Errorf("unknown sort %q, must be cpu or memory", by)
+	}
+	if n <= 0 {
+		n = 10
+	}
+
+	procs, err := gops.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	before := make(map[int32]float64, len(procs))
+	for _, p := range procs {
+		if t, err := p.Times(); err == nil {
+			before[p.Pid] = t.User + t.System
+		}
+	}
+	start := time.Now()
+	time.Sleep(topProcessesInterval)
+	elapsed := time.Since(start).Seconds()
+
+	ret := make([]rmm.ProcessInfo, 0, len(procs))
+	for _, p := range procs {
+		if p.Pid == 0 {
+			continue
+		}
+		info := rmm.ProcessInfo{PID: p.Pid}
+		if t, err := p.Times(); err == nil {
+			if prev, ok := before[p.Pid]; ok {
+				info.CPUPercent = math.Round((t.User+t.System-prev)/elapsed*1000) / 10
+			}
+		} else {
+			// exited while we were sampling
+			continue
+		}
+		if m, err := p.MemoryInfo(); err == nil {
+			info.RSS = m.RSS
+		}
+		info.Name, _ = p.Name()
+		info.Username, _ = p.Username()
+		ret = append(ret, info)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if by == "cpu" && ret[i].CPUPercent != ret[j].CPUPercent {
+			return ret[i].CPUPercent > ret[j].CPUPercent
+		}
+		return ret[i].RSS > ret[j].RSS
+	})
+	if len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret, nil
+}
+
+// processInfo returns what can be read about a running process, fields are left empty if it can't be opened
+func processInfo(pid int32) rmm.ProcessInfo {
+	info := rmm.ProcessInfo{PID: pid}
+	p, err := gops.NewProcess(pid)
+	if err != nil {
+		return info
+	}
+	info.Name, _ = p.Name()
+	info.Username, _ = p.Username()
+	if m, err := p.MemoryInfo(); err == nil {
+		info.RSS = m.RSS
+	}
+	return info
+}
+
 func (a *Agent) KillHungUpdates() {
 	procs, err := ps.Processes()
 	if err != nil {
@@ -0,0 +1,76 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"sort"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetProcessNetworkUsage samples the byte counters this long apart to work out the rates
+const procNetSampleInterval = 2 * time.Second
+
+// connBytes is one tcp connection's byte counters, ok is false when they couldn't be read
+type connBytes struct {
+	pid        int32
+	sent, recv uint64
+	ok         bool
+}
+
+// procNetUsage adds up two samples of connection counters, keyed by connection, per process
+// Connections missing from before started during the interval so all their bytes count towards the rate
+func procNetUsage(before, after map[string]connBytes, interval time.Duration) []rmm.ProcNetUsage {
+	byPid := make(map[int32]*rmm.ProcNetUsage)
+	deltas := make(map[int32][2]uint64)
+	for key, c := range after {
+		if c.pid <= 0 {
+			continue
+		}
+		u, ok := byPid[c.pid]
+		if !ok {
+			u = &rmm.ProcNetUsage{PID: c.pid, Name: processInfo(c.pid).Name}
+			byPid[c.pid] = u
+		}
+		u.Connections++
+		if !c.ok {
+			u.Partial = true
+			continue
+		}
+		u.BytesSent += c.sent
+		u.BytesRecv += c.recv
+
+		prev := before[key]
+		d := deltas[c.pid]
+		if c.sent >= prev.sent {
+			d[0] += c.sent - prev.sent
+		}
+		if c.recv >= prev.recv {
+			d[1] += c.recv - prev.recv
+		}
+		deltas[c.pid] = d
+	}
+
+	ret := make([]rmm.ProcNetUsage, 0, len(byPid))
+	secs := interval.Seconds()
+	for pid, u := range byPid {
+		d := deltas[pid]
+		u.SentBps = uint64(float64(d[0]) / secs)
+		u.RecvBps = uint64(float64(d[1]) / secs)
+		ret = append(ret, *u)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].SentBps+ret[i].RecvBps > ret[j].SentBps+ret[j].RecvBps
+	})
+	return ret
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	psnet "github.com/shirou/gopsutil/v3/net"
+)
+
+// first owner of a socket in ss -p output, users:(("nginx",pid=812,fd=6),("nginx",pid=813,fd=6))
+var ssUsersRe = regexp.MustCompile(`users:\(\("((?:[^"\\]|\\.)*)",pid=(\d+)`)
+
+// GetProcessNetworkUsage returns tcp bytes and rates per process from the kernel's per socket counters in ss -tinp
+// Without ss, or on kernels older than 4.1 that don't keep the counters, only the connections are counted
+func (a *Agent) GetProcessNetworkUsage() ([]rmm.ProcNetUsage, error) {
+	before, err := ssSample()
+	if err != nil {
+		a.Logger.Debugln("GetProcessNetworkUsage():", err)
+		return connCountUsage()
+	}
+	time.Sleep(procNetSampleInterval)
+	after, err := ssSample()
+	if err != nil {
+		return nil, err
+	}
+	return procNetUsage(before, after, procNetSampleInterval), nil
+}
+
+// ssSample reads the byte counters of every tcp connection that has an owning process
+func ssSample() (map[string]connBytes, error) {
+	out, err := runTool(30*time.Second, "ss", "-tinp")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]connBytes)
+	var key string
+	var cur connBytes
+	counters := false
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+		// the tcp_info details are on an indented line after each socket
+		if line[0] == ' ' || line[0] == '\t' {
+			if key == "" {
+				continue
+			}
+			cur.sent, cur.recv, cur.ok = ssByteCounters(line)
+			counters = counters || cur.ok
+			ret[key] = cur
+			continue
+		}
+
+		key = ""
+		f := strings.Fields(line)
+		m := ssUsersRe.FindStringSubmatch(line)
+		if len(f) < 5 || m == nil || f[0] == "State" {
+			continue
+		}
+		pid, err := strconv.ParseInt(m[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		key = fmt.Sprintf("%s-%s/%d", f[3], f[4], pid)
+		cur = connBytes{pid: int32(pid)}
+		ret[key] = cur
+	}
+	if len(ret) > 0 && !counters {
+		return nil, fmt.Errorf("ss doesn't report tcp byte counters on this kernel")
+	}
+	return ret, nil
+}
+
+// ssByteCounters finds bytes_sent, or bytes_acked on kernels before 4.19, and bytes_received in an ss -i line
+func ssByteCounters(line string) (sent, recv uint64, ok bool) {
+	var acked uint64
+	var haveSent, haveAcked, haveRecv bool
+	for _, f := range strings.Fields(line) {
+		i := strings.IndexByte(f, ':')
+		if i < 0 {
+			continue
+		}
+		k := f[:i]
+		n, err := strconv.ParseUint(f[i+1:], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch k {
+		case "bytes_sent":
+			sent, haveSent = n, true
+		case "bytes_acked":
+			acked, haveAcked = n, true
+		case "bytes_received":
+			recv, haveRecv = n, true
+		}
+	}
+	if !haveSent {
+		sent = acked
+	}
+	return sent, recv, (haveSent || haveAcked) && haveRecv
+}
+
+// connCountUsage is the fallback without byte counters, every process is partial
+func connCountUsage() ([]rmm.ProcNetUsage, error) {
+	conns, err := psnet.Connections("tcp")
+	if err != nil {
+		return nil, err
+	}
+	after := make(map[string]connBytes)
+	for _, c := range conns {
+		if c.Status == "LISTEN" || c.Raddr.IP == "" {
+			continue
+		}
+		key := fmt.Sprintf("%s:%d-%s:%d/%d", c.Laddr.IP, c.Laddr.Port, c.Raddr.IP, c.Raddr.Port, c.Pid)
+		after[key] = connBytes{pid: c.Pid}
+	}
+	return procNetUsage(nil, after, procNetSampleInterval), nil
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import "testing"
+
+func TestSsByteCounters(t *testing.T) {
+	tests := []struct {
+		line       string
+		sent, recv uint64
+		ok         bool
+	}{
+		{"cubic wscale:7,7 rto:204 bytes_sent:1200 bytes_acked:1100 bytes_received:3400 segs_out:10", 1200, 3400, true},
+		// kernels before 4.19 only have bytes_acked
+		{"cubic wscale:7,7 rto:204 bytes_acked:1100 bytes_received:3400", 1100, 3400, true},
+		{"cubic bytes_sent:5", 5, 0, false},
+		{"cubic bytes_received:9", 0, 9, false},
+		{"cubic bytes_sent:x bytes_received:9", 0, 9, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		sent, recv, ok := ssByteCounters(tt.line)
+		if sent != tt.sent || recv != tt.recv || ok != tt.ok {
+			t.Errorf("ssByteCounters(%q) = %d, %d, %v, want %d, %d, %v", tt.line, sent, recv, ok, tt.sent, tt.recv, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+func TestProcNetUsage(t *testing.T) {
+	// pids that won't exist so the names stay empty
+	const busy, partial = 1<<30 + 1, 1<<30 + 2
+
+	tests := []struct {
+		name          string
+		before, after map[string]connBytes
+		interval      time.Duration
+		want          []rmm.ProcNetUsage
+	}{
+		{
+			name:     "empty",
+			before:   map[string]connBytes{},
+			after:    map[string]connBytes{},
+			interval: time.Second,
+			want:     []rmm.ProcNetUsage{},
+		},
+		{
+			name: "rates per process",
+			before: map[string]connBytes{
+				"a":    {pid: busy, sent: 1000, recv: 500, ok: true},
+				"e":    {pid: partial, sent: 200, recv: 50, ok: true},
+				"gone": {pid: busy, sent: 99999, recv: 99999, ok: true},
+			},
+			after: map[string]connBytes{
+				"a": {pid: busy, sent: 3000, recv: 1000, ok: true},
+				// new during the interval, all of it counts
+				"b": {pid: busy, sent: 500, ok: true},
+				"c": {pid: partial},
+				// counters went backwards, the socket was reused
+				"e":    {pid: partial, sent: 100, recv: 100, ok: true},
+				"kern": {pid: 0, sent: 1 << 20, recv: 1 << 20, ok: true},
+			},
+			interval: 2 * time.Second,
+			want: []rmm.ProcNetUsage{
+				{PID: busy, Connections: 2, BytesSent: 3500, BytesRecv: 1000, SentBps: 1250, RecvBps: 250},
+				{PID: partial, Connections: 2, BytesSent: 100, BytesRecv: 100, SentBps: 0, RecvBps: 25, Partial: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := procNetUsage(tt.before, tt.after, tt.interval)
+		for i := range got {
+			got[i].Name = ""
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: procNetUsage() =\n%+v\nwant\n%+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"golang.org/x/sys/windows"
+)
+
+// GetProcessNetworkUsage returns tcp bytes and rates per process from the extended tcp statistics of each ipv4 connection
+// Windows only keeps the byte counters once collection is turned on for a connection, so it's turned on here and left on,
+// connections seen for the first time count from now and are partial until the next call. ipv6 connections and all
+// connections when not elevated are only counted
+func (a *Agent) GetProcessNetworkUsage() ([]rmm.ProcNetUsage, error) {
+	elevated := windows.GetCurrentProcessToken().IsElevated()
+
+	rows, err := tcp4Connections()
+	if err != nil {
+		return nil, err
+	}
+	before := make(map[string]connBytes)
+	if elevated {
+		for i := range rows {
+			r := &rows[i]
+			if err := enableTcpEStats(r); err != nil {
+				a.Logger.Debugln("GetProcessNetworkUsage() SetPerTcpConnectionEStats:", err)
+				continue
+			}
+			if c, err := readTcpEStats(r); err == nil {
+				before[tcpRowKey(r)] = c
+			}
+		}
+	}
+
+	time.Sleep(procNetSampleInterval)
+
+	rows, err = tcp4Connections()
+	if err != nil {
+		return nil, err
+	}
+	after := make(map[string]connBytes)
+	for i := range rows {
+		r := &rows[i]
+		key := tcpRowKey(r)
+		c := connBytes{pid: int32(r.OwningPid)}
+		if _, seen := before[key]; seen {
+			if read, err := readTcpEStats(r); err == nil {
+				c = read
+			}
+		} else if elevated {
+			// started during the interval, picked up properly by the next call
+			enableTcpEStats(r)
+		}
+		after[key] = c
+	}
+
+	conns6, err := psnet.Connections("tcp6")
+	if err != nil {
+		a.Logger.Debugln("GetProcessNetworkUsage() tcp6:", err)
+	}
+	for _, c := range conns6 {
+		if c.Status == "LISTEN" || c.Raddr.IP == "" {
+			continue
+		}
+		key := fmt.Sprintf("[%s]:%d-[%s]:%d/%d", c.Laddr.IP, c.Laddr.Port, c.Raddr.IP, c.Raddr.Port, c.Pid)
+		after[key] = connBytes{pid: c.Pid}
+	}
+
+	return procNetUsage(before, after, procNetSampleInterval), nil
+}
+
+// tcp4Connections returns the ipv4 tcp connections with their owning pids, listeners aren't included
+func tcp4Connections() ([]MIB_TCPROW_OWNER_PID, error) {
+	var buf []byte
+	var size uint32
+	// the table can grow between the size query and the read, so try a few times
+	for i := 0; i < 5; i++ {
+		var p *byte
+		if len(buf) > 0 {
+			p = &buf[0]
+		}
+		err := GetExtendedTcpTable(p, &size, false, windows.AF_INET, TCP_TABLE_OWNER_PID_CONNECTIONS)
+		if err == nil && len(buf) > 0 {
+			break
+		}
+		if err != nil && !errors.Is(err, windows.ERROR_INSUFFICIENT_BUFFER) {
+			return nil, fmt.Errorf("GetExtendedTcpTable: %w", err)
+		}
+		buf = make([]byte, size)
+	}
+	if len(buf) < 4 {
+		return nil, errors.New("GetExtendedTcpTable: empty table")
+	}
+
+	// MIB_TCPTABLE_OWNER_PID is a dword count followed by the rows
+	n := int(*(*uint32)(unsafe.Pointer(&buf[0])))
+	rowSize := int(unsafe.Sizeof(MIB_TCPROW_OWNER_PID{}))
+	if 4+n*rowSize > len(buf) {
+		return nil, errors.New("GetExtendedTcpTable: truncated table")
+	}
+	ret := make([]MIB_TCPROW_OWNER_PID, n)
+	for i := range ret {
+		ret[i] = *(*MIB_TCPROW_OWNER_PID)(unsafe.Pointer(&buf[4+i*rowSize]))
+	}
+	return ret, nil
+}
+
+func tcpRowKey(r *MIB_TCPROW_OWNER_PID) string {
+	return fmt.Sprintf("%d:%d-%d:%d/%d", r.LocalAddr, r.LocalPort, r.RemoteAddr, r.RemotePort, r.OwningPid)
+}
+
+// enableTcpEStats turns on byte counting for a connection, it needs admin
+func enableTcpEStats(r *MIB_TCPROW_OWNER_PID) error {
+	// TCP_ESTATS_DATA_RW_v0 is a single EnableCollection boolean
+	enable := byte(1)
+	return SetPerTcpConnectionEStats(r, TcpConnectionEstatsData, &enable, 0, 1, 0)
+}
+
+func readTcpEStats(r *MIB_TCPROW_OWNER_PID) (connBytes, error) {
+	var rod TCP_ESTATS_DATA_ROD_v0
+	if err := GetPerTcpConnectionEStats(r, TcpConnectionEstatsData, (*byte)(unsafe.Pointer(&rod)), 0, uint32(unsafe.Sizeof(rod))); err != nil {
+		return connBytes{}, err
+	}
+	return connBytes{pid: int32(r.OwningPid), sent: rod.DataBytesOut, recv: rod.DataBytesIn, ok: true}, nil
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// procTree is the process group of a command started with prepareProcTree
+type procTree struct {
+	pgid int
+}
+
+// prepareProcTree puts the command in its own process group so the whole tree can be signalled
+func prepareProcTree(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func trackProcTree(pid int) (*procTree, error) {
+	return &procTree{pgid: pid}, nil
+}
+
+func (t *procTree) Kill() error {
+	return syscall.Kill(-t.pgid, syscall.SIGKILL)
+}
+
+func (t *procTree) Close() {}
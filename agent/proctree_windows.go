@@ -0,0 +1,55 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"os/exec"
+
+	"golang.org/x/sys/windows"
+)
+
+// procTree is a job object holding a command and every process it starts
+type procTree struct {
+	job windows.Handle
+}
+
+// prepareProcTree is a no-op on windows, the process is added to a job once it starts
+func prepareProcTree(cmd *exec.Cmd) {}
+
+// trackProcTree assigns pid to a new job object, children started after this are added automatically
+func trackProcTree(pid int) (*procTree, error) {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	h, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(pid))
+	if err != nil {
+		windows.CloseHandle(job)
+		return nil, err
+	}
+	defer windows.CloseHandle(h)
+
+	if err := windows.AssignProcessToJobObject(job, h); err != nil {
+		windows.CloseHandle(job)
+		return nil, err
+	}
+	return &procTree{job: job}, nil
+}
+
+func (t *procTree) Kill() error {
+	return windows.TerminateJobObject(t.job, 1)
+}
+
+// Close releases the job handle, processes still running are left alone
+func (t *procTree) Close() {
+	windows.CloseHandle(t.job)
+}
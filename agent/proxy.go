@@ -0,0 +1,114 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// setting the proxy to this value resolves it from the os instead
+const systemProxy = "system"
+
+// parseProxyList picks the proxy to use for scheme from a windows style proxy list
+// e.g. "http=proxy:8080;https=proxy:8443" or "proxy:8080"
+func parseProxyList(list, scheme string) string {
+	var generic, httpProxy string
+	for _, p := range strings.FieldsFunc(list, func(r rune) bool { return r == ';' || r == ' ' }) {
+		switch {
+		case strings.HasPrefix(p, scheme+"="):
+			return normalizeProxyURL(strings.TrimPrefix(p, scheme+"="))
+		case strings.HasPrefix(p, "http="):
+			httpProxy = strings.TrimPrefix(p, "http=")
+		case !strings.Contains(p, "="):
+			if generic == "" {
+				generic = p
+			}
+		}
+	}
+	if generic != "" {
+		return normalizeProxyURL(generic)
+	}
+	return normalizeProxyURL(httpProxy)
+}
+
+func normalizeProxyURL(p string) string {
+	p = strings.TrimSpace(p)
+	if p == "" || strings.Contains(p, "://") {
+		return p
+	}
+	return "http://" + p
+}
+
+// proxyDialer tunnels nats connections through an http proxy using CONNECT
+// It never falls back to a direct connection, a proxy is usually there because direct traffic is blocked
+// or must not leave the network unproxied
+type proxyDialer struct {
+	proxy   *url.URL
+	timeout time.Duration
+}
+
+func (d *proxyDialer) Dial(network, address string) (net.Conn, error) {
+	conn, err := net.DialTimeout(network, d.proxy.Host, d.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %w", d.proxy.Host, err)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if d.proxy.User != nil {
+		pw, _ := d.proxy.User.Password()
+		req.SetBasicAuth(d.proxy.User.Username(), pw)
+		req.Header.Set("Proxy-Authorization", req.Header.Get("Authorization"))
+		req.Header.Del("Authorization")
+	}
+
+	conn.SetDeadline(time.Now().Add(d.timeout))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT %s: %s", address, resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+
+	// nats sends INFO straight away, don't lose anything already buffered
+	return &bufferedConn{Conn: conn, r: br}, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// getSystemProxy resolves the proxy from the environment
+// systemd services don't inherit a login env so /etc/environment is checked as well
+func getSystemProxy(target string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+
+	cfg := httpproxy.FromEnvironment()
+	if cfg.HTTPProxy == "" && cfg.HTTPSProxy == "" {
+		if env, err := readEnvironmentFile("/etc/environment"); err == nil {
+			cfg = &httpproxy.Config{
+				HTTPProxy:  firstNonEmpty(env["HTTP_PROXY"], env["http_proxy"]),
+				HTTPSProxy: firstNonEmpty(env["HTTPS_PROXY"], env["https_proxy"]),
+				NoProxy:    firstNonEmpty(env["NO_PROXY"], env["no_proxy"]),
+			}
+		}
+	}
+
+	p, err := cfg.ProxyFunc()(u)
+	if err != nil || p == nil {
+		return "", err
+	}
+	return p.String(), nil
+}
+
+func readEnvironmentFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ret := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		ret[strings.TrimSpace(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+	}
+	return ret, scanner.Err()
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
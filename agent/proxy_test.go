@@ -0,0 +1,71 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestProxyDialerNoDirectFallback(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	direct := make(chan struct{}, 1)
+	go func() {
+		if c, err := target.Accept(); err == nil {
+			c.Close()
+			direct <- struct{}{}
+		}
+	}()
+
+	proxy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+	go func() {
+		c, err := proxy.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		if _, err := http.ReadRequest(bufio.NewReader(c)); err == nil {
+			c.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+		}
+	}()
+
+	d := &proxyDialer{proxy: &url.URL{Scheme: "http", Host: proxy.Addr().String()}, timeout: 2 * time.Second}
+	if conn, err := d.Dial("tcp", target.Addr().String()); err == nil {
+		conn.Close()
+		t.Fatal("Dial succeeded through a proxy that refused CONNECT")
+	}
+
+	// an unreachable proxy is an error too
+	proxy.Close()
+	if conn, err := d.Dial("tcp", target.Addr().String()); err == nil {
+		conn.Close()
+		t.Fatal("Dial succeeded with the proxy down")
+	}
+
+	select {
+	case <-direct:
+		t.Error("dialed the target directly")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
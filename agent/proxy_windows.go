@@ -0,0 +1,149 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"net/url"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modwinhttp = windows.NewLazySystemDLL("winhttp.dll")
+
+	procWinHttpOpen                           = modwinhttp.NewProc("WinHttpOpen")
+	procWinHttpCloseHandle                    = modwinhttp.NewProc("WinHttpCloseHandle")
+	procWinHttpGetProxyForUrl                 = modwinhttp.NewProc("WinHttpGetProxyForUrl")
+	procWinHttpGetDefaultProxyConfiguration   = modwinhttp.NewProc("WinHttpGetDefaultProxyConfiguration")
+	procWinHttpGetIEProxyConfigForCurrentUser = modwinhttp.NewProc("WinHttpGetIEProxyConfigForCurrentUser")
+	procGlobalFree                            = modkernel32.NewProc("GlobalFree")
+)
+
+const (
+	WINHTTP_ACCESS_TYPE_NO_PROXY    = 1
+	WINHTTP_ACCESS_TYPE_NAMED_PROXY = 3
+
+	WINHTTP_AUTOPROXY_AUTO_DETECT = 0x00000001
+	WINHTTP_AUTOPROXY_CONFIG_URL  = 0x00000002
+
+	WINHTTP_AUTO_DETECT_TYPE_DHCP  = 0x00000001
+	WINHTTP_AUTO_DETECT_TYPE_DNS_A = 0x00000002
+)
+
+// https://docs.microsoft.com/en-us/windows/win32/api/winhttp/ns-winhttp-winhttp_proxy_info
+type WINHTTP_PROXY_INFO struct {
+	AccessType  uint32
+	Proxy       *uint16
+	ProxyBypass *uint16
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/winhttp/ns-winhttp-winhttp_current_user_ie_proxy_config
+type WINHTTP_CURRENT_USER_IE_PROXY_CONFIG struct {
+	AutoDetect    int32
+	AutoConfigUrl *uint16
+	Proxy         *uint16
+	ProxyBypass   *uint16
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/winhttp/ns-winhttp-winhttp_autoproxy_options
+type WINHTTP_AUTOPROXY_OPTIONS struct {
+	Flags                 uint32
+	AutoDetectFlags       uint32
+	AutoConfigUrl         *uint16
+	Reserved              uintptr
+	ReservedDword         uint32
+	AutoLogonIfChallenged int32
+}
+
+// takeWinHttpString copies and frees a string allocated by winhttp
+func takeWinHttpString(p *uint16) string {
+	if p == nil {
+		return ""
+	}
+	s := windows.UTF16PtrToString(p)
+	procGlobalFree.Call(uintptr(unsafe.Pointer(p)))
+	return s
+}
+
+// getSystemProxy resolves the proxy for target from winhttp
+// netsh winhttp config first, then the ie settings, then WPAD auto detection
+func getSystemProxy(target string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+
+	var info WINHTTP_PROXY_INFO
+	r1, _, _ := procWinHttpGetDefaultProxyConfiguration.Call(uintptr(unsafe.Pointer(&info)))
+	if r1 != 0 {
+		proxy := takeWinHttpString(info.Proxy)
+		takeWinHttpString(info.ProxyBypass)
+		if info.AccessType == WINHTTP_ACCESS_TYPE_NAMED_PROXY && proxy != "" {
+			return parseProxyList(proxy, u.Scheme), nil
+		}
+	}
+
+	var ie WINHTTP_CURRENT_USER_IE_PROXY_CONFIG
+	autoDetect := true
+	var autoConfigURL string
+	r1, _, _ = procWinHttpGetIEProxyConfigForCurrentUser.Call(uintptr(unsafe.Pointer(&ie)))
+	if r1 != 0 {
+		autoConfigURL = takeWinHttpString(ie.AutoConfigUrl)
+		proxy := takeWinHttpString(ie.Proxy)
+		takeWinHttpString(ie.ProxyBypass)
+		if proxy != "" {
+			return parseProxyList(proxy, u.Scheme), nil
+		}
+		autoDetect = ie.AutoDetect != 0
+	}
+
+	return winHttpAutoProxy(target, u.Scheme, autoDetect, autoConfigURL)
+}
+
+func winHttpAutoProxy(target, scheme string, autoDetect bool, configURL string) (string, error) {
+	if !autoDetect && configURL == "" {
+		return "", errors.New("no proxy configured")
+	}
+	agent, _ := windows.UTF16PtrFromString("TacticalRMM")
+	session, _, e1 := procWinHttpOpen.Call(uintptr(unsafe.Pointer(agent)), WINHTTP_ACCESS_TYPE_NO_PROXY, 0, 0, 0)
+	if session == 0 {
+		return "", e1
+	}
+	defer procWinHttpCloseHandle.Call(session)
+
+	var opts WINHTTP_AUTOPROXY_OPTIONS
+	opts.AutoLogonIfChallenged = 1
+	if autoDetect {
+		opts.Flags |= WINHTTP_AUTOPROXY_AUTO_DETECT
+		opts.AutoDetectFlags = WINHTTP_AUTO_DETECT_TYPE_DHCP | WINHTTP_AUTO_DETECT_TYPE_DNS_A
+	}
+	if configURL != "" {
+		opts.Flags |= WINHTTP_AUTOPROXY_CONFIG_URL
+		opts.AutoConfigUrl, _ = windows.UTF16PtrFromString(configURL)
+	}
+
+	targetPtr, _ := windows.UTF16PtrFromString(target)
+	var info WINHTTP_PROXY_INFO
+	r1, _, e1 := procWinHttpGetProxyForUrl.Call(session, uintptr(unsafe.Pointer(targetPtr)), uintptr(unsafe.Pointer(&opts)), uintptr(unsafe.Pointer(&info)))
+	if r1 == 0 {
+		return "", e1
+	}
+
+	proxy := takeWinHttpString(info.Proxy)
+	takeWinHttpString(info.ProxyBypass)
+	if info.AccessType != WINHTTP_ACCESS_TYPE_NAMED_PROXY || proxy == "" {
+		return "", errors.New("no proxy configured")
+	}
+	return parseProxyList(proxy, scheme), nil
+}
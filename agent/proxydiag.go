@@ -0,0 +1,97 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// ProxyDiagnostic checks whether api requests actually go through the configured proxy
+func (a *Agent) ProxyDiagnostic() (rmm.ProxyInfo, error) {
+	info := rmm.ProxyInfo{Source: "none"}
+	var proxy *url.URL
+	if len(a.Proxy) > 0 {
+		u, err := url.Parse(a.Proxy)
+		if err != nil {
+			return info, fmt.Errorf("invalid proxy %q: %w", a.Proxy, err)
+		}
+		proxy = u
+		info.Configured = u.Redacted()
+		info.Source = "config"
+		if a.SystemProxy {
+			info.Source = "system"
+		}
+	}
+
+	var egress struct {
+		IP string `json:"ip"`
+	}
+	r, err := a.newRestyClient(15 * time.Second).R().EnableTrace().SetResult(&egress).Get(fmt.Sprintf("/api/v3/%s/egressip/", a.agentID()))
+	if err != nil {
+		return info, err
+	}
+	if remote := r.Request.TraceInfo().RemoteAddr; remote != nil {
+		info.RemoteAddr = remote.String()
+		info.UsedProxy = proxy != nil && isProxyAddr(proxy, info.RemoteAddr)
+	}
+	if r.IsError() {
+		a.Logger.Debugln("ProxyDiagnostic() egressip response code:", r.StatusCode())
+	} else {
+		info.ServerEgressIP = egress.IP
+	}
+
+	// PublicIP goes through the proxy too, so it should match what the rmm saw
+	if ip := a.PublicIP(); IsValidIP(ip) {
+		info.PublicIP = ip
+	}
+
+	if proxy != nil {
+		mismatch := info.ServerEgressIP != "" && info.PublicIP != "" && info.ServerEgressIP != info.PublicIP
+		info.Leak = !info.UsedProxy || mismatch
+	}
+	return info, nil
+}
+
+// isProxyAddr reports whether addr, an ip:port, is the proxy server
+func isProxyAddr(proxy *url.URL, addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	proxyPort := proxy.Port()
+	if proxyPort == "" {
+		proxyPort = "80"
+		if proxy.Scheme == "https" {
+			proxyPort = "443"
+		}
+	}
+	if port != proxyPort {
+		return false
+	}
+
+	ips, err := net.LookupHost(proxy.Hostname())
+	if err != nil {
+		return false
+	}
+	for _, ip := range ips {
+		if net.ParseIP(ip).Equal(net.ParseIP(host)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	// AgentState key of the authentication required state, see AuthStatus
+	authStateKey = "auth_required"
+	// after a failed re-auth, rejected requests wait this long before trying again so a revoked agent doesn't hammer the api
+	reauthInterval = 5 * time.Minute
+)
+
+// enableReauth makes c re-authenticate and retry once when the api rejects the agent token
+// Only the retry condition below decides, so other errors still aren't retried
+func (a *Agent) enableReauth(c *resty.Client) {
+	c.SetRetryCount(1)
+	c.AddRetryCondition(a.reauthRetry)
+}
+
+func (a *Agent) reauthRetry(r *resty.Response, err error) bool {
+	if err != nil || r == nil || r.Request == nil || !tokenRejected(r) {
+		return false
+	}
+	sent := strings.TrimPrefix(r.Request.Header.Get("Authorization"), "Token ")
+	if err := a.reauthenticate(sent); err != nil {
+		a.Logger.Debugln("reauthRetry():", err)
+		return false
+	}
+	// a streamed body was used up by the first attempt, the caller's own retry will get the new token
+	_, streamed := r.Request.Body.(io.Reader)
+	return !streamed
+}
+
+// tokenRejected is true for a 401, or a 403 about the credentials rather than a plain permission error
+func tokenRejected(r *resty.Response) bool {
+	switch r.StatusCode() {
+	case http.StatusUnauthorized:
+		return true
+	case http.StatusForbidden:
+		body := strings.ToLower(r.String())
+		return strings.Contains(body, "credentials") || strings.Contains(body, "token")
+	}
+	return false
+}
+
+// reauthenticate gets a new token from the rmm with the enrollment secret and rotates to it
+// sent is the token the rejected request used, if it's already been replaced there's nothing to do
+func (a *Agent) reauthenticate(sent string) error {
+	a.auth.reauthMu.Lock()
+	defer a.auth.reauthMu.Unlock()
+
+	if sent != a.authToken() {
+		return nil
+	}
+	secret := a.enrollSecret()
+	if secret == "" {
+		a.setAuthRequired("the agent token was rejected and there's no enrollment secret to re-authenticate with")
+		return ErrAuthRequired
+	}
+	if time.Since(a.auth.lastReauth) < reauthInterval {
+		return ErrAuthRequired
+	}
+	a.auth.lastReauth = time.Now()
+
+	token, newSecret, err := a.requestToken(secret)
+	if err != nil {
+		a.setAuthRequired(err.Error())
+		return fmt.Errorf("%w: %v", ErrAuthRequired, err)
+	}
+	if err := a.RotateToken(token); err != nil {
+		a.setAuthRequired(err.Error())
+		return fmt.Errorf("%w: %v", ErrAuthRequired, err)
+	}
+	// the rmm can hand out a new secret with each token so a leaked one only works once
+	if newSecret != "" && newSecret != secret {
+		if err := saveEnrollSecret(newSecret); err != nil {
+			a.Logger.Errorln("reauthenticate() saving enrollment secret:", err)
+		}
+		a.auth.mu.Lock()
+		a.auth.secret = newSecret
+		a.auth.mu.Unlock()
+	}
+	a.Logger.Infoln("Re-authenticated with the enrollment secret after the agent token was rejected")
+	return nil
+}
+
+// requestToken trades the enrollment secret for a new agent token, and maybe a new secret
+func (a *Agent) requestToken(secret string) (token, newSecret string, err error) {
+	type reauthResp struct {
+		Token  string `json:"token"`
+		Secret string `json:"secret"`
+	}
+	payload := map[string]string{"agent_id": a.agentID(), "secret": secret}
+	// sent without the old token, which would get the request rejected before the secret is looked at
+	r, err := a.newAnonRestyClient(30 * time.Second).R().SetBody(payload).SetResult(&reauthResp{}).Post("/api/v3/reauth/")
+	if err != nil {
+		return "", "", err
+	}
+	if r.IsError() {
+		return "", "", fmt.Errorf("re-auth rejected, status code: %d", r.StatusCode())
+	}
+	resp := r.Result().(*reauthResp)
+	if resp.Token == "" {
+		return "", "", errors.New("re-auth response has no token")
+	}
+	return resp.Token, resp.Secret, nil
+}
+
+func (a *Agent) enrollSecret() string {
+	a.auth.mu.RLock()
+	defer a.auth.mu.RUnlock()
+	return a.auth.secret
+}
+
+// setAuthRequired records that the agent can't authenticate until it gets a new token
+// It's kept in AgentState so it survives restarts and the rpc service sees what the agent service hit
+func (a *Agent) setAuthRequired(reason string) {
+	var st rmm.AuthStatus
+	found, _ := a.state.Get(authStateKey, &st)
+	if !found {
+		st.Since = time.Now().Unix()
+		a.Logger.Errorln("Authentication required:", reason)
+	}
+	st.AuthRequired = true
+	st.Reason = reason
+	if err := a.state.Set(authStateKey, st); err != nil {
+		a.Logger.Debugln("setAuthRequired():", err)
+	}
+}
+
+func (a *Agent) clearAuthRequired() {
+	var st rmm.AuthStatus
+	if found, _ := a.state.Get(authStateKey, &st); !found {
+		return
+	}
+	if err := a.state.Delete(authStateKey); err != nil {
+		a.Logger.Debugln("clearAuthRequired():", err)
+		return
+	}
+	a.Logger.Infoln("Authentication restored")
+}
+
+// AuthStatus reports whether the agent token has been rejected without a successful re-auth
+func (a *Agent) AuthStatus() (rmm.AuthStatus, error) {
+	var st rmm.AuthStatus
+	if _, err := a.state.Get(authStateKey, &st); err != nil {
+		return st, err
+	}
+	st.CanReauth = a.enrollSecret() != ""
+	return st, nil
+}
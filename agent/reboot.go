@@ -0,0 +1,59 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+const rebootStateKey = "reboot"
+
+// ScheduleReboot schedules a reboot at the given time and warns logged on users with message
+func (a *Agent) ScheduleReboot(at time.Time, message string) error {
+	if !at.After(time.Now()) {
+		return errors.New("reboot time must be in the future")
+	}
+	if err := scheduleReboot(at, message); err != nil {
+		return err
+	}
+	return a.state.Set(rebootStateKey, rmm.ScheduledReboot{At: at.Unix(), Message: message})
+}
+
+// CancelScheduledReboot aborts a reboot set with ScheduleReboot
+func (a *Agent) CancelScheduledReboot() error {
+	if err := cancelReboot(); err != nil {
+		return err
+	}
+	return a.state.Delete(rebootStateKey)
+}
+
+// GetScheduledReboot returns the pending reboot time, if there is one
+func (a *Agent) GetScheduledReboot() (time.Time, bool, error) {
+	// the os knows about reboots scheduled outside the agent too
+	if at, ok := pendingReboot(); ok {
+		return at, true, nil
+	}
+
+	var r rmm.ScheduledReboot
+	if found, err := a.state.Get(rebootStateKey, &r); err != nil || !found {
+		return time.Time{}, false, err
+	}
+	at := time.Unix(r.At, 0)
+	if !at.After(time.Now()) {
+		// already happened, or was cancelled outside the agent
+		return time.Time{}, false, nil
+	}
+	return at, true, nil
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemd-logind writes pending shutdowns here
+const systemdScheduledShutdown = "/run/systemd/shutdown/scheduled"
+
+func scheduleReboot(at time.Time, message string) error {
+	// shutdown only takes a time of day or minutes from now
+	mins := int(math.Ceil(time.Until(at).Minutes()))
+	args := []string{"-r", "+" + strconv.Itoa(mins)}
+	if message != "" {
+		args = append(args, message)
+	}
+	_, err := runTool(15*time.Second, "shutdown", args...)
+	return err
+}
+
+func cancelReboot() error {
+	_, err := runTool(15*time.Second, "shutdown", "-c")
+	return err
+}
+
+func pendingReboot() (time.Time, bool) {
+	b, err := os.ReadFile(systemdScheduledShutdown)
+	if err != nil {
+		return time.Time{}, false
+	}
+	var usec int64
+	var mode string
+	for _, line := range strings.Split(string(b), "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "USEC":
+			usec, _ = strconv.ParseInt(kv[1], 10, 64)
+		case "MODE":
+			mode = kv[1]
+		}
+	}
+	if mode != "reboot" || usec == 0 {
+		return time.Time{}, false
+	}
+	return time.UnixMicro(usec), true
+}
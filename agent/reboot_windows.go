@@ -0,0 +1,50 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// shutdown.exe caps the delay at 10 years and the comment at 512 characters
+const (
+	maxShutdownDelay   = 315360000
+	maxShutdownComment = 512
+)
+
+func scheduleReboot(at time.Time, message string) error {
+	secs := int(time.Until(at).Round(time.Second).Seconds())
+	if secs > maxShutdownDelay {
+		return errors.New("reboot time is too far in the future")
+	}
+	args := []string{"/r", "/t", strconv.Itoa(secs), "/d", "p:0:0"}
+	if len(message) > maxShutdownComment {
+		message = message[:maxShutdownComment]
+	}
+	if message != "" {
+		args = append(args, "/c", message)
+	}
+	_, err := CMD("shutdown.exe", args, 15, false)
+	return err
+}
+
+func cancelReboot() error {
+	_, err := CMD("shutdown.exe", []string{"/a"}, 15, false)
+	return err
+}
+
+// windows has no api to query a pending shutdown so the state file is used instead
+func pendingReboot() (time.Time, bool) {
+	return time.Time{}, false
+}
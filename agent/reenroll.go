@@ -0,0 +1,185 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	nats "github.com/nats-io/nats.go"
+)
+
+// enrollment is the part of the agent config that points it at an rmm server
+type enrollment struct {
+	BaseURL string
+	ApiURL  string
+	AgentID string
+	Token   string
+}
+
+func (a *Agent) currentEnrollment() enrollment {
+	a.auth.mu.RLock()
+	defer a.auth.mu.RUnlock()
+	return enrollment{BaseURL: a.auth.baseURL, ApiURL: a.auth.apiURL, AgentID: a.auth.agentID, Token: a.auth.token}
+}
+
+// ReEnroll moves the agent to another rmm server without a reinstall
+// The new api and nats are checked with the new credentials before anything is changed, then the config is saved and
+// api requests and nats sessions move over. If the sessions can't be moved the old config and connections are put back
+func (a *Agent) ReEnroll(newBaseURL, newToken, newAgentID string) error {
+	if newBaseURL == "" || newToken == "" || newAgentID == "" {
+		return errors.New("base url, token and agent id are required")
+	}
+	u, err := url.Parse(newBaseURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return errors.New("invalid url, must start with https or http")
+	}
+	next := enrollment{
+		BaseURL: u.Scheme + "://" + u.Host,
+		ApiURL:  u.Hostname(),
+		AgentID: newAgentID,
+		Token:   newToken,
+	}
+
+	a.auth.rotateMu.Lock()
+	defer a.auth.rotateMu.Unlock()
+
+	prev := a.currentEnrollment()
+	if next == prev {
+		return nil
+	}
+
+	if err := a.checkEnrollment(next); err != nil {
+		return fmt.Errorf("ReEnroll() new server unreachable: %w", err)
+	}
+
+	a.auth.natsMu.Lock()
+	sessions := make([]*natsSession, len(a.auth.sessions))
+	copy(sessions, a.auth.sessions)
+	a.auth.natsMu.Unlock()
+
+	conns := make([]*nats.Conn, 0, len(sessions))
+	closeAll := func() {
+		for _, nc := range conns {
+			nc.Close()
+		}
+	}
+	for range sessions {
+		nc, err := a.natsDial(next.ApiURL, next.AgentID, next.Token)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("ReEnroll() nats.Connect(): %w", err)
+		}
+		conns = append(conns, nc)
+		if err := nc.FlushTimeout(15 * time.Second); err != nil {
+			closeAll()
+			return fmt.Errorf("ReEnroll() new nats rejected the agent: %w", err)
+		}
+	}
+
+	if err := saveEnrollment(next); err != nil {
+		closeAll()
+		// a partial write would leave a mix of both servers in the config
+		if rerr := saveEnrollment(prev); rerr != nil {
+			a.Logger.Errorln("ReEnroll() restoring config:", rerr)
+		}
+		return fmt.Errorf("ReEnroll() saving config: %w", err)
+	}
+	a.applyEnrollment(next)
+
+	for i, s := range sessions {
+		// the rpc session listens on the agent id, everything else keeps its subject
+		subject := s.subject
+		if subject == prev.AgentID {
+			subject = next.AgentID
+		}
+		if err := s.swap(conns[i], subject); err != nil {
+			a.Logger.Errorln("ReEnroll() swap:", err)
+			for _, nc := range conns[i:] {
+				nc.Close()
+			}
+			a.rollbackEnrollment(prev, next, sessions[:i])
+			return fmt.Errorf("ReEnroll() rolled back: %w", err)
+		}
+	}
+	a.Logger.Infoln("Agent re-enrolled with", next.BaseURL, "as", next.AgentID)
+	return nil
+}
+
+// checkEnrollment makes sure the api answers for the new agent id and token
+// nats is checked by the caller since it has to open the connections anyway
+func (a *Agent) checkEnrollment(e enrollment) error {
+	c := resty.New()
+	c.SetBaseURL(e.BaseURL)
+	c.SetCloseConnection(true)
+	c.SetTimeout(15 * time.Second)
+	c.SetDebug(a.Debug)
+	c.SetHeader("Content-Type", "application/json")
+	c.SetHeader("Authorization", fmt.Sprintf("Token %s", e.Token))
+	if len(a.Proxy) > 0 {
+		c.SetProxy(a.Proxy)
+	}
+	if a.caPool != nil {
+		c.SetTLSClientConfig(&tls.Config{RootCAs: a.caPool})
+	}
+
+	r, err := c.R().Get(fmt.Sprintf("/api/v3/%s/checkinterval/", e.AgentID))
+	if err != nil {
+		return err
+	}
+	if r.IsError() {
+		return fmt.Errorf("api response code: %v", r.StatusCode())
+	}
+	return nil
+}
+
+// applyEnrollment switches the agent over, api clients pick up the base url and token per request in setRequestURL
+// and setAuthHeader
+func (a *Agent) applyEnrollment(e enrollment) {
+	a.auth.mu.Lock()
+	defer a.auth.mu.Unlock()
+	a.auth.baseURL = e.BaseURL
+	a.auth.apiURL = e.ApiURL
+	a.auth.agentID = e.AgentID
+	a.auth.token = e.Token
+}
+
+// rollbackEnrollment puts back the old config and moves the sessions that already switched back to the old server
+func (a *Agent) rollbackEnrollment(prev, next enrollment, moved []*natsSession) {
+	if err := saveEnrollment(prev); err != nil {
+		a.Logger.Errorln("ReEnroll() restoring config:", err)
+	}
+	a.applyEnrollment(prev)
+
+	for _, s := range moved {
+		subject := s.subject
+		if subject == next.AgentID {
+			subject = prev.AgentID
+		}
+		nc, err := a.natsDial(prev.ApiURL, prev.AgentID, prev.Token)
+		if err != nil {
+			a.Logger.Errorln("ReEnroll() reconnecting to the old server:", err)
+			continue
+		}
+		if err := s.swap(nc, subject); err != nil {
+			a.Logger.Errorln("ReEnroll() swap back:", err)
+			nc.Close()
+		}
+	}
+}
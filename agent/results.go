@@ -0,0 +1,206 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// ScriptResult is a CmdStatus with the metadata the rmm records for every run
+// Task and script results are posted as a ScriptResult, it has every field their old payloads had
+type ScriptResult struct {
+	AgentID  string `json:"agent_id"`
+	Hostname string `json:"hostname"`
+	// sha256 of the shell and arguments, or of the script, set even for sensitive commands
+	CommandHash string  `json:"command_hash"`
+	Initiator   string  `json:"initiator"`
+	StartedAt   string  `json:"started_at"`
+	Duration    float64 `json:"duration"`
+	Retcode     int     `json:"retcode"`
+	Attempts    int     `json:"attempts"`
+	Stdout      string  `json:"stdout"`
+	Stderr      string  `json:"stderr"`
+	Error       string  `json:"error,omitempty"`
+	// set when the output was too big to send inline, Stdout and Stderr are then empty
+	// and the full output was uploaded under this name
+	OutputRef string `json:"output_ref,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+
+	// from the old task and script payloads, execution_time includes setup unlike Duration
+	ExecTime float64         `json:"execution_time"`
+	ID       int             `json:"id,omitempty"`
+	Timing   *rmm.ExecTiming `json:"timing,omitempty"`
+
+	Status CmdStatus `json:"-"`
+}
+
+// commandHash identifies a command without including its text
+func commandHash(c *CmdOptions) string {
+	h := sha256.Sum256([]byte(c.Shell + "\x00" + strings.Join(c.cmdArgs(), "\x00")))
+	return hex.EncodeToString(h[:])
+}
+
+// newScriptResult wraps ret, the start time and duration come from the exec itself so temp file setup isn't counted
+func (a *Agent) newScriptResult(c *CmdOptions, ret CmdStatus) ScriptResult {
+	res := ScriptResult{
+		AgentID:     a.agentID(),
+		Hostname:    a.Hostname,
+		CommandHash: commandHash(c),
+		Initiator:   c.Initiator,
+		Duration:    ret.Status.Runtime,
+		Retcode:     ret.Status.Exit,
+		Attempts:    ret.Attempts,
+		Stdout:      ret.Stdout,
+		Stderr:      ret.Stderr,
+		Status:      ret,
+	}
+	if ret.Status.StartTs > 0 {
+		res.StartedAt = time.Unix(0, ret.Status.StartTs).UTC().Format(time.RFC3339Nano)
+	}
+	if ret.Status.Error != nil {
+		res.Error = ret.Status.Error.Error()
+	}
+	return res
+}
+
+// newRunResult starts a ScriptResult for a run that doesn't give a CmdStatus, like a script or a task's actions
+// what is hashed for CommandHash
+func (a *Agent) newRunResult(initiator, what string, start time.Time) ScriptResult {
+	h := sha256.Sum256([]byte(what))
+	return ScriptResult{
+		AgentID:     a.agentID(),
+		Hostname:    a.Hostname,
+		CommandHash: hex.EncodeToString(h[:]),
+		Initiator:   initiator,
+		StartedAt:   start.UTC().Format(time.RFC3339Nano),
+		ExecTime:    time.Since(start).Seconds(),
+	}
+}
+
+// scriptResult wraps the outcome of RunScriptWith, timing is the one passed to it so the duration
+// and start time leave out writing the temp file
+func (a *Agent) scriptResult(code, initiator string, start time.Time, timing *CmdTiming, stdout, stderr string, retcode int, err error) ScriptResult {
+	res := a.newRunResult(initiator, code, start)
+	res.StartedAt = start.Add(timing.Setup + timing.Start).UTC().Format(time.RFC3339Nano)
+	res.Duration = timing.Exec.Seconds()
+	res.Retcode = retcode
+	res.Stdout = stdout
+	res.Stderr = stderr
+	if err != nil {
+		res.Retcode = 1
+		res.Stdout = ""
+		res.Stderr = err.Error()
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// RunAndReport runs a command with CmdV2 and sends the result to endpoint
+// The result is returned with all its output even if sending it fails
+func (a *Agent) RunAndReport(c *CmdOptions, endpoint string) (ScriptResult, error) {
+	res := a.newScriptResult(c, a.CmdV2(c))
+	return res, a.reportResult(endpoint, "", res)
+}
+
+// postScriptResult sends a script run's result to its history entry
+func (a *Agent) postScriptResult(id int, res ScriptResult) {
+	if err := a.reportResult(fmt.Sprintf("/api/v3/%d/%s/histresult/", id, a.agentID()), "script_results", res); err != nil {
+		a.Logger.Debugln("postScriptResult():", err)
+	}
+}
+
+// reportResult patches res to the history or task entry at endpoint, output over ResultInlineMax is moved out first.
+// key is the field the endpoint expects the result under, empty to send it as is
+func (a *Agent) reportResult(endpoint, key string, res ScriptResult) error {
+	if err := a.offloadOutput(&res); err != nil {
+		a.Logger.Errorln("reportResult() uploading output:", err)
+	}
+
+	var body interface{} = res
+	if key != "" {
+		body = map[string]interface{}{key: res}
+	}
+	r, err := a.rClient.R().SetBody(body).Patch(endpoint)
+	if err != nil {
+		return err
+	}
+	if r.IsError() {
+		return fmt.Errorf("%s response code: %v", endpoint, r.StatusCode())
+	}
+	return nil
+}
+
+// offloadOutput moves output over ResultInlineMax out of the result, uploading it if an endpoint is configured
+// and truncating it otherwise. Output is truncated if the upload fails so the result can still be sent
+func (a *Agent) offloadOutput(res *ScriptResult) error {
+	max := a.ResultInlineMax
+	if max <= 0 || len(res.Stdout)+len(res.Stderr) <= max {
+		return nil
+	}
+
+	var err error
+	if a.ResultUploadURL != "" {
+		var ref string
+		if ref, err = a.uploadOutput(res); err == nil {
+			res.OutputRef = ref
+			res.Stdout, res.Stderr = "", ""
+			return nil
+		}
+	}
+
+	res.Stdout = truncateString(res.Stdout, max)
+	res.Stderr = truncateString(res.Stderr, max-len(res.Stdout))
+	res.Truncated = true
+	return err
+}
+
+func (a *Agent) uploadOutput(res *ScriptResult) (string, error) {
+	b, err := json.Marshal(map[string]string{"stdout": res.Stdout, "stderr": res.Stderr})
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(os.TempDir(), "trmm")
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("output-%s-%d.json", res.CommandHash[:12], time.Now().UnixNano())
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		return "", err
+	}
+	defer os.Remove(path)
+
+	if err := a.UploadFileChunked(path, a.ResultUploadURL, 0, 0); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func truncateString(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
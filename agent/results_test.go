@@ -0,0 +1,98 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+func TestOffloadOutput(t *testing.T) {
+	tests := []struct {
+		name           string
+		max            int
+		stdout, stderr string
+		wantOut        string
+		wantErr        string
+		truncated      bool
+	}{
+		{"no limit", 0, "aaaa", "bbbb", "aaaa", "bbbb", false},
+		{"under", 8, "aaaa", "bbbb", "aaaa", "bbbb", false},
+		{"stderr cut", 6, "aaaa", "bbbb", "aaaa", "bb", true},
+		{"stdout fills it", 3, "aaaa", "bbbb", "aaa", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAgent()
+			a.ResultInlineMax = tt.max
+			res := &ScriptResult{Stdout: tt.stdout, Stderr: tt.stderr}
+			if err := a.offloadOutput(res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Stdout != tt.wantOut || res.Stderr != tt.wantErr || res.Truncated != tt.truncated {
+				t.Errorf("got %q %q %v, want %q %q %v", res.Stdout, res.Stderr, res.Truncated, tt.wantOut, tt.wantErr, tt.truncated)
+			}
+		})
+	}
+}
+
+func TestReportResult(t *testing.T) {
+	var method string
+	var body map[string]json.RawMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		b, _ := io.ReadAll(r.Body)
+		body = nil
+		json.Unmarshal(b, &body)
+	}))
+	defer srv.Close()
+
+	a := testAgent()
+	a.auth = &authState{agentID: "agent1"}
+	a.rClient = resty.New().SetBaseURL(srv.URL)
+	a.cmdLimiter = newExecLimiter(0, 0)
+	a.postCmdHooks = &postCmdHooks{}
+	a.ResultInlineMax = 5
+
+	a.postScriptResult(7, ScriptResult{Stdout: "hello world"})
+	if method != http.MethodPatch {
+		t.Errorf("method %s, want PATCH", method)
+	}
+	var res ScriptResult
+	if err := json.Unmarshal(body["script_results"], &res); err != nil {
+		t.Fatalf("no script_results in %v: %v", body, err)
+	}
+	if res.Stdout != "hello" || !res.Truncated {
+		t.Errorf("posted stdout %q truncated %v, want it cut to the inline max", res.Stdout, res.Truncated)
+	}
+
+	// the caller keeps all the output, only what's sent is cut
+	c := a.NewCMDOpts()
+	c.Command = "echo hello world"
+	c.Timeout = 10 * time.Second
+	full, err := a.RunAndReport(c, "/api/v3/task/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.Retcode != 0 || full.Truncated || len(full.Stdout) <= a.ResultInlineMax {
+		t.Errorf("returned %+v, want the whole output", full)
+	}
+	if _, ok := body["stdout"]; !ok || body["script_results"] != nil {
+		t.Errorf("RunAndReport sent %v, want the bare result", body)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetRoutingTable returns the ipv4 and ipv6 routes in the main table from iproute2
+func (a *Agent) GetRoutingTable() ([]rmm.Route, error) {
+	ret := make([]rmm.Route, 0)
+	for _, family := range []string{"-4", "-6"} {
+		out, err := runTool(15*time.Second, "ip", "-j", family, "route", "show")
+		if err != nil {
+			return ret, err
+		}
+
+		var routes []struct {
+			Dst      string `json:"dst"`
+			Gateway  string `json:"gateway"`
+			Dev      string `json:"dev"`
+			Metric   int    `json:"metric"`
+			Protocol string `json:"protocol"`
+		}
+		if out != "" {
+			if err := json.Unmarshal([]byte(out), &routes); err != nil {
+				return ret, err
+			}
+		}
+
+		for _, r := range routes {
+			dst := r.Dst
+			switch {
+			case dst == "default" && family == "-4":
+				dst = "0.0.0.0/0"
+			case dst == "default":
+				dst = "::/0"
+			case !strings.Contains(dst, "/") && family == "-4":
+				dst += "/32"
+			case !strings.Contains(dst, "/"):
+				dst += "/128"
+			}
+			ret = append(ret, rmm.Route{
+				Destination: dst,
+				Gateway:     r.Gateway,
+				Interface:   r.Dev,
+				Metric:      r.Metric,
+				Source:      r.Protocol,
+			})
+		}
+	}
+	return ret, nil
+}
+
+// GetARPTable returns the ipv4 and ipv6 neighbour entries from iproute2, failed and incomplete ones are skipped
+func (a *Agent) GetARPTable() ([]rmm.ARPEntry, error) {
+	ret := make([]rmm.ARPEntry, 0)
+	out, err := runTool(15*time.Second, "ip", "-j", "neigh", "show")
+	if err != nil {
+		return ret, err
+	}
+
+	var neigh []struct {
+		Dst    string   `json:"dst"`
+		Dev    string   `json:"dev"`
+		Lladdr string   `json:"lladdr"`
+		State  []string `json:"state"`
+	}
+	if out != "" {
+		if err := json.Unmarshal([]byte(out), &neigh); err != nil {
+			return ret, err
+		}
+	}
+
+	for _, n := range neigh {
+		if n.Lladdr == "" {
+			continue
+		}
+		ret = append(ret, rmm.ARPEntry{
+			IP:        n.Dst,
+			MAC:       normalizeMAC(n.Lladdr),
+			Interface: n.Dev,
+			State:     strings.ToLower(strings.Join(n.State, ",")),
+		})
+	}
+	return ret, nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// Interface: 192.168.1.10 --- 0x5, the first word is localized
+var arpInterfaceRe = regexp.MustCompile(`^\S+:\s+(\S+)\s+---\s+0x([0-9a-fA-F]+)`)
+
+// GetRoutingTable returns the ipv4 and ipv6 routes from route print
+// Interfaces are reported by name rather than the address or index route print uses
+func (a *Agent) GetRoutingTable() ([]rmm.Route, error) {
+	ret := make([]rmm.Route, 0)
+	byAddr, byIndex := interfaceNames()
+
+	out, err := runTool(15*time.Second, "route", "print", "-4")
+	if err != nil {
+		return ret, err
+	}
+	// Network Destination  Netmask  Gateway  Interface  Metric
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Fields(line)
+		if len(f) != 5 {
+			continue
+		}
+		dst, mask := net.ParseIP(f[0]), net.ParseIP(f[1])
+		metric, err := strconv.Atoi(f[4])
+		if dst == nil || mask == nil || mask.To4() == nil || err != nil {
+			continue
+		}
+		ones, _ := net.IPMask(mask.To4()).Size()
+		ret = append(ret, rmm.Route{
+			Destination: fmt.Sprintf("%s/%d", f[0], ones),
+			Gateway:     routeGateway(f[2]),
+			Interface:   byAddr[f[3]],
+			Metric:      metric,
+		})
+	}
+
+	out, err = runTool(15*time.Second, "route", "print", "-6")
+	if err != nil {
+		return ret, err
+	}
+	// If  Metric  Network Destination  Gateway, long destinations push the gateway onto the next line
+	var pending *rmm.Route
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Fields(line)
+		if pending != nil {
+			if len(f) == 1 {
+				pending.Gateway = routeGateway(f[0])
+			}
+			ret = append(ret, *pending)
+			pending = nil
+			if len(f) == 1 {
+				continue
+			}
+		}
+		if len(f) < 3 || len(f) > 4 || !strings.Contains(f[2], "/") {
+			continue
+		}
+		index, err1 := strconv.Atoi(f[0])
+		metric, err2 := strconv.Atoi(f[1])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		r := rmm.Route{Destination: f[2], Interface: byIndex[index], Metric: metric}
+		if len(f) == 3 {
+			pending = &r
+			continue
+		}
+		r.Gateway = routeGateway(f[3])
+		ret = append(ret, r)
+	}
+	if pending != nil {
+		ret = append(ret, *pending)
+	}
+	return ret, nil
+}
+
+// GetARPTable returns the ipv4 arp cache from arp -a
+func (a *Agent) GetARPTable() ([]rmm.ARPEntry, error) {
+	ret := make([]rmm.ARPEntry, 0)
+	_, byIndex := interfaceNames()
+
+	out, err := runTool(15*time.Second, "arp", "-a")
+	if err != nil {
+		return ret, err
+	}
+
+	iface := ""
+	for _, line := range strings.Split(out, "\n") {
+		if m := arpInterfaceRe.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			index, _ := strconv.ParseInt(m[2], 16, 32)
+			iface = byIndex[int(index)]
+			if iface == "" {
+				iface = m[1]
+			}
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) != 3 || net.ParseIP(f[0]) == nil {
+			continue
+		}
+		if _, err := net.ParseMAC(normalizeMAC(f[1])); err != nil {
+			continue
+		}
+		ret = append(ret, rmm.ARPEntry{
+			IP:        f[0],
+			MAC:       normalizeMAC(f[1]),
+			Interface: iface,
+			State:     strings.ToLower(f[2]),
+		})
+	}
+	return ret, nil
+}
+
+// routeGateway returns "" for on-link routes, the word is localized so anything that isn't an ip counts
+func routeGateway(s string) string {
+	if net.ParseIP(s) == nil {
+		return ""
+	}
+	return s
+}
+
+// interfaceNames maps interface addresses and indexes to interface names
+func interfaceNames() (map[string]string, map[int]string) {
+	byAddr := make(map[string]string)
+	byIndex := make(map[int]string)
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return byAddr, byIndex
+	}
+	for _, i := range ifaces {
+		byIndex[i.Index] = i.Name
+		addrs, err := i.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				byAddr[ipnet.IP.String()] = i.Name
+			}
+		}
+	}
+	return byAddr, byIndex
+}
@@ -12,6 +12,7 @@ https://license.tacticalrmm.com
 package agent
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"runtime"
@@ -50,17 +51,28 @@ var (
 
 func (a *Agent) RunRPC() {
 	a.Logger.Infoln("Agent service started")
+	a.recordAgentStart()
+	a.logMissingDependencies()
+	if cloned, err := a.DetectClonedAgent(); err != nil {
+		a.Logger.Debugln("DetectClonedAgent():", err)
+	} else if cloned && a.ReenrollOnClone {
+		if err := a.requestReenroll(); err != nil {
+			a.Logger.Errorln("requestReenroll():", err)
+		}
+	}
+	if a.NetworkWait > 0 {
+		// carry on regardless, nats and the api calls retry on their own
+		if err := a.WaitForNetwork(a.NetworkWait); err != nil {
+			a.Logger.Infoln("WaitForNetwork():", err)
+		}
+	}
 	go a.RunAsService()
 	var wg sync.WaitGroup
 	wg.Add(1)
-	opts := a.setupNatsOptions()
-	server := fmt.Sprintf("tls://%s:4222", a.ApiURL)
-	nc, err := nats.Connect(server, opts...)
-	if err != nil {
-		a.Logger.Fatalln("RunRPC() nats.Connect()", err)
-	}
-
-	nc.Subscribe(a.AgentID, func(msg *nats.Msg) {
+	var sess *natsSession
+	sess = a.newNatsSession(a.agentID(), func(msg *nats.Msg) {
+		// the connection changes if the token is rotated
+		nc := sess.Conn()
 		var payload *NatsMsg
 		var mh codec.MsgpackHandle
 		mh.RawToString = true
@@ -146,6 +158,81 @@ func (a *Agent) RunRPC() {
 				msg.Respond(resp)
 			}(payload)
 
+		case "tailfile":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				lines, _ := strconv.Atoi(p.Data["lines"])
+				if lines < 0 {
+					lines = 0
+				} else if lines > tailMaxLines {
+					lines = tailMaxLines
+				}
+				subject := p.Data["subject"]
+				// following needs somewhere to stream to, otherwise just reply with the last lines
+				follow := subject != ""
+				timeout := time.Duration(p.Timeout) * time.Second
+				if timeout <= 0 || timeout > 30*time.Minute {
+					timeout = 5 * time.Minute
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				defer cancel()
+
+				out := make(chan string, 100)
+				errc := make(chan error, 1)
+				go func() { errc <- a.TailFile(p.Data["path"], lines, follow, ctx, out) }()
+
+				if !follow {
+					tail := make([]string, 0, lines)
+					for l := range out {
+						tail = append(tail, l)
+					}
+					if err := <-errc; err != nil {
+						a.Logger.Debugln("TailFile:", err)
+						ret.Encode(err.Error())
+					} else {
+						ret.Encode(tail)
+					}
+					msg.Respond(resp)
+					return
+				}
+
+				ret.Encode("ok")
+				msg.Respond(resp)
+				nc := sess.Conn()
+				for l := range out {
+					nc.Publish(subject, []byte(l))
+				}
+				if err := <-errc; err != nil {
+					a.Logger.Debugln("TailFile:", err)
+					nc.Publish(subject, []byte(err.Error()))
+				}
+			}(payload)
+
+		case "journallog":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				days, _ := strconv.Atoi(p.Data["days"])
+				max, _ := strconv.Atoi(p.Data["max"])
+				priority, err := strconv.Atoi(p.Data["priority"])
+				if err != nil {
+					priority = -1
+				}
+				var since time.Time
+				if days > 0 {
+					since = time.Now().AddDate(0, 0, -days)
+				}
+				entries, err := a.GetJournalLog(p.Data["unit"], priority, since, max)
+				if err != nil {
+					a.Logger.Debugln("GetJournalLog:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(entries)
+				}
+				msg.Respond(resp)
+			}(payload)
+
 		case "procs":
 			go func() {
 				var resp []byte
@@ -178,7 +265,22 @@ func (a *Agent) RunRPC() {
 
 				switch runtime.GOOS {
 				case "windows":
-					out, _ := CMDShell(p.Data["shell"], []string{}, p.Data["command"], p.Timeout, false)
+					// CMDShell doesn't go through CmdV2 so the policy is checked and the run audited here
+					c := &CmdOptions{
+						Shell:     p.Data["shell"],
+						Command:   p.Data["command"],
+						Initiator: "rpc:rawcmd",
+						Sensitive: p.Data["sensitive"] == "true",
+					}
+					start := time.Now()
+					if blocked, ok := a.checkPolicy(c); !ok {
+						a.auditCommand(c, blocked, start)
+						ret.Encode(blocked.Stderr)
+						resultData.Results = blocked.Stderr
+						break
+					}
+					out, err := CMDShell(p.Data["shell"], []string{}, p.Data["command"], p.Timeout, false)
+					a.auditExec(c, 0, err, start)
 					a.Logger.Debugln(out)
 					if out[1] != "" {
 						ret.Encode(out[1])
@@ -191,7 +293,10 @@ func (a *Agent) RunRPC() {
 					opts := a.NewCMDOpts()
 					opts.Shell = p.Data["shell"]
 					opts.Command = p.Data["command"]
-					opts.Timeout = time.Duration(p.Timeout)
+					opts.Timeout = time.Duration(p.Timeout) * time.Second
+					opts.Initiator = "rpc:rawcmd"
+					opts.Sensitive = p.Data["sensitive"] == "true"
+					opts.Sandbox = p.Data["sandbox"] == "true"
 					out := a.CmdV2(opts)
 					tmp := ""
 					if len(out.Stdout) > 0 {
@@ -207,7 +312,7 @@ func (a *Agent) RunRPC() {
 
 				msg.Respond(resp)
 				if p.ID != 0 {
-					a.rClient.R().SetBody(resultData).Patch(fmt.Sprintf("/api/v3/%d/%s/histresult/", p.ID, a.AgentID))
+					a.rClient.R().SetBody(resultData).Patch(fmt.Sprintf("/api/v3/%d/%s/histresult/", p.ID, a.agentID()))
 				}
 			}(payload)
 
@@ -255,30 +360,32 @@ func (a *Agent) RunRPC() {
 			go func(p *NatsMsg) {
 				var resp []byte
 				var retData string
-				var resultData rmm.RunScriptResp
 				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				so := ScriptOptions{Initiator: "rpc:runscript", Sensitive: p.Data["sensitive"] == "true"}
+				// only runs the server flags as automated, like alert actions, wait out a maintenance window,
+				// a script a user ran by hand always runs
+				so.Suppressible = p.Data["automated"] == "true"
+				// always timed for the result's duration, only reported when asked for
+				so.Timing = &CmdTiming{}
 				start := time.Now()
-				stdout, stderr, retcode, err := a.RunScript(p.Data["code"], p.Data["shell"], p.ScriptArgs, p.Timeout)
-				resultData.ExecTime = time.Since(start).Seconds()
+				stdout, stderr, retcode, err := a.RunScriptWith(p.Data["code"], p.Data["shell"], p.ScriptArgs, p.Timeout, so)
+				resultData := a.scriptResult(p.Data["code"], so.Initiator, start, so.Timing, stdout, stderr, retcode, err)
 				resultData.ID = p.ID
+				if p.Data["timing"] == "true" {
+					resultData.Timing = so.Timing.report()
+				}
 
 				if err != nil {
 					a.Logger.Debugln(err)
 					retData = err.Error()
-					resultData.Retcode = 1
-					resultData.Stderr = err.Error()
 				} else {
 					retData = stdout + stderr // to keep backwards compat
-					resultData.Retcode = retcode
-					resultData.Stdout = stdout
-					resultData.Stderr = stderr
 				}
 				a.Logger.Debugln(retData)
 				ret.Encode(retData)
 				msg.Respond(resp)
 				if p.ID != 0 {
-					results := map[string]interface{}{"script_results": resultData}
-					a.rClient.R().SetBody(results).Patch(fmt.Sprintf("/api/v3/%d/%s/histresult/", p.ID, a.AgentID))
+					a.postScriptResult(p.ID, resultData)
 				}
 			}(payload)
 
@@ -287,10 +394,22 @@ func (a *Agent) RunRPC() {
 				var resp []byte
 				var retData rmm.RunScriptResp
 				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				so := ScriptOptions{Initiator: "rpc:runscriptfull", Sensitive: p.Data["sensitive"] == "true"}
+				// only runs the server flags as automated, like alert actions, wait out a maintenance window,
+				// a script a user ran by hand always runs
+				so.Suppressible = p.Data["automated"] == "true"
+				// always timed for the result's duration, only reported when asked for
+				so.Timing = &CmdTiming{}
 				start := time.Now()
-				stdout, stderr, retcode, err := a.RunScript(p.Data["code"], p.Data["shell"], p.ScriptArgs, p.Timeout)
+				stdout, stderr, retcode, err := a.RunScriptWith(p.Data["code"], p.Data["shell"], p.ScriptArgs, p.Timeout, so)
+				result := a.scriptResult(p.Data["code"], so.Initiator, start, so.Timing, stdout, stderr, retcode, err)
+				result.ID = p.ID
 
 				retData.ExecTime = time.Since(start).Seconds()
+				if p.Data["timing"] == "true" {
+					retData.Timing = so.Timing.report()
+					result.Timing = retData.Timing
+				}
 				if err != nil {
 					retData.Stderr = err.Error()
 					retData.Retcode = 1
@@ -304,8 +423,196 @@ func (a *Agent) RunRPC() {
 				ret.Encode(retData)
 				msg.Respond(resp)
 				if p.ID != 0 {
-					results := map[string]interface{}{"script_results": retData}
-					a.rClient.R().SetBody(results).Patch(fmt.Sprintf("/api/v3/%d/%s/histresult/", p.ID, a.AgentID))
+					a.postScriptResult(p.ID, result)
+				}
+			}(payload)
+
+		case "maintenance":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				var err error
+				switch p.Data["action"] {
+				case "set":
+					days, derr := ParseMaintenanceDays(p.Data["days"])
+					if derr != nil {
+						err = derr
+						break
+					}
+					err = a.SetMaintenanceWindow(rmm.MaintenanceWindow{
+						Enabled: p.Data["enabled"] != "false",
+						Start:   p.Data["start"],
+						End:     p.Data["end"],
+						Days:    days,
+					})
+				case "clear":
+					err = a.ClearMaintenanceWindow()
+				}
+				if err != nil {
+					a.Logger.Debugln("Maintenance:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(a.MaintenanceStatus())
+				}
+				msg.Respond(resp)
+			}(payload)
+
+		case "publickey":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				key, err := a.AgentPublicKey()
+				if err != nil {
+					a.Logger.Debugln("AgentPublicKey:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(key)
+				}
+				msg.Respond(resp)
+			}()
+
+		case "reenroll":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				if err := a.ReEnroll(p.Data["base_url"], p.Data["token"], p.Data["agent_id"]); err != nil {
+					a.Logger.Errorln("ReEnroll:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode("ok")
+				}
+				msg.Respond(resp)
+			}(payload)
+
+		case "rotatetoken":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				if err := a.RotateToken(p.Data["token"]); err != nil {
+					a.Logger.Errorln("RotateToken:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode("ok")
+				}
+				msg.Respond(resp)
+			}(payload)
+
+		case "setenv":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				if err := a.SetPersistentEnv(p.Data["name"], p.Data["value"], p.Data["scope"]); err != nil {
+					a.Logger.Debugln("SetPersistentEnv:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode("ok")
+				}
+				msg.Respond(resp)
+			}(payload)
+
+		case "flushdns":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				if err := a.FlushDNS(); err != nil {
+					a.Logger.Debugln("FlushDNS:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode("ok")
+				}
+				msg.Respond(resp)
+			}()
+
+		case "resetnetwork":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				// reply first since the reset can drop the connection
+				ret.Encode("ok")
+				msg.Respond(resp)
+				if err := a.ResetNetworkStack(); err != nil {
+					a.Logger.Errorln("ResetNetworkStack:", err)
+				}
+			}()
+
+		case "schedulereboot":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				var err error
+				switch p.Data["action"] {
+				case "set":
+					at, perr := time.Parse(time.RFC3339, p.Data["at"])
+					if perr != nil {
+						err = perr
+						break
+					}
+					err = a.ScheduleReboot(at, p.Data["message"])
+				case "cancel":
+					err = a.CancelScheduledReboot()
+				}
+				if err != nil {
+					a.Logger.Debugln("ScheduleReboot:", err)
+					ret.Encode(err.Error())
+					msg.Respond(resp)
+					return
+				}
+				at, pending, err := a.GetScheduledReboot()
+				if err != nil {
+					ret.Encode(err.Error())
+				} else if pending {
+					ret.Encode(rmm.ScheduledReboot{At: at.Unix()})
+				} else {
+					ret.Encode(rmm.ScheduledReboot{})
+				}
+				msg.Respond(resp)
+			}(payload)
+
+		case "powerplan":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				var err error
+				switch p.Data["action"] {
+				case "set":
+					err = a.SetPowerPlan(p.Data["plan"])
+				case "nosleep":
+					err = a.DisableSleep()
+				case "nohibernate":
+					err = a.DisableHibernate()
+				}
+				if err != nil {
+					a.Logger.Debugln("PowerPlan:", err)
+					ret.Encode(err.Error())
+					msg.Respond(resp)
+					return
+				}
+				plan, err := a.GetPowerPlan()
+				if err != nil {
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(plan)
+				}
+				msg.Respond(resp)
+			}(payload)
+
+		case "diagnostics":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				path, err := a.CollectDiagnostics()
+				if err != nil {
+					a.Logger.Errorln("CollectDiagnostics:", err)
+					ret.Encode(err.Error())
+					msg.Respond(resp)
+					return
+				}
+				ret.Encode("ok")
+				msg.Respond(resp)
+				defer os.Remove(path)
+				limit, _ := strconv.Atoi(p.Data["limit"])
+				if err := a.UploadFileChunked(path, p.Data["endpoint"], 0, limit); err != nil {
+					a.Logger.Errorln("CollectDiagnostics upload:", err)
 				}
 			}(payload)
 
@@ -318,6 +625,13 @@ func (a *Agent) RunRPC() {
 				case "mesh":
 					a.Logger.Debugln("Recovering mesh")
 					a.RecoverMesh()
+				case "meshregistration":
+					if err := a.RepairMeshRegistration(); err != nil {
+						a.Logger.Errorln("RepairMeshRegistration():", err)
+						ret.Encode(err.Error())
+						msg.Respond(resp)
+						return
+					}
 				}
 
 				ret.Encode("ok")
@@ -380,99 +694,816 @@ func (a *Agent) RunRPC() {
 				a.Logger.Debugln("Sending WMI")
 				a.NatsMessage(nc, "agent-wmi")
 			}()
-		case "cpuloadavg":
+		case "systeminfo":
 			go func() {
 				var resp []byte
 				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
-				a.Logger.Debugln("Getting CPU Load Avg")
-				loadAvg := a.GetCPULoadAvg()
-				a.Logger.Debugln("CPU Load Avg:", loadAvg)
-				ret.Encode(loadAvg)
+				info, err := a.GetSystemInfo()
+				if err != nil {
+					a.Logger.Debugln("GetSystemInfo:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(info)
+				}
 				msg.Respond(resp)
 			}()
-		case "runchecks":
+		case "avstatus":
 			go func() {
 				var resp []byte
 				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
-				if runtime.GOOS == "windows" {
-					if a.ChecksRunning() {
-						ret.Encode("busy")
-						msg.Respond(resp)
-						a.Logger.Debugln("Checks are already running, please wait")
-					} else {
-						ret.Encode("ok")
-						msg.Respond(resp)
-						a.Logger.Debugln("Running checks")
-						_, checkerr := CMD(a.EXE, []string{"-m", "runchecks"}, 600, false)
-						if checkerr != nil {
-							a.Logger.Errorln("RPC RunChecks", checkerr)
-						}
-					}
+				av, err := a.GetAntivirusStatus()
+				if err != nil {
+					a.Logger.Debugln("GetAntivirusStatus:", err)
+					ret.Encode(err.Error())
 				} else {
-					ret.Encode("ok")
-					msg.Respond(resp)
-					a.Logger.Debugln("Running checks")
-					a.RunChecks(true)
+					ret.Encode(av)
 				}
-
+				msg.Respond(resp)
 			}()
-		case "runtask":
-			go func(p *NatsMsg) {
-				a.Logger.Debugln("Running task")
-				a.RunTask(p.TaskPK)
-			}(payload)
-
-		case "publicip":
+		case "localusers":
 			go func() {
 				var resp []byte
 				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
-				ret.Encode(a.PublicIP())
+				users, err := a.GetLocalUsers()
+				if err != nil {
+					a.Logger.Debugln("GetLocalUsers:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(users)
+				}
 				msg.Respond(resp)
 			}()
-		case "installpython":
-			go a.GetPython(true)
-		case "installchoco":
-			go a.InstallChoco()
-		case "installwithchoco":
-			go func(p *NatsMsg) {
+		case "powerstatus":
+			go func() {
 				var resp []byte
 				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
-				ret.Encode("ok")
+				status, err := a.GetPowerStatus()
+				if err != nil {
+					a.Logger.Debugln("GetPowerStatus:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(status)
+				}
 				msg.Respond(resp)
-				out, _ := a.InstallWithChoco(p.ChocoProgName)
-				results := map[string]string{"results": out}
-				url := fmt.Sprintf("/api/v3/%d/chocoresult/", p.PendingActionPK)
-				a.rClient.R().SetBody(results).Patch(url)
-			}(payload)
-		case "getwinupdates":
+			}()
+		case "mounts":
 			go func() {
-				if !atomic.CompareAndSwapUint32(&getWinUpdateLocker, 0, 1) {
-					a.Logger.Debugln("Already checking for windows updates")
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				mounts, err := a.GetMounts()
+				if err != nil {
+					a.Logger.Debugln("GetMounts:", err)
+					ret.Encode(err.Error())
 				} else {
-					a.Logger.Debugln("Checking for windows updates")
-					defer atomic.StoreUint32(&getWinUpdateLocker, 0)
-					a.GetWinUpdates()
+					ret.Encode(mounts)
 				}
+				msg.Respond(resp)
 			}()
-		case "installwinupdates":
-			go func(p *NatsMsg) {
-				if !atomic.CompareAndSwapUint32(&installWinUpdateLocker, 0, 1) {
-					a.Logger.Debugln("Already installing windows updates")
+		case "shutdownreason":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				clean, reason, when, err := a.GetLastShutdownReason()
+				if err != nil {
+					a.Logger.Debugln("GetLastShutdownReason:", err)
+					ret.Encode(err.Error())
 				} else {
-					a.Logger.Debugln("Installing windows updates", p.UpdateGUIDs)
-					defer atomic.StoreUint32(&installWinUpdateLocker, 0)
-					a.InstallUpdates(p.UpdateGUIDs)
+					sr := rmm.ShutdownReason{Clean: clean, Reason: reason}
+					if !when.IsZero() {
+						sr.When = when.Unix()
+					}
+					ret.Encode(sr)
 				}
-			}(payload)
-		case "agentupdate":
-			go func(p *NatsMsg) {
+				msg.Respond(resp)
+			}()
+		case "virtinfo":
+			go func() {
 				var resp []byte
 				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
-				if !atomic.CompareAndSwapUint32(&agentUpdateLocker, 0, 1) {
-					a.Logger.Debugln("Agent update already running")
-					ret.Encode("updaterunning")
-					msg.Respond(resp)
-				} else {
+				isVirtual, hypervisor, err := a.GetVirtualizationInfo()
+				if err != nil {
+					a.Logger.Debugln("GetVirtualizationInfo:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(rmm.VirtualizationInfo{IsVirtual: isVirtual, Hypervisor: hypervisor})
+				}
+				msg.Respond(resp)
+			}()
+		case "gpuinfo":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				gpus, err := a.GetGPUInfo()
+				if err != nil {
+					a.Logger.Debugln("GetGPUInfo:", err)
+				}
+				ret.Encode(gpus)
+				msg.Respond(resp)
+			}()
+		case "cpuloadavg":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				a.Logger.Debugln("Getting CPU Load Avg")
+				loadAvg := a.GetCPULoadAvg()
+				a.Logger.Debugln("CPU Load Avg:", loadAvg)
+				ret.Encode(loadAvg)
+				msg.Respond(resp)
+			}()
+		case "handlestats":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				stats, err := a.GetHandleStats()
+				if err != nil {
+					a.Logger.Debugln("GetHandleStats:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(stats)
+				}
+				msg.Respond(resp)
+			}()
+		case "usbdevices":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				devices, err := a.GetRemovableDevices()
+				if err != nil {
+					a.Logger.Debugln("GetRemovableDevices:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(devices)
+				}
+				msg.Respond(resp)
+			}()
+		case "procnetusage":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				usage, err := a.GetProcessNetworkUsage()
+				if err != nil {
+					a.Logger.Debugln("GetProcessNetworkUsage:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(usage)
+				}
+				msg.Respond(resp)
+			}()
+		case "authstatus":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				status, err := a.AuthStatus()
+				if err != nil {
+					a.Logger.Debugln("AuthStatus:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(status)
+				}
+				msg.Respond(resp)
+			}()
+		case "firewallrules":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				rules, err := a.GetFirewallRules()
+				if err != nil {
+					a.Logger.Debugln("GetFirewallRules:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(rules)
+				}
+				msg.Respond(resp)
+			}()
+		case "browserextensions":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				exts, err := a.GetBrowserExtensions()
+				if err != nil {
+					a.Logger.Debugln("GetBrowserExtensions:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(exts)
+				}
+				msg.Respond(resp)
+			}()
+		case "nestedvirt":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				supported, err := a.SupportsNestedVirtualization()
+				if err != nil {
+					a.Logger.Debugln("SupportsNestedVirtualization:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(supported)
+				}
+				msg.Respond(resp)
+			}()
+		case "dhcpinfo":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				leases, err := a.GetDHCPInfo()
+				if err != nil {
+					a.Logger.Debugln("GetDHCPInfo:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(leases)
+				}
+				msg.Respond(resp)
+			}()
+		case "taskhistory":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				runs, err := a.GetTaskRunHistory(p.Data["name"])
+				if err != nil {
+					a.Logger.Debugln("GetTaskRunHistory:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(runs)
+				}
+				msg.Respond(resp)
+			}(payload)
+		case "entropy":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				available, err := a.GetEntropyStatus()
+				if err != nil {
+					a.Logger.Debugln("GetEntropyStatus:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(available)
+				}
+				msg.Respond(resp)
+			}()
+		case "hostsfile":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				var err error
+				switch p.Data["action"] {
+				case "add":
+					err = a.AddHostsEntry(p.Data["ip"], p.Data["hostname"], p.Data["comment"])
+				case "remove":
+					err = a.RemoveHostsEntry(p.Data["hostname"])
+				default:
+					entries, err := a.GetHostsEntries()
+					if err != nil {
+						a.Logger.Debugln("GetHostsEntries:", err)
+						ret.Encode(err.Error())
+					} else {
+						ret.Encode(entries)
+					}
+					msg.Respond(resp)
+					return
+				}
+				if err != nil {
+					a.Logger.Debugln("hostsfile:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode("ok")
+				}
+				msg.Respond(resp)
+			}(payload)
+		case "binarycmd":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				opts := a.NewCMDOpts()
+				opts.Shell = p.Data["shell"]
+				opts.Command = p.Data["command"]
+				opts.Timeout = time.Duration(p.Timeout) * time.Second
+				opts.Initiator = "rpc:binarycmd"
+				opts.Sensitive = p.Data["sensitive"] == "true"
+				opts.BinaryOutput = true
+				out := a.CmdV2(opts)
+				ret.Encode(map[string]interface{}{
+					"stdout_b64": out.Stdout,
+					"stderr":     out.Stderr,
+					"retcode":    out.Status.Exit,
+				})
+				msg.Respond(resp)
+			}(payload)
+		case "configdrift":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				drift, err := a.ConfigDrift(p.Data)
+				if err != nil {
+					a.Logger.Debugln("ConfigDrift:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(drift)
+				}
+				msg.Respond(resp)
+			}(payload)
+		case "secureboot":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				enabled, supported, err := a.GetSecureBootStatus()
+				if err != nil {
+					a.Logger.Debugln("GetSecureBootStatus:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(map[string]bool{"enabled": enabled, "supported": supported})
+				}
+				msg.Respond(resp)
+			}()
+		case "percorecpu":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				interval, _ := strconv.Atoi(p.Data["interval"])
+				cores, err := a.GetPerCoreCPU(interval)
+				if err != nil {
+					a.Logger.Debugln("GetPerCoreCPU:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(cores)
+				}
+				msg.Respond(resp)
+			}(payload)
+		case "mempressure":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				mp, err := a.GetMemoryPressure()
+				if err != nil {
+					a.Logger.Debugln("GetMemoryPressure:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(mp)
+				}
+				msg.Respond(resp)
+			}()
+		case "apitls":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				report, err := a.InspectAPITLS()
+				if err != nil {
+					a.Logger.Debugln("InspectAPITLS:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(report)
+				}
+				msg.Respond(resp)
+			}()
+		case "filelockers":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				procs, err := a.GetFileLockers(p.Data["path"])
+				if err != nil {
+					a.Logger.Debugln("GetFileLockers:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(procs)
+				}
+				msg.Respond(resp)
+			}(payload)
+		case "rawcmdstream":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				// output goes to the endpoint, the reply only says the command was started
+				ret.Encode("ok")
+				msg.Respond(resp)
+
+				opts := a.NewCMDOpts()
+				opts.Shell = p.Data["shell"]
+				opts.Command = p.Data["command"]
+				opts.Timeout = time.Duration(p.Timeout) * time.Second
+				opts.Initiator = "rpc:rawcmdstream"
+				opts.Sensitive = p.Data["sensitive"] == "true"
+				opts.LogLines = false
+				if err := a.RunCmdStreamToServer(opts, p.Data["endpoint"]); err != nil {
+					a.Logger.Errorln("RunCmdStreamToServer():", err)
+				}
+			}(payload)
+		case "routingtable":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				routes, err := a.GetRoutingTable()
+				if err != nil {
+					a.Logger.Debugln("GetRoutingTable:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(routes)
+				}
+				msg.Respond(resp)
+			}()
+		case "arptable":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				entries, err := a.GetARPTable()
+				if err != nil {
+					a.Logger.Debugln("GetARPTable:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(entries)
+				}
+				msg.Respond(resp)
+			}()
+		case "agentconnections":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				conns, err := a.GetAgentConnections()
+				if err != nil {
+					a.Logger.Debugln("GetAgentConnections:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(conns)
+				}
+				msg.Respond(resp)
+			}()
+		case "installpackage":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				var status CmdStatus
+				var err error
+				if p.Data["action"] == "uninstall" {
+					status, err = a.UninstallPackage(p.Data["path"], p.ScriptArgs, p.Timeout)
+				} else {
+					status, err = a.InstallPackage(p.Data["path"], p.ScriptArgs, p.Timeout)
+				}
+				result := rmm.PackageResult{
+					ExitCode: status.Status.Exit,
+					Meaning:  status.ExitMeaning,
+					Stdout:   status.Stdout,
+					Stderr:   status.Stderr,
+				}
+				if err != nil {
+					a.Logger.Debugln("InstallPackage:", err)
+					result.Error = err.Error()
+				}
+				ret.Encode(result)
+				msg.Respond(resp)
+			}(payload)
+		case "diskusage":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				usage, err := a.GetDiskUsageDetailed()
+				if err != nil {
+					a.Logger.Debugln("GetDiskUsageDetailed:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(usage)
+				}
+				msg.Respond(resp)
+			}()
+		case "toggles":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				// a payload replaces the toggles, an empty one just returns them
+				if len(p.Data) > 0 {
+					toggles := make(map[string]bool, len(p.Data))
+					for k, v := range p.Data {
+						on, err := strconv.ParseBool(v)
+						if err != nil {
+							ret.Encode(fmt.Sprintf("toggle %s: %q is not a bool", k, v))
+							msg.Respond(resp)
+							return
+						}
+						toggles[k] = on
+					}
+					if err := a.SetToggles(toggles); err != nil {
+						a.Logger.Errorln("SetToggles():", err)
+					}
+				}
+				ret.Encode(a.GetToggles())
+				msg.Respond(resp)
+			}(payload)
+		case "remotesessions":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				if id := p.Data["logoff"]; id != "" {
+					if err := a.LogoffSession(id); err != nil {
+						a.Logger.Debugln("LogoffSession:", err)
+						ret.Encode(err.Error())
+					} else {
+						ret.Encode("ok")
+					}
+					msg.Respond(resp)
+					return
+				}
+				sessions, err := a.GetRemoteSessions()
+				if err != nil {
+					a.Logger.Debugln("GetRemoteSessions:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(sessions)
+				}
+				msg.Respond(resp)
+			}(payload)
+		case "loglevel":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				if level, ok := p.Data["level"]; ok {
+					if err := a.SetLogLevel(level); err != nil {
+						ret.Encode(err.Error())
+						msg.Respond(resp)
+						return
+					}
+				}
+				ret.Encode(a.GetLogLevel())
+				msg.Respond(resp)
+			}(payload)
+		case "wmiquery":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				rows, err := a.RunWMIQuery(p.Data["namespace"], p.Data["query"])
+				if err != nil {
+					a.Logger.Debugln("RunWMIQuery:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(rows)
+				}
+				msg.Respond(resp)
+			}(payload)
+		case "tpminfo":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				info, err := a.GetTPMInfo()
+				if err != nil {
+					a.Logger.Debugln("GetTPMInfo:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(info)
+				}
+				msg.Respond(resp)
+			}()
+		case "defenderexclusions":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				if p.Data["action"] == "add" {
+					if err := a.AddDefenderExclusion(p.Data["kind"], p.Data["value"]); err != nil {
+						a.Logger.Debugln("AddDefenderExclusion:", err)
+						ret.Encode(err.Error())
+					} else {
+						ret.Encode("ok")
+					}
+					msg.Respond(resp)
+					return
+				}
+				exclusions, err := a.GetDefenderExclusions()
+				if err != nil {
+					a.Logger.Debugln("GetDefenderExclusions:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(exclusions)
+				}
+				msg.Respond(resp)
+			}(payload)
+		case "natsstatus":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				status, err := a.NatsStatus()
+				if err != nil {
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(status)
+				}
+				msg.Respond(resp)
+			}()
+		case "proxyinfo":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				info, err := a.ProxyDiagnostic()
+				if err != nil {
+					a.Logger.Debugln("ProxyDiagnostic:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(info)
+				}
+				msg.Respond(resp)
+			}()
+		case "topprocs":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				n, _ := strconv.Atoi(p.Data["count"])
+				procs, err := a.GetTopProcesses(p.Data["by"], n)
+				if err != nil {
+					a.Logger.Debugln("GetTopProcesses:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(procs)
+				}
+				msg.Respond(resp)
+			}(payload)
+		case "hostnamecheck":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				report, err := a.CheckHostnameConsistency()
+				if err != nil {
+					a.Logger.Debugln("CheckHostnameConsistency:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(report)
+				}
+				msg.Respond(resp)
+			}()
+		case "bitlocker":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				if p.Data["action"] == "backupkey" {
+					if err := a.BackupBitLockerKey(); err != nil {
+						a.Logger.Debugln("BackupBitLockerKey:", err)
+						ret.Encode(err.Error())
+					} else {
+						ret.Encode("ok")
+					}
+					msg.Respond(resp)
+					return
+				}
+				vols, err := a.GetBitLockerStatus()
+				if err != nil {
+					a.Logger.Debugln("GetBitLockerStatus:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(vols)
+				}
+				msg.Respond(resp)
+			}(payload)
+		case "diskencryption":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				var vols []rmm.VolumeEncryption
+				var err error
+				if runtime.GOOS == "windows" {
+					vols, err = a.GetBitLockerStatus()
+				} else {
+					vols, err = a.GetLUKSStatus()
+				}
+				if err != nil {
+					a.Logger.Debugln("diskencryption:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(vols)
+				}
+				msg.Respond(resp)
+			}()
+		case "diskio":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				stats, err := a.GetDiskIOStats()
+				if err != nil {
+					a.Logger.Debugln("GetDiskIOStats:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(stats)
+				}
+				msg.Respond(resp)
+			}()
+		case "runchecks":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				if runtime.GOOS == "windows" {
+					if a.ChecksRunning() {
+						ret.Encode("busy")
+						msg.Respond(resp)
+						a.Logger.Debugln("Checks are already running, please wait")
+					} else {
+						ret.Encode("ok")
+						msg.Respond(resp)
+						a.Logger.Debugln("Running checks")
+						_, checkerr := CMD(a.EXE, []string{"-m", "runchecks"}, 600, false)
+						if checkerr != nil {
+							a.Logger.Errorln("RPC RunChecks", checkerr)
+						}
+					}
+				} else {
+					ret.Encode("ok")
+					msg.Respond(resp)
+					a.Logger.Debugln("Running checks")
+					a.RunChecks(true)
+				}
+
+			}()
+		case "runtask":
+			go func(p *NatsMsg) {
+				a.Logger.Debugln("Running task")
+				a.RunTask(p.TaskPK)
+			}(payload)
+
+		case "certexpiry":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				notAfter, daysLeft, err := a.CheckCertExpiry(p.Data["addr"])
+				if err != nil {
+					a.Logger.Debugln("CheckCertExpiry:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(rmm.CertExpiry{Addr: p.Data["addr"], NotAfter: notAfter.Unix(), DaysLeft: daysLeft})
+				}
+				msg.Respond(resp)
+			}(payload)
+		case "tracerequest":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				path := p.Data["path"]
+				if path == "" {
+					path = fmt.Sprintf("/api/v3/%s/checkinterval/", a.agentID())
+				}
+				trace, err := a.TraceRequest(path)
+				if err != nil {
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(trace)
+				}
+				msg.Respond(resp)
+			}(payload)
+
+		case "publicip":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				ret.Encode(a.PublicIP())
+				msg.Respond(resp)
+			}()
+		case "installpython":
+			go a.GetPython(true)
+		case "installchoco":
+			go a.InstallChoco()
+		case "installwithchoco":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				ret.Encode("ok")
+				msg.Respond(resp)
+				out, _ := a.InstallWithChoco(p.ChocoProgName)
+				results := map[string]string{"results": out}
+				url := fmt.Sprintf("/api/v3/%d/chocoresult/", p.PendingActionPK)
+				a.rClient.R().SetBody(results).Patch(url)
+			}(payload)
+		case "linuxupdates":
+			go func() {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				updates, err := a.GetLinuxUpdates()
+				if err != nil {
+					a.Logger.Debugln("GetLinuxUpdates:", err)
+					ret.Encode(err.Error())
+				} else {
+					ret.Encode(updates)
+				}
+				msg.Respond(resp)
+			}()
+		case "getwinupdates":
+			go func() {
+				if !atomic.CompareAndSwapUint32(&getWinUpdateLocker, 0, 1) {
+					a.Logger.Debugln("Already checking for windows updates")
+				} else {
+					a.Logger.Debugln("Checking for windows updates")
+					defer atomic.StoreUint32(&getWinUpdateLocker, 0)
+					a.GetWinUpdates()
+				}
+			}()
+		case "installwinupdates":
+			go func(p *NatsMsg) {
+				if !atomic.CompareAndSwapUint32(&installWinUpdateLocker, 0, 1) {
+					a.Logger.Debugln("Already installing windows updates")
+				} else {
+					a.Logger.Debugln("Installing windows updates", p.UpdateGUIDs)
+					defer atomic.StoreUint32(&installWinUpdateLocker, 0)
+					a.InstallUpdates(p.UpdateGUIDs)
+				}
+			}(payload)
+		case "agentupdate":
+			go func(p *NatsMsg) {
+				var resp []byte
+				ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+				if !atomic.CompareAndSwapUint32(&agentUpdateLocker, 0, 1) {
+					a.Logger.Debugln("Agent update already running")
+					ret.Encode("updaterunning")
+					msg.Respond(resp)
+				} else {
 					ret.Encode("ok")
 					msg.Respond(resp)
 					a.AgentUpdate(p.Data["url"], p.Data["inno"], p.Data["version"])
@@ -496,6 +1527,23 @@ func (a *Agent) RunRPC() {
 			}(payload)
 		}
 	})
+	if err := sess.Connect(); err != nil {
+		a.Logger.Fatalln("RunRPC() nats.Connect()", err)
+	}
+
+	// health checks get their own subject so they can be polled without going through the rpc handler
+	health := a.newNatsSession(a.agentID()+".health", func(msg *nats.Msg) {
+		go func() {
+			var resp []byte
+			ret := codec.NewEncoderBytes(&resp, new(codec.MsgpackHandle))
+			ret.Encode(a.HealthCheck())
+			msg.Respond(resp)
+		}()
+	})
+	if err := health.Connect(); err != nil {
+		a.Logger.Errorln("RunRPC() health nats.Connect()", err)
+	}
+	nc := sess.Conn()
 	nc.Flush()
 
 	if err := nc.LastError(); err != nil {
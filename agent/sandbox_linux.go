@@ -0,0 +1,56 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"os"
+	"os/exec"
+)
+
+// sandboxCmd wraps c in bubblewrap: no network or other namespaces shared with the host, the whole
+// filesystem read only and a fresh scratch dir as the working dir and TMPDIR. cleanup removes the scratch dir.
+// Fails closed, if bwrap isn't installed the command isn't run at all
+func sandboxCmd(c *CmdOptions) (sc *CmdOptions, cleanup func(), err error) {
+	bwrap, err := exec.LookPath("bwrap")
+	if err != nil {
+		return nil, nil, ErrNoSandbox
+	}
+
+	scratch, err := os.MkdirTemp("", "trmm-sandbox-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup = func() { os.RemoveAll(scratch) }
+
+	args := []string{
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--bind", scratch, scratch,
+		"--chdir", scratch,
+		"--setenv", "TMPDIR", scratch,
+		"--unshare-all",
+		"--die-with-parent",
+		// stops the command pushing input into the agent's terminal with TIOCSTI
+		"--new-session",
+		"--",
+		c.Shell,
+	}
+	args = append(args, c.cmdArgs()...)
+
+	wrapped := *c
+	wrapped.Shell = bwrap
+	wrapped.Args = args
+	wrapped.IsScript = true
+	wrapped.IsExecutable = false
+	return &wrapped, cleanup, nil
+}
@@ -0,0 +1,17 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+// sandboxCmd always refuses on windows so a command that asked for a sandbox never runs without one
+func sandboxCmd(c *CmdOptions) (*CmdOptions, func(), error) {
+	return nil, nil, ErrNoSandbox
+}
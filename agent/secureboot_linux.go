@@ -0,0 +1,50 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// efi global variable guid, SecureBoot and SetupMode live under it
+const efiGlobalGUID = "8be4df61-93ca-11d2-aa0d-00e098032b8c"
+
+// GetSecureBootStatus reads the SecureBoot efi variable, supported is false on bios systems
+// and on firmware that doesn't have the variable at all
+func (a *Agent) GetSecureBootStatus() (enabled bool, supported bool, err error) {
+	if _, err := os.Stat("/sys/firmware/efi"); os.IsNotExist(err) {
+		return false, false, nil
+	}
+
+	dir := "/sys/firmware/efi/efivars"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, true, err
+	}
+	if len(entries) == 0 {
+		return false, true, errors.New("efivarfs is not mounted on /sys/firmware/efi/efivars")
+	}
+
+	// 4 bytes of attributes followed by the value
+	b, err := os.ReadFile(filepath.Join(dir, "SecureBoot-"+efiGlobalGUID))
+	if os.IsNotExist(err) {
+		return false, false, nil
+	} else if err != nil {
+		return false, true, err
+	}
+	if len(b) < 5 {
+		return false, true, errors.New("SecureBoot efi variable is too short")
+	}
+	return b[4] == 1, true, nil
+}
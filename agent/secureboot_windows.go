@@ -0,0 +1,80 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// efi global variable guid, SecureBoot and SetupMode live under it
+const efiGlobalGUID = "{8be4df61-93ca-11d2-aa0d-00e098032b8c}"
+
+// https://docs.microsoft.com/en-us/windows/win32/api/winnt/ne-winnt-firmware_type
+const firmwareTypeUefi = 2
+
+// GetSecureBootStatus is the Confirm-SecureBootUEFI equivalent, supported is false on bios systems instead of an error
+// The state windows records at boot is used first, the firmware variable is only read if that's missing
+func (a *Agent) GetSecureBootStatus() (enabled bool, supported bool, err error) {
+	var fw uint32
+	if err := GetFirmwareType(&fw); err != nil {
+		return false, false, err
+	}
+	if fw != firmwareTypeUefi {
+		return false, false, nil
+	}
+
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\SecureBoot\State`, registry.QUERY_VALUE)
+	if err == nil {
+		defer k.Close()
+		if v, _, err := k.GetIntegerValue("UEFISecureBootEnabled"); err == nil {
+			return v == 1, true, nil
+		}
+	}
+
+	if err := enablePrivilege("SeSystemEnvironmentPrivilege"); err != nil {
+		return false, true, err
+	}
+	var val byte
+	_, err = GetFirmwareEnvironmentVariable("SecureBoot", efiGlobalGUID, unsafe.Pointer(&val), 1)
+	if errors.Is(err, windows.ERROR_ENVVAR_NOT_FOUND) {
+		// uefi without secure boot support
+		return false, false, nil
+	} else if errors.Is(err, windows.ERROR_PRIVILEGE_NOT_HELD) {
+		return false, true, ErrNotElevated
+	} else if err != nil {
+		return false, true, err
+	}
+	return val == 1, true, nil
+}
+
+// enablePrivilege turns on a privilege the agent's token holds but has disabled
+func enablePrivilege(name string) error {
+	var luid windows.LUID
+	if err := windows.LookupPrivilegeValue(nil, windows.StringToUTF16Ptr(name), &luid); err != nil {
+		return err
+	}
+
+	var token windows.Token
+	if err := windows.OpenProcessToken(windows.CurrentProcess(), windows.TOKEN_ADJUST_PRIVILEGES|windows.TOKEN_QUERY, &token); err != nil {
+		return err
+	}
+	defer token.Close()
+
+	tp := windows.Tokenprivileges{PrivilegeCount: 1}
+	tp.Privileges[0] = windows.LUIDAndAttributes{Luid: luid, Attributes: windows.SE_PRIVILEGE_ENABLED}
+	// succeeds even if the token doesn't hold the privilege, the call that needs it fails instead
+	return windows.AdjustTokenPrivileges(token, false, &tp, 0, nil, nil)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetRemoteSessions returns the logged in terminal and ssh sessions from utmp, the session id is the login process pid
+func (a *Agent) GetRemoteSessions() ([]rmm.RemoteSession, error) {
+	ret := make([]rmm.RemoteSession, 0)
+
+	out, err := runTool(10*time.Second, "who", "-u")
+	if err != nil {
+		return ret, err
+	}
+
+	// user  pts/0  2022-06-01 10:15  00:02  12345 (10.0.0.5)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+
+		s := rmm.RemoteSession{User: fields[0], Station: fields[1], Protocol: "tty", State: "active"}
+		last := len(fields) - 1
+		if strings.HasPrefix(fields[last], "(") {
+			s.Client = strings.Trim(fields[last], "()")
+			last--
+		}
+		if _, err := strconv.Atoi(fields[last]); err != nil {
+			continue
+		}
+		s.ID = fields[last]
+		if s.Client != "" && !strings.HasPrefix(s.Client, ":") {
+			s.Protocol = "ssh"
+		}
+		if fields[last-1] == "old" {
+			s.State = "idle"
+		}
+		if t, err := time.ParseInLocation("2006-01-02 15:04", fields[2]+" "+fields[3], time.Local); err == nil {
+			s.LogonTime = t.Unix()
+		}
+		ret = append(ret, s)
+	}
+	return ret, nil
+}
+
+// LogoffSession ends a session from GetRemoteSessions by hanging up its login process, killing it if that doesn't work
+func (a *Agent) LogoffSession(sessionID string) error {
+	sessions, err := a.GetRemoteSessions()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, s := range sessions {
+		if s.ID == sessionID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: %q", ErrNoSession, sessionID)
+	}
+
+	pid, _ := strconv.Atoi(sessionID)
+	if err := syscall.Kill(pid, syscall.SIGHUP); err != nil {
+		return err
+	}
+	for i := 0; i < 10; i++ {
+		time.Sleep(500 * time.Millisecond)
+		if err := syscall.Kill(pid, 0); err != nil {
+			return nil
+		}
+	}
+	a.Logger.Debugln("LogoffSession(): session", sessionID, "ignored SIGHUP, killing it")
+	return KillProc(int32(pid))
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"unsafe"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	"golang.org/x/sys/windows"
+)
+
+// WTS_INFO_CLASS values
+const (
+	wtsUserName           = 5
+	wtsDomainName         = 7
+	wtsClientName         = 10
+	wtsClientProtocolType = 16
+)
+
+var wtsStates = map[uint32]string{
+	windows.WTSActive:       "active",
+	windows.WTSConnected:    "connected",
+	windows.WTSConnectQuery: "connecting",
+	windows.WTSShadow:       "shadow",
+	windows.WTSDisconnected: "disconnected",
+	windows.WTSIdle:         "idle",
+	windows.WTSReset:        "reset",
+	windows.WTSDown:         "down",
+	windows.WTSInit:         "init",
+}
+
+// GetRemoteSessions returns the console and rdp sessions that have a user logged in
+func (a *Agent) GetRemoteSessions() ([]rmm.RemoteSession, error) {
+	ret := make([]rmm.RemoteSession, 0)
+
+	var info *windows.WTS_SESSION_INFO
+	var count uint32
+	if err := windows.WTSEnumerateSessions(0, 0, 1, &info, &count); err != nil {
+		return ret, fmt.Errorf("WTSEnumerateSessions: %v", err)
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(info)))
+
+	sessions := unsafe.Slice(info, count)
+	for _, s := range sessions {
+		// session 0 is services and the rdp listener has no user
+		user := wtsQueryString(s.SessionID, wtsUserName)
+		if user == "" {
+			continue
+		}
+
+		rs := rmm.RemoteSession{
+			ID:       strconv.Itoa(int(s.SessionID)),
+			User:     user,
+			Domain:   wtsQueryString(s.SessionID, wtsDomainName),
+			Station:  windows.UTF16PtrToString(s.WindowStationName),
+			Client:   wtsQueryString(s.SessionID, wtsClientName),
+			State:    wtsStates[s.State],
+			Protocol: "console",
+		}
+		if p, err := wtsQuery(s.SessionID, wtsClientProtocolType); err == nil {
+			if len(p) >= 2 && *(*uint16)(unsafe.Pointer(&p[0])) == 2 {
+				rs.Protocol = "rdp"
+			}
+		}
+		ret = append(ret, rs)
+	}
+	return ret, nil
+}
+
+// LogoffSession logs off a session from GetRemoteSessions, waiting for the logoff to finish
+func (a *Agent) LogoffSession(sessionID string) error {
+	id, err := strconv.ParseUint(sessionID, 10, 32)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrNoSession, sessionID)
+	}
+
+	sessions, err := a.GetRemoteSessions()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, s := range sessions {
+		if s.ID == sessionID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: %q", ErrNoSession, sessionID)
+	}
+	return WTSLogoffSession(0, uint32(id), true)
+}
+
+// wtsQuery returns a copy of the WTSQuerySessionInformation buffer
+func wtsQuery(session uint32, class uint32) ([]byte, error) {
+	var buf *byte
+	var n uint32
+	if err := WTSQuerySessionInformation(0, session, class, &buf, &n); err != nil {
+		return nil, err
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(buf)))
+	return append([]byte(nil), unsafe.Slice(buf, n)...), nil
+}
+
+func wtsQueryString(session uint32, class uint32) string {
+	b, err := wtsQuery(session, class)
+	if err != nil || len(b) < 2 {
+		return ""
+	}
+	return windows.UTF16ToString(unsafe.Slice((*uint16)(unsafe.Pointer(&b[0])), len(b)/2))
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"strings"
+	"time"
+)
+
+// GetLastShutdownReason reads wtmp through last to see how the previous boot ended
+// A shutdown record right before the current boot means it was clean, another boot record means it wasn't
+func (a *Agent) GetLastShutdownReason() (clean bool, reason string, when time.Time, err error) {
+	out, err := runTool(30*time.Second, "last", "-x", "-n", "5", "--time-format", "iso", "shutdown", "reboot")
+	if err != nil {
+		a.Logger.Debugln("GetLastShutdownReason():", err)
+		return false, "unknown", time.Time{}, nil
+	}
+
+	type record struct {
+		kind string
+		at   time.Time
+	}
+	records := make([]record, 0, 2)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || (fields[0] != "reboot" && fields[0] != "shutdown") {
+			continue
+		}
+		at, perr := time.Parse("2006-01-02T15:04:05-07:00", fields[4])
+		if perr != nil {
+			at, perr = time.Parse("2006-01-02T15:04:05-0700", fields[4])
+		}
+		if perr != nil {
+			continue
+		}
+		records = append(records, record{kind: fields[0], at: at})
+		if len(records) == 2 {
+			break
+		}
+	}
+
+	// wtmp rotates, so there may not be anything from before the current boot
+	if len(records) < 2 || records[0].kind != "reboot" {
+		return false, "unknown", time.Time{}, nil
+	}
+
+	prev := records[1]
+	if prev.kind == "shutdown" {
+		return true, "clean shutdown", prev.at, nil
+	}
+	// the time of the crash itself isn't recorded, only the boot after it
+	return false, "unexpected shutdown, no shutdown record before boot", records[0].at, nil
+}
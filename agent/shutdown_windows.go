@@ -0,0 +1,59 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/StackExchange/wmi"
+)
+
+// GetLastShutdownReason looks at the newest shutdown related event in the System log
+// 1074 (shutdown initiated) and 6006 (event log stopped) mean a clean shutdown,
+// 6008 (unexpected shutdown) and kernel-power 41 mean a crash or power loss
+func (a *Agent) GetLastShutdownReason() (clean bool, reason string, when time.Time, err error) {
+	var events []struct {
+		EventCode   uint16
+		SourceName  string
+		TimeWritten time.Time
+		Message     string
+	}
+	q := "SELECT EventCode, SourceName, TimeWritten, Message FROM Win32_NTLogEvent WHERE Logfile = 'System' AND (EventCode = 1074 OR EventCode = 6006 OR EventCode = 6008 OR EventCode = 41)"
+	if err := wmi.Query(q, &events); err != nil {
+		return false, "unknown", time.Time{}, err
+	}
+
+	latest := -1
+	for i, e := range events {
+		// 41 is only interesting from kernel-power
+		if e.EventCode == 41 && !strings.Contains(e.SourceName, "Kernel-Power") {
+			continue
+		}
+		if latest < 0 || e.TimeWritten.After(events[latest].TimeWritten) {
+			latest = i
+		}
+	}
+	if latest < 0 {
+		return false, "unknown", time.Time{}, nil
+	}
+
+	e := events[latest]
+	msg := strings.TrimSpace(strings.Split(e.Message, "\n")[0])
+	switch e.EventCode {
+	case 1074, 6006:
+		return true, fmt.Sprintf("event %d: %s", e.EventCode, msg), e.TimeWritten, nil
+	default:
+		return false, fmt.Sprintf("event %d: %s", e.EventCode, msg), e.TimeWritten, nil
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	agentKeyFile    = "agent.key"
+	signatureHeader = "X-Signature"
+	hmacHeader      = "X-Agent-HMAC"
+)
+
+// agentKey loads the agent's ed25519 signing key, generating and saving one on first use
+func (a *Agent) agentKey() (ed25519.PrivateKey, error) {
+	a.auth.keyMu.Lock()
+	defer a.auth.keyMu.Unlock()
+
+	if a.auth.key != nil {
+		return a.auth.key, nil
+	}
+
+	path := a.stateFile(agentKeyFile)
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return nil, fmt.Errorf("%s is not a pem file", path)
+		}
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an ed25519 key", path)
+		}
+		a.auth.key = key
+	case os.IsNotExist(err):
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeStateFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})); err != nil {
+			return nil, err
+		}
+		a.Logger.Infoln("Generated new agent signing key")
+		a.auth.key = key
+	default:
+		return nil, err
+	}
+	return a.auth.key, nil
+}
+
+// AgentPublicKey returns the pem encoded public key the server uses to verify signed payloads
+func (a *Agent) AgentPublicKey() (string, error) {
+	key, err := a.agentKey()
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// signRequest is a resty pre-request hook that adds a base64 ed25519 signature of the body
+// it runs after the body is serialized so the signature covers exactly what's sent
+func (a *Agent) signRequest(c *resty.Client, req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if req.GetBody == nil {
+		return errors.New("signRequest(): request body can't be re-read for signing")
+	}
+
+	rc, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	body, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+
+	key, err := a.agentKey()
+	if err != nil {
+		return err
+	}
+	req.Header.Set(signatureHeader, base64.StdEncoding.EncodeToString(ed25519.Sign(key, body)))
+	// body was only peeked through GetBody, make sure the original reader is at the start
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
+// hmacSign returns the hex hmac-sha256 of body keyed with the agent token
+func (a *Agent) hmacSign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(a.authToken()))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// shared by every feature that stores small bits of state with AgentState, only the agent key has its own file
+const agentStateFile = "state.json"
+
+// stateImports are the files features kept their state in before AgentState, imported on startup
+var stateImports = []struct {
+	key, file string
+	// the file holds a plain string rather than json
+	raw bool
+}{
+	{runtimeStateKey, "runtime.json", false},
+	{rebootStateKey, "reboot.json", false},
+	{maintenanceStateKey, "maintenance.json", false},
+	{fingerprintStateKey, "fingerprint", true},
+}
+
+// AgentState is a small json key-value store in the state dir for anything that needs to survive a restart
+// The file is read on every call and replaced atomically on every write so the rpc and agent services,
+// which are separate processes, see each other's changes. Calls hold state.json.lock so one service's
+// update isn't lost to the other's. A file that can't be parsed is moved aside to state.json.corrupt
+// and the store starts empty
+type AgentState struct {
+	mu     sync.Mutex
+	path   string
+	logger *logrus.Logger
+}
+
+func newAgentState(path string, logger *logrus.Logger) *AgentState {
+	return &AgentState{path: path, logger: logger}
+}
+
+// Get decodes the value for key into v, found is false if it isn't set
+func (s *AgentState) Get(key string, v interface{}) (found bool, err error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	m, err := s.load()
+	if err != nil {
+		return false, err
+	}
+	raw, ok := m[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// Set stores v as json under key
+func (s *AgentState) Set(key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	m, err := s.load()
+	if err != nil {
+		return err
+	}
+	m[key] = b
+	return s.save(m)
+}
+
+// Delete removes key, it's not an error if it isn't set
+func (s *AgentState) Delete(key string) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	m, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := m[key]; !ok {
+		return nil
+	}
+	delete(m, key)
+	return s.save(m)
+}
+
+// lock serializes calls in this process with mu and across processes with the lock file
+func (s *AgentState) lock() (unlock func(), err error) {
+	s.mu.Lock()
+	// the state dir doesn't exist yet on a fresh linux install
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	unlockFile, err := lockFile(s.path + ".lock")
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		unlockFile()
+		s.mu.Unlock()
+	}, nil
+}
+
+// importFile moves a state file from before AgentState into the store under key, then removes it.
+// A key that's already set wins over the file
+func (s *AgentState) importFile(key, path string, raw bool) error {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	v := json.RawMessage(b)
+	if raw {
+		if v, err = json.Marshal(strings.TrimSpace(string(b))); err != nil {
+			return err
+		}
+	} else if !json.Valid(b) {
+		s.logger.Debugln("AgentState: not importing corrupt state file", path)
+		return os.Remove(path)
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	m, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := m[key]; !ok {
+		m[key] = v
+		if err := s.save(m); err != nil {
+			return err
+		}
+	}
+	return os.Remove(path)
+}
+
+// importStateFiles brings the state files of an agent upgraded from before AgentState into the store
+func (a *Agent) importStateFiles() {
+	for _, f := range stateImports {
+		if err := a.state.importFile(f.key, a.stateFile(f.file), f.raw); err != nil {
+			a.Logger.Debugln("importStateFiles():", err)
+		}
+	}
+}
+
+func (s *AgentState) load() (map[string]json.RawMessage, error) {
+	m := make(map[string]json.RawMessage)
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return m, nil
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		s.logger.Errorln("AgentState: resetting corrupt state file:", err)
+		corrupt := s.path + ".corrupt"
+		os.Remove(corrupt)
+		if rerr := os.Rename(s.path, corrupt); rerr != nil {
+			s.logger.Debugln("AgentState:", rerr)
+		}
+		return make(map[string]json.RawMessage), nil
+	}
+	return m, nil
+}
+
+// save writes to a temp file and renames it over the state file so a crash never leaves it half written
+func (s *AgentState) save(m map[string]json.RawMessage) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.tmp%d", s.path, os.Getpid())
+	if err := writeStateFile(tmp, b); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
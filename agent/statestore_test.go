@@ -0,0 +1,145 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testAgentState(t *testing.T) *AgentState {
+	t.Helper()
+	// a dir that doesn't exist yet, like /var/lib/tacticalagent on a fresh install
+	return newAgentState(filepath.Join(t.TempDir(), "missing", agentStateFile), testAgent().Logger)
+}
+
+func TestAgentState(t *testing.T) {
+	s := testAgentState(t)
+
+	var n int
+	if found, err := s.Get("count", &n); err != nil || found {
+		t.Fatalf("Get() on an empty store = %v, %v, want false, nil", found, err)
+	}
+	if err := s.Delete("count"); err != nil {
+		t.Fatalf("Delete() of a missing key: %v", err)
+	}
+
+	tests := []struct {
+		key   string
+		value int
+	}{
+		{"count", 1},
+		{"other", 2},
+		{"count", 3},
+	}
+	for _, tt := range tests {
+		if err := s.Set(tt.key, tt.value); err != nil {
+			t.Fatalf("Set(%q): %v", tt.key, err)
+		}
+		if found, err := s.Get(tt.key, &n); err != nil || !found || n != tt.value {
+			t.Errorf("Get(%q) = %d, %v, %v, want %d", tt.key, n, found, err, tt.value)
+		}
+	}
+
+	// a second store on the same file, like the other service, sees the changes
+	other := newAgentState(s.path, s.logger)
+	if found, err := other.Get("other", &n); err != nil || !found || n != 2 {
+		t.Errorf("Get() from a second store = %d, %v, %v, want 2", n, found, err)
+	}
+	if err := other.Delete("other"); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := s.Get("other", &n); found {
+		t.Error("deleted key is still set")
+	}
+	if found, _ := s.Get("count", &n); !found || n != 3 {
+		t.Errorf("Delete() removed another key, count = %d, %v", n, found)
+	}
+
+	if err := s.Set("bad", func() {}); err == nil {
+		t.Error("Set() of a value json can't encode succeeded")
+	}
+}
+
+func TestAgentStateCorrupt(t *testing.T) {
+	s := testAgentState(t)
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.path, []byte(`{"count": 1`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if found, err := s.Get("count", &n); err != nil || found {
+		t.Fatalf("Get() on a corrupt file = %v, %v, want false, nil", found, err)
+	}
+	if b, err := os.ReadFile(s.path + ".corrupt"); err != nil || string(b) != `{"count": 1` {
+		t.Errorf("corrupt file wasn't moved aside: %q, %v", b, err)
+	}
+	if err := s.Set("count", 2); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := s.Get("count", &n); err != nil || !found || n != 2 {
+		t.Errorf("Get() after reset = %d, %v, %v, want 2", n, found, err)
+	}
+}
+
+func TestAgentStateImportFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		raw     bool
+		preset  bool
+		want    string
+		found   bool
+	}{
+		{"json", `{"at":1}`, false, false, `{"at":1}`, true},
+		{"raw", "abc123\n", true, false, `"abc123"`, true},
+		{"corrupt", `{"at":`, false, false, "", false},
+		{"store wins", `{"at":1}`, false, true, `"preset"`, true},
+	}
+	for _, tt := range tests {
+		s := testAgentState(t)
+		if tt.preset {
+			if err := s.Set("key", "preset"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		legacy := filepath.Join(t.TempDir(), "legacy")
+		if err := os.WriteFile(legacy, []byte(tt.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.importFile("key", legacy, tt.raw); err != nil {
+			t.Errorf("%s: importFile(): %v", tt.name, err)
+			continue
+		}
+		if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+			t.Errorf("%s: legacy file wasn't removed", tt.name)
+		}
+		var raw json.RawMessage
+		found, err := s.Get("key", &raw)
+		var got bytes.Buffer
+		json.Compact(&got, raw)
+		if err != nil || found != tt.found || got.String() != tt.want {
+			t.Errorf("%s: Get() = %s, %v, %v, want %s, %v", tt.name, got.String(), found, err, tt.want, tt.found)
+		}
+	}
+
+	// nothing to import isn't an error
+	if err := testAgentState(t).importFile("key", filepath.Join(t.TempDir(), "none"), false); err != nil {
+		t.Errorf("importFile() of a missing file: %v", err)
+	}
+}
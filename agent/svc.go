@@ -12,11 +12,8 @@ https://license.tacticalrmm.com
 package agent
 
 import (
-	"fmt"
 	"sync"
 	"time"
-
-	nats "github.com/nats-io/nats.go"
 )
 
 func (a *Agent) RunAsService() {
@@ -37,19 +34,24 @@ func (a *Agent) AgentSvc() {
 	a.Logger.Debugf("AgentSvc() sleeping for %v seconds", sleepDelay)
 	time.Sleep(time.Duration(sleepDelay) * time.Second)
 
-	opts := a.setupNatsOptions()
-	server := fmt.Sprintf("tls://%s:4222", a.ApiURL)
-	nc, err := nats.Connect(server, opts...)
-	if err != nil {
+	sess := a.newNatsSession("", nil)
+	if err := sess.Connect(); err != nil {
 		a.Logger.Fatalln("AgentSvc() nats.Connect()", err)
 	}
 
-	for _, s := range natsCheckin {
-		a.NatsMessage(nc, s)
+	for _, s := range a.checkinModes() {
+		a.NatsMessage(sess.Conn(), s)
 		time.Sleep(time.Duration(randRange(100, 400)) * time.Millisecond)
 	}
 
 	go a.SyncMeshNodeID()
+	if err := a.RefreshToggles(); err != nil {
+		a.Logger.Debugln("RefreshToggles():", err)
+	}
+
+	if a.NetChangeCheckin {
+		go a.NetChangeWatcher(sess)
+	}
 
 	time.Sleep(time.Duration(randRange(1, 3)) * time.Second)
 	a.AgentStartup()
@@ -63,32 +65,37 @@ func (a *Agent) AgentSvc() {
 	checkInSWTicker := time.NewTicker(time.Duration(randRange(2800, 3500)) * time.Second)
 	checkInWMITicker := time.NewTicker(time.Duration(randRange(3000, 4000)) * time.Second)
 	syncMeshTicker := time.NewTicker(time.Duration(randRange(800, 1200)) * time.Second)
+	togglesTicker := time.NewTicker(time.Duration(randRange(600, 900)) * time.Second)
 
 	for {
 		select {
 		case <-checkInHelloTicker.C:
-			a.NatsMessage(nc, "agent-hello")
+			a.NatsMessage(sess.Conn(), "agent-hello")
 		case <-checkInAgentInfoTicker.C:
-			a.NatsMessage(nc, "agent-agentinfo")
+			a.NatsMessage(sess.Conn(), "agent-agentinfo")
 		case <-checkInWinSvcTicker.C:
-			a.NatsMessage(nc, "agent-winsvc")
+			a.NatsMessage(sess.Conn(), "agent-winsvc")
 		case <-checkInPubIPTicker.C:
-			a.NatsMessage(nc, "agent-publicip")
+			a.NatsMessage(sess.Conn(), "agent-publicip")
 		case <-checkInDisksTicker.C:
-			a.NatsMessage(nc, "agent-disks")
+			a.NatsMessage(sess.Conn(), "agent-disks")
 		case <-checkInSWTicker.C:
 			a.SendSoftware()
 		case <-checkInWMITicker.C:
-			a.NatsMessage(nc, "agent-wmi")
+			a.NatsMessage(sess.Conn(), "agent-wmi")
 		case <-syncMeshTicker.C:
 			a.SyncMeshNodeID()
+		case <-togglesTicker.C:
+			if err := a.RefreshToggles(); err != nil {
+				a.Logger.Debugln("RefreshToggles():", err)
+			}
 		}
 	}
 }
 
 func (a *Agent) AgentStartup() {
 	url := "/api/v3/checkin/"
-	payload := map[string]interface{}{"agent_id": a.AgentID}
+	payload := map[string]interface{}{"agent_id": a.agentID()}
 	_, err := a.rClient.R().SetBody(payload).Post(url)
 	if err != nil {
 		a.Logger.Debugln("AgentStartup()", err)
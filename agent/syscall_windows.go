@@ -24,11 +24,31 @@ var _ unsafe.Pointer
 var (
 	modadvapi32 = windows.NewLazySystemDLL("advapi32.dll")
 	modkernel32 = windows.NewLazySystemDLL("kernel32.dll")
+	modiphlpapi = windows.NewLazySystemDLL("iphlpapi.dll")
+	moduser32   = windows.NewLazySystemDLL("user32.dll")
+	modmpr      = windows.NewLazySystemDLL("mpr.dll")
+	modwtsapi32 = windows.NewLazySystemDLL("wtsapi32.dll")
+	modrstrtmgr = windows.NewLazySystemDLL("rstrtmgr.dll")
 
 	procFormatMessageW          = modkernel32.NewProc("FormatMessageW")
+	procGetFirmwareEnvVarW      = modkernel32.NewProc("GetFirmwareEnvironmentVariableW")
+	procGetFirmwareType         = modkernel32.NewProc("GetFirmwareType")
+	procGetSystemPowerStatus    = modkernel32.NewProc("GetSystemPowerStatus")
 	procGetOldestEventLogRecord = modadvapi32.NewProc("GetOldestEventLogRecord")
 	procLoadLibraryExW          = modkernel32.NewProc("LoadLibraryExW")
+	procNotifyAddrChange        = modiphlpapi.NewProc("NotifyAddrChange")
+	procGetExtendedTcpTable     = modiphlpapi.NewProc("GetExtendedTcpTable")
+	procGetPerTcpConnEStats     = modiphlpapi.NewProc("GetPerTcpConnectionEStats")
+	procSetPerTcpConnEStats     = modiphlpapi.NewProc("SetPerTcpConnectionEStats")
 	procReadEventLogW           = modadvapi32.NewProc("ReadEventLogW")
+	procSendMessageTimeoutW     = moduser32.NewProc("SendMessageTimeoutW")
+	procWNetGetConnectionW      = modmpr.NewProc("WNetGetConnectionW")
+	procWTSLogoffSession        = modwtsapi32.NewProc("WTSLogoffSession")
+	procWTSQuerySessionInfoW    = modwtsapi32.NewProc("WTSQuerySessionInformationW")
+	procRmStartSession          = modrstrtmgr.NewProc("RmStartSession")
+	procRmRegisterResources     = modrstrtmgr.NewProc("RmRegisterResources")
+	procRmGetList               = modrstrtmgr.NewProc("RmGetList")
+	procRmEndSession            = modrstrtmgr.NewProc("RmEndSession")
 )
 
 // https://docs.microsoft.com/en-us/windows/win32/api/winnt/ns-winnt-eventlogrecord
@@ -114,3 +134,183 @@ func ReadEventLog(eventLog w32.HANDLE, readFlags ReadFlag, recordOffset uint32,
 	}
 	return
 }
+
+// NotifyAddrChange blocks until the ipv4 address table changes
+// https://docs.microsoft.com/en-us/windows/win32/api/iphlpapi/nf-iphlpapi-notifyaddrchange
+func NotifyAddrChange() (err error) {
+	r1, _, _ := syscall.Syscall(procNotifyAddrChange.Addr(), 2, 0, 0, 0)
+	if r1 != 0 {
+		err = syscall.Errno(r1)
+	}
+	return
+}
+
+const (
+	TCP_TABLE_OWNER_PID_CONNECTIONS = 4
+	TcpConnectionEstatsData         = 1
+)
+
+// https://docs.microsoft.com/en-us/windows/win32/api/tcpmib/ns-tcpmib-mib_tcprow_owner_pid
+// the first five fields are a MIB_TCPROW, which is all the estats functions read
+type MIB_TCPROW_OWNER_PID struct {
+	State      uint32
+	LocalAddr  uint32
+	LocalPort  uint32
+	RemoteAddr uint32
+	RemotePort uint32
+	OwningPid  uint32
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/tcpestats/ns-tcpestats-tcp_estats_data_rod_v0
+// padded by hand so the layout matches on 386, where go only aligns uint64 to 4 bytes
+type TCP_ESTATS_DATA_ROD_v0 struct {
+	DataBytesOut      uint64
+	DataSegsOut       uint64
+	DataBytesIn       uint64
+	DataSegsIn        uint64
+	SegsOut           uint64
+	SegsIn            uint64
+	SoftErrors        uint32
+	SoftErrorReason   uint32
+	SndUna            uint32
+	SndNxt            uint32
+	SndMax            uint32
+	_                 uint32
+	ThruBytesAcked    uint64
+	RcvNxt            uint32
+	_                 uint32
+	ThruBytesReceived uint64
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/iphlpapi/nf-iphlpapi-getextendedtcptable
+func GetExtendedTcpTable(table *byte, size *uint32, order bool, af uint32, class uint32) (err error) {
+	var o uintptr
+	if order {
+		o = 1
+	}
+	r1, _, _ := syscall.Syscall6(procGetExtendedTcpTable.Addr(), 6, uintptr(unsafe.Pointer(table)), uintptr(unsafe.Pointer(size)), o, uintptr(af), uintptr(class), 0)
+	if r1 != 0 {
+		err = syscall.Errno(r1)
+	}
+	return
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/iphlpapi/nf-iphlpapi-setpertcpconnectionestats
+func SetPerTcpConnectionEStats(row *MIB_TCPROW_OWNER_PID, estatsType uint32, rw *byte, rwVersion, rwSize, offset uint32) (err error) {
+	r1, _, _ := syscall.Syscall6(procSetPerTcpConnEStats.Addr(), 6, uintptr(unsafe.Pointer(row)), uintptr(estatsType), uintptr(unsafe.Pointer(rw)), uintptr(rwVersion), uintptr(rwSize), uintptr(offset))
+	if r1 != 0 {
+		err = syscall.Errno(r1)
+	}
+	return
+}
+
+// GetPerTcpConnectionEStats only reads the rod (dynamic) struct, the rw and ros arguments are left empty
+// https://docs.microsoft.com/en-us/windows/win32/api/iphlpapi/nf-iphlpapi-getpertcpconnectionestats
+func GetPerTcpConnectionEStats(row *MIB_TCPROW_OWNER_PID, estatsType uint32, rod *byte, rodVersion, rodSize uint32) (err error) {
+	r1, _, _ := syscall.Syscall12(procGetPerTcpConnEStats.Addr(), 11, uintptr(unsafe.Pointer(row)), uintptr(estatsType), 0, 0, 0, 0, 0, 0, uintptr(unsafe.Pointer(rod)), uintptr(rodVersion), uintptr(rodSize), 0)
+	if r1 != 0 {
+		err = syscall.Errno(r1)
+	}
+	return
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/nf-wtsapi32-wtslogoffsession
+func WTSLogoffSession(server windows.Handle, sessionID uint32, wait bool) (err error) {
+	var w uintptr
+	if wait {
+		w = 1
+	}
+	r1, _, e1 := syscall.Syscall(procWTSLogoffSession.Addr(), 3, uintptr(server), uintptr(sessionID), w)
+	if r1 == 0 {
+		err = e1
+	}
+	return
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/nf-wtsapi32-wtsquerysessioninformationw
+func WTSQuerySessionInformation(server windows.Handle, sessionID uint32, infoClass uint32, buffer **byte, bytesReturned *uint32) (err error) {
+	r1, _, e1 := syscall.Syscall6(procWTSQuerySessionInfoW.Addr(), 5, uintptr(server), uintptr(sessionID), uintptr(infoClass), uintptr(unsafe.Pointer(buffer)), uintptr(unsafe.Pointer(bytesReturned)), 0)
+	if r1 == 0 {
+		err = e1
+	}
+	return
+}
+
+const (
+	CCH_RM_SESSION_KEY  = 32
+	CCH_RM_MAX_APP_NAME = 255
+	CCH_RM_MAX_SVC_NAME = 63
+)
+
+// https://docs.microsoft.com/en-us/windows/win32/api/restartmanager/ns-restartmanager-rm_unique_process
+type RM_UNIQUE_PROCESS struct {
+	ProcessId        uint32
+	ProcessStartTime windows.Filetime
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/restartmanager/ns-restartmanager-rm_process_info
+type RM_PROCESS_INFO struct {
+	Process          RM_UNIQUE_PROCESS
+	AppName          [CCH_RM_MAX_APP_NAME + 1]uint16
+	ServiceShortName [CCH_RM_MAX_SVC_NAME + 1]uint16
+	ApplicationType  uint32
+	AppStatus        uint32
+	TSSessionId      uint32
+	Restartable      int32
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/restartmanager/nf-restartmanager-rmstartsession
+func RmStartSession(session *uint32, flags uint32, sessionKey *uint16) (err error) {
+	r1, _, _ := syscall.Syscall(procRmStartSession.Addr(), 3, uintptr(unsafe.Pointer(session)), uintptr(flags), uintptr(unsafe.Pointer(sessionKey)))
+	if r1 != 0 {
+		err = syscall.Errno(r1)
+	}
+	return
+}
+
+// RmRegisterResources registers files only, no applications or services
+// https://docs.microsoft.com/en-us/windows/win32/api/restartmanager/nf-restartmanager-rmregisterresources
+func RmRegisterResources(session uint32, nFiles uint32, fileNames **uint16) (err error) {
+	r1, _, _ := syscall.Syscall9(procRmRegisterResources.Addr(), 7, uintptr(session), uintptr(nFiles), uintptr(unsafe.Pointer(fileNames)), 0, 0, 0, 0, 0, 0)
+	if r1 != 0 {
+		err = syscall.Errno(r1)
+	}
+	return
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/restartmanager/nf-restartmanager-rmgetlist
+func RmGetList(session uint32, needed *uint32, n *uint32, info *RM_PROCESS_INFO, rebootReasons *uint32) (err error) {
+	r1, _, _ := syscall.Syscall6(procRmGetList.Addr(), 5, uintptr(session), uintptr(unsafe.Pointer(needed)), uintptr(unsafe.Pointer(n)), uintptr(unsafe.Pointer(info)), uintptr(unsafe.Pointer(rebootReasons)), 0)
+	if r1 != 0 {
+		err = syscall.Errno(r1)
+	}
+	return
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/restartmanager/nf-restartmanager-rmendsession
+func RmEndSession(session uint32) (err error) {
+	r1, _, _ := syscall.Syscall(procRmEndSession.Addr(), 1, uintptr(session), 0, 0)
+	if r1 != 0 {
+		err = syscall.Errno(r1)
+	}
+	return
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-getfirmwaretype
+func GetFirmwareType(firmwareType *uint32) (err error) {
+	r1, _, e1 := syscall.Syscall(procGetFirmwareType.Addr(), 1, uintptr(unsafe.Pointer(firmwareType)), 0, 0)
+	if r1 == 0 {
+		err = e1
+	}
+	return
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-getfirmwareenvironmentvariablew
+func GetFirmwareEnvironmentVariable(name, guid string, buffer unsafe.Pointer, size uint32) (n uint32, err error) {
+	r1, _, e1 := syscall.Syscall6(procGetFirmwareEnvVarW.Addr(), 4, uintptr(unsafe.Pointer(windows.StringToUTF16Ptr(name))), uintptr(unsafe.Pointer(windows.StringToUTF16Ptr(guid))), uintptr(buffer), uintptr(size), 0, 0)
+	n = uint32(r1)
+	if n == 0 {
+		err = e1
+	}
+	return
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"os"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+const dmiDir = "/sys/class/dmi/id"
+
+func readDMI(name string) string {
+	return readSysfs(dmiDir, name)
+}
+
+// GetSystemInfo returns hardware identifiers from dmi
+// Placeholder values like "To Be Filled By O.E.M." are returned as-is
+func (a *Agent) GetSystemInfo() (rmm.SystemInfo, error) {
+	if _, err := os.Stat(dmiDir); err != nil {
+		return rmm.SystemInfo{}, errors.New("dmi information is not available on this system")
+	}
+
+	// product_serial and product_uuid are only readable by root
+	return rmm.SystemInfo{
+		Manufacturer: readDMI("sys_vendor"),
+		Model:        readDMI("product_name"),
+		SerialNumber: readDMI("product_serial"),
+		UUID:         readDMI("product_uuid"),
+		BIOSVendor:   readDMI("bios_vendor"),
+		BIOSVersion:  readDMI("bios_version"),
+		BIOSDate:     readDMI("bios_date"),
+	}, nil
+}
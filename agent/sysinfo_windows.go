@@ -0,0 +1,60 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"github.com/StackExchange/wmi"
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetSystemInfo returns hardware identifiers from Win32_ComputerSystemProduct and Win32_BIOS
+// Placeholder values like "To Be Filled By O.E.M." are returned as-is
+func (a *Agent) GetSystemInfo() (rmm.SystemInfo, error) {
+	var ret rmm.SystemInfo
+
+	var product []struct {
+		Vendor            string
+		Name              string
+		IdentifyingNumber string
+		UUID              string
+	}
+	if err := wmi.Query("SELECT Vendor, Name, IdentifyingNumber, UUID FROM Win32_ComputerSystemProduct", &product); err != nil {
+		return ret, err
+	}
+	if len(product) > 0 {
+		ret.Manufacturer = product[0].Vendor
+		ret.Model = product[0].Name
+		ret.SerialNumber = product[0].IdentifyingNumber
+		ret.UUID = product[0].UUID
+	}
+
+	var bios []struct {
+		Manufacturer      string
+		SMBIOSBIOSVersion string
+		SerialNumber      string
+		ReleaseDate       string
+	}
+	if err := wmi.Query("SELECT Manufacturer, SMBIOSBIOSVersion, SerialNumber, ReleaseDate FROM Win32_BIOS", &bios); err != nil {
+		a.Logger.Debugln("GetSystemInfo() Win32_BIOS:", err)
+		return ret, nil
+	}
+	if len(bios) > 0 {
+		ret.BIOSVendor = bios[0].Manufacturer
+		ret.BIOSVersion = bios[0].SMBIOSBIOSVersion
+		ret.BIOSDate = bios[0].ReleaseDate
+		// some vendors leave the product serial blank and only fill in the bios one
+		if ret.SerialNumber == "" {
+			ret.SerialNumber = bios[0].SerialNumber
+		}
+	}
+	return ret, nil
+}
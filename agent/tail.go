@@ -0,0 +1,171 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	tailPollInterval = 500 * time.Millisecond
+	tailBlockSize    = 64 * 1024
+	// give up on a single line that never ends rather than buffering forever
+	tailMaxLine = 1024 * 1024
+	// most lines a tail can ask for, the whole tail is held in memory
+	tailMaxLines = 10000
+)
+
+// TailFile sends the last n lines of path to out and, if follow is set, keeps sending new lines until ctx is cancelled
+// Rotation is handled by reopening the path when the file is truncated or replaced
+// out is closed when TailFile returns
+func (a *Agent) TailFile(path string, lines int, follow bool, ctx context.Context, out chan<- string) error {
+	defer close(out)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+
+	last, offset, err := lastLines(f, lines)
+	if err != nil {
+		return err
+	}
+	for _, l := range last {
+		select {
+		case out <- l:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	if !follow {
+		return nil
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	var partial []byte
+	buf := make([]byte, tailBlockSize)
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, rerr := f.Read(buf)
+			if n > 0 {
+				offset += int64(n)
+				partial = append(partial, buf[:n]...)
+				for {
+					i := bytes.IndexByte(partial, '\n')
+					if i < 0 {
+						break
+					}
+					line := strings.TrimRight(string(partial[:i]), "\r")
+					partial = partial[i+1:]
+					select {
+					case out <- line:
+					case <-ctx.Done():
+						return nil
+					}
+				}
+				if len(partial) > tailMaxLine {
+					partial = partial[:0]
+				}
+			}
+			if rerr == io.EOF {
+				break
+			}
+			if rerr != nil {
+				return rerr
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		cur, err := os.Stat(path)
+		if err != nil {
+			// mid-rotation, the new file isn't there yet
+			continue
+		}
+		if !os.SameFile(fi, cur) || cur.Size() < offset {
+			a.Logger.Debugln("TailFile(): reopening", path)
+			nf, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			f.Close()
+			f, fi, offset, partial = nf, cur, 0, partial[:0]
+		}
+	}
+}
+
+// lastLines returns up to n complete lines from the end of f and the offset just past them
+func lastLines(f *os.File, n int) ([]string, int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	size := fi.Size()
+	if n <= 0 {
+		return []string{}, size, nil
+	}
+
+	// read backwards a block at a time until we have enough newlines
+	var data []byte
+	pos := size
+	for pos > 0 && bytes.Count(data, []byte{'\n'}) <= n {
+		step := int64(tailBlockSize)
+		if pos < step {
+			step = pos
+		}
+		pos -= step
+		chunk := make([]byte, step)
+		if _, err := f.ReadAt(chunk, pos); err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		data = append(chunk, data...)
+	}
+
+	ret := make([]string, 0, n)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, tailBlockSize), tailMaxLine)
+	for sc.Scan() {
+		ret = append(ret, strings.TrimRight(sc.Text(), "\r"))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, 0, err
+	}
+	// the first line is likely cut off unless we read from the start of the file
+	if pos > 0 && len(ret) > 0 {
+		ret = ret[1:]
+	}
+	if len(ret) > n {
+		ret = ret[len(ret)-n:]
+	}
+	return ret, size, nil
+}
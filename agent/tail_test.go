@@ -0,0 +1,67 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLastLines(t *testing.T) {
+	// enough lines that reading back has to go more than one block and cut the first line it sees
+	var long strings.Builder
+	for i := 1; i <= 20000; i++ {
+		fmt.Fprintf(&long, "line %d\n", i)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		n       int
+		want    []string
+	}{
+		{"empty file", "", 5, []string{}},
+		{"zero lines", "a\nb\n", 0, []string{}},
+		{"fewer than asked", "a\nb\n", 5, []string{"a", "b"}},
+		{"last two", "a\nb\nc\n", 2, []string{"b", "c"}},
+		{"no trailing newline", "a\nb\nc", 2, []string{"b", "c"}},
+		{"crlf", "a\r\nb\r\nc\r\n", 2, []string{"b", "c"}},
+		{"blank lines count", "a\n\nb\n", 2, []string{"", "b"}},
+		{"across blocks", long.String(), 3, []string{"line 19998", "line 19999", "line 20000"}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "log")
+		if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, offset, err := lastLines(f, tt.n)
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: lastLines() error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: lastLines() = %q, want %q", tt.name, got, tt.want)
+		}
+		if offset != int64(len(tt.content)) {
+			t.Errorf("%s: lastLines() offset = %d, want %d", tt.name, offset, len(tt.content))
+		}
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// runs returned by GetTaskRunHistory
+const taskHistoryMax = 20
+
+// systemd's messages about a unit's main process, e.g. Main process exited, code=exited, status=1/FAILURE
+var unitExitRe = regexp.MustCompile(`Main process exited, code=\w+, status=(\d+)/?(\S*)`)
+
+// GetTaskRunHistory returns the latest runs of a systemd timer or service, or a cron job, newest first
+// name is a unit (a timer is looked up through the service it starts) or, if there's no such unit,
+// text to match against the commands cron ran. Cron doesn't log exit codes so those runs have no result
+func (a *Agent) GetTaskRunHistory(name string) ([]rmm.TaskRun, error) {
+	if name == "" {
+		return []rmm.TaskRun{}, errors.New("task name is empty")
+	}
+
+	unit := strings.TrimSuffix(name, ".timer")
+	if !strings.Contains(unit, ".") {
+		unit += ".service"
+	}
+	if hasBinary("systemctl") {
+		state, err := runTool(10*time.Second, "systemctl", "show", "-p", "LoadState", "--value", unit)
+		if err == nil && strings.TrimSpace(state) == "loaded" {
+			return a.unitRuns(unit)
+		}
+	}
+	return a.cronRuns(name)
+}
+
+// unitRuns follows systemd's messages about the unit, one run ends in success or a failure
+func (a *Agent) unitRuns(unit string) ([]rmm.TaskRun, error) {
+	ret := make([]rmm.TaskRun, 0)
+	entries, err := a.GetJournalLog(unit, -1, time.Time{}, 2000)
+	if err != nil {
+		return ret, err
+	}
+
+	code := int64(0)
+	status := ""
+	// set once a run's result is recorded, systemd logs more than one line as a unit stops
+	done := false
+	// entries are newest first
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Identifier != "systemd" {
+			continue
+		}
+		msg := e.Message
+		switch {
+		// Started is logged when a oneshot finishes on older systemd, or as soon as a simple service starts, so it's no use
+		case strings.HasPrefix(msg, "Starting "):
+			code, status, done = 0, "", false
+		case unitExitRe.MatchString(msg):
+			m := unitExitRe.FindStringSubmatch(msg)
+			code, _ = strconv.ParseInt(m[1], 10, 64)
+			status = m[2]
+		case strings.Contains(msg, "Failed with result"):
+			if !done {
+				result := strings.TrimSuffix(msg[strings.Index(msg, "Failed with result"):], ".")
+				if status != "" {
+					result += ", status " + status
+				}
+				ret = append(ret, rmm.TaskRun{Time: e.Time, ResultCode: code, Result: result, Source: "journal"})
+				done = true
+			}
+		case strings.HasPrefix(msg, "Succeeded") || strings.HasPrefix(msg, "Deactivated successfully") || strings.HasPrefix(msg, "Finished "):
+			if !done {
+				ret = append(ret, rmm.TaskRun{Time: e.Time, Result: "Succeeded", Success: true, Source: "journal"})
+				done = true
+			}
+		}
+	}
+	return newestRuns(ret), nil
+}
+
+// cronRuns finds cron's CMD lines for commands containing name, in the journal or the syslog files
+func (a *Agent) cronRuns(name string) ([]rmm.TaskRun, error) {
+	ret := make([]rmm.TaskRun, 0)
+	matches := func(msg string) bool {
+		return strings.Contains(msg, "CMD (") && strings.Contains(msg, name)
+	}
+
+	if _, ok := journalAvailable(); ok {
+		for _, unit := range []string{"cron.service", "crond.service"} {
+			entries, err := a.GetJournalLog(unit, -1, time.Time{}, 5000)
+			if err != nil {
+				continue
+			}
+			for i := len(entries) - 1; i >= 0; i-- {
+				if matches(entries[i].Message) {
+					ret = append(ret, rmm.TaskRun{Time: entries[i].Time, ResultCode: -1, Result: entries[i].Message, Source: "cron"})
+				}
+			}
+		}
+		if len(ret) > 0 {
+			return newestRuns(ret), nil
+		}
+	}
+
+	// Jun  1 10:15:01 host CRON[1234]: (root) CMD (/usr/local/bin/backup.sh)
+	for _, path := range []string{"/var/log/cron", "/var/log/syslog", "/var/log/messages"} {
+		b, err := readFileTail(path, 4*1024*1024)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if !matches(line) || len(line) < 16 {
+				continue
+			}
+			ret = append(ret, rmm.TaskRun{Time: line[:15], ResultCode: -1, Result: strings.TrimSpace(line[16:]), Source: "cron"})
+		}
+	}
+	return newestRuns(ret), nil
+}
+
+// newestRuns reverses runs collected oldest first and keeps the latest taskHistoryMax
+func newestRuns(runs []rmm.TaskRun) []rmm.TaskRun {
+	if len(runs) > taskHistoryMax {
+		runs = runs[len(runs)-taskHistoryMax:]
+	}
+	ret := make([]rmm.TaskRun, 0, len(runs))
+	for i := len(runs) - 1; i >= 0; i-- {
+		ret = append(ret, runs[i])
+	}
+	return ret
+}
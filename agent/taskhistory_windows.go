@@ -0,0 +1,156 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	"github.com/amidaware/taskmaster"
+)
+
+// runs returned by GetTaskRunHistory
+const taskHistoryMax = 20
+
+// task scheduler errors FormatMessage has no text for, or only an unhelpful one
+var taskResultText = map[uint32]string{
+	0x8004130F: "No account information could be found in the task scheduler security database",
+	0x8004131F: "An instance of this task is already running",
+	0x80041323: "The task scheduler service is too busy to handle the request",
+	0x80041326: "The task is disabled",
+	0x800710E0: "The operator or administrator has refused the request",
+	0xC000013A: "The task was stopped or terminated by Ctrl+C",
+	0xC0000142: "The program failed to initialize, usually a desktop heap or session problem",
+}
+
+type taskEvent struct {
+	System struct {
+		EventID     int `xml:"EventID"`
+		TimeCreated struct {
+			SystemTime string `xml:"SystemTime,attr"`
+		} `xml:"TimeCreated"`
+	} `xml:"System"`
+	Data []struct {
+		Name  string `xml:"Name,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"EventData>Data"`
+}
+
+func (e taskEvent) data(name string) string {
+	for _, d := range e.Data {
+		if d.Name == name {
+			return d.Value
+		}
+	}
+	return ""
+}
+
+// GetTaskRunHistory returns the latest runs of a scheduled task, newest first
+// Runs come from the task scheduler operational log, which is off by default, so without it only the last run is reported
+func (a *Agent) GetTaskRunHistory(name string) ([]rmm.TaskRun, error) {
+	ret := make([]rmm.TaskRun, 0)
+	if name == "" {
+		return ret, errors.New("task name is empty")
+	}
+	path := name
+	if !strings.HasPrefix(path, `\`) {
+		path = `\` + path
+	}
+
+	conn, err := taskmaster.Connect()
+	if err != nil {
+		return ret, err
+	}
+	defer conn.Disconnect()
+
+	task, err := conn.GetRegisteredTask(path)
+	if err != nil {
+		return ret, err
+	}
+	defer task.Release()
+
+	runs, err := taskEventRuns(path)
+	if err != nil {
+		a.Logger.Debugln("GetTaskRunHistory() event log:", err)
+	}
+	if len(runs) > 0 {
+		return runs, nil
+	}
+
+	if task.LastTaskResult == taskmaster.SCHED_S_TASK_HAS_NOT_RUN || task.LastRunTime.IsZero() {
+		return ret, nil
+	}
+	code := uint32(task.LastTaskResult)
+	ret = append(ret, rmm.TaskRun{
+		Time:       task.LastRunTime.Format("2006-01-02 15:04:05"),
+		ResultCode: int64(code),
+		Result:     describeTaskResult(code),
+		Success:    code == 0,
+		Source:     "scheduler",
+	})
+	return ret, nil
+}
+
+// taskEventRuns reads action completed (201) and launch failure (101, 103) events for the task
+func taskEventRuns(path string) ([]rmm.TaskRun, error) {
+	ret := make([]rmm.TaskRun, 0)
+	query := fmt.Sprintf("*[System[(EventID=201 or EventID=101 or EventID=103)]] and *[EventData[Data[@Name='TaskName']='%s']]", strings.ReplaceAll(path, "'", "&apos;"))
+	out, err := runTool(60*time.Second, "wevtutil", "qe", "Microsoft-Windows-TaskScheduler/Operational", "/q:"+query, "/rd:true", fmt.Sprintf("/c:%d", taskHistoryMax), "/f:xml")
+	if err != nil {
+		return ret, err
+	}
+
+	// the events aren't wrapped in a root element
+	var events struct {
+		Events []taskEvent `xml:"Event"`
+	}
+	if err := xml.Unmarshal([]byte("<Events>"+out+"</Events>"), &events); err != nil {
+		return ret, err
+	}
+
+	for _, e := range events.Events {
+		code64, _ := strconv.ParseUint(strings.TrimSpace(e.data("ResultCode")), 0, 32)
+		code := uint32(code64)
+		run := rmm.TaskRun{
+			ResultCode: int64(code),
+			Result:     describeTaskResult(code),
+			Success:    e.System.EventID == 201 && code == 0,
+			Source:     "eventlog",
+		}
+		if e.System.EventID != 201 {
+			run.Result = "Failed to start: " + run.Result
+		}
+		if t, err := time.Parse(time.RFC3339Nano, e.System.TimeCreated.SystemTime); err == nil {
+			run.Time = t.Local().Format("2006-01-02 15:04:05")
+		}
+		ret = append(ret, run)
+	}
+	return ret, nil
+}
+
+// describeTaskResult turns a last run result into text, program exit codes come through as HRESULT_FROM_WIN32
+func describeTaskResult(code uint32) string {
+	if s, ok := taskResultText[code]; ok {
+		return s
+	}
+	if code&0xFFFF0000 == 0x80070000 {
+		exit := code & 0xFFFF
+		return fmt.Sprintf("Exit code %d (%s)", exit, strings.TrimSpace(syscall.Errno(exit).Error()))
+	}
+	return strings.TrimSpace(taskmaster.TaskResult(code).String())
+}
@@ -25,8 +25,13 @@ import (
 )
 
 func (a *Agent) RunTask(id int) error {
+	if a.InMaintenance() {
+		a.Logger.Debugln("Run Task:", ErrMaintenanceMode)
+		return ErrMaintenanceMode
+	}
+
 	data := rmm.AutomatedTask{}
-	url := fmt.Sprintf("/api/v3/%d/%s/taskrunner/", id, a.AgentID)
+	url := fmt.Sprintf("/api/v3/%d/%s/taskrunner/", id, a.agentID())
 	r1, gerr := a.rClient.R().Get(url)
 	if gerr != nil {
 		a.Logger.Debugln(gerr)
@@ -45,21 +50,25 @@ func (a *Agent) RunTask(id int) error {
 
 	start := time.Now()
 
-	type TaskResult struct {
-		Stdout   string  `json:"stdout"`
-		Stderr   string  `json:"stderr"`
-		RetCode  int     `json:"retcode"`
-		ExecTime float64 `json:"execution_time"`
+	// the actions' output is collected here and posted as a ScriptResult
+	var payload struct {
+		Stdout  string
+		Stderr  string
+		RetCode int
 	}
-
-	payload := TaskResult{}
+	// what ran, for the result's command hash, and how long it ran for leaving out setup
+	var ran []string
+	var execTime time.Duration
 
 	// loop through all task actions
 	for _, action := range data.TaskActions {
 
 		action_start := time.Now()
 		if action.ActionType == "script" {
-			stdout, stderr, retcode, err := a.RunScript(action.Code, action.Shell, action.Args, action.Timeout)
+			so := ScriptOptions{Timing: &CmdTiming{}, Initiator: "task", Suppressible: true}
+			stdout, stderr, retcode, err := a.RunScriptWith(action.Code, action.Shell, action.Args, action.Timeout, so)
+			ran = append(ran, action.Code)
+			execTime += so.Timing.Exec
 
 			if err != nil {
 				a.Logger.Debugln(err)
@@ -83,7 +92,19 @@ func (a *Agent) RunTask(id int) error {
 
 		} else if action.ActionType == "cmd" {
 			// out[0] == stdout, out[1] == stderr
-			out, err := CMDShell(action.Shell, []string{}, action.Command, action.Timeout, false)
+			var out [2]string
+			var err error
+			// CMDShell doesn't go through CmdV2 so the policy is checked and the run audited here
+			c := &CmdOptions{Shell: action.Shell, Command: action.Command, Initiator: "task"}
+			if blocked, ok := a.checkPolicy(c); !ok {
+				a.auditCommand(c, blocked, action_start)
+				out[1] = blocked.Stderr
+			} else {
+				out, err = CMDShell(action.Shell, []string{}, action.Command, action.Timeout, false)
+				a.auditExec(c, 0, err, action_start)
+			}
+			ran = append(ran, action.Shell+" "+action.Command)
+			execTime += time.Since(action_start)
 
 			if err != nil {
 				a.Logger.Debugln(err)
@@ -115,12 +136,14 @@ func (a *Agent) RunTask(id int) error {
 		}
 	}
 
-	payload.ExecTime = time.Since(start).Seconds()
-
-	_, perr := a.rClient.R().SetBody(payload).Patch(url)
-	if perr != nil {
-		a.Logger.Debugln(perr)
-		return perr
+	result := a.newRunResult("task", strings.Join(ran, "\x00"), start)
+	result.Duration = execTime.Seconds()
+	result.Stdout = payload.Stdout
+	result.Stderr = payload.Stderr
+	result.Retcode = payload.RetCode
+	if err := a.reportResult(url, "", result); err != nil {
+		a.Logger.Debugln(err)
+		return err
 	}
 	return nil
 }
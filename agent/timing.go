@@ -0,0 +1,61 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// CmdTiming is where a command's time went, filled in when CmdOptions.Timing is set or one is passed to
+// RunScriptWith or RunPythonCodeTimed. CmdV2 only knows Start and Exec, the temp file is the caller's
+type CmdTiming struct {
+	// writing the temp file, up to asking for the process
+	Setup time.Duration
+	// from asking for the process until it's running
+	Start time.Duration
+	// the process running
+	Exec time.Duration
+	// removing the temp file after it exits
+	Cleanup time.Duration
+}
+
+func (t *CmdTiming) report() *rmm.ExecTiming {
+	if t == nil {
+		return nil
+	}
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	return &rmm.ExecTiming{
+		SetupMs:   ms(t.Setup),
+		StartMs:   ms(t.Start),
+		ExecMs:    ms(t.Exec),
+		CleanupMs: ms(t.Cleanup),
+	}
+}
+
+// timeCleanup runs f and records how long it took, for use in a defer
+func (t *CmdTiming) timeCleanup(f func()) {
+	start := time.Now()
+	f()
+	if t != nil {
+		t.Cleanup = time.Since(start)
+	}
+}
+
+func (a *Agent) RunScript(code string, shell string, args []string, timeout int) (stdout, stderr string, exitcode int, e error) {
+	return a.RunScriptWith(code, shell, args, timeout, ScriptOptions{})
+}
+
+func (a *Agent) RunPythonCode(code string, timeout int, args []string) (string, error) {
+	return a.RunPythonCodeTimed(code, timeout, args, nil)
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// AgentState key of the last toggles from the server, used until the next refresh so they survive restarts during an outage
+const togglesStateKey = "toggles"
+
+// featureToggles are on/off switches set per agent from the rmm, e.g. disable_publicip
+type featureToggles struct {
+	sync.RWMutex
+	m map[string]bool
+}
+
+// loadToggles reads the last known toggles, none are set if there aren't any saved
+func (a *Agent) loadToggles() *featureToggles {
+	t := &featureToggles{m: make(map[string]bool)}
+	if _, err := a.state.Get(togglesStateKey, &t.m); err != nil {
+		a.Logger.Debugln("loadToggles(): ignoring saved toggles:", err)
+		t.m = make(map[string]bool)
+	}
+	return t
+}
+
+// Toggle returns whether a feature toggle is on, unknown toggles are off. Names are case insensitive
+func (a *Agent) Toggle(name string) bool {
+	a.toggles.RLock()
+	defer a.toggles.RUnlock()
+	return a.toggles.m[strings.ToLower(name)]
+}
+
+// GetToggles returns a copy of the current toggles
+func (a *Agent) GetToggles() map[string]bool {
+	a.toggles.RLock()
+	defer a.toggles.RUnlock()
+	ret := make(map[string]bool, len(a.toggles.m))
+	for k, v := range a.toggles.m {
+		ret[k] = v
+	}
+	return ret
+}
+
+// SetToggles replaces the toggles and saves them
+func (a *Agent) SetToggles(toggles map[string]bool) error {
+	m := make(map[string]bool, len(toggles))
+	for k, v := range toggles {
+		m[strings.ToLower(k)] = v
+	}
+
+	a.toggles.Lock()
+	a.toggles.m = m
+	a.toggles.Unlock()
+
+	return a.state.Set(togglesStateKey, m)
+}
+
+// RefreshToggles fetches the toggles from the rmm, the current ones are kept if that fails
+func (a *Agent) RefreshToggles() error {
+	var toggles map[string]bool
+	r, err := a.rClient.R().SetResult(&toggles).Get(fmt.Sprintf("/api/v3/%s/toggles/", a.agentID()))
+	if err != nil {
+		return err
+	}
+	if r.IsError() {
+		return fmt.Errorf("toggles: %s", r.Status())
+	}
+	return a.SetToggles(toggles)
+}
+
+// checkinDisabled reports whether a checkin mode is turned off with a disable_<mode> toggle, e.g. disable_publicip
+// The hello checkin is the agent's heartbeat so it can't be turned off
+func (a *Agent) checkinDisabled(mode string) bool {
+	if mode == "agent-hello" {
+		return false
+	}
+	return a.Toggle("disable_" + strings.TrimPrefix(mode, "agent-"))
+}
@@ -0,0 +1,35 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import "testing"
+
+func TestToggleCase(t *testing.T) {
+	a := testAgent()
+	a.state = testAgentState(t)
+	a.toggles = a.loadToggles()
+	if err := a.SetToggles(map[string]bool{"Disable_PublicIP": true, "beta": false}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"disable_publicip", "DISABLE_PUBLICIP", "Disable_PublicIP"} {
+		if !a.Toggle(name) {
+			t.Errorf("Toggle(%q) is off", name)
+		}
+	}
+	if a.Toggle("Beta") || a.Toggle("unknown") {
+		t.Error("off or unknown toggle is on")
+	}
+	if !a.checkinDisabled("agent-publicip") {
+		t.Error("publicip checkin not disabled")
+	}
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	nats "github.com/nats-io/nats.go"
+)
+
+// how long a replaced nats connection is kept open so in-flight rpc replies can still be sent
+const natsDrainGrace = 10 * time.Minute
+
+// authState holds the token and signing key in use and the nats sessions that need to move over when the token changes
+type authState struct {
+	mu    sync.RWMutex
+	token string
+	// the server and agent id, changed by ReEnroll, so read them with the accessors rather than the Agent fields
+	baseURL string
+	apiURL  string
+	agentID string
+	// enrollment secret used to get a new token when the current one is rejected, see reauthenticate
+	secret string
+
+	reauthMu   sync.Mutex
+	lastReauth time.Time
+
+	// payload signing key, loaded on first use
+	keyMu sync.Mutex
+	key   ed25519.PrivateKey
+
+	rotateMu sync.Mutex
+	natsMu   sync.Mutex
+	sessions []*natsSession
+
+	// last nats disconnect error from any connection, set by the DisconnectErrHandler
+	natsErrMu     sync.Mutex
+	natsLastErr   string
+	natsLastErrAt time.Time
+}
+
+// natsSession is a nats connection that can be swapped out when the token is rotated
+type natsSession struct {
+	a       *Agent
+	subject string
+	handler nats.MsgHandler
+
+	mu  sync.RWMutex
+	nc  *nats.Conn
+	sub *nats.Subscription
+}
+
+// newNatsSession registers a session with the agent, handler is optional
+func (a *Agent) newNatsSession(subject string, handler nats.MsgHandler) *natsSession {
+	s := &natsSession{a: a, subject: subject, handler: handler}
+	a.auth.natsMu.Lock()
+	a.auth.sessions = append(a.auth.sessions, s)
+	a.auth.natsMu.Unlock()
+	return s
+}
+
+func (s *natsSession) Conn() *nats.Conn {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nc
+}
+
+func (s *natsSession) Connect() error {
+	nc, err := s.a.natsConnect(s.a.authToken())
+	if err != nil {
+		return err
+	}
+	var sub *nats.Subscription
+	if s.handler != nil {
+		sub, err = nc.Subscribe(s.subject, s.handler)
+		if err != nil {
+			nc.Close()
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.nc, s.sub = nc, sub
+	s.mu.Unlock()
+	return nil
+}
+
+// swap moves the session onto nc listening on subject, the old subscription is dropped before the new one is made
+// so a request is never handled twice
+func (s *natsSession) swap(nc *nats.Conn, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sub != nil {
+		if err := s.sub.Unsubscribe(); err != nil {
+			s.a.Logger.Debugln("natsSession swap() unsubscribe:", err)
+		}
+	}
+	var sub *nats.Subscription
+	if s.handler != nil {
+		var err error
+		sub, err = nc.Subscribe(subject, s.handler)
+		if err != nil {
+			// put the old subscription back so we keep serving requests
+			if s.nc != nil {
+				s.sub, _ = s.nc.Subscribe(s.subject, s.handler)
+			}
+			return err
+		}
+	}
+
+	old := s.nc
+	s.nc, s.sub, s.subject = nc, sub, subject
+	if old != nil {
+		time.AfterFunc(natsDrainGrace, func() {
+			old.Flush()
+			old.Close()
+		})
+	}
+	return nil
+}
+
+func (a *Agent) natsConnect(token string) (*nats.Conn, error) {
+	return a.natsDial(a.apiURL(), a.agentID(), token)
+}
+
+// natsDial connects to the nats server on apiURL as agentID, used directly when moving to another server
+func (a *Agent) natsDial(apiURL, agentID, token string) (*nats.Conn, error) {
+	server := fmt.Sprintf("tls://%s:4222", apiURL)
+	// options are applied in order so this replaces the user set by natsOptions
+	opts := append(a.natsOptions(token), nats.UserInfo(agentID, token))
+	return nats.Connect(server, opts...)
+}
+
+func (a *Agent) authToken() string {
+	a.auth.mu.RLock()
+	defer a.auth.mu.RUnlock()
+	return a.auth.token
+}
+
+func (a *Agent) agentID() string {
+	a.auth.mu.RLock()
+	defer a.auth.mu.RUnlock()
+	return a.auth.agentID
+}
+
+func (a *Agent) baseURL() string {
+	a.auth.mu.RLock()
+	defer a.auth.mu.RUnlock()
+	return a.auth.baseURL
+}
+
+func (a *Agent) apiURL() string {
+	a.auth.mu.RLock()
+	defer a.auth.mu.RUnlock()
+	return a.auth.apiURL
+}
+
+// setRequestURL is a resty middleware that makes relative request urls absolute with the current base url
+// rather than the client's, which can't be changed safely while other requests are using it
+func (a *Agent) setRequestURL(c *resty.Client, r *resty.Request) error {
+	if u, err := url.Parse(r.URL); err == nil && !u.IsAbs() {
+		if !strings.HasPrefix(r.URL, "/") {
+			r.URL = "/" + r.URL
+		}
+		r.URL = strings.TrimRight(a.baseURL(), "/") + r.URL
+	}
+	return nil
+}
+
+// setAuthHeader is a resty middleware that stamps each request with the current token
+// requests already in flight keep the header they were sent with
+func (a *Agent) setAuthHeader(c *resty.Client, r *resty.Request) error {
+	if token := a.authToken(); len(token) > 0 {
+		r.SetHeader("Authorization", fmt.Sprintf("Token %s", token))
+	}
+	return nil
+}
+
+// RotateToken switches the agent to a new auth token without a restart
+// New nats connections are verified with the new token before anything is changed,
+// then the token is saved to the config and api requests and nats sessions move over
+func (a *Agent) RotateToken(newToken string) error {
+	if len(newToken) == 0 {
+		return errors.New("token is empty")
+	}
+
+	a.auth.rotateMu.Lock()
+	defer a.auth.rotateMu.Unlock()
+
+	if newToken == a.authToken() {
+		return nil
+	}
+
+	a.auth.natsMu.Lock()
+	sessions := make([]*natsSession, len(a.auth.sessions))
+	copy(sessions, a.auth.sessions)
+	a.auth.natsMu.Unlock()
+
+	conns := make([]*nats.Conn, 0, len(sessions))
+	closeAll := func() {
+		for _, nc := range conns {
+			nc.Close()
+		}
+	}
+	for range sessions {
+		nc, err := a.natsConnect(newToken)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("RotateToken() nats.Connect(): %w", err)
+		}
+		conns = append(conns, nc)
+		if err := nc.FlushTimeout(15 * time.Second); err != nil {
+			closeAll()
+			return fmt.Errorf("RotateToken() new token rejected: %w", err)
+		}
+	}
+
+	if err := saveToken(newToken); err != nil {
+		closeAll()
+		return fmt.Errorf("RotateToken() saving token: %w", err)
+	}
+
+	a.auth.mu.Lock()
+	a.auth.token = newToken
+	a.auth.mu.Unlock()
+
+	var swapErr error
+	for i, s := range sessions {
+		if err := s.swap(conns[i], s.subject); err != nil {
+			a.Logger.Errorln("RotateToken() swap:", err)
+			conns[i].Close()
+			swapErr = err
+		}
+	}
+	if swapErr != nil {
+		return swapErr
+	}
+	a.clearAuthRequired()
+	a.Logger.Infoln("Agent token rotated")
+	return nil
+}
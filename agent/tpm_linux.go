@@ -0,0 +1,54 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetTPMInfo returns the state of tpm0 from sysfs, Present is false if there isn't one
+// A 2.0 tpm exposed to the kernel is always enabled and active, ownership isn't reported
+func (a *Agent) GetTPMInfo() (rmm.TPMInfo, error) {
+	dir := "/sys/class/tpm/tpm0"
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return rmm.TPMInfo{Present: false}, nil
+	}
+
+	ret := rmm.TPMInfo{Present: true}
+	dev := filepath.Join(dir, "device")
+	switch readSysfs(dir, "tpm_version_major") {
+	case "2":
+		ret.Version = "2.0"
+	case "1":
+		ret.Version = "1.2"
+	default:
+		// older kernels only have tpm_version_major for 2.0, and only 1.2 devices have these files
+		if readSysfs(dev, "enabled") != "" {
+			ret.Version = "1.2"
+		} else {
+			ret.Version = "2.0"
+		}
+	}
+
+	if ret.Version == "2.0" {
+		ret.Enabled = true
+		ret.Activated = true
+	} else {
+		ret.Enabled = readSysfs(dev, "enabled") == "1"
+		ret.Activated = readSysfs(dev, "active") == "1"
+		ret.Owned = readSysfs(dev, "owned") == "1"
+	}
+	return ret, nil
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"strings"
+
+	"github.com/StackExchange/wmi"
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetTPMInfo returns the state of the first tpm from Win32_Tpm, Present is false if there isn't one
+func (a *Agent) GetTPMInfo() (rmm.TPMInfo, error) {
+	var dst []struct {
+		IsEnabled_InitialValue   bool
+		IsActivated_InitialValue bool
+		IsOwned_InitialValue     bool
+		SpecVersion              string
+		ManufacturerIdTxt        string
+	}
+	q := "SELECT IsEnabled_InitialValue, IsActivated_InitialValue, IsOwned_InitialValue, SpecVersion, ManufacturerIdTxt FROM Win32_Tpm"
+	if err := wmi.QueryNamespace(q, &dst, `root\CIMV2\Security\MicrosoftTpm`); err != nil {
+		return rmm.TPMInfo{}, err
+	}
+	if len(dst) == 0 {
+		return rmm.TPMInfo{Present: false}, nil
+	}
+
+	t := dst[0]
+	// SpecVersion is like "2.0, 0, 1.38", the first field is the tpm version
+	version := strings.TrimSpace(strings.Split(t.SpecVersion, ",")[0])
+	return rmm.TPMInfo{
+		Present:      true,
+		Version:      version,
+		Manufacturer: strings.TrimSpace(t.ManufacturerIdTxt),
+		Enabled:      t.IsEnabled_InitialValue,
+		Activated:    t.IsActivated_InitialValue,
+		Owned:        t.IsOwned_InitialValue,
+	}, nil
+}
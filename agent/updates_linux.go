@@ -0,0 +1,234 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+const (
+	pkgCmdTimeout = 10 * time.Minute
+	// apt doesn't refresh its own lists so refresh them if they're older than this
+	aptStaleAfter = 24 * time.Hour
+)
+
+// runPkgCmd runs a package manager command with a C locale and returns stdout and the exit code
+func runPkgCmd(name string, args ...string) (string, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pkgCmdTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", -1, fmt.Errorf("%s timed out", name)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(out), exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return "", -1, err
+	}
+	return string(out), 0, nil
+}
+
+// GetLinuxUpdates lists available package upgrades using whichever package manager is installed
+func (a *Agent) GetLinuxUpdates() ([]rmm.PackageUpdate, error) {
+	switch {
+	case hasBinary("apt"):
+		return a.aptUpdates()
+	case hasBinary("dnf"):
+		return a.rpmUpdates("dnf")
+	case hasBinary("yum"):
+		return a.rpmUpdates("yum")
+	case hasBinary("zypper"):
+		return a.zypperUpdates()
+	}
+	return nil, ErrNoPackageManager
+}
+
+func hasBinary(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+func (a *Agent) aptUpdates() ([]rmm.PackageUpdate, error) {
+	if aptListsStale() {
+		a.Logger.Debugln("GetLinuxUpdates(): apt lists are stale, refreshing")
+		if _, code, err := runPkgCmd("apt-get", "update", "-qq"); err != nil || code != 0 {
+			a.Logger.Debugln("GetLinuxUpdates(): apt-get update failed", code, err)
+		}
+	}
+
+	out, code, err := runPkgCmd("apt", "list", "--upgradable")
+	if err != nil {
+		return nil, err
+	}
+	if code != 0 {
+		return nil, fmt.Errorf("apt list exited with %d", code)
+	}
+
+	// bash/jammy-updates,jammy-security 5.1-6ubuntu1.1 amd64 [upgradable from: 5.1-6ubuntu1]
+	ret := make([]rmm.PackageUpdate, 0)
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.Contains(line, "[upgradable from:") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		nameOrigin := strings.SplitN(fields[0], "/", 2)
+		origin := ""
+		if len(nameOrigin) == 2 {
+			origin = nameOrigin[1]
+		}
+		ret = append(ret, rmm.PackageUpdate{
+			Name:      nameOrigin[0],
+			Current:   strings.TrimSuffix(fields[len(fields)-1], "]"),
+			Candidate: fields[1],
+			Arch:      fields[2],
+			Source:    origin,
+			Security:  strings.Contains(origin, "-security"),
+		})
+	}
+	return ret, nil
+}
+
+func aptListsStale() bool {
+	for _, stamp := range []string{"/var/lib/apt/periodic/update-success-stamp", "/var/lib/apt/lists"} {
+		if fi, err := os.Stat(stamp); err == nil {
+			return time.Since(fi.ModTime()) > aptStaleAfter
+		}
+	}
+	return true
+}
+
+// rpmUpdates handles dnf and yum, which share check-update and updateinfo
+// metadata is refreshed by the tool itself once it expires
+func (a *Agent) rpmUpdates(bin string) ([]rmm.PackageUpdate, error) {
+	// exits 100 when there are updates, 0 when there aren't
+	out, code, err := runPkgCmd(bin, "-q", "check-update")
+	if err != nil {
+		return nil, err
+	}
+	if code != 0 && code != 100 {
+		return nil, fmt.Errorf("%s check-update exited with %d", bin, code)
+	}
+
+	installed := rpmInstalled()
+	security := rpmSecurityUpdates(bin)
+
+	ret := make([]rmm.PackageUpdate, 0)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		// anything after this is obsoleted packages, not upgrades
+		if len(fields) > 0 && strings.HasPrefix(fields[0], "Obsoleting") {
+			break
+		}
+		if len(fields) != 3 || !strings.Contains(fields[0], ".") {
+			continue
+		}
+		dot := strings.LastIndex(fields[0], ".")
+		name, arch := fields[0][:dot], fields[0][dot+1:]
+		ret = append(ret, rmm.PackageUpdate{
+			Name:      name,
+			Current:   installed[fields[0]],
+			Candidate: fields[1],
+			Arch:      arch,
+			Source:    fields[2],
+			Security:  security[name],
+		})
+	}
+	return ret, nil
+}
+
+func rpmInstalled() map[string]string {
+	ret := make(map[string]string)
+	out, _, err := runPkgCmd("rpm", "-qa", "--qf", "%{NAME}.%{ARCH} %{VERSION}-%{RELEASE}\n")
+	if err != nil {
+		return ret
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			ret[fields[0]] = fields[1]
+		}
+	}
+	return ret
+}
+
+// rpmSecurityUpdates returns the names of packages with a pending security advisory
+// not every repo publishes updateinfo, in which case nothing is flagged
+func rpmSecurityUpdates(bin string) map[string]bool {
+	ret := make(map[string]bool)
+	out, code, err := runPkgCmd(bin, "-q", "updateinfo", "list", "--security")
+	if err != nil || code != 0 {
+		return ret
+	}
+	// RHSA-2022:1234 Important/Sec. openssl-1:1.1.1k-6.el8_5.x86_64
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		ret[rpmNameFromNEVRA(fields[len(fields)-1])] = true
+	}
+	return ret
+}
+
+// rpmNameFromNEVRA strips version, release and arch from name-[epoch:]version-release.arch
+func rpmNameFromNEVRA(nevra string) string {
+	parts := strings.Split(nevra, "-")
+	if len(parts) < 3 {
+		return nevra
+	}
+	return strings.Join(parts[:len(parts)-2], "-")
+}
+
+// zypper only flags security fixes at the patch level, so packages aren't marked here
+func (a *Agent) zypperUpdates() ([]rmm.PackageUpdate, error) {
+	out, code, err := runPkgCmd("zypper", "--non-interactive", "-q", "list-updates")
+	if err != nil {
+		return nil, err
+	}
+	if code != 0 {
+		return nil, fmt.Errorf("zypper list-updates exited with %d", code)
+	}
+
+	// S | Repository | Name | Current Version | Available Version | Arch
+	ret := make([]rmm.PackageUpdate, 0)
+	for _, line := range strings.Split(out, "\n") {
+		cols := strings.Split(line, "|")
+		if len(cols) < 6 || strings.TrimSpace(cols[0]) != "v" {
+			continue
+		}
+		name := strings.TrimSpace(cols[2])
+		ret = append(ret, rmm.PackageUpdate{
+			Name:      name,
+			Current:   strings.TrimSpace(cols[3]),
+			Candidate: strings.TrimSpace(cols[4]),
+			Arch:      strings.TrimSpace(cols[5]),
+			Source:    strings.TrimSpace(cols[1]),
+		})
+	}
+	return ret, nil
+}
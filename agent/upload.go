@@ -0,0 +1,197 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	defaultUploadChunkSize = 4 * 1024 * 1024
+	uploadChunkRetries     = 5
+	uploadChunkTimeout     = 2 * time.Minute
+	// smallest chunk when the speed is capped, so a tiny cap doesn't turn into a request per few bytes
+	uploadMinPacedChunk = 64 * 1024
+)
+
+type uploadState struct {
+	Offset int64 `json:"offset"`
+}
+
+// UploadFileChunked uploads a file in chunks so it can be resumed after a failure
+// The server is first asked how much of the file it already has, then each chunk is sent with
+// its range and sha256, and finally the whole file's sha256 is sent to be verified.
+// maxBps caps the upload speed in bytes per second, 0 uses UploadMaxBps from the config
+func (a *Agent) UploadFileChunked(path, endpoint string, chunkSize, maxBps int) error {
+	if chunkSize <= 0 {
+		chunkSize = defaultUploadChunkSize
+	}
+	if maxBps <= 0 {
+		maxBps = a.UploadMaxBps
+	}
+	var limiter *rateLimiter
+	if maxBps > 0 {
+		limiter = newRateLimiter(maxBps)
+		// pacing is per chunk, so keep them to about a second's worth rather than long bursts and pauses
+		if chunkSize > maxBps {
+			chunkSize = maxBps
+			if chunkSize < uploadMinPacedChunk {
+				chunkSize = uploadMinPacedChunk
+			}
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+
+	fileHash := sha256.New()
+	if _, err := io.Copy(fileHash, f); err != nil {
+		return err
+	}
+	checksum := hex.EncodeToString(fileHash.Sum(nil))
+
+	client := a.newRestyClient(uploadChunkTimeout)
+	params := map[string]string{
+		"agent_id": a.agentID(),
+		"name":     filepath.Base(path),
+		"size":     strconv.FormatInt(size, 10),
+		"sha256":   checksum,
+	}
+
+	// ask the server where to resume from
+	r, err := client.R().SetQueryParams(params).SetResult(&uploadState{}).Get(endpoint)
+	if err != nil {
+		return err
+	}
+	if r.IsError() {
+		return fmt.Errorf("UploadFileChunked() resume status code: %d", r.StatusCode())
+	}
+	offset := r.Result().(*uploadState).Offset
+	if offset < 0 || offset > size {
+		offset = 0
+	}
+	a.Logger.Debugf("Uploading %s (%d bytes) from offset %d\n", path, size, offset)
+
+	buf := make([]byte, chunkSize)
+	for offset < size {
+		n, err := f.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		chunk := buf[:n]
+		sum := sha256.Sum256(chunk)
+
+		var next int64
+		for attempt := 1; ; attempt++ {
+			next, err = a.uploadChunk(client, endpoint, params, chunk, hex.EncodeToString(sum[:]), offset, size, limiter)
+			if err == nil {
+				break
+			}
+			if attempt >= uploadChunkRetries {
+				return fmt.Errorf("UploadFileChunked() chunk at offset %d: %w", offset, err)
+			}
+			a.Logger.Debugln("UploadFileChunked() retrying chunk:", err)
+			time.Sleep(time.Duration(attempt*attempt) * time.Second)
+		}
+
+		// the server tells us what it has, which may not be what we sent
+		if next <= offset {
+			return fmt.Errorf("UploadFileChunked() server did not accept chunk at offset %d", offset)
+		}
+		offset = next
+	}
+
+	body := map[string]interface{}{
+		"agent_id": a.agentID(),
+		"name":     params["name"],
+		"size":     size,
+		"sha256":   checksum,
+	}
+	r, err = client.R().SetBody(body).Post(endpoint)
+	if err != nil {
+		return err
+	}
+	if r.IsError() {
+		return fmt.Errorf("UploadFileChunked() checksum verification failed: %s", r.String())
+	}
+	return nil
+}
+
+func (a *Agent) uploadChunk(client *resty.Client, endpoint string, params map[string]string, chunk []byte, checksum string, offset, size int64, limiter *rateLimiter) (int64, error) {
+	end := offset + int64(len(chunk)) - 1
+	// the body stays a byte slice so it can be re-read for signing and retries, the limiter waits before each send instead
+	if limiter != nil {
+		limiter.wait(len(chunk))
+	}
+	r, err := client.R().
+		SetQueryParams(params).
+		SetHeader("Content-Type", "application/octet-stream").
+		SetHeader("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, end, size)).
+		SetHeader("X-Chunk-SHA256", checksum).
+		SetBody(chunk).
+		SetResult(&uploadState{}).
+		Put(endpoint)
+	if err != nil {
+		return 0, err
+	}
+	if r.IsError() {
+		return 0, fmt.Errorf("status code: %d", r.StatusCode())
+	}
+	return r.Result().(*uploadState).Offset, nil
+}
+
+// rateLimiter paces chunks to an average of bps bytes per second over the whole upload
+type rateLimiter struct {
+	bps   int
+	start time.Time
+	sent  int64
+}
+
+func newRateLimiter(bps int) *rateLimiter {
+	return &rateLimiter{bps: bps, start: time.Now()}
+}
+
+// wait records n bytes about to be sent and sleeps until they're within the limit
+func (l *rateLimiter) wait(n int) {
+	// idle time between chunks isn't saved up for a burst later
+	if l.due() < time.Since(l.start)-time.Second {
+		l.start = time.Now()
+		l.sent = 0
+	}
+	l.sent += int64(n)
+	if d := l.due() - time.Since(l.start); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// due is how long the bytes recorded so far should take at the limit
+func (l *rateLimiter) due() time.Duration {
+	return time.Duration(float64(l.sent) / float64(l.bps) * float64(time.Second))
+}
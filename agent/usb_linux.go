@@ -0,0 +1,92 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetRemovableDevices returns usb and removable block devices from sysfs with their mount points
+func (a *Agent) GetRemovableDevices() ([]rmm.USBDevice, error) {
+	ret := make([]rmm.USBDevice, 0)
+
+	disks, err := filepath.Glob("/sys/block/*")
+	if err != nil {
+		return ret, err
+	}
+
+	mounts, _ := a.GetMounts()
+
+	for _, d := range disks {
+		real, err := filepath.EvalSymlinks(d)
+		if err != nil {
+			continue
+		}
+		usb := strings.Contains(real, "/usb")
+		if !usb && readSysfs(d, "removable") != "1" {
+			continue
+		}
+		// empty card readers and optical drives report a size of 0
+		if readSysfsInt(d, "size") == 0 {
+			continue
+		}
+
+		name := filepath.Base(d)
+		dev := rmm.USBDevice{
+			Name:   strings.TrimSpace(readSysfs(filepath.Join(d, "device"), "vendor") + " " + readSysfs(filepath.Join(d, "device"), "model")),
+			USB:    usb,
+			Mounts: make([]string, 0),
+		}
+		if usb {
+			if parent := usbParent(real); parent != "" {
+				dev.VendorID = readSysfs(parent, "idVendor")
+				dev.ProductID = readSysfs(parent, "idProduct")
+				dev.Serial = readSysfs(parent, "serial")
+				dev.Vendor = readSysfs(parent, "manufacturer")
+				if p := readSysfs(parent, "product"); p != "" {
+					dev.Name = p
+				}
+			}
+		}
+		if dev.Name == "" {
+			dev.Name = name
+		}
+
+		// the whole disk or any of its partitions, /dev/sdb and /dev/sdb1
+		for _, m := range mounts {
+			if m.Device == "/dev/"+name || (strings.HasPrefix(m.Device, "/dev/"+name) && isPartitionOf(d, strings.TrimPrefix(m.Device, "/dev/"))) {
+				dev.Mounts = append(dev.Mounts, m.MountPoint)
+			}
+		}
+		ret = append(ret, dev)
+	}
+	return ret, nil
+}
+
+// usbParent walks up from a block device's sysfs path to the usb device that owns it
+func usbParent(path string) string {
+	for dir := filepath.Dir(path); dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "idVendor")); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+func isPartitionOf(disk, part string) bool {
+	_, err := os.Stat(filepath.Join(disk, part, "partition"))
+	return err == nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/StackExchange/wmi"
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+// GetRemovableDevices returns usb and removable disk drives from wmi with the drive letters they're mounted on
+func (a *Agent) GetRemovableDevices() ([]rmm.USBDevice, error) {
+	ret := make([]rmm.USBDevice, 0)
+
+	var disks []struct {
+		DeviceID      string
+		Model         string
+		PNPDeviceID   string
+		SerialNumber  string
+		InterfaceType string
+	}
+	q := "SELECT DeviceID, Model, PNPDeviceID, SerialNumber, InterfaceType FROM Win32_DiskDrive WHERE InterfaceType = 'USB' OR MediaType = 'Removable Media'"
+	if err := wmi.Query(q, &disks); err != nil {
+		return ret, err
+	}
+	if len(disks) == 0 {
+		return ret, nil
+	}
+
+	// the usb devices behind USBSTOR\DISK&VEN_...\<serial>&0 look like USB\VID_0781&PID_5567\<serial>
+	var parents []struct {
+		PNPDeviceID  string
+		Manufacturer string
+	}
+	if err := wmi.Query("SELECT PNPDeviceID, Manufacturer FROM Win32_PnPEntity WHERE Service = 'USBSTOR' OR Service = 'UASPStor'", &parents); err != nil {
+		a.Logger.Debugln("GetRemovableDevices() Win32_PnPEntity:", err)
+	}
+
+	for _, d := range disks {
+		dev := rmm.USBDevice{
+			Name:   d.Model,
+			Serial: strings.TrimSpace(d.SerialNumber),
+			USB:    strings.EqualFold(d.InterfaceType, "USB"),
+			Mounts: diskDriveLetters(d.DeviceID),
+		}
+
+		instance := pnpInstance(d.PNPDeviceID)
+		if i := strings.LastIndex(instance, "&"); i > 0 {
+			instance = instance[:i]
+		}
+		for _, p := range parents {
+			if instance == "" || !strings.EqualFold(pnpInstance(p.PNPDeviceID), instance) {
+				continue
+			}
+			dev.Vendor = p.Manufacturer
+			ids := strings.Split(p.PNPDeviceID, `\`)[1]
+			for _, part := range strings.Split(ids, "&") {
+				if strings.HasPrefix(part, "VID_") {
+					dev.VendorID = strings.ToLower(strings.TrimPrefix(part, "VID_"))
+				} else if strings.HasPrefix(part, "PID_") {
+					dev.ProductID = strings.ToLower(strings.TrimPrefix(part, "PID_"))
+				}
+			}
+			if dev.Serial == "" {
+				dev.Serial = instance
+			}
+			break
+		}
+		ret = append(ret, dev)
+	}
+	return ret, nil
+}
+
+// pnpInstance returns the last part of a pnp device id, the serial number for most usb devices
+func pnpInstance(id string) string {
+	parts := strings.Split(id, `\`)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[len(parts)-1]
+}
+
+// diskDriveLetters follows a disk drive through its partitions to the logical disks mounted on them
+func diskDriveLetters(deviceID string) []string {
+	ret := make([]string, 0)
+
+	var parts []struct{ DeviceID string }
+	q := fmt.Sprintf("ASSOCIATORS OF {Win32_DiskDrive.DeviceID='%s'} WHERE AssocClass = Win32_DiskDriveToDiskPartition", strings.ReplaceAll(deviceID, `\`, `\\`))
+	if err := wmi.Query(q, &parts); err != nil {
+		return ret
+	}
+
+	for _, p := range parts {
+		var logical []struct{ DeviceID string }
+		q := fmt.Sprintf("ASSOCIATORS OF {Win32_DiskPartition.DeviceID='%s'} WHERE AssocClass = Win32_LogicalDiskToPartition", p.DeviceID)
+		if err := wmi.Query(q, &logical); err != nil {
+			continue
+		}
+		for _, l := range logical {
+			ret = append(ret, l.DeviceID+`\`)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+)
+
+var linuxAdminGroups = []string{"root", "sudo", "wheel", "admin"}
+
+// readColonFile splits each non comment line of /etc/passwd style files on ':'
+func readColonFile(path string) ([][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ret := make([][]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ret = append(ret, strings.Split(line, ":"))
+	}
+	return ret, scanner.Err()
+}
+
+// uidMin returns UID_MIN from login.defs, the first uid given to regular users
+func uidMin() int {
+	if defs, err := os.ReadFile("/etc/login.defs"); err == nil {
+		for _, line := range strings.Split(string(defs), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[0] == "UID_MIN" {
+				if n, err := strconv.Atoi(fields[1]); err == nil {
+					return n
+				}
+			}
+		}
+	}
+	return 1000
+}
+
+// GetLocalUsers returns root, regular users and any system account that is in an admin group
+func (a *Agent) GetLocalUsers() ([]rmm.LocalUser, error) {
+	ret := make([]rmm.LocalUser, 0)
+
+	passwd, err := readColonFile("/etc/passwd")
+	if err != nil {
+		return ret, err
+	}
+
+	// group membership, by primary gid and supplementary member list
+	gidNames := make(map[string]string)
+	membership := make(map[string][]string)
+	if groups, err := readColonFile("/etc/group"); err == nil {
+		for _, g := range groups {
+			if len(g) < 4 {
+				continue
+			}
+			gidNames[g[2]] = g[0]
+			for _, m := range strings.Split(g[3], ",") {
+				if m != "" {
+					membership[m] = append(membership[m], g[0])
+				}
+			}
+		}
+	}
+
+	shadow := make(map[string][]string)
+	if entries, err := readColonFile("/etc/shadow"); err == nil {
+		for _, e := range entries {
+			shadow[e[0]] = e
+		}
+	} else {
+		a.Logger.Debugln("GetLocalUsers() /etc/shadow:", err)
+	}
+
+	lastLogons := a.lastLogons()
+	minUID := uidMin()
+
+	for _, p := range passwd {
+		if len(p) < 7 {
+			continue
+		}
+		uid, _ := strconv.Atoi(p[2])
+		groups := make([]string, 0)
+		if primary, ok := gidNames[p[3]]; ok {
+			groups = append(groups, primary)
+		}
+		for _, g := range membership[p[0]] {
+			if !contains(groups, g) {
+				groups = append(groups, g)
+			}
+		}
+
+		isAdmin := uid == 0
+		for _, g := range groups {
+			if contains(linuxAdminGroups, g) {
+				isAdmin = true
+			}
+		}
+		if uid != 0 && uid < minUID && !isAdmin {
+			continue
+		}
+
+		user := rmm.LocalUser{
+			Username:  p[0],
+			FullName:  strings.Split(p[4], ",")[0],
+			UID:       p[2],
+			Shell:     p[6],
+			Enabled:   !strings.HasSuffix(p[6], "nologin") && !strings.HasSuffix(p[6], "/false"),
+			IsAdmin:   isAdmin,
+			Groups:    groups,
+			LastLogon: lastLogons[p[0]],
+		}
+
+		if s, ok := shadow[p[0]]; ok && len(s) >= 8 {
+			if strings.HasPrefix(s[1], "!") || strings.HasPrefix(s[1], "*") {
+				user.Locked = true
+			}
+			lastChange, lcErr := strconv.Atoi(s[2])
+			maxDays, maxErr := strconv.Atoi(s[4])
+			if lcErr == nil && lastChange > 0 {
+				changed := time.Unix(int64(lastChange)*86400, 0)
+				user.PasswordAgeDays = int(time.Since(changed).Hours() / 24)
+				if maxErr == nil && maxDays < 99999 {
+					user.PasswordExpires = changed.AddDate(0, 0, maxDays).Format("2006-01-02")
+				}
+			}
+			user.PasswordNeverExpires = maxErr != nil || maxDays >= 99999
+			if expire, err := strconv.Atoi(s[7]); err == nil && expire > 0 {
+				if time.Unix(int64(expire)*86400, 0).Before(time.Now()) {
+					user.Enabled = false
+				}
+			}
+		}
+		ret = append(ret, user)
+	}
+	return ret, nil
+}
+
+// lastLogons parses the output of lastlog into a map of user to last login time
+func (a *Agent) lastLogons() map[string]string {
+	ret := make(map[string]string)
+	if _, err := exec.LookPath("lastlog"); err != nil {
+		return ret
+	}
+
+	opts := a.NewCMDOpts()
+	opts.Command = "LC_ALL=C lastlog"
+	out := a.CmdV2(opts)
+
+	for i, line := range strings.Split(out.Stdout, "\n") {
+		// skip the header
+		if i == 0 || strings.Contains(line, "**Never logged in**") {
+			continue
+		}
+		fields := strings.Fields(line)
+		// last 6 fields are the date e.g. Mon Jan  2 15:04:05 -0700 2006
+		if len(fields) < 7 {
+			continue
+		}
+		date := strings.Join(fields[len(fields)-6:], " ")
+		t, err := time.Parse("Mon Jan 2 15:04:05 -0700 2006", date)
+		if err != nil {
+			continue
+		}
+		ret[fields[0]] = t.Format("2006-01-02 15:04:05")
+	}
+	return ret
+}
+
+func contains(s []string, v string) bool {
+	for _, i := range s {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
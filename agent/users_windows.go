@@ -0,0 +1,67 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"strings"
+
+	rmm "github.com/amidaware/rmmagent/shared"
+	wapf "github.com/wh1te909/go-win64api"
+)
+
+// GetLocalUsers returns local accounts and the local groups they belong to
+func (a *Agent) GetLocalUsers() ([]rmm.LocalUser, error) {
+	ret := make([]rmm.LocalUser, 0)
+
+	users, err := wapf.ListLocalUsers()
+	if err != nil {
+		return ret, err
+	}
+
+	membership := make(map[string][]string)
+	groups, err := wapf.ListLocalGroups()
+	if err != nil {
+		a.Logger.Debugln("GetLocalUsers() ListLocalGroups:", err)
+	}
+	for _, g := range groups {
+		members, err := wapf.LocalGroupGetMembers(g.Name)
+		if err != nil {
+			a.Logger.Debugln("GetLocalUsers() LocalGroupGetMembers:", g.Name, err)
+			continue
+		}
+		for _, m := range members {
+			name := strings.ToLower(m.Name)
+			membership[name] = append(membership[name], g.Name)
+		}
+	}
+
+	for _, u := range users {
+		user := rmm.LocalUser{
+			Username:             u.Username,
+			FullName:             u.FullName,
+			Enabled:              u.IsEnabled,
+			Locked:               u.IsLocked,
+			IsAdmin:              u.IsAdmin,
+			Groups:               membership[strings.ToLower(u.Username)],
+			PasswordNeverExpires: u.PasswordNeverExpires,
+			PasswordAgeDays:      int(u.PasswordAge.Hours() / 24),
+		}
+		if !u.LastLogon.IsZero() && u.LastLogon.Unix() > 0 {
+			user.LastLogon = u.LastLogon.Format("2006-01-02 15:04:05")
+		}
+		if user.Groups == nil {
+			user.Groups = []string{}
+		}
+		ret = append(ret, user)
+	}
+	return ret, nil
+}
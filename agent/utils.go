@@ -14,12 +14,16 @@ package agent
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"math"
 	"math/rand"
 	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -318,3 +322,66 @@ func createTmpFile() (*os.File, error) {
 	}
 	return f, nil
 }
+
+// LoadCABundle loads every certificate in a pem file into a pool on top of the system roots
+// Blocks that fail to parse are skipped, it's only an error if nothing could be loaded
+func LoadCABundle(path string) (*x509.CertPool, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	loaded := 0
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		pool.AddCert(cert)
+		loaded++
+	}
+
+	if loaded == 0 {
+		return nil, 0, fmt.Errorf("%s: no valid certificates found", path)
+	}
+	return pool, loaded, nil
+}
+
+// runTool runs an external tool and includes its output in the error if it fails
+func runTool(timeout time.Duration, name string, args ...string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%s is not available on this system", name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, args...).CombinedOutput()
+	output := CleanString(string(out))
+	if ctx.Err() == context.DeadlineExceeded {
+		return output, fmt.Errorf("%s %s timed out after %v", name, strings.Join(args, " "), timeout)
+	}
+	if err != nil {
+		return output, fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, output)
+	}
+	return output, nil
+}
+
+// normalizeMAC returns a mac address as lowercase and colon separated, windows tools use dashes
+func normalizeMAC(mac string) string {
+	return strings.ToLower(strings.ReplaceAll(mac, "-", ":"))
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import "strings"
+
+// known hypervisor signatures as they show up in dmi vendor/product strings
+var hypervisorSignatures = []struct {
+	match string
+	name  string
+}{
+	{"vmware", "VMware"},
+	{"virtualbox", "VirtualBox"},
+	{"innotek", "VirtualBox"},
+	{"kvm", "KVM"},
+	{"qemu", "QEMU"},
+	{"bochs", "Bochs"},
+	{"xen", "Xen"},
+	{"virtual machine", "Hyper-V"},
+	{"parallels", "Parallels"},
+	{"amazon ec2", "Amazon EC2"},
+	{"google compute engine", "Google Compute Engine"},
+	{"openstack", "OpenStack"},
+	{"bhyve", "bhyve"},
+}
+
+// classifyHypervisor returns the hypervisor name if any of the strings match a known signature
+func classifyHypervisor(vals ...string) string {
+	joined := strings.ToLower(strings.Join(vals, " "))
+	for _, h := range hypervisorSignatures {
+		if strings.Contains(joined, h.match) {
+			return h.name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// GetVirtualizationInfo detects if we are running as a guest and under which hypervisor
+// systemd-detect-virt is preferred, falling back to dmi strings and the cpu hypervisor flag
+func (a *Agent) GetVirtualizationInfo() (isVirtual bool, hypervisor string, err error) {
+	if _, lerr := exec.LookPath("systemd-detect-virt"); lerr == nil {
+		opts := a.NewCMDOpts()
+		opts.Command = "systemd-detect-virt --vm"
+		out := a.CmdV2(opts)
+		// exits 1 and prints "none" on bare metal
+		if out.Status.Error == nil {
+			virt := strings.TrimSpace(out.Stdout)
+			if out.Status.Exit == 0 && virt != "" && virt != "none" {
+				if name := classifyHypervisor(virt); name != "" {
+					return true, name, nil
+				}
+				return true, virt, nil
+			}
+			if virt == "none" {
+				return false, "", nil
+			}
+		}
+	}
+
+	if name := classifyHypervisor(readDMI("sys_vendor"), readDMI("product_name"), readDMI("bios_vendor")); name != "" {
+		return true, name, nil
+	}
+
+	if b, rerr := os.ReadFile("/sys/hypervisor/type"); rerr == nil && strings.TrimSpace(string(b)) == "xen" {
+		return true, "Xen", nil
+	}
+
+	cpuinfo, rerr := os.ReadFile("/proc/cpuinfo")
+	if rerr != nil {
+		return false, "", rerr
+	}
+	for _, line := range strings.Split(string(cpuinfo), "\n") {
+		if strings.HasPrefix(line, "flags") {
+			for _, flag := range strings.Fields(line) {
+				if flag == "hypervisor" {
+					return true, "unknown", nil
+				}
+			}
+			break
+		}
+	}
+	return false, "", nil
+}
+
+// SupportsNestedVirtualization reports if this system can run its own virtual machines, i.e. the cpu's vmx or svm flag
+// is visible. In a guest that only happens when the hypervisor passes it through, on bare metal newer kernels hide
+// it when vt is disabled in the bios. Other architectures don't have an equivalent flag so are ErrVirtUnknown
+func (a *Agent) SupportsNestedVirtualization() (bool, error) {
+	if runtime.GOARCH != "amd64" && runtime.GOARCH != "386" {
+		return false, ErrVirtUnknown
+	}
+	cpuinfo, err := os.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(string(cpuinfo), "\n") {
+		if !strings.HasPrefix(line, "flags") {
+			continue
+		}
+		for _, flag := range strings.Fields(line) {
+			if flag == "vmx" || flag == "svm" {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, ErrVirtUnknown
+}
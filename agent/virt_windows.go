@@ -0,0 +1,82 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"github.com/StackExchange/wmi"
+)
+
+// GetVirtualizationInfo detects if we are running as a guest and under which hypervisor
+// HypervisorPresent alone isn't enough since it's also set on hyper-v hosts and with vbs enabled,
+// so only the dmi strings are used to decide
+func (a *Agent) GetVirtualizationInfo() (isVirtual bool, hypervisor string, err error) {
+	var cs []struct {
+		Manufacturer      string
+		Model             string
+		HypervisorPresent bool
+	}
+	if err := wmi.Query("SELECT Manufacturer, Model, HypervisorPresent FROM Win32_ComputerSystem", &cs); err != nil {
+		return false, "", err
+	}
+	if len(cs) == 0 {
+		return false, "", nil
+	}
+
+	var bios []struct {
+		Manufacturer string
+		Version      string
+	}
+	if err := wmi.Query("SELECT Manufacturer, Version FROM Win32_BIOS", &bios); err != nil {
+		a.Logger.Debugln("GetVirtualizationInfo() Win32_BIOS:", err)
+	}
+
+	vals := []string{cs[0].Manufacturer, cs[0].Model}
+	for _, b := range bios {
+		vals = append(vals, b.Manufacturer, b.Version)
+	}
+
+	if name := classifyHypervisor(vals...); name != "" {
+		return true, name, nil
+	}
+	return false, "", nil
+}
+
+// SupportsNestedVirtualization reports if this system can run its own virtual machines
+// Once a hypervisor is running, windows reports the cpu's vt fields as false, so on a physical host with hyper-v
+// or vbs on the answer is yes, and in a guest with a hypervisor present there's no way to tell from wmi
+func (a *Agent) SupportsNestedVirtualization() (bool, error) {
+	var cs []struct {
+		HypervisorPresent bool
+	}
+	if err := wmi.Query("SELECT HypervisorPresent FROM Win32_ComputerSystem", &cs); err != nil {
+		return false, err
+	}
+	if len(cs) > 0 && cs[0].HypervisorPresent {
+		guest, _, err := a.GetVirtualizationInfo()
+		if err != nil || guest {
+			return false, ErrVirtUnknown
+		}
+		return true, nil
+	}
+
+	var cpus []struct {
+		VMMonitorModeExtensions       bool
+		VirtualizationFirmwareEnabled bool
+	}
+	if err := wmi.Query("SELECT VMMonitorModeExtensions, VirtualizationFirmwareEnabled FROM Win32_Processor", &cpus); err != nil {
+		return false, err
+	}
+	if len(cpus) == 0 {
+		return false, ErrVirtUnknown
+	}
+	return cpus[0].VMMonitorModeExtensions && cpus[0].VirtualizationFirmwareEnabled, nil
+}
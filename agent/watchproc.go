@@ -0,0 +1,97 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	gops "github.com/shirou/gopsutil/v3/process"
+)
+
+const watchProcessInterval = 2 * time.Second
+
+// WatchProcess calls onExit whenever the last running instance of a process exits, until ctx is cancelled
+// If the process isn't running when the watch starts onExit is called straight away, after that only once it
+// has started again and exited. Names are matched case insensitively on windows and .exe is optional
+func (a *Agent) WatchProcess(name string, ctx context.Context, onExit func()) {
+	ticker := time.NewTicker(watchProcessInterval)
+	defer ticker.Stop()
+
+	// true to begin with so a process that was never started is reported
+	wasRunning := true
+	var pids []int32
+	for {
+		// checking the known pids is much cheaper than listing every process, only rescan when they're all gone
+		alive := make([]int32, 0, len(pids))
+		for _, pid := range pids {
+			if ok, _ := gops.PidExistsWithContext(ctx, pid); ok {
+				alive = append(alive, pid)
+			}
+		}
+		if len(alive) == 0 {
+			found, err := findProcesses(ctx, name)
+			if err != nil {
+				a.Logger.Debugln("WatchProcess():", err)
+			}
+			alive = found
+		}
+
+		if len(alive) == 0 && wasRunning {
+			a.Logger.Debugln("WatchProcess():", name, "is not running")
+			onExit()
+		}
+		wasRunning = len(alive) > 0
+		pids = alive
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// findProcesses returns the pids of every process called name
+func findProcesses(ctx context.Context, name string) ([]int32, error) {
+	procs, err := gops.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	want := processBaseName(name)
+	ret := make([]int32, 0)
+	for _, p := range procs {
+		pname, err := p.NameWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		if processBaseName(pname) == want {
+			ret = append(ret, p.Pid)
+		}
+	}
+	return ret, nil
+}
+
+func processBaseName(name string) string {
+	name = filepath.Base(name)
+	if strings.EqualFold(filepath.Ext(name), ".exe") {
+		name = name[:len(name)-4]
+	}
+	if runtime.GOOS == "windows" {
+		return strings.ToLower(name)
+	}
+	return name
+}
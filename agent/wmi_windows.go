@@ -13,11 +13,137 @@ package agent
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"github.com/StackExchange/wmi"
 	rmm "github.com/amidaware/rmmagent/shared"
+	ole "github.com/go-ole/go-ole"
+	"github.com/go-ole/go-ole/oleutil"
 )
 
+// execWMIMethod calls method on a wmi class or instance path, e.g. Win32_Volume.DeviceID='...', with named parameters
+// and returns the requested out parameters. A non zero ReturnValue is returned as an error
+func execWMIMethod(namespace, path, method string, params map[string]interface{}, outputs ...string) (map[string]interface{}, error) {
+	if err := ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED); err != nil {
+		e, ok := err.(*ole.OleError)
+		if !ok || (e.Code() != S_OK && e.Code() != S_FALSE) {
+			return nil, fmt.Errorf("ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED): %v", err)
+		}
+	}
+	defer ole.CoUninitialize()
+
+	locator, err := NewCOMObject("WbemScripting.SWbemLocator")
+	if err != nil {
+		return nil, err
+	}
+	defer locator.Release()
+
+	serviceRaw, err := oleutil.CallMethod(locator, "ConnectServer", nil, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("ConnectServer %s: %v", namespace, err)
+	}
+	defer serviceRaw.Clear()
+	service := serviceRaw.ToIDispatch()
+
+	objRaw, err := oleutil.CallMethod(service, "Get", path)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %v", path, err)
+	}
+	defer objRaw.Clear()
+
+	var in *ole.IDispatch
+	if len(params) > 0 {
+		methodsRaw, err := oleutil.GetProperty(objRaw.ToIDispatch(), "Methods_")
+		if err != nil {
+			return nil, err
+		}
+		defer methodsRaw.Clear()
+
+		methodRaw, err := oleutil.CallMethod(methodsRaw.ToIDispatch(), "Item", method)
+		if err != nil {
+			return nil, fmt.Errorf("%s has no method %s: %v", path, method, err)
+		}
+		defer methodRaw.Clear()
+
+		inClassRaw, err := oleutil.GetProperty(methodRaw.ToIDispatch(), "InParameters")
+		if err != nil {
+			return nil, err
+		}
+		defer inClassRaw.Clear()
+
+		// parameters are set by name on an instance of InParameters rather than passed positionally
+		inRaw, err := oleutil.CallMethod(inClassRaw.ToIDispatch(), "SpawnInstance_")
+		if err != nil {
+			return nil, err
+		}
+		defer inRaw.Clear()
+		in = inRaw.ToIDispatch()
+
+		for k, v := range params {
+			if _, err := oleutil.PutProperty(in, k, v); err != nil {
+				return nil, fmt.Errorf("set %s: %v", k, err)
+			}
+		}
+	}
+
+	var outRaw *ole.VARIANT
+	if in != nil {
+		outRaw, err = oleutil.CallMethod(service, "ExecMethod", path, method, in)
+	} else {
+		outRaw, err = oleutil.CallMethod(service, "ExecMethod", path, method)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %v", path, method, err)
+	}
+	defer outRaw.Clear()
+	out := outRaw.ToIDispatch()
+
+	if rv, err := oleutil.GetProperty(out, "ReturnValue"); err == nil {
+		code := variantInt(rv)
+		rv.Clear()
+		if code != 0 {
+			return nil, fmt.Errorf("%s %s returned %#x", path, method, uint32(code))
+		}
+	}
+
+	ret := make(map[string]interface{}, len(outputs))
+	for _, name := range outputs {
+		v, err := oleutil.GetProperty(out, name)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s output %s: %v", path, method, name, err)
+		}
+		if v.VT&ole.VT_ARRAY != 0 {
+			ret[name] = v.ToArray().ToStringArray()
+		} else {
+			ret[name] = v.Value()
+		}
+		v.Clear()
+	}
+	return ret, nil
+}
+
+func variantInt(v *ole.VARIANT) int64 {
+	switch n := v.Value().(type) {
+	case int32:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	case int64:
+		return n
+	case uint64:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case uint16:
+		return int64(n)
+	case uint8:
+		return int64(n)
+	case int8:
+		return int64(n)
+	}
+	return 0
+}
+
 func GetWin32_USBController() ([]interface{}, error) {
 	var dst []rmm.Win32_USBController
 	ret := make([]interface{}, 0)
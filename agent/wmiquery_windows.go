@@ -0,0 +1,156 @@
+/*
+Copyright 2022 AmidaWare LLC.
+
+Licensed under the Tactical RMM License Version 1.0 (the “License”).
+You may only use the Licensed Software in accordance with the License.
+A copy of the License is available at:
+
+https://license.tacticalrmm.com
+
+*/
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	ole "github.com/go-ole/go-ole"
+	"github.com/go-ole/go-ole/oleutil"
+)
+
+const (
+	wmiQueryTimeout = 60 * time.Second
+	wmiQueryMaxRows = 5000
+	// wbemFlagReturnImmediately | wbemFlagForwardOnly, rows are streamed instead of buffered by wmi
+	wmiQueryFlags = 0x10 | 0x20
+)
+
+// returned from the ForEach callbacks to stop enumerating early
+var errWMIStop = errors.New("stop")
+
+// RunWMIQuery runs an arbitrary wql query and returns each row as a map of property name to value
+// Queries are cut off after wmiQueryTimeout and wmiQueryMaxRows rows
+func (a *Agent) RunWMIQuery(namespace, query string) ([]map[string]interface{}, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("empty wmi query")
+	}
+	if namespace == "" {
+		namespace = `root\CIMV2`
+	}
+
+	type result struct {
+		rows []map[string]interface{}
+		err  error
+	}
+	done := make(chan result, 1)
+	deadline := time.Now().Add(wmiQueryTimeout)
+
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		rows, err := a.wmiQuery(namespace, query, deadline)
+		done <- result{rows, err}
+	}()
+
+	// the query goroutine checks the deadline between rows, this covers a provider hanging on a single row
+	select {
+	case r := <-done:
+		return r.rows, r.err
+	case <-time.After(time.Until(deadline) + 5*time.Second):
+		return nil, fmt.Errorf("wmi query timed out after %v", wmiQueryTimeout)
+	}
+}
+
+func (a *Agent) wmiQuery(namespace, query string, deadline time.Time) ([]map[string]interface{}, error) {
+	if err := ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED); err != nil {
+		e, ok := err.(*ole.OleError)
+		if !ok || (e.Code() != S_OK && e.Code() != S_FALSE) {
+			return nil, fmt.Errorf("ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED): %v", err)
+		}
+	}
+	defer ole.CoUninitialize()
+
+	locator, err := NewCOMObject("WbemScripting.SWbemLocator")
+	if err != nil {
+		return nil, err
+	}
+	defer locator.Release()
+
+	serviceRaw, err := oleutil.CallMethod(locator, "ConnectServer", nil, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("ConnectServer %s: %v", namespace, err)
+	}
+	defer serviceRaw.Clear()
+
+	resultRaw, err := oleutil.CallMethod(serviceRaw.ToIDispatch(), "ExecQuery", query, "WQL", wmiQueryFlags)
+	if err != nil {
+		return nil, fmt.Errorf("ExecQuery: %v", err)
+	}
+	defer resultRaw.Clear()
+
+	ret := make([]map[string]interface{}, 0)
+	var rowErr error
+	err = oleutil.ForEach(resultRaw.ToIDispatch(), func(v *ole.VARIANT) error {
+		defer v.Clear()
+		if len(ret) >= wmiQueryMaxRows {
+			a.Logger.Warnf("RunWMIQuery(): stopped after %d rows: %s\n", wmiQueryMaxRows, query)
+			return errWMIStop
+		}
+		if time.Now().After(deadline) {
+			rowErr = fmt.Errorf("wmi query timed out after %v", wmiQueryTimeout)
+			return errWMIStop
+		}
+		row, err := wmiRow(v.ToIDispatch())
+		if err != nil {
+			rowErr = err
+			return errWMIStop
+		}
+		ret = append(ret, row)
+		return nil
+	})
+	if rowErr != nil {
+		return nil, rowErr
+	}
+	if err != nil && err != errWMIStop {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// wmiRow reads every property of a SWbemObject
+func wmiRow(item *ole.IDispatch) (map[string]interface{}, error) {
+	propsRaw, err := oleutil.GetProperty(item, "Properties_")
+	if err != nil {
+		return nil, err
+	}
+	defer propsRaw.Clear()
+
+	row := make(map[string]interface{})
+	err = oleutil.ForEach(propsRaw.ToIDispatch(), func(p *ole.VARIANT) error {
+		defer p.Clear()
+		prop := p.ToIDispatch()
+		name, err := oleutil.GetProperty(prop, "Name")
+		if err != nil {
+			return err
+		}
+		defer name.Clear()
+
+		val, err := oleutil.GetProperty(prop, "Value")
+		if err != nil {
+			return err
+		}
+		defer val.Clear()
+
+		if val.VT&ole.VT_ARRAY != 0 {
+			row[name.ToString()] = val.ToArray().ToValueArray()
+		} else {
+			row[name.ToString()] = val.Value()
+		}
+		return nil
+	})
+	return row, err
+}
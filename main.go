@@ -12,6 +12,7 @@ https://license.tacticalrmm.com
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
@@ -114,6 +115,15 @@ func main() {
 		a.UninstallCleanup()
 	case "publicip":
 		fmt.Println(a.PublicIP())
+	case "apitls":
+		// for onboarding failures, works without nats
+		report, err := a.InspectAPITLS()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		b, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(b))
 	case "getpython":
 		a.GetPython(true)
 	case "runmigrations":
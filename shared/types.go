@@ -33,15 +33,59 @@ type ProcessMsg struct {
 }
 
 type AgentConfig struct {
-	BaseURL       string
-	AgentID       string
-	APIURL        string
-	Token         string
-	AgentPK       string
-	PK            int
-	Cert          string
-	Proxy         string
-	CustomMeshDir string
+	BaseURL           string
+	AgentID           string
+	APIURL            string
+	Token             string
+	AgentPK           string
+	PK                int
+	Cert              string
+	Proxy             string
+	CustomMeshDir     string
+	NetChangeCheckin  bool
+	AuditLog          string
+	MaintenanceWindow MaintenanceWindow
+	SignPayloads      bool
+	// seconds
+	NetworkWait int
+	// max concurrent python processes, 0 for no limit
+	PythonWorkers int
+	// regex patterns, commands matching a deny pattern never run,
+	// if any allow patterns are set only commands matching one of them run
+	CommandDenylist  []string
+	CommandAllowlist []string
+	// nats heartbeat, seconds between pings and unanswered pings before reconnecting, 0 for the nats defaults
+	NatsPingInterval int
+	NatsMaxPingsOut  int
+	// ask the rmm to re-enroll the agent if it detects it's running on a clone
+	ReenrollOnClone bool
+	// script output over this many bytes is uploaded to ResultUploadURL instead of sent inline,
+	// or truncated if no endpoint is set. 0 always sends it inline
+	ResultInlineMax int
+	ResultUploadURL string
+	// max concurrent CmdV2 commands, 0 for no limit, and seconds a command waits for a slot
+	MaxParallelCmds int
+	CmdQueueTimeout int
+	// add an X-Agent-HMAC header to the syncmesh request, keyed with the agent token
+	SignMeshSync bool
+	// cap on chunked upload speed in bytes per second, 0 for no limit
+	UploadMaxBps int
+	// rotate the audit log at this size or age, 0 uses the default of 10 MB and never by age,
+	// and how many compressed segments to keep, 0 keeps 10
+	AuditMaxSizeMB  int
+	AuditMaxAgeDays int
+	AuditKeep       int
+	// traded for a new token when the current one is rejected, blank to not re-authenticate
+	EnrollSecret string
+}
+
+// ProcessInfo is a process snapshot for top style listings, CPUPercent is of one core so can go over 100
+type ProcessInfo struct {
+	PID        int32   `json:"pid"`
+	Name       string  `json:"name"`
+	Username   string  `json:"username"`
+	CPUPercent float64 `json:"cpu_percent"`
+	RSS        uint64  `json:"rss"`
 }
 
 type RunScriptResp struct {
@@ -50,6 +94,17 @@ type RunScriptResp struct {
 	Retcode  int     `json:"retcode"`
 	ExecTime float64 `json:"execution_time"`
 	ID       int     `json:"id"`
+
+	// only when timing was asked for
+	Timing *ExecTiming `json:"timing,omitempty"`
+}
+
+// ExecTiming is the breakdown of a script run in milliseconds
+type ExecTiming struct {
+	SetupMs   float64 `json:"setup_ms"`
+	StartMs   float64 `json:"start_ms"`
+	ExecMs    float64 `json:"exec_ms"`
+	CleanupMs float64 `json:"cleanup_ms"`
 }
 
 type RawCMDResp struct {
@@ -68,6 +123,50 @@ type AgentInfo struct {
 	RebootNeeded bool    `json:"needs_reboot"`
 }
 
+// HTTPTrace holds the timings of a single api request, durations are in milliseconds
+type HTTPTrace struct {
+	URL          string  `json:"url"`
+	StatusCode   int     `json:"status_code"`
+	RemoteAddr   string  `json:"remote_addr"`
+	DNSLookup    float64 `json:"dns_lookup"`
+	TCPConnect   float64 `json:"tcp_connect"`
+	TLSHandshake float64 `json:"tls_handshake"`
+	ServerTime   float64 `json:"server_time"`
+	ResponseTime float64 `json:"response_time"`
+	TotalTime    float64 `json:"total_time"`
+	ConnReused   bool    `json:"conn_reused"`
+}
+
+// AgentInfoNats extends the agentinfo checkin
+// ClockOffset is how many seconds the server's clock is ahead of the agent's
+// CheckInNats is the agent-hello payload, with the features this agent supports
+type CheckInNats struct {
+	trmm.CheckInNats
+	Capabilities map[string]bool `json:"capabilities"`
+}
+
+type AgentInfoNats struct {
+	trmm.AgentInfoNats
+	ClockOffset float64 `json:"clock_offset,omitempty"`
+	// unix time the agent service started and the number of times it has restarted
+	AgentStarted int64 `json:"agent_started,omitempty"`
+	RestartCount int   `json:"restart_count"`
+
+	Build    BuildInfo `json:"build"`
+	Elevated bool      `json:"elevated"`
+}
+
+type BuildInfo struct {
+	AgentVersion  string `json:"agent_version"`
+	GoVersion     string `json:"go_version"`
+	Module        string `json:"module"`
+	ModuleVersion string `json:"module_version"`
+	Revision      string `json:"revision"`
+	BuildTime     string `json:"build_time"`
+	Platform      string `json:"platform"`
+	Arch          string `json:"arch"`
+}
+
 type PingCheckResponse struct {
 	ID      int    `json:"id"`
 	AgentID string `json:"agent_id"`
@@ -126,6 +225,490 @@ type Disk struct {
 	Percent float64 `json:"percent"`
 }
 
+// DiskIO holds io counters and rates for a single device
+// latencies are averages per operation over the sampling window
+type DiskIO struct {
+	Device           string  `json:"device"`
+	ReadBytes        uint64  `json:"read_bytes"`
+	WriteBytes       uint64  `json:"write_bytes"`
+	ReadCount        uint64  `json:"read_count"`
+	WriteCount       uint64  `json:"write_count"`
+	ReadTime         uint64  `json:"read_time"`
+	WriteTime        uint64  `json:"write_time"`
+	IoTime           uint64  `json:"io_time"`
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+	ReadOpsPerSec    float64 `json:"read_ops_per_sec"`
+	WriteOpsPerSec   float64 `json:"write_ops_per_sec"`
+	ReadLatencyMs    float64 `json:"read_latency_ms"`
+	WriteLatencyMs   float64 `json:"write_latency_ms"`
+	BusyPercent      float64 `json:"busy_percent"`
+}
+
+type GPUInfo struct {
+	Name          string `json:"name"`
+	Vendor        string `json:"vendor"`
+	DriverVersion string `json:"driver_version"`
+	VRAM          uint64 `json:"vram"`
+}
+
+// SystemInfo holds hardware identifiers for asset management
+type SystemInfo struct {
+	Manufacturer string `json:"manufacturer"`
+	Model        string `json:"model"`
+	SerialNumber string `json:"serial_number"`
+	UUID         string `json:"uuid"`
+	BIOSVendor   string `json:"bios_vendor"`
+	BIOSVersion  string `json:"bios_version"`
+	BIOSDate     string `json:"bios_date"`
+}
+
+// AVProduct is an antivirus product and its health
+// SignatureAge is in days, -1 if unknown
+type AVProduct struct {
+	Name               string `json:"name"`
+	Source             string `json:"source"`
+	Path               string `json:"path"`
+	ProductState       uint32 `json:"product_state"`
+	Enabled            bool   `json:"enabled"`
+	UpToDate           bool   `json:"up_to_date"`
+	RealTimeProtection bool   `json:"real_time_protection"`
+	SignatureAge       int    `json:"signature_age"`
+	SignatureVersion   string `json:"signature_version"`
+}
+
+type DefenderExclusions struct {
+	Paths      []string `json:"paths"`
+	Processes  []string `json:"processes"`
+	Extensions []string `json:"extensions"`
+}
+
+type RemoteSession struct {
+	ID        string `json:"id"`
+	User      string `json:"user"`
+	Domain    string `json:"domain"`
+	Station   string `json:"station"`
+	Client    string `json:"client"`
+	Protocol  string `json:"protocol"`
+	State     string `json:"state"`
+	LogonTime int64  `json:"logon_time"`
+}
+
+type LocalUser struct {
+	Username             string   `json:"username"`
+	FullName             string   `json:"full_name"`
+	UID                  string   `json:"uid"`
+	Shell                string   `json:"shell"`
+	Enabled              bool     `json:"enabled"`
+	Locked               bool     `json:"locked"`
+	IsAdmin              bool     `json:"is_admin"`
+	Groups               []string `json:"groups"`
+	LastLogon            string   `json:"last_logon"`
+	PasswordNeverExpires bool     `json:"password_never_expires"`
+	PasswordExpires      string   `json:"password_expires"`
+	PasswordAgeDays      int      `json:"password_age_days"`
+}
+
+// MaintenanceWindow is a daily window during which automated scripts and tasks are suppressed
+// Start and End are HH:MM local time, Days are weekdays with 0 being sunday, empty means every day
+// An enabled window without a start and end is always active
+type MaintenanceWindow struct {
+	Enabled bool   `json:"enabled"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+	Days    []int  `json:"days"`
+}
+
+type MaintenanceStatus struct {
+	Window MaintenanceWindow `json:"window"`
+	Source string            `json:"source"`
+	Active bool              `json:"active"`
+}
+
+type HandleStats struct {
+	// open file descriptors on linux, open handles on windows
+	Open    uint64 `json:"open"`
+	HasOpen bool   `json:"has_open"`
+	Limit   uint64 `json:"limit"`
+	// false where the os has no limit or it couldn't be read
+	HasLimit bool `json:"has_limit"`
+}
+
+type PackageUpdate struct {
+	Name      string `json:"name"`
+	Current   string `json:"current"`
+	Candidate string `json:"candidate"`
+	Arch      string `json:"arch"`
+	// repo or origin the update comes from
+	Source   string `json:"source"`
+	Security bool   `json:"security"`
+}
+
+type NetworkStats struct {
+	BytesSent   uint64 `json:"bytes_sent"`
+	BytesRecv   uint64 `json:"bytes_recv"`
+	PacketsSent uint64 `json:"packets_sent"`
+	PacketsRecv uint64 `json:"packets_recv"`
+	Errors      uint64 `json:"errors"`
+	Drops       uint64 `json:"drops"`
+}
+
+type MetricsBatch struct {
+	AgentID    string       `json:"agent_id"`
+	Timestamp  int64        `json:"timestamp"`
+	CPULoad    int          `json:"cpu_load"`
+	MemTotal   uint64       `json:"mem_total"`
+	MemUsed    uint64       `json:"mem_used"`
+	MemPercent float64      `json:"mem_percent"`
+	Disks      []trmm.Disk  `json:"disks"`
+	Network    NetworkStats `json:"network"`
+}
+
+type CertExpiry struct {
+	Addr string `json:"addr"`
+	// unix time
+	NotAfter int64 `json:"not_after"`
+	DaysLeft int   `json:"days_left"`
+}
+
+type ShutdownReason struct {
+	Clean  bool   `json:"clean"`
+	Reason string `json:"reason"`
+	// unix time, 0 when unknown
+	When int64 `json:"when"`
+}
+
+type ScheduledReboot struct {
+	// unix time
+	At      int64  `json:"at"`
+	Message string `json:"message"`
+}
+
+// ProcNetUsage is a process's tcp traffic, udp isn't attributed to processes on either platform
+// Bytes are totals over the open connections, since they opened on linux and since the agent first sampled them
+// on windows. Partial is set when the bytes of some of the connections couldn't be read, only Connections is complete then
+type ProcNetUsage struct {
+	PID         int32  `json:"pid"`
+	Name        string `json:"name"`
+	Connections int    `json:"connections"`
+	BytesSent   uint64 `json:"bytes_sent"`
+	BytesRecv   uint64 `json:"bytes_recv"`
+	SentBps     uint64 `json:"sent_bps"`
+	RecvBps     uint64 `json:"recv_bps"`
+	Partial     bool   `json:"partial"`
+}
+
+// AuthStatus is set once the api rejects the agent token and re-authenticating didn't fix it, Since is unix time
+type AuthStatus struct {
+	AuthRequired bool   `json:"auth_required"`
+	Reason       string `json:"reason,omitempty"`
+	Since        int64  `json:"since,omitempty"`
+	CanReauth    bool   `json:"can_reauth"`
+}
+
+// FirewallRule is a firewall rule normalized across windows firewall, nftables and iptables
+// Direction is in, out or forward, Action is allow, block or the jump target, and "*" is any port or address
+type FirewallRule struct {
+	Name        string `json:"name"`
+	Direction   string `json:"direction"`
+	Action      string `json:"action"`
+	Protocol    string `json:"protocol"`
+	LocalPorts  string `json:"local_ports"`
+	RemotePorts string `json:"remote_ports"`
+	RemoteAddrs string `json:"remote_addrs"`
+	Program     string `json:"program,omitempty"`
+	Enabled     bool   `json:"enabled"`
+}
+
+type BrowserExtension struct {
+	User        string   `json:"user"`
+	Browser     string   `json:"browser"`
+	Profile     string   `json:"profile"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Version     string   `json:"version"`
+	Permissions []string `json:"permissions"`
+	Enabled     bool     `json:"enabled"`
+}
+
+// DHCPLease is an interface's ipv4 config, Method is dhcp or static and the lease fields are blank without a lease
+type DHCPLease struct {
+	Interface   string `json:"interface"`
+	Description string `json:"description,omitempty"`
+	Method      string `json:"method"`
+	Address     string `json:"address"`
+	Server      string `json:"server"`
+	Obtained    string `json:"obtained"`
+	Expires     string `json:"expires"`
+	Expired     bool   `json:"expired"`
+}
+
+// TaskRun is one run of a scheduled task, ResultCode is -1 when the scheduler doesn't record it
+type TaskRun struct {
+	Time       string `json:"time"`
+	ResultCode int64  `json:"result_code"`
+	Result     string `json:"result"`
+	Success    bool   `json:"success"`
+	Source     string `json:"source"`
+}
+
+type HostEntry struct {
+	IP        string   `json:"ip"`
+	Hostnames []string `json:"hostnames"`
+	Comment   string   `json:"comment"`
+	Line      int      `json:"line"`
+}
+
+// ConfigDiff is one difference between the agent config and a baseline, Change is added, removed or changed
+type ConfigDiff struct {
+	Change   string `json:"change"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+type MemPressure struct {
+	TotalMemory     uint64 `json:"total_memory"`
+	AvailableMemory uint64 `json:"available_memory"`
+	SwapTotal       uint64 `json:"swap_total"`
+	SwapUsed        uint64 `json:"swap_used"`
+	// pages per second
+	SwapInPerSec  float64 `json:"swap_in_per_sec"`
+	SwapOutPerSec float64 `json:"swap_out_per_sec"`
+	// linux psi, percent of the last 10 seconds some or all tasks were stalled waiting on memory
+	PressureSome float64 `json:"pressure_some"`
+	PressureFull float64 `json:"pressure_full"`
+	// oom kills on linux, low memory events on windows, since boot
+	OOMKills        int      `json:"oom_kills"`
+	RecentOOMEvents []string `json:"recent_oom_events"`
+	OOMEventsError  string   `json:"oom_events_error,omitempty"`
+}
+
+type TLSCert struct {
+	Subject   string   `json:"subject"`
+	Issuer    string   `json:"issuer"`
+	SANs      []string `json:"sans"`
+	NotBefore string   `json:"not_before"`
+	NotAfter  string   `json:"not_after"`
+	// negative once expired
+	DaysLeft int    `json:"days_left"`
+	IsCA     bool   `json:"is_ca"`
+	SHA256   string `json:"sha256"`
+}
+
+type TLSReport struct {
+	Address     string `json:"address"`
+	ServerName  string `json:"server_name"`
+	TLSVersion  string `json:"tls_version"`
+	CipherSuite string `json:"cipher_suite"`
+	// leaf first, as presented by the server
+	Chain       []TLSCert `json:"chain"`
+	CustomCA    bool      `json:"custom_ca"`
+	Verified    bool      `json:"verified"`
+	VerifyError string    `json:"verify_error,omitempty"`
+}
+
+type CmdStreamLine struct {
+	Stderr bool   `json:"stderr"`
+	Line   string `json:"line"`
+}
+
+// CmdStreamChunk is one batch of streamed command output, the last one has Done set
+type CmdStreamChunk struct {
+	AgentID string          `json:"agent_id"`
+	Seq     int             `json:"seq"`
+	Lines   []CmdStreamLine `json:"lines"`
+	// lines lost because the server couldn't keep up
+	Dropped  int    `json:"dropped"`
+	Done     bool   `json:"done"`
+	ExitCode int    `json:"exit_code"`
+	TimedOut string `json:"timed_out,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type Route struct {
+	// cidr, 0.0.0.0/0 or ::/0 for the default route
+	Destination string `json:"destination"`
+	// empty for on-link routes
+	Gateway   string `json:"gateway"`
+	Interface string `json:"interface"`
+	Metric    int    `json:"metric"`
+	// where the route came from (kernel, dhcp, static), linux only
+	Source string `json:"source,omitempty"`
+}
+
+type ARPEntry struct {
+	IP        string `json:"ip"`
+	MAC       string `json:"mac"`
+	Interface string `json:"interface"`
+	State     string `json:"state"`
+}
+
+type ConnInfo struct {
+	Protocol string `json:"protocol"`
+	Local    string `json:"local"`
+	Remote   string `json:"remote"`
+	State    string `json:"state"`
+	// api, nats, proxy or local when the remote end is known, empty otherwise
+	Endpoint string `json:"endpoint"`
+}
+
+type PackageResult struct {
+	ExitCode int    `json:"exit_code"`
+	Meaning  string `json:"meaning"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	Error    string `json:"error"`
+}
+
+type DiskUsage struct {
+	Device            string  `json:"device"`
+	MountPoint        string  `json:"mount_point"`
+	FSType            string  `json:"fs_type"`
+	Total             uint64  `json:"total"`
+	Used              uint64  `json:"used"`
+	Free              uint64  `json:"free"`
+	UsedPercent       float64 `json:"used_percent"`
+	InodesTotal       uint64  `json:"inodes_total"`
+	InodesUsed        uint64  `json:"inodes_used"`
+	InodesFree        uint64  `json:"inodes_free"`
+	InodesUsedPercent float64 `json:"inodes_used_percent"`
+}
+
+type MountInfo struct {
+	MountPoint string `json:"mount_point"`
+	// device for local mounts, remote path (UNC, host:/export) for network mounts
+	Device  string `json:"device"`
+	FSType  string `json:"fs_type"`
+	Network bool   `json:"network"`
+	// set for mapped drives that belong to a user session rather than the system
+	User string `json:"user,omitempty"`
+}
+
+// USBDevice is a removable storage device, ids are the usb vendor/product ids in hex
+type USBDevice struct {
+	Name      string   `json:"name"`
+	Vendor    string   `json:"vendor"`
+	VendorID  string   `json:"vendor_id"`
+	ProductID string   `json:"product_id"`
+	Serial    string   `json:"serial"`
+	USB       bool     `json:"usb"`
+	Mounts    []string `json:"mounts"`
+}
+
+type TPMInfo struct {
+	Present bool `json:"present"`
+	// 1.2 or 2.0
+	Version      string `json:"version"`
+	Manufacturer string `json:"manufacturer"`
+	Enabled      bool   `json:"enabled"`
+	Activated    bool   `json:"activated"`
+	Owned        bool   `json:"owned"`
+}
+
+// ProxyInfo compares the proxy the agent is configured with to the route api requests actually took
+type ProxyInfo struct {
+	// proxy url with credentials removed, empty if none
+	Configured string `json:"configured"`
+	// config, system or none
+	Source string `json:"source"`
+	// address the api request connected to and whether that was the proxy
+	RemoteAddr string `json:"remote_addr"`
+	UsedProxy  bool   `json:"used_proxy"`
+	// source ip of the api request as seen by the rmm, and from the public ip lookup
+	ServerEgressIP string `json:"server_egress_ip"`
+	PublicIP       string `json:"public_ip"`
+	// a proxy is configured but traffic went around it
+	Leak bool `json:"leak"`
+}
+
+type HostnameReport struct {
+	// current os hostname and the one the agent has been reporting since it started
+	Hostname       string   `json:"hostname"`
+	AgentHostname  string   `json:"agent_hostname"`
+	FQDN           string   `json:"fqdn"`
+	PrimaryIP      string   `json:"primary_ip"`
+	ReverseDNS     []string `json:"reverse_dns"`
+	ServerHostname string   `json:"server_hostname"`
+	Mismatches     []string `json:"mismatches"`
+}
+
+// VolumeEncryption is the disk encryption state of a volume, from bitlocker on windows and luks on linux
+type VolumeEncryption struct {
+	// drive letter or block device
+	Volume string `json:"volume"`
+	// bitlocker or luks
+	Type      string `json:"type"`
+	Encrypted bool   `json:"encrypted"`
+	// fully encrypted, encrypting, decrypting, etc
+	Status string `json:"status"`
+	Method string `json:"method"`
+	// bitlocker protection is on, or the luks volume is unlocked
+	Protected bool `json:"protected"`
+	Unlocked  bool `json:"unlocked"`
+}
+
+// BitLockerKey is a recovery password escrowed with the rmm
+type BitLockerKey struct {
+	Volume           string `json:"volume"`
+	ProtectorID      string `json:"protector_id"`
+	RecoveryPassword string `json:"recovery_password"`
+}
+
+type PowerStatus struct {
+	HasBattery bool `json:"has_battery"`
+	OnAC       bool `json:"on_ac"`
+	// -1 when unknown
+	BatteryPercent int `json:"battery_percent"`
+	// seconds of battery left, -1 when unknown or charging
+	TimeRemaining int64  `json:"time_remaining"`
+	Charging      bool   `json:"charging"`
+	Detail        string `json:"detail"`
+}
+
+type NatsStatus struct {
+	Status       string `json:"status"`
+	Connected    bool   `json:"connected"`
+	ConnectedURL string `json:"connected_url"`
+	Reconnects   uint64 `json:"reconnects"`
+	InMsgs       uint64 `json:"in_msgs"`
+	OutMsgs      uint64 `json:"out_msgs"`
+	InBytes      uint64 `json:"in_bytes"`
+	OutBytes     uint64 `json:"out_bytes"`
+	// last disconnect error, unix time
+	LastError   string `json:"last_error"`
+	LastErrorAt int64  `json:"last_error_at"`
+}
+
+type HealthCheckResult struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+type DependencyStatus struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+type DependencyReport struct {
+	OK           bool               `json:"ok"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+type HealthReport struct {
+	Healthy   bool                `json:"healthy"`
+	Version   string              `json:"version"`
+	Timestamp int64               `json:"timestamp"`
+	Checks    []HealthCheckResult `json:"checks"`
+}
+
+type VirtualizationInfo struct {
+	IsVirtual  bool   `json:"is_virtual"`
+	Hypervisor string `json:"hypervisor"`
+}
+
 type MeshNodeID struct {
 	Func    string `json:"func"`
 	Agentid string `json:"agent_id"`
@@ -203,6 +786,16 @@ type EventLogMsg struct {
 	UID       int    `json:"uid"` // for vue
 }
 
+type JournalEntry struct {
+	Unit       string `json:"unit"`
+	Identifier string `json:"identifier"`
+	Priority   int    `json:"priority"`
+	PID        int    `json:"pid"`
+	Message    string `json:"message"`
+	Time       string `json:"time"`
+	UID        int    `json:"uid"` // for vue
+}
+
 type SoftwareList struct {
 	Name        string `json:"name"`
 	Version     string `json:"version"`